@@ -3,23 +3,135 @@ package main
 import (
 	"flag"
 	"log"
+	"strings"
+	"time"
 
 	"net/http"
 
+	"github.com/go-redis/redis"
+	"github.com/gocs/davy/models"
 	"github.com/gocs/davy/router"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	session = flag.String("session-key", "soopa-shiikurrets", "sets the session cookie store key")
+	session   = flag.String("session-key", "soopa-shiikurrets", "sets the session cookie store key")
+	storage   = flag.String("store", "redis", "sets the storage backend: redis, memory, sqlite3 or postgres")
+	redisAddr = flag.String("redis-addr", "localhost:6379", "sets the redis server address")
+	dsn       = flag.String("dsn", "davy.db", "sets the data source name of the sqlite3 or postgres store")
+	questions = flag.String("questions", "private/questions.json", "sets the questions file to migrate on startup")
+	admins    = flag.String("admins", "", "sets the comma separated usernames allowed to manage the questions")
+	qTime     = flag.Duration("question-time", 0, "sets the time to answer each question, e.g. 30s, 0 is no limit")
+	examTime  = flag.Duration("exam-time", 0, "sets the time of the whole exam, e.g. 10m, 0 is no limit")
+	weighted  = flag.Bool("weighted", false, "multiplies the points of a right answer by the question's difficulty")
+	penalty   = flag.Int64("penalty", 0, "sets the points taken off for a wrong answer")
+	streak    = flag.Int64("streak-every", 0, "raises the points multiplier by 1 every so many right answers in a row, 0 is off")
+	streakMax = flag.Int64("streak-max", 0, "caps the streak multiplier, 0 is no cap")
+	timeBonus = flag.Int64("time-bonus", 0, "sets the points added to a right answer given within -bonus-within")
+	bonusTime = flag.Duration("bonus-within", 0, "sets how soon a right answer earns the time bonus, e.g. 10s")
+	fifty     = flag.Int64("fifty-fifty", 1, "sets how many 50/50 lifelines an exam gives")
+	fiftyCost = flag.Int64("fifty-fifty-cost", 1, "sets the points a 50/50 lifeline costs")
+	hints     = flag.Int64("hints", 1, "sets how many hint lifelines an exam gives")
+	hintCost  = flag.Int64("hint-cost", 1, "sets the points a hint lifeline costs")
+	rounds    = flag.Int64("rounds", 10, "sets how many questions a lobby's game asks, 0 asks the whole bank")
+	roundTime = flag.Duration("round-time", 20*time.Second, "sets the time to answer each question of a lobby's game")
+	quorum    = flag.Int64("ready-quorum", 100, "sets the percent of a lobby's members who must be ready to start, 0 is no check")
+	countdown = flag.Duration("countdown", 5*time.Second, "sets the countdown before the first round of a lobby's game")
+	chatKeep  = flag.Int64("chat-history", 100, "sets how many of the latest chat messages each lobby keeps")
+	chatLen   = flag.Int("chat-max-length", 500, "sets the characters a chat message can have")
+	chatRate  = flag.Int("chat-rate", 5, "sets how many chat messages a member can send within -chat-per, 0 is no limit")
+	chatPer   = flag.Duration("chat-per", 10*time.Second, "sets the window -chat-rate counts the chat messages in")
+	lobbyTTL  = flag.Duration("lobby-ttl", time.Hour, "sets how long an idle or ended lobby is kept, 0 keeps them forever")
+	sweep     = flag.Duration("lobby-sweep", time.Minute, "sets how often the janitor looks for lobbies past -lobby-ttl")
+	heartbeat = flag.Duration("heartbeat", 30*time.Second, "sets how often the lobby websockets are pinged, 0 keeps the default")
+	grace     = flag.Duration("reconnect-grace", time.Minute, "sets how long a disconnected member keeps its seat, 0 is forever")
 )
 
+func newStore() (models.Store, error) {
+	switch *storage {
+	case "redis":
+		return models.NewRedisStore(redis.NewClient(&redis.Options{
+			Addr: *redisAddr,
+		})), nil
+	case "memory":
+		return models.NewMemoryStore(), nil
+	case "sqlite3", "postgres":
+		return models.NewSQLStore(*storage, *dsn)
+	}
+	return nil, models.ErrUnknownStore
+}
+
+func adminList() []string {
+	var list []string
+	for _, name := range strings.Split(*admins, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// expireLobbies is the janitor deleting the lobbies nobody has used within the ttl, it runs every sweep
+func expireLobbies(s models.Store, j models.JanitorT) {
+	for range time.Tick(j.Sweep) {
+		ids, err := models.ExpireLobbies(s, time.Now().Add(-j.TTL))
+		if err != nil {
+			log.Println(err)
+		}
+		if len(ids) > 0 {
+			log.Printf("expired %d lobbies", len(ids))
+		}
+	}
+}
+
 func main() {
 	flag.Parse()
 
-	r, err := router.NewRouter(*session)
+	s, err := newStore()
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := models.MigrateQuestions(s, *questions); err != nil {
+		report, ok := err.(*models.ImportReportT)
+		if !ok {
+			log.Fatal(err)
+		}
+		// the valid questions are imported, the rest are fixed in the file and picked up on the next start
+		for _, e := range report.Errors {
+			log.Printf("skipped question in %s, row %d: %v", *questions, e.Row, e.Err)
+		}
+	}
+
+	janitor := models.JanitorT{TTL: *lobbyTTL, Sweep: *sweep}
+	if err := janitor.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	r, err := router.NewRouter(router.Config{
+		SessionKey: *session,
+		Store:      s,
+		Admins:     adminList(),
+		Limits:     models.LimitsT{Question: *qTime, Exam: *examTime},
+		Scoring: models.ScoringT{
+			Weighted:    *weighted,
+			Penalty:     *penalty,
+			StreakEvery: *streak,
+			StreakMax:   *streakMax,
+			TimeBonus:   *timeBonus,
+			BonusWithin: *bonusTime,
+		},
+		Lifelines: models.LifelinesT{FiftyFifty: *fifty, FiftyFiftyCost: *fiftyCost, Hint: *hints, HintCost: *hintCost},
+		Game:      models.GameRulesT{Rounds: *rounds, RoundTime: *roundTime, Quorum: *quorum, Countdown: *countdown},
+		Chat:      models.ChatRulesT{History: *chatKeep, MaxLength: *chatLen, Rate: *chatRate, Per: *chatPer},
+		Presence:  router.PresenceT{Heartbeat: *heartbeat, Grace: *grace},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if janitor.TTL > 0 {
+		go expireLobbies(s, janitor)
+	}
 	http.Handle("/", r)
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -0,0 +1,240 @@
+// Package message is the protocol spoken over the lobby websocket, every message is a json object carrying the
+// protocol version and its type along with the fields of that type
+package message
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Version is the version of the protocol, a message of another version is not read
+const Version = 1
+
+// the types of message
+const (
+	// TypeState tells the whole lobby, sent on connect and after every change of its members
+	TypeState = "state"
+	// TypeMemberJoined tells that Username has joined the lobby
+	TypeMemberJoined = "member_joined"
+	// TypeMemberLeft tells that Username has left the lobby
+	TypeMemberLeft = "member_left"
+	// TypeKicked tells that Username has been kicked out of the lobby
+	TypeKicked = "kicked"
+	// TypeHostChanged tells that Username is the lobby's host now
+	TypeHostChanged = "host_changed"
+	// TypeGame tells how the lobby's game stands
+	TypeGame = "game"
+	// TypeError tells the client why its message was not taken
+	TypeError = "error"
+	// TypeLobbies tells the lobby browser the public lobbies waiting for players
+	TypeLobbies = "lobbies"
+	// TypeChat is a message of the lobby's chat, the client sends its Text and the server tells the whole Chat
+	TypeChat = "chat"
+	// TypeChatHistory tells the lobby's chat, sent on connect
+	TypeChatHistory = "chat_history"
+	// TypeDeleteChat asks to delete the chat message of the Chat's ID, only the host and co-hosts may
+	TypeDeleteChat = "delete_chat"
+	// TypeChatDeleted tells that the chat message of the Chat's ID has been deleted
+	TypeChatDeleted = "chat_deleted"
+	// TypeMute and TypeUnmute ask to mute Username in the lobby's chat or let it talk again, only the host and
+	// co-hosts may
+	TypeMute   = "mute"
+	TypeUnmute = "unmute"
+	// TypePresence tells the server whether the member is looking at the lobby, its Presence is PresenceOnline or
+	// PresenceAway
+	TypePresence = "presence"
+	// TypeReady and TypeUnready mark the member as ready for the game or not while the lobby is waiting
+	TypeReady   = "ready"
+	TypeUnready = "unready"
+	// TypeCountdown tells the seconds left in Countdown before the starting lobby's game opens its first round
+	TypeCountdown = "countdown"
+)
+
+// the presences of a member, a member with no websocket open is disconnected
+const (
+	PresenceOnline       = "online"
+	PresenceAway         = "away"
+	PresenceDisconnected = "disconnected"
+)
+
+var (
+	// ErrVersion gives error message when a message is of another version of the protocol
+	ErrVersion = errors.New("message is of another protocol version")
+
+	// ErrMalformed gives error message when a message is not json or has no type
+	ErrMalformed = errors.New("message is malformed")
+
+	// ErrUnexpected gives error message when the client sends a type of message only the server sends
+	ErrUnexpected = errors.New("message is not expected from the client")
+)
+
+// Message is a message of the protocol, only the fields of its type are set
+type Message struct {
+	Version  int     `json:"v"`
+	Type     string  `json:"type"`
+	Username string  `json:"username,omitempty"`
+	State    *State  `json:"state,omitempty"`
+	Game     *Game   `json:"game,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Lobbies  []Lobby `json:"lobbies,omitempty"`
+	Chat     *Chat   `json:"chat,omitempty"`
+	Chats    []Chat  `json:"chats,omitempty"`
+	Presence string  `json:"presence,omitempty"`
+	// Countdown is the seconds left before the game
+	Countdown int64 `json:"countdown,omitempty"`
+}
+
+// State is the lobby as its members see it
+type State struct {
+	Code    string   `json:"code"`
+	Host    string   `json:"host"`
+	CoHosts []string `json:"co_hosts"`
+	Members []string `json:"members"`
+	// Status is one of the models' Status constants
+	Status   int64    `json:"status"`
+	Settings Settings `json:"settings"`
+	// Muted are the usernames muted in the lobby's chat
+	Muted []string `json:"muted"`
+	// Presence is each member's presence by username
+	Presence map[string]string `json:"presence"`
+	// Ready are the usernames of the members ready for the game
+	Ready []string `json:"ready"`
+}
+
+// Settings are how the host has set the lobby up, 0 and empty leave it to the server's defaults
+type Settings struct {
+	MaxPlayers int64 `json:"max_players"`
+	// Public lobbies are listed for anybody to join, private ones are joined by their code only
+	Public bool  `json:"public"`
+	Rounds int64 `json:"rounds"`
+	// RoundTime is the seconds to answer each question
+	RoundTime int64  `json:"round_time"`
+	Category  string `json:"category"`
+}
+
+// Game is the lobby's game, it leaves the answers out
+type Game struct {
+	// Type is "question" while a round is open and "results" once the game has ended
+	Type   string `json:"type"`
+	Round  int64  `json:"round"`
+	Rounds int64  `json:"rounds"`
+	// QuestionID is 0 if the round's question has been deleted from the bank, the round then just runs out
+	QuestionID   int64    `json:"question_id"`
+	Statement    string   `json:"statement"`
+	QuestionType string   `json:"question_type"`
+	Choices      []string `json:"choices"`
+	// Remaining is the seconds left to answer the round
+	Remaining  int64    `json:"remaining"`
+	LastAnswer string   `json:"last_answer"`
+	Players    []Player `json:"players"`
+}
+
+// Lobby is a public lobby as the lobby browser lists it
+type Lobby struct {
+	Code    string `json:"code"`
+	Host    string `json:"host"`
+	Players int64  `json:"players"`
+	// MaxPlayers is 0 for an uncapped lobby
+	MaxPlayers int64  `json:"max_players"`
+	Category   string `json:"category"`
+}
+
+// Chat is a message of the lobby's chat
+type Chat struct {
+	ID       int64  `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Text     string `json:"text,omitempty"`
+	// SentAt is the unix time the message was sent
+	SentAt int64 `json:"sent_at,omitempty"`
+}
+
+// Player is how a player stands in the game
+type Player struct {
+	Username string `json:"username"`
+	Points   int64  `json:"points"`
+	Correct  int64  `json:"correct"`
+	// Answered tells whether the player has answered the current round
+	Answered bool `json:"answered"`
+}
+
+// NewState tells the whole lobby
+func NewState(s State) Message {
+	return Message{Version: Version, Type: TypeState, State: &s}
+}
+
+// MemberJoined tells that the user has joined the lobby
+func MemberJoined(username string) Message {
+	return Message{Version: Version, Type: TypeMemberJoined, Username: username}
+}
+
+// MemberLeft tells that the user has left the lobby
+func MemberLeft(username string) Message {
+	return Message{Version: Version, Type: TypeMemberLeft, Username: username}
+}
+
+// Kicked tells that the user has been kicked out of the lobby
+func Kicked(username string) Message {
+	return Message{Version: Version, Type: TypeKicked, Username: username}
+}
+
+// HostChanged tells that the user is the lobby's host now
+func HostChanged(username string) Message {
+	return Message{Version: Version, Type: TypeHostChanged, Username: username}
+}
+
+// NewGame tells how the lobby's game stands
+func NewGame(g *Game) Message {
+	return Message{Version: Version, Type: TypeGame, Game: g}
+}
+
+// NewLobbies tells the lobby browser the public lobbies waiting for players, none leaves Lobbies out
+func NewLobbies(ls []Lobby) Message {
+	return Message{Version: Version, Type: TypeLobbies, Lobbies: ls}
+}
+
+// NewChat tells a message of the lobby's chat
+func NewChat(c Chat) Message {
+	return Message{Version: Version, Type: TypeChat, Chat: &c}
+}
+
+// ChatHistory tells the lobby's chat, an empty chat leaves Chats out
+func ChatHistory(cs []Chat) Message {
+	return Message{Version: Version, Type: TypeChatHistory, Chats: cs}
+}
+
+// ChatDeleted tells that the chat message has been deleted
+func ChatDeleted(id int64) Message {
+	return Message{Version: Version, Type: TypeChatDeleted, Chat: &Chat{ID: id}}
+}
+
+// NewPresence tells the server whether the member is looking at the lobby
+func NewPresence(presence string) Message {
+	return Message{Version: Version, Type: TypePresence, Presence: presence}
+}
+
+// Countdown tells the seconds left before the game opens its first round
+func Countdown(seconds int64) Message {
+	return Message{Version: Version, Type: TypeCountdown, Countdown: seconds}
+}
+
+// Error tells the client why its message was not taken
+func Error(err error) Message {
+	return Message{Version: Version, Type: TypeError, Error: err.Error()}
+}
+
+// Encode writes the message as json
+func (m Message) Encode() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Decode reads a message written by Encode, ErrVersion is returned for another version of the protocol
+func Decode(b []byte) (*Message, error) {
+	m := &Message{}
+	if err := json.Unmarshal(b, m); err != nil || m.Type == "" {
+		return nil, ErrMalformed
+	}
+	if m.Version != Version {
+		return nil, ErrVersion
+	}
+	return m, nil
+}
@@ -0,0 +1,71 @@
+package message
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []Message{
+		NewState(State{Code: "ABCDE", Host: "host", CoHosts: []string{"guest"}, Members: []string{"host", "guest"},
+			Settings: Settings{MaxPlayers: 4, Public: true, Rounds: 5, RoundTime: 30, Category: "math"}}),
+		MemberJoined("guest"),
+		MemberLeft("guest"),
+		Kicked("guest"),
+		HostChanged("guest"),
+		NewGame(&Game{Type: "results", Rounds: 2, Players: []Player{{Username: "host", Points: 2}}}),
+		Error(errors.New("nope")),
+		NewLobbies([]Lobby{{Code: "ABCDE", Host: "host", Players: 2, MaxPlayers: 4, Category: "math"}}),
+		NewChat(Chat{ID: 1, Username: "guest", Text: "hi", SentAt: 1600000000}),
+		ChatHistory([]Chat{{ID: 1, Username: "guest", Text: "hi", SentAt: 1600000000}}),
+		ChatDeleted(1),
+		NewPresence(PresenceAway),
+		Countdown(3),
+	}
+	for _, m := range tests {
+		b, err := m.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*result, m) {
+			t.Errorf("message not same: expected=%+v, result=%+v", m, *result)
+		}
+	}
+}
+
+func TestEncodeState(t *testing.T) {
+	// the status of a waiting lobby is 0 and is still sent
+	b, err := NewState(State{Code: "ABCDE", Host: "host", CoHosts: []string{}, Members: []string{"host"},
+		Muted: []string{}, Presence: map[string]string{"host": PresenceOnline}, Ready: []string{}}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"v":1,"type":"state","state":{"code":"ABCDE","host":"host","co_hosts":[],"members":["host"],"status":0,` +
+		`"settings":{"max_players":0,"public":false,"rounds":0,"round_time":0,"category":""},"muted":[],` +
+		`"presence":{"host":"online"},"ready":[]}}`
+	if string(b) != expected {
+		t.Errorf("json not same: expected=%s, result=%s", expected, b)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{`{"v":1,"type":"state"}`, nil},
+		{`{"v":2,"type":"state"}`, ErrVersion},
+		{`{"v":1}`, ErrMalformed},
+		{`hello`, ErrMalformed},
+	}
+	for _, tt := range tests {
+		if _, err := Decode([]byte(tt.in)); err != tt.err {
+			t.Errorf("%s: expected=%v, result=%v", tt.in, tt.err, err)
+		}
+	}
+}
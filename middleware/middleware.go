@@ -13,7 +13,7 @@ type StoreGetter interface {
 }
 
 // AuthRequired middleware that checks if the user is loggedin
-func AuthRequired(store StoreGetter) func(handler http.HandlerFunc) http.HandlerFunc {
+func AuthRequired(store StoreGetter, s models.Store) func(handler http.HandlerFunc) http.HandlerFunc {
 	return func(handler http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			session, _ := store.Get(r, "session")
@@ -28,7 +28,7 @@ func AuthRequired(store StoreGetter) func(handler http.HandlerFunc) http.Handler
 				http.Redirect(w, r, "/login", http.StatusFound)
 				return
 			}
-			aUser, err := models.IsUser(userID)
+			aUser, err := models.IsUser(s, userID)
 			if err != nil || !aUser {
 				http.Redirect(w, r, "/login", http.StatusFound)
 				return
@@ -37,3 +37,34 @@ func AuthRequired(store StoreGetter) func(handler http.HandlerFunc) http.Handler
 		}
 	}
 }
+
+// AdminRequired middleware that checks if the loggedin user is one of the admins, it is meant to wrap AuthRequired
+func AdminRequired(store StoreGetter, s models.Store, admins []string) func(handler http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			session, _ := store.Get(r, "session")
+			userID, ok := session.Values["user_id"].(int64)
+			if !ok {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			user, err := models.GetUserByUserID(s, userID)
+			if err != nil {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			username, err := user.GetUsername()
+			if err != nil {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			for _, admin := range admins {
+				if admin == username {
+					handler.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// answersPerPage is how many answers a page of the history shows
+const answersPerPage = 20
+
+// AnswerT is a single answer of the user's history
+type AnswerT struct {
+	QuestionID   int64     `json:"question_id"`
+	Statement    string    `json:"statement"`
+	Choice       string    `json:"choice"`
+	Correct      bool      `json:"correct"`
+	AnsweredAt   time.Time `json:"answered_at"`
+	TimeToAnswer float64   `json:"time_to_answer"`
+}
+
+// AnswerPageT is a page of the user's answer history, latest first
+type AnswerPageT struct {
+	Answers []AnswerT `json:"answers"`
+	Page    int64     `json:"page"`
+	Pages   int64     `json:"pages"`
+	Total   int64     `json:"total"`
+}
+
+// HasPrev checks if there is a newer page
+func (p *AnswerPageT) HasPrev() bool { return p.Page > 1 }
+
+// HasNext checks if there is an older page
+func (p *AnswerPageT) HasNext() bool { return p.Page < p.Pages }
+
+// PrevPage is the number of the newer page
+func (p *AnswerPageT) PrevPage() int64 { return p.Page - 1 }
+
+// NextPage is the number of the older page
+func (p *AnswerPageT) NextPage() int64 { return p.Page + 1 }
+
+// logAnswer appends the graded submission to the user's history
+func logAnswer(s Store, userID, questionID int64, choice string, correct bool, assignedAt, at time.Time) error {
+	var elapsed time.Duration
+	if !assignedAt.IsZero() {
+		elapsed = at.Sub(assignedAt)
+	}
+	_, err := s.CreateAnswer(&AnswerRecord{
+		UserID:     userID,
+		QuestionID: questionID,
+		Choice:     choice,
+		Correct:    correct,
+		AnsweredAt: at,
+		Elapsed:    elapsed,
+	})
+	return err
+}
+
+// GetAnswerPage gets a page of the user's answer history, pages start at 1
+func GetAnswerPage(s Store, userID, page int64) (*AnswerPageT, error) {
+	total, err := s.CountAnswers(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := (total + answersPerPage - 1) / answersPerPage
+	if page < 1 {
+		page = 1
+	}
+
+	records, err := s.ListAnswers(userID, (page-1)*answersPerPage, answersPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]AnswerT, len(records))
+	for i, r := range records {
+		a := AnswerT{
+			QuestionID:   r.QuestionID,
+			Choice:       r.Choice,
+			Correct:      r.Correct,
+			AnsweredAt:   r.AnsweredAt,
+			TimeToAnswer: r.Elapsed.Seconds(),
+		}
+		// the question may have been removed since, the answer is still listed
+		if qt, err := s.GetQuestion(r.QuestionID); err == nil {
+			a.Statement = qt.Statement
+		} else if err != ErrQuestionNotFound {
+			return nil, err
+		}
+		answers[i] = a
+	}
+
+	return &AnswerPageT{
+		Answers: answers,
+		Page:    page,
+		Pages:   pages,
+		Total:   total,
+	}, nil
+}
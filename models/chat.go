@@ -0,0 +1,116 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gocs/davy/validator"
+)
+
+// ChatRulesT is how a lobby's chat is kept
+type ChatRulesT struct {
+	// History is how many of the latest messages each lobby keeps
+	History int64
+	// MaxLength caps a message's characters, Validate wants it set as the websocket messages are sized to it
+	MaxLength int
+	// Rate is how many messages a member can send within Per, 0 is no limit
+	Rate int
+	Per  time.Duration
+}
+
+// Validate checks that no rule is negative, that the messages are capped and that a rate has its window
+func (cr ChatRulesT) Validate() error {
+	return validator.ChatRules(cr.History, cr.MaxLength, cr.Rate, cr.Per)
+}
+
+// ChatMessageT is a message of the lobby's chat
+type ChatMessageT struct {
+	ID       int64
+	Username string
+	Text     string
+	SentAt   time.Time
+}
+
+// SendChat saves the member's message to the lobby's chat, the text is trimmed of spaces, ErrMuted is returned if the
+// member is muted
+func (l *Lobby) SendChat(rules ChatRulesT, userID int64, text string) (*ChatMessageT, error) {
+	member, err := l.IsMember(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, ErrUserNotInLobby
+	}
+	mutes, err := l.s.ListLobbyMutes(l.id)
+	if err != nil {
+		return nil, err
+	}
+	if containsID(mutes, userID) {
+		return nil, ErrMuted
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrChatEmpty
+	}
+	if rules.MaxLength > 0 && utf8.RuneCountInString(text) > rules.MaxLength {
+		return nil, ErrChatTooLong
+	}
+
+	u, err := l.s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	m := &ChatRecord{UserID: userID, Body: text, SentAt: time.Now()}
+	id, err := l.s.AddChatMessage(l.id, m, rules.History)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.touch(); err != nil {
+		return nil, err
+	}
+	return &ChatMessageT{ID: id, Username: u.Username, Text: text, SentAt: m.SentAt}, nil
+}
+
+// GetChat gets the lobby's chat the oldest message first
+func (l *Lobby) GetChat() ([]ChatMessageT, error) {
+	records, err := l.s.ListChatMessages(l.id)
+	if err != nil {
+		return nil, err
+	}
+	chat := []ChatMessageT{}
+	for _, m := range records {
+		u, err := l.s.GetUser(m.UserID)
+		if err != nil {
+			return nil, err
+		}
+		chat = append(chat, ChatMessageT{ID: m.ID, Username: u.Username, Text: m.Body, SentAt: m.SentAt})
+	}
+	return chat, nil
+}
+
+// DeleteChat lets the host or a co-host delete a message from the lobby's chat
+func (l *Lobby) DeleteChat(byID, id int64) error {
+	if err := l.canManage(byID); err != nil {
+		return err
+	}
+	return l.s.DeleteChatMessage(l.id, id)
+}
+
+// Mute lets the host or a co-host mute a member of a lower role in the lobby's chat or let it talk again
+func (l *Lobby) Mute(byID, userID int64, muted bool) error {
+	if err := l.canActOn(byID, userID); err != nil {
+		return err
+	}
+	return l.s.SetLobbyMute(l.id, userID, muted)
+}
+
+// GetMuted gets the usernames of the members muted in the lobby's chat
+func (l *Lobby) GetMuted() ([]string, error) {
+	ids, err := l.s.ListLobbyMutes(l.id)
+	if err != nil {
+		return nil, err
+	}
+	return l.usernames(ids)
+}
@@ -4,21 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-
-	"github.com/go-redis/redis"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
-// NewRedisDB instantiates a package-level redis client access
-func NewRedisDB() error {
-	client = redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-	}) // fuuuuck
-	return MigrateQuestions(client, "private/questions.json")
-}
-
 var (
-	redisNil = redis.Nil
-
 	// ErrUserNotFound common error on login form when the user is not found
 	ErrUserNotFound = errors.New("user not found")
 
@@ -34,16 +25,61 @@ var (
 	// ErrEmptyUserQuestion specific error for capturing uninitialized array error
 	ErrEmptyUserQuestion = errors.New("user has no question")
 
+	// ErrStaleAnswer specific error when the answered question is no longer the user's current question
+	ErrStaleAnswer = errors.New("question has already been answered")
+
+	// ErrExamFinished specific error when an answer is given after every question has been answered
+	ErrExamFinished = errors.New("exam has already finished")
+
+	// ErrCardNotFound specific error when the user has not studied the question yet
+	ErrCardNotFound = errors.New("question has not been studied")
+
+	// ErrQuizNotFound gives error message when the quiz does not exist or is not published
+	ErrQuizNotFound = errors.New("quiz does not exist")
+
+	// ErrQuizNotStarted specific error when the user has not started the quiz
+	ErrQuizNotStarted = errors.New("quiz has not been started")
+
+	// ErrEmptyQuiz gives error message when a quiz is started without any question left in the bank
+	ErrEmptyQuiz = errors.New("quiz has no questions")
+
+	// ErrQuizQuestion gives error message when a quiz is given a question that is not in the bank
+	ErrQuizQuestion = errors.New("quiz question is not in the bank")
+
+	// ErrAnswerLate specific error when an answer is given after the time of the question or of the exam has run out
+	ErrAnswerLate = errors.New("time to answer has run out")
+
+	// ErrLifelineUsed specific error when the lifeline has already been used on the current question
+	ErrLifelineUsed = errors.New("lifeline has already been used on this question")
+
+	// ErrNoLifelines specific error when the exam has used up the lifeline
+	ErrNoLifelines = errors.New("no lifelines of this kind are left")
+
+	// ErrLifelineUnavailable specific error when the lifeline cannot help with the question, e.g. a 50/50 on a text
+	// question or a hint on a question without one
+	ErrLifelineUnavailable = errors.New("lifeline cannot be used on this question")
+
 	// ErrTypeMismatch specific error for capturing type mismatch
 	ErrTypeMismatch = errors.New("the type didn't match")
 
-	// client is a redis client shadow, make sure this is not null, if you use this
-	// FIXME: this must not be roaming at a package level
-	client *redis.Client // fuuuuck// fuuuuck// fuuuuck// fuuuuck
-
-	// ErrNilClient gives error message when redis client variable is nil
+	// ErrNilClient gives error message when the store is nil
 	ErrNilClient = errors.New("client is nil")
 
+	// ErrUnknownStore gives error message when the selected storage backend does not exist
+	ErrUnknownStore = errors.New("unknown store")
+
+	// ErrQuestionNotFound specific error when the question does not exist
+	ErrQuestionNotFound = errors.New("question not found")
+
+	// ErrLobbyNotFound gives error message when no lobby matches the given id or code
+	ErrLobbyNotFound = errors.New("lobby not found")
+
+	// ErrUpdateNotFound specific error when the update does not exist
+	ErrUpdateNotFound = errors.New("update not found")
+
+	// ErrUserNotRanked gives error message when the user is not on the leaderboard yet
+	ErrUserNotRanked = errors.New("user is not ranked")
+
 	// ErrUserInLobby gives error message when user attempts to join a lobby when is already in lobby
 	ErrUserInLobby = errors.New("user is currently joined in to a lobby")
 
@@ -53,34 +89,85 @@ var (
 	// ErrLobbyEmptyMembers gives error message when the lobby has no members
 	ErrLobbyEmptyMembers = errors.New("lobby is currently empty")
 
+	// ErrEmptyCategory gives error message when an exam is started on a category without questions
+	ErrEmptyCategory = errors.New("category has no questions")
+
 	// ErrGameEnded gives error message when the game has already ended
 	ErrGameEnded = errors.New("game has already end")
+
+	// ErrGameNotFound specific error when the lobby has not started a game
+	ErrGameNotFound = errors.New("game has not been started")
+
+	// ErrLobbyStatus gives error message when the lobby is not in the state the action needs, e.g. starting a game
+	// that is already on
+	ErrLobbyStatus = errors.New("lobby cannot do that now")
+
+	// ErrLobbyPermission gives error message when the member's role in the lobby does not allow what it tries, e.g. a
+	// player kicking or a co-host kicking the host
+	ErrLobbyPermission = errors.New("your role in the lobby does not allow that")
+
+	// ErrBanned gives error message when a user banned from the lobby tries to join it
+	ErrBanned = errors.New("user is banned from this lobby")
+
+	// ErrLobbyFull gives error message when a user tries to join a lobby that has its max players
+	ErrLobbyFull = errors.New("lobby is full")
+
+	// ErrNotReady gives error message when a game is started before enough of the lobby's members are ready
+	ErrNotReady = errors.New("not enough members are ready")
+
+	// ErrLobbyCodeTaken gives error message when a new lobby's code is already used by a live lobby
+	ErrLobbyCodeTaken = errors.New("lobby code is already taken")
+
+	// ErrLobbySettings gives error message when the lobby settings are out of their bounds
+	ErrLobbySettings = errors.New("lobby settings are not valid")
+
+	// ErrChatNotFound gives error message when the lobby's chat has no such message
+	ErrChatNotFound = errors.New("chat message not found")
+
+	// ErrChatEmpty gives error message when a chat message has nothing but spaces
+	ErrChatEmpty = errors.New("chat message is empty")
+
+	// ErrChatTooLong gives error message when a chat message is longer than the chat allows
+	ErrChatTooLong = errors.New("chat message is too long")
+
+	// ErrChatRate gives error message when a member sends chat messages faster than the chat allows
+	ErrChatRate = errors.New("sending chat messages too fast")
+
+	// ErrMuted gives error message when a muted member tries to talk in the lobby's chat
+	ErrMuted = errors.New("you are muted in this lobby")
+
+	// ErrNotPlaying gives error message when a user who is not one of the game's players answers
+	ErrNotPlaying = errors.New("user is not playing this game")
+
+	// ErrAlreadyAnswered specific error when the player has already answered the round
+	ErrAlreadyAnswered = errors.New("round has already been answered")
+
+	// ErrEmptyGame gives error message when a game is started without any question in the bank
+	ErrEmptyGame = errors.New("game has no questions")
 )
 
-// MigrateQuestions sends the questions.json to the redis server
-func MigrateQuestions(client *redis.Client, path string) error {
+// MigrateQuestions sends the questions.json to the store, a .csv file is imported with ImportQuestionsCSV instead and
+// its rows that are not valid are returned as an *ImportReportT after the rest are imported
+func MigrateQuestions(s Store, path string) error {
+	if s == nil {
+		return ErrNilClient
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return migrateQuestionsCSV(s, path)
+	}
+
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	type AutoGenerated struct {
-		Questions []struct {
-			Statement string   `json:"statement"`
-			Answer    string   `json:"answer"`
-			Choices   []string `json:"choices"`
-		} `json:"questions"`
-	}
-	var ag AutoGenerated
-	if err := json.Unmarshal(data, &ag); err != nil {
+	var qf QuestionFileT
+	if err := json.Unmarshal(data, &qf); err != nil {
 		return err
 	}
 
-	if client == nil {
-		return ErrNilClient
-	}
-	for _, q := range ag.Questions {
-		err := NewQuestion(q.Statement, q.Answer, q.Choices)
+	for i := range qf.Questions {
+		err := NewQuestion(s, &qf.Questions[i])
 		if err != nil {
 			switch err {
 			case ErrQuestionDuplicate:
@@ -92,3 +179,20 @@ func MigrateQuestions(client *redis.Client, path string) error {
 
 	return nil
 }
+
+func migrateQuestionsCSV(s Store, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report, err := ImportQuestionsCSV(s, f)
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return report
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package models
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gocs/davy/validator"
+)
+
+// GameRulesT is how a lobby's game is played
+type GameRulesT struct {
+	// Rounds is how many questions the game asks, 0 or more than the bank has asks every question
+	Rounds int64
+	// RoundTime is how long the players have to answer each question
+	RoundTime time.Duration
+	// Category limits the questions to the category, empty means every question
+	Category string
+	// Quorum is the percent of the members who must be ready for the game to start, the member starting it counts as
+	// ready, 0 starts it regardless
+	Quorum int64
+	// Countdown is how long the lobby is starting before the first round opens
+	Countdown time.Duration
+}
+
+// Validate checks that the rounds are not negative and that they can be answered, that the quorum is a percentage
+// and that the countdown is not negative
+func (gr GameRulesT) Validate() error {
+	return validator.GameRules(gr.Rounds, gr.RoundTime, gr.Quorum, gr.Countdown)
+}
+
+// GameScoreT is how a player stands in the game
+type GameScoreT struct {
+	Username string
+	Points   int64
+	Correct  int64
+	// Answered tells whether the player has answered the current round
+	Answered bool
+}
+
+// GameT is how the lobby's game stands
+type GameT struct {
+	// Round counts the rounds from 0, it reaches Rounds once the game has ended
+	Round  int64
+	Rounds int64
+	// QuestionID and Question are the question of the current round, Question is nil once the game has ended or if
+	// the question has been deleted from the bank
+	QuestionID int64
+	Question   *QuestionT
+	EndsAt     time.Time
+	Ended      bool
+	// LastAnswer is the right answer of the round before, empty on the first round
+	LastAnswer string
+	// Players are the players the most points first
+	Players []GameScoreT
+}
+
+// gameRules are the server's rules overridden by the lobby's settings
+func (l *Lobby) gameRules(rules GameRulesT) (GameRulesT, error) {
+	settings, err := l.GetSettings()
+	if err != nil {
+		return rules, err
+	}
+	if settings.Rounds > 0 {
+		rules.Rounds = settings.Rounds
+	}
+	if settings.RoundTime > 0 {
+		rules.RoundTime = settings.RoundTime
+	}
+	rules.Category = settings.Category
+	return rules, nil
+}
+
+// StartGame lets the host or a co-host start the waiting lobby's game once the rules' quorum of its members are ready,
+// the lobby is starting for the rules' countdown until BeginGame sets the game up, the lobby's settings override the
+// rules
+func (l *Lobby) StartGame(userID int64, rules GameRulesT) error {
+	if err := l.canManage(userID); err != nil {
+		return err
+	}
+	status, err := l.GetStatus()
+	if err != nil {
+		return err
+	}
+	if status != StatusWaiting {
+		return ErrLobbyStatus
+	}
+	rules, err = l.gameRules(rules)
+	if err != nil {
+		return err
+	}
+	ids, err := categoryQuestionIDs(l.s, rules.Category)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return ErrEmptyGame
+	}
+	ready, err := l.enoughReady(userID, rules.Quorum)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return ErrNotReady
+	}
+
+	// the time is kept before the lobby is starting so that a starting lobby always has it
+	if err := l.s.SetLobbyStartsAt(l.id, time.Now().Add(rules.Countdown)); err != nil {
+		return err
+	}
+	if err := l.s.SwapLobbyStatus(l.id, StatusWaiting, StatusStarting); err != nil {
+		return err
+	}
+	return l.touch()
+}
+
+// GetStartsAt gets when the starting lobby's game begins
+func (l *Lobby) GetStartsAt() (time.Time, error) {
+	r, err := l.s.GetLobby(l.id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.StartsAt, nil
+}
+
+// BeginGame sets the starting lobby's game up for its members with random questions from the bank, the lobby is
+// ongoing once its first round is open, the lobby's settings override the rules
+func (l *Lobby) BeginGame(rules GameRulesT) error {
+	status, err := l.GetStatus()
+	if err != nil {
+		return err
+	}
+	if status != StatusStarting {
+		return ErrLobbyStatus
+	}
+	rules, err = l.gameRules(rules)
+	if err != nil {
+		return err
+	}
+
+	if err := l.createGame(rules); err != nil {
+		// let the host try again
+		l.s.SwapLobbyStatus(l.id, StatusStarting, StatusWaiting)
+		return err
+	}
+	if err := l.s.SwapLobbyStatus(l.id, StatusStarting, StatusOngoing); err != nil {
+		return err
+	}
+	return l.touch()
+}
+
+// enoughReady tells whether the quorum percent of the members are ready, the member starting the game counts as
+// ready
+func (l *Lobby) enoughReady(starterID, quorum int64) (bool, error) {
+	if quorum <= 0 {
+		return true, nil
+	}
+	members, err := l.s.ListLobbyMembers(l.id)
+	if err != nil {
+		return false, err
+	}
+	ready, err := l.s.ListLobbyReady(l.id)
+	if err != nil {
+		return false, err
+	}
+	var n int64
+	for _, id := range members {
+		if id == starterID || containsID(ready, id) {
+			n++
+		}
+	}
+	return n*100 >= quorum*int64(len(members)), nil
+}
+
+// SetReady marks the member as ready for the waiting lobby's game or not
+func (l *Lobby) SetReady(userID int64, ready bool) error {
+	member, err := l.IsMember(userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrUserNotInLobby
+	}
+	status, err := l.GetStatus()
+	if err != nil {
+		return err
+	}
+	if status != StatusWaiting {
+		return ErrLobbyStatus
+	}
+	if err := l.s.SetLobbyReady(l.id, userID, ready); err != nil {
+		return err
+	}
+	return l.touch()
+}
+
+// GetReady gets the usernames of the members ready for the game
+func (l *Lobby) GetReady() ([]string, error) {
+	ids, err := l.s.ListLobbyReady(l.id)
+	if err != nil {
+		return nil, err
+	}
+	return l.usernames(ids)
+}
+
+func (l *Lobby) createGame(rules GameRulesT) error {
+	ids, err := categoryQuestionIDs(l.s, rules.Category)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return ErrEmptyGame
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if rules.Rounds > 0 && rules.Rounds < int64(len(ids)) {
+		ids = ids[:rules.Rounds]
+	}
+
+	players, err := l.s.ListLobbyMembers(l.id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return l.s.CreateGame(&GameRecord{
+		LobbyID:        l.id,
+		QuestionIDs:    ids,
+		RoundStartedAt: now,
+		RoundEndsAt:    now.Add(rules.RoundTime),
+		StartedAt:      now,
+	}, players)
+}
+
+// GetGame gets how the lobby's game stands
+func (l *Lobby) GetGame() (*GameT, error) {
+	g, err := l.s.GetGame(l.id)
+	if err != nil {
+		return nil, err
+	}
+	players, err := l.s.ListGamePlayers(l.id)
+	if err != nil {
+		return nil, err
+	}
+
+	game := &GameT{
+		Round:  g.Round,
+		Rounds: int64(len(g.QuestionIDs)),
+		Ended:  g.Round >= int64(len(g.QuestionIDs)),
+	}
+	if !game.Ended {
+		game.QuestionID = g.QuestionIDs[g.Round]
+		game.EndsAt = g.RoundEndsAt
+		qt, err := l.s.GetQuestion(game.QuestionID)
+		if err != nil && err != ErrQuestionNotFound {
+			return nil, err
+		}
+		game.Question = qt
+	}
+	if g.Round > 0 {
+		qt, err := l.s.GetQuestion(g.QuestionIDs[g.Round-1])
+		if err != nil && err != ErrQuestionNotFound {
+			return nil, err
+		}
+		if qt != nil {
+			game.LastAnswer = qt.CorrectAnswer()
+		}
+	}
+	for _, p := range players {
+		u, err := l.s.GetUser(p.UserID)
+		if err != nil {
+			return nil, err
+		}
+		game.Players = append(game.Players, GameScoreT{
+			Username: u.Username,
+			Points:   p.Points,
+			Correct:  p.Correct,
+			Answered: !game.Ended && p.AnsweredRound >= g.Round,
+		})
+	}
+	return game, nil
+}
+
+// AnswerGame grades the player's answer to the round and adds its points, the time bonus counts from when the round
+// opened and there are no streaks in a game, ErrAnswerLate is returned once the round's time has run out
+func (l *Lobby) AnswerGame(sc ScoringT, userID, round int64, choices ...string) (bool, error) {
+	g, err := l.s.GetGame(l.id)
+	if err != nil {
+		return false, err
+	}
+	if g.Round != round || round >= int64(len(g.QuestionIDs)) {
+		return false, ErrStaleAnswer
+	}
+	now := time.Now()
+	if now.After(g.RoundEndsAt) {
+		return false, ErrAnswerLate
+	}
+
+	qt, err := l.s.GetQuestion(g.QuestionIDs[round])
+	if err == ErrQuestionNotFound {
+		// deleted from the bank, the round is left to run out
+		return false, ErrStaleAnswer
+	}
+	if err != nil {
+		return false, err
+	}
+
+	grade := qt.Grade(choices)
+	points := sc.Points(grade, qt, 0, now.Sub(g.RoundStartedAt))
+	if err := l.s.AnswerRound(l.id, userID, round, points, grade > 0); err != nil {
+		return false, err
+	}
+	return grade > 0, nil
+}
+
+// RoundDone tells whether the round can be closed, that is its time has run out or every player still in the lobby
+// has answered it, a round the game has moved past is done
+func (l *Lobby) RoundDone(round int64) (bool, error) {
+	g, err := l.s.GetGame(l.id)
+	if err != nil {
+		return false, err
+	}
+	if g.Round != round || round >= int64(len(g.QuestionIDs)) || !time.Now().Before(g.RoundEndsAt) {
+		return true, nil
+	}
+
+	players, err := l.s.ListGamePlayers(l.id)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range players {
+		if p.AnsweredRound >= round {
+			continue
+		}
+		member, err := l.IsMember(p.UserID)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AdvanceGame closes the round and opens the next one, past the last round the game and the lobby are ended, ended
+// tells which happened, ErrStaleAnswer is returned if the round has been closed already, the lobby's settings
+// override the rules
+func (l *Lobby) AdvanceGame(rules GameRulesT, round int64) (ended bool, err error) {
+	g, err := l.s.GetGame(l.id)
+	if err != nil {
+		return false, err
+	}
+	if rules, err = l.gameRules(rules); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if err := l.s.AdvanceRound(l.id, round, now, now.Add(rules.RoundTime)); err != nil {
+		return false, err
+	}
+	if err := l.touch(); err != nil {
+		return false, err
+	}
+	if round+1 < int64(len(g.QuestionIDs)) {
+		return false, nil
+	}
+	err = l.s.SwapLobbyStatus(l.id, StatusOngoing, StatusEnded)
+	if err != nil && err != ErrLobbyStatus {
+		return true, err
+	}
+	return true, nil
+}
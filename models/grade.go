@@ -0,0 +1,216 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gocs/davy/validator"
+)
+
+// the types of question, each is answered and graded differently
+const (
+	// TypeSingle is answered by picking the one correct choice
+	TypeSingle = "single"
+	// TypeTrueFalse is TypeSingle with True and False as the choices
+	TypeTrueFalse = "true-false"
+	// TypeMultiple is answered by picking every correct choice listed in Answers
+	TypeMultiple = "multiple"
+	// TypeText is answered by typing the answer, small typos are forgiven
+	TypeText = "text"
+	// TypeNumeric is answered by typing a number within the tolerance of the answer
+	TypeNumeric = "numeric"
+)
+
+// QuestionTypes lists the types of question in the order they are offered
+var QuestionTypes = []string{TypeSingle, TypeTrueFalse, TypeMultiple, TypeText, TypeNumeric}
+
+// kind is the type of the question, the questions stored before the types existed are TypeSingle
+func (q *QuestionT) kind() string {
+	if q.Type == "" {
+		return TypeSingle
+	}
+	return q.Type
+}
+
+// CorrectAnswer is the answer as it is shown to the user, every correct choice of TypeMultiple
+func (q *QuestionT) CorrectAnswer() string {
+	if q.kind() == TypeMultiple {
+		return strings.Join(q.Answers, ", ")
+	}
+	return q.Answer
+}
+
+// validateQuestion checks that the question can be answered as its type is graded
+func validateQuestion(q *QuestionT) error {
+	if strings.TrimSpace(q.Statement) == "" {
+		return validator.ErrInvalidQuestion
+	}
+	for _, link := range q.Links {
+		if err := validator.Link(link); err != nil {
+			return err
+		}
+	}
+	if err := validator.Difficulty(q.Difficulty); err != nil {
+		return err
+	}
+
+	switch q.kind() {
+	case TypeSingle, TypeTrueFalse:
+		return validator.Question(q.Statement, q.Answer, q.Choices)
+	case TypeMultiple:
+		if len(q.Answers) == 0 {
+			return validator.ErrInvalidQuestion
+		}
+		for _, a := range q.Answers {
+			if err := validator.Question(q.Statement, a, q.Choices); err != nil {
+				return err
+			}
+		}
+		return nil
+	case TypeText:
+		if normalizeText(q.Answer) == "" {
+			return validator.ErrInvalidQuestion
+		}
+		return nil
+	case TypeNumeric:
+		if _, err := parseNumber(q.Answer); err != nil || q.Tolerance < 0 {
+			return validator.ErrInvalidQuestion
+		}
+		return nil
+	}
+	return validator.ErrInvalidQuestion
+}
+
+// Grade gives the points the selected choices are worth, 0 is a wrong answer
+// only TypeMultiple takes more than one choice, with PartialCredit it is worth a point for each correct choice less
+// a point for each wrong one, so up to len(Answers) points as the points are whole numbers, otherwise every question is
+// worth a single point
+func (q *QuestionT) Grade(choices []string) int64 {
+	if q.kind() == TypeMultiple {
+		return q.gradeMultiple(choices)
+	}
+	if len(choices) != 1 {
+		return 0
+	}
+
+	choice := choices[0]
+	var correct bool
+	switch q.kind() {
+	case TypeSingle:
+		correct = choice == q.Answer
+	case TypeTrueFalse:
+		correct = strings.EqualFold(choice, q.Answer)
+	case TypeText:
+		correct = matchText(choice, append([]string{q.Answer}, q.Answers...))
+	case TypeNumeric:
+		correct = matchNumber(choice, q.Answer, q.Tolerance)
+	}
+	if correct {
+		return 1
+	}
+	return 0
+}
+
+func (q *QuestionT) gradeMultiple(choices []string) int64 {
+	var right, wrong int64
+	var seen []string
+	for _, c := range choices {
+		if contains(seen, c) {
+			continue
+		}
+		seen = append(seen, c)
+		if contains(q.Answers, c) {
+			right++
+		} else {
+			wrong++
+		}
+	}
+
+	if q.PartialCredit {
+		if right > wrong {
+			return right - wrong
+		}
+		return 0
+	}
+	if wrong == 0 && right == int64(len(q.Answers)) {
+		return 1
+	}
+	return 0
+}
+
+// normalizeText lowers the case and drops the punctuation and the extra spaces so only the words are compared
+func normalizeText(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// matchText accepts a typed answer that is at most one typo away for every 5 letters of an accepted answer
+func matchText(choice string, answers []string) bool {
+	typed := normalizeText(choice)
+	if typed == "" {
+		return false
+	}
+	for _, a := range answers {
+		a = normalizeText(a)
+		if a != "" && levenshtein(typed, a) <= len([]rune(a))/5 {
+			return true
+		}
+	}
+	return false
+}
+
+// levenshtein counts the single letter insertions, deletions and substitutions between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// parseNumber reads a typed number, thousands separators and surrounding spaces are ignored
+func parseNumber(s string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+}
+
+func matchNumber(choice, answer string, tolerance float64) bool {
+	typed, err := parseNumber(choice)
+	if err != nil {
+		return false
+	}
+	want, err := parseNumber(answer)
+	if err != nil {
+		return false
+	}
+	diff := typed - want
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= tolerance
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrade(t *testing.T) {
+	single := &QuestionT{Answer: "Norway", Choices: []string{"Wales", "Norway"}}
+	trueFalse := normalizeQuestion(&QuestionT{Type: TypeTrueFalse, Answer: "false"})
+	multiple := &QuestionT{Type: TypeMultiple, Choices: []string{"Wales", "Norway", "Sweden", "England"},
+		Answers: []string{"Norway", "Sweden"}}
+	partial := &QuestionT{Type: TypeMultiple, Choices: multiple.Choices, Answers: multiple.Answers, PartialCredit: true}
+	partialUK := &QuestionT{Type: TypeMultiple, Choices: multiple.Choices, Answers: []string{"Wales", "Sweden", "England"},
+		PartialCredit: true}
+	text := &QuestionT{Type: TypeText, Answer: "Greenland", Answers: []string{"Kalaallit Nunaat"}}
+	numeric := &QuestionT{Type: TypeNumeric, Answer: "3.14", Tolerance: 0.01}
+
+	given := []struct {
+		q        *QuestionT
+		choices  []string
+		expected int64
+	}{
+		{single, []string{"Norway"}, 1},
+		{single, []string{"norway"}, 0},
+		{single, []string{"Norway", "Wales"}, 0},
+		{trueFalse, []string{"False"}, 1},
+		{trueFalse, []string{"false"}, 1},
+		{trueFalse, []string{"True"}, 0},
+		{multiple, []string{"Sweden", "Norway"}, 1},
+		{multiple, []string{"Sweden"}, 0},
+		{multiple, []string{"Sweden", "Norway", "Wales"}, 0},
+		{partial, []string{"Sweden", "Norway"}, 2},
+		{partial, []string{"Sweden", "Sweden"}, 1},
+		{partial, []string{"Sweden", "Wales"}, 0},
+		{partial, nil, 0},
+		{partialUK, []string{"Wales", "Sweden", "England"}, 3},
+		{partialUK, []string{"Wales", "England", "Norway"}, 1},
+		{text, []string{"  greenland! "}, 1},
+		{text, []string{"Grenland"}, 1},
+		{text, []string{"kalaallit-nunaat"}, 1},
+		{text, []string{"Iceland"}, 0},
+		{text, []string{""}, 0},
+		{numeric, []string{"3.14"}, 1},
+		{numeric, []string{" 3.149 "}, 1},
+		{numeric, []string{"3.2"}, 0},
+		{numeric, []string{"pi"}, 0},
+	}
+
+	for _, g := range given {
+		result := g.q.Grade(g.choices)
+		if result != g.expected {
+			t.Errorf("points not same: type=%s choices=%q expected=%d result=%d", g.q.kind(), g.choices, g.expected, result)
+		}
+	}
+}
+
+func TestValidateQuestion(t *testing.T) {
+	given := map[*QuestionT]bool{
+		{Statement: "Is it?", Type: TypeTrueFalse, Answer: "true"}:                                     true,
+		{Statement: "Is it?", Type: TypeTrueFalse, Answer: "maybe"}:                                    false,
+		{Statement: "Which?", Type: TypeMultiple, Choices: []string{"a", "b"}, Answers: []string{"b"}}: true,
+		{Statement: "Which?", Type: TypeMultiple, Choices: []string{"a", "b"}, Answers: []string{"c"}}: false,
+		{Statement: "Which?", Type: TypeMultiple, Choices: []string{"a", "b"}}:                         false,
+		{Statement: "Name?", Type: TypeText, Answer: "?!"}:                                             false,
+		{Statement: "How many?", Type: TypeNumeric, Answer: "1,000", Tolerance: 5}:                     true,
+		{Statement: "How many?", Type: TypeNumeric, Answer: "many"}:                                    false,
+		{Statement: "How many?", Type: TypeNumeric, Answer: "1", Tolerance: -1}:                        false,
+		{Statement: "What?", Type: "essay", Answer: "a"}:                                               false,
+	}
+
+	for q, valid := range given {
+		err := validateQuestion(normalizeQuestion(q))
+		if (err == nil) != valid {
+			t.Errorf("validation not same: question=%+v expected=%v result=%v", q, valid, err)
+		}
+	}
+}
+
+func TestScoring(t *testing.T) {
+	easy := &QuestionT{}
+	hard := &QuestionT{Difficulty: 4}
+	rules := ScoringT{Weighted: true, Penalty: 2, StreakEvery: 2, StreakMax: 3, TimeBonus: 5, BonusWithin: 10 * time.Second}
+
+	given := []struct {
+		sc       ScoringT
+		grade    int64
+		q        *QuestionT
+		streak   int64
+		elapsed  time.Duration
+		expected int64
+	}{
+		{ScoringT{}, 1, hard, 9, time.Second, 1},
+		{ScoringT{}, 2, easy, 0, 0, 2},
+		{ScoringT{}, 0, hard, 0, 0, 0},
+		{rules, 0, hard, 5, time.Second, -2},
+		{rules, 1, easy, 0, time.Minute, 1},
+		{rules, 1, hard, 0, time.Minute, 4},
+		{rules, 1, hard, 0, time.Second, 9},
+		{rules, 1, easy, 1, time.Minute, 2},
+		{rules, 1, easy, 3, time.Minute, 3},
+		{rules, 1, easy, 9, time.Minute, 3},
+		{ScoringT{StreakEvery: 2}, 1, easy, 9, time.Minute, 6},
+		{ScoringT{Weighted: true}, 2, hard, 0, time.Minute, 8},
+	}
+
+	for _, g := range given {
+		result := g.sc.Points(g.grade, g.q, g.streak, g.elapsed)
+		if result != g.expected {
+			t.Errorf("points not same: scoring=%+v grade=%d difficulty=%d streak=%d elapsed=%v expected=%d result=%d",
+				g.sc, g.grade, g.q.Difficulty, g.streak, g.elapsed, g.expected, result)
+		}
+	}
+}
+
+func TestWrongChoices(t *testing.T) {
+	given := []struct {
+		q        *QuestionT
+		expected int
+	}{
+		{&QuestionT{Answer: "Norway", Choices: []string{"Wales", "Norway", "Sweden"}}, 2},
+		{normalizeQuestion(&QuestionT{Type: TypeTrueFalse, Answer: "false"}), 1},
+		{&QuestionT{Type: TypeMultiple, Choices: []string{"Wales", "Norway", "Sweden", "England"},
+			Answers: []string{"Norway", "Sweden"}}, 2},
+		{&QuestionT{Type: TypeText, Answer: "Greenland", Choices: []string{"Iceland", "Greenland"}}, 0},
+		{&QuestionT{Type: TypeNumeric, Answer: "3.14"}, 0},
+	}
+
+	for _, g := range given {
+		if result := wrongChoices(g.q); len(result) != g.expected {
+			t.Errorf("wrong choices not same: type=%s expected=%d result=%q", g.q.kind(), g.expected, result)
+		}
+	}
+}
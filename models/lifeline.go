@@ -0,0 +1,174 @@
+package models
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gocs/davy/validator"
+)
+
+// LifelinesT is how many times each lifeline can be used during an exam and how many points a use costs
+type LifelinesT struct {
+	// FiftyFifty takes two wrong choices away from the current question
+	FiftyFifty     int64
+	FiftyFiftyCost int64
+	// Hint shows the hint of the current question
+	Hint     int64
+	HintCost int64
+}
+
+// Validate checks that no lifeline is used a negative number of times or costs negative points
+func (ll LifelinesT) Validate() error {
+	return validator.Lifelines(ll.FiftyFifty, ll.FiftyFiftyCost, ll.Hint, ll.HintCost)
+}
+
+// LifelineStateT is how the lifelines stand on the user's current question
+type LifelineStateT struct {
+	// Hidden is the choices taken away by the 50/50
+	Hidden []string
+	// Hint is the hint of the question once the lifeline has shown it
+	Hint           string
+	FiftyFiftyLeft int64
+	HintsLeft      int64
+	// CanFiftyFifty and CanHint tell whether the lifelines can still help with the question
+	CanFiftyFifty bool
+	CanHint       bool
+}
+
+// Choices are the choices of the question the 50/50 has left
+func (st *LifelineStateT) Choices(qt *QuestionT) []string {
+	choices := []string{}
+	for _, c := range qt.Choices {
+		if !contains(st.Hidden, c) {
+			choices = append(choices, c)
+		}
+	}
+	return choices
+}
+
+// wrongChoices are the choices of the question that are not right, there is none to pick from a text or a numeric
+// question
+func wrongChoices(qt *QuestionT) []string {
+	kind := qt.kind()
+	if kind == TypeText || kind == TypeNumeric {
+		return nil
+	}
+
+	wrong := []string{}
+	for _, c := range qt.Choices {
+		if kind == TypeMultiple && !contains(qt.Answers, c) || kind != TypeMultiple && c != qt.Answer {
+			wrong = append(wrong, c)
+		}
+	}
+	return wrong
+}
+
+// GetLifelines tells how the lifelines stand on the current question, none can be used once the exam is finished
+func (uq *UserQuestion) GetLifelines(ll LifelinesT) (*LifelineStateT, error) {
+	r, err := uq.s.GetUserQuestion(uq.id)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &LifelineStateT{
+		Hidden:         r.Hidden,
+		FiftyFiftyLeft: ll.FiftyFifty - r.FiftyFifties,
+		HintsLeft:      ll.Hint - r.Hints,
+	}
+	if r.QuestionID == 0 {
+		return st, nil
+	}
+	qt, err := uq.s.GetQuestion(r.QuestionID)
+	if err == ErrQuestionNotFound {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Hinted {
+		st.Hint = qt.Hint
+	}
+	st.CanFiftyFifty = st.FiftyFiftyLeft > 0 && len(r.Hidden) == 0 && len(wrongChoices(qt)) >= 2
+	st.CanHint = st.HintsLeft > 0 && !r.Hinted && qt.Hint != ""
+	return st, nil
+}
+
+// currentForLifeline gets the progress and the question the lifeline is used on, questionID is as in
+// UserConfirmAnswer
+func (uq *UserQuestion) currentForLifeline(questionID int64) (*UserQuestionRecord, *QuestionT, error) {
+	r, err := uq.s.GetUserQuestion(uq.id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.QuestionID == 0 {
+		return nil, nil, ErrExamFinished
+	}
+	if questionID == 0 {
+		questionID = r.QuestionID
+	}
+	if questionID != r.QuestionID {
+		return nil, nil, ErrStaleAnswer
+	}
+	if timeUp(r, time.Now()) {
+		return nil, nil, ErrAnswerLate
+	}
+
+	qt, err := uq.s.GetQuestion(questionID)
+	if err == ErrQuestionNotFound {
+		return nil, nil, ErrStaleAnswer
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, qt, nil
+}
+
+// chargeLifeline takes the cost of the lifeline off the user's points and the leaderboard
+func (uq *UserQuestion) chargeLifeline(userID, cost int64) error {
+	if cost == 0 {
+		return nil
+	}
+	points, err := uq.s.AddPoints(uq.id, -cost)
+	if err != nil {
+		return err
+	}
+	return uq.s.SetScore(userID, points)
+}
+
+// UseFiftyFifty takes two random wrong choices away from the current question for its cost,
+// ErrLifelineUnavailable is returned if the question does not have two wrong choices to take away
+func (uq *UserQuestion) UseFiftyFifty(ll LifelinesT, questionID int64) error {
+	r, qt, err := uq.currentForLifeline(questionID)
+	if err != nil {
+		return err
+	}
+
+	wrong := wrongChoices(qt)
+	if len(wrong) < 2 {
+		return ErrLifelineUnavailable
+	}
+	rand.Shuffle(len(wrong), func(i, j int) { wrong[i], wrong[j] = wrong[j], wrong[i] })
+
+	if err := uq.s.UseFiftyFifty(uq.id, r.QuestionID, ll.FiftyFifty, wrong[:2]); err != nil {
+		return err
+	}
+	return uq.chargeLifeline(r.UserID, ll.FiftyFiftyCost)
+}
+
+// UseHint shows the hint of the current question for its cost, ErrLifelineUnavailable is returned if the question
+// has no hint
+func (uq *UserQuestion) UseHint(ll LifelinesT, questionID int64) error {
+	r, qt, err := uq.currentForLifeline(questionID)
+	if err != nil {
+		return err
+	}
+	if qt.Hint == "" {
+		return ErrLifelineUnavailable
+	}
+
+	if err := uq.s.UseHint(uq.id, r.QuestionID, ll.Hint); err != nil {
+		return err
+	}
+	return uq.chargeLifeline(r.UserID, ll.HintCost)
+}
@@ -1,146 +1,188 @@
 package models
 
 import (
-	"fmt"
-	"strconv"
+	"time"
 
 	"github.com/gocs/davy/generator"
+	"github.com/gocs/davy/validator"
 )
 
 // Lobby is a manager for accessing users in the database
 type Lobby struct {
 	id int64
+	s  Store
 }
 
 // NewLobby creates new lobby, saves it to the database, and returns the newly created lobby
-func NewLobby(hostID int64, length int) (*Lobby, error) {
-	lid, err := client.HGet(fmt.Sprintf("user:%d", hostID), "lobby").Int64()
+func NewLobby(s Store, hostID int64, length int) (*Lobby, error) {
+	u, err := s.GetUser(hostID)
 	if err != nil {
 		return nil, err
 	}
-	if lid != -1 {
+	if u.LobbyID != -1 {
 		return nil, ErrUserInLobby
 	}
 
-	id, err := client.Incr("lobby:next-id").Result()
-	if err != nil {
-		return nil, err
+	// a code clashing with a live lobby's is drawn again
+	var id int64
+	for i := 0; i < codeAttempts; i++ {
+		id, err = s.CreateLobby(hostID, generator.Code(length))
+		if err != ErrLobbyCodeTaken {
+			break
+		}
 	}
-
-	code := generator.Code(length)
-
-	key := fmt.Sprintf("lobby:%d", id)
-	pipe := client.Pipeline()
-	pipe.HSet(key, "id", id)
-	pipe.HSet(key, "code", code)
-	pipe.HSet(key, "host_id", hostID)
-	pipe.HSet(key, "status", StatusWaiting)
-	pipe.HSet("lobby:by-code", code, id)
-	pipe.HSet(fmt.Sprintf("user:%d", hostID), "lobby", id)
-	pipe.SAdd(fmt.Sprintf("lobby:%d:members", id), hostID)
-	_, err = pipe.Exec()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Lobby{id: id}, nil
+	return &Lobby{id: id, s: s}, nil
 }
 
+// codeAttempts is how many codes NewLobby draws before it gives up on finding one that is free
+const codeAttempts = 10
+
 const (
 	// StatusWaiting means the status is "waiting"
-	StatusWaiting  = 0
+	StatusWaiting = 0
 	// StatusStarting means the status is "starting"
 	StatusStarting = 1
 	// StatusOngoing means the status is "on-going"
-	StatusOngoing  = 2
+	StatusOngoing = 2
 	// StatusEnded means the status is "ended"
-	StatusEnded    = 3
+	StatusEnded = 3
 )
 
 // GetLobbyID LobbyID getter
 func (l *Lobby) GetLobbyID() (int64, error) {
-	key := fmt.Sprintf("lobby:%d", l.id)
-	return client.HGet(key, "id").Int64()
+	r, err := l.s.GetLobby(l.id)
+	if err != nil {
+		return 0, err
+	}
+	return r.ID, nil
 }
 
 // GetCode Lobby Code getter
 func (l *Lobby) GetCode() (string, error) {
-	key := fmt.Sprintf("lobby:%d", l.id)
-	code, err := client.HGet(key, "code").Result()
+	r, err := l.s.GetLobby(l.id)
 	if err != nil {
 		return "", err
 	}
-	return code, err
+	return r.Code, nil
 }
 
 // GetHostID Lobby HostID getter
 func (l *Lobby) GetHostID() (int64, error) {
-	key := fmt.Sprintf("lobby:%d", l.id)
-	return client.HGet(key, "host_id").Int64()
+	r, err := l.s.GetLobby(l.id)
+	if err != nil {
+		return 0, err
+	}
+	return r.HostID, nil
 }
 
 // SetHostID Lobby HostID setter
 func (l *Lobby) SetHostID(hostID int64) error {
-	key := fmt.Sprintf("lobby:%d", l.id)
-	pipe := client.Pipeline()
-	pipe.HSet(key, "host_id", hostID)
-	_, err := pipe.Exec()
-	return err
+	return l.s.SetLobbyHost(l.id, hostID)
 }
 
 func (l *Lobby) GetStatus() (int64, error) {
-	key := fmt.Sprintf("lobby:%d", l.id)
-	return client.HGet(key, "status").Int64()
+	r, err := l.s.GetLobby(l.id)
+	if err != nil {
+		return 0, err
+	}
+	return r.Status, nil
 }
 
 func (l *Lobby) SetStatus(status int64) error {
-	key := fmt.Sprintf("lobby:%d", l.id)
-	_, err := client.HSet(key, "status", status).Result()
-	return err
+	if err := l.s.SetLobbyStatus(l.id, status); err != nil {
+		return err
+	}
+	return l.touch()
 }
 
-// IsMember checks if the user is a member
-func (l *Lobby) IsMember(userID int64) (bool, error) {
-	return client.SIsMember(fmt.Sprintf("lobby:%d:members", l.id), userID).Result()
+// touch marks the lobby as used now so that the janitor keeps it
+func (l *Lobby) touch() error {
+	return l.s.TouchLobby(l.id, time.Now())
 }
 
-// GetTopMember gets the member supposedly inherits the host role
-func (l *Lobby) GetTopMember() (*User, error) {
-	count, err := client.SCard(fmt.Sprintf("lobby:%d:members", l.id)).Result()
+// the bounds of the lobby settings, 0 is always taken for the default
+const (
+	// MaxLobbyPlayers caps the lobby's max players
+	MaxLobbyPlayers = 50
+	// MaxLobbyRounds caps the lobby's rounds
+	MaxLobbyRounds = 50
+	// MinRoundTime and MaxRoundTime bound the lobby's time per question
+	MinRoundTime = 5 * time.Second
+	MaxRoundTime = 5 * time.Minute
+)
+
+// GetSettings Lobby Settings getter
+func (l *Lobby) GetSettings() (*LobbySettings, error) {
+	r, err := l.s.GetLobby(l.id)
 	if err != nil {
 		return nil, err
 	}
-	if count <= 0 {
-		return nil, ErrLobbyEmptyMembers
-	}
+	return &r.Settings, nil
+}
 
-	ids, err := client.SMembers(fmt.Sprintf("lobby:%d:members", l.id)).Result()
+// SetSettings lets the host or a co-host set the waiting lobby up, ErrLobbySettings is returned for settings out of
+// their bounds or a max players below the members the lobby has
+func (l *Lobby) SetSettings(userID int64, settings LobbySettings) error {
+	if err := l.canManage(userID); err != nil {
+		return err
+	}
+	status, err := l.GetStatus()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if status != StatusWaiting {
+		return ErrLobbyStatus
 	}
 
-	id, err := strconv.ParseInt(ids[0], 10, 64)
-	if err != nil {
-		return nil, err
+	if settings.MaxPlayers < 0 || settings.MaxPlayers > MaxLobbyPlayers ||
+		settings.Rounds < 0 || settings.Rounds > MaxLobbyRounds ||
+		settings.RoundTime != 0 && (settings.RoundTime < MinRoundTime || settings.RoundTime > MaxRoundTime) {
+		return ErrLobbySettings
+	}
+	if settings.MaxPlayers > 0 {
+		ids, err := l.s.ListLobbyMembers(l.id)
+		if err != nil {
+			return err
+		}
+		if int64(len(ids)) > settings.MaxPlayers {
+			return ErrLobbySettings
+		}
+	}
+	if settings.Category != "" {
+		ids, err := categoryQuestionIDs(l.s, settings.Category)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrEmptyCategory
+		}
 	}
 
-	return &User{id: id}, nil
+	if err := l.s.SetLobbySettings(l.id, settings); err != nil {
+		return err
+	}
+	return l.touch()
+}
+
+// IsMember checks if the user is a member
+func (l *Lobby) IsMember(userID int64) (bool, error) {
+	return l.s.IsLobbyMember(l.id, userID)
 }
 
 // GetMembers gets all the members
 func (l *Lobby) GetMembers() ([]*User, error) {
-	ids, err := client.SMembers(fmt.Sprintf("lobby:%d:members", l.id)).Result()
+	ids, err := l.s.ListLobbyMembers(l.id)
 	if err != nil {
 		return nil, err
 	}
 
 	var users []*User
-	for _, v := range ids {
-		id, err := strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, &User{id: id})
+	for _, id := range ids {
+		users = append(users, &User{id: id, s: l.s})
 	}
 
 	return users, nil
@@ -170,11 +212,10 @@ func (l *Lobby) LeaveLobby(userID int64) error {
 		return err
 	}
 
-	pipe := client.Pipeline()
-	pipe.HSet(fmt.Sprintf("user:%d", userID), "lobby", -1)
-	pipe.SRem(fmt.Sprintf("lobby:%d:members", l.id), userID)
-	_, err = pipe.Exec()
-	if err != nil {
+	if err := l.s.RemoveLobbyMember(l.id, userID); err != nil {
+		return err
+	}
+	if err := l.touch(); err != nil {
 		return err
 	}
 
@@ -182,29 +223,53 @@ func (l *Lobby) LeaveLobby(userID int64) error {
 		return nil
 	}
 
-	u, err := l.GetTopMember()
+	successorID, err := l.successor()
 	if err != nil {
 		if err == ErrLobbyEmptyMembers {
-			l.CloseLobby()
-			return nil
+			return l.CloseLobby()
 		}
 		return err
 	}
 
-	key := fmt.Sprintf("lobby:%d", l.id)
-	pipe.HSet(key, "host_id", u.id)
-	_, err = pipe.Exec()
-	return err
+	return l.setHost(successorID)
+}
+
+// setHost makes the member the host, a co-host taking over gives up the co-host role
+func (l *Lobby) setHost(userID int64) error {
+	if err := l.s.SetLobbyCoHost(l.id, userID, false); err != nil {
+		return err
+	}
+	return l.SetHostID(userID)
+}
+
+// successor is the member who takes over from a host who leaves, the co-host who joined first or else the member who
+// joined first
+func (l *Lobby) successor() (int64, error) {
+	ids, err := l.s.ListLobbyMembers(l.id)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) <= 0 {
+		return 0, ErrLobbyEmptyMembers
+	}
+	cohosts, err := l.s.ListLobbyCoHosts(l.id)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if containsID(cohosts, id) {
+			return id, nil
+		}
+	}
+	return ids[0], nil
 }
 
 // CloseLobby sets the lobby status to ended then permits entering of member
 func (l *Lobby) CloseLobby() error {
-	key := fmt.Sprintf("lobby:%d", l.id)
-	_, err := client.HSet(key, "status", StatusEnded).Result()
-	return err
+	return l.SetStatus(StatusEnded)
 }
 
-// AddMember adds a member to the lobby
+// AddMember adds a member to the lobby, a user who is in a lobby already has to leave it first
 func (l *Lobby) AddMember(userID int64) error {
 	status, err := l.GetStatus()
 	if err != nil {
@@ -213,6 +278,13 @@ func (l *Lobby) AddMember(userID int64) error {
 	if status == StatusEnded {
 		return ErrGameEnded
 	}
+	banned, err := l.s.IsLobbyBanned(l.id, userID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrBanned
+	}
 
 	userIsMember, err := l.IsMember(userID)
 	if err != nil {
@@ -222,33 +294,40 @@ func (l *Lobby) AddMember(userID int64) error {
 		return ErrUserInLobby
 	}
 
-	id, err := client.HGet(fmt.Sprintf("user:%d", userID), "lobby").Int64()
+	u, err := l.s.GetUser(userID)
 	if err != nil {
 		return err
 	}
-	if id == l.id {
+	if u.LobbyID != -1 {
 		return ErrUserInLobby
 	}
 
-	pipe := client.Pipeline()
-	pipe.HSet(fmt.Sprintf("user:%d", userID), "lobby", l.id)
-	pipe.SAdd(fmt.Sprintf("lobby:%d:members", l.id), userID)
-	_, err = pipe.Exec()
-	return err
+	if err := l.s.AddLobbyMember(l.id, userID); err != nil {
+		return err
+	}
+	return l.touch()
 }
 
 // GetLobbyByCode get the lobby based on the given code
-func GetLobbyByCode(code string) (*Lobby, error) {
-	id, err := client.HGet("lobby:by-code", code).Int64()
+func GetLobbyByCode(s Store, code string) (*Lobby, error) {
+	id, err := s.GetLobbyIDByCode(code)
 	if err != nil {
 		return nil, err
 	}
-	return &Lobby{id: id}, nil
+	return &Lobby{id: id, s: s}, nil
+}
+
+// GetLobbyByID get the lobby of the given id
+func GetLobbyByID(s Store, id int64) (*Lobby, error) {
+	if _, err := s.GetLobby(id); err != nil {
+		return nil, err
+	}
+	return &Lobby{id: id, s: s}, nil
 }
 
 // JoinLobby joins the user to the lobby from the given code
-func JoinLobby(code string, userID int64) error {
-	l, err := GetLobbyByCode(code)
+func JoinLobby(s Store, code string, userID int64) error {
+	l, err := GetLobbyByCode(s, code)
 	if err != nil {
 		return err
 	}
@@ -256,15 +335,268 @@ func JoinLobby(code string, userID int64) error {
 }
 
 // JoinOrCreateLobby process whether the lobby is joined or created by the current user
-func JoinOrCreateLobby(choice, code string, userID int64) error {
+func JoinOrCreateLobby(s Store, choice, code string, userID int64) error {
 	if choice == "join" {
-		return JoinLobby(code, userID)
+		return JoinLobby(s, code, userID)
 	}
-	_, err := NewLobby(userID, 5)
+	_, err := NewLobby(s, userID, 5)
 	return err
 }
 
-func GetLobbyByUserID(userID int64) (*Lobby, error) {
-	u := &User{id: userID}
+// LobbyListingT is a public lobby as the lobby browser lists it
+type LobbyListingT struct {
+	Code       string
+	Host       string
+	Players    int64
+	MaxPlayers int64
+	Category   string
+}
+
+// ListPublicLobbies lists the public lobbies that are waiting for players, the oldest first
+func ListPublicLobbies(s Store) ([]LobbyListingT, error) {
+	ids, err := s.ListPublicLobbyIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	listings := []LobbyListingT{}
+	for _, id := range ids {
+		r, err := s.GetLobby(id)
+		if err == ErrLobbyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		host, err := s.GetUser(r.HostID)
+		if err != nil {
+			return nil, err
+		}
+		members, err := s.ListLobbyMembers(id)
+		if err != nil {
+			return nil, err
+		}
+		listings = append(listings, LobbyListingT{
+			Code:       r.Code,
+			Host:       host.Username,
+			Players:    int64(len(members)),
+			MaxPlayers: r.Settings.MaxPlayers,
+			Category:   r.Settings.Category,
+		})
+	}
+	return listings, nil
+}
+
+func GetLobbyByUserID(s Store, userID int64) (*Lobby, error) {
+	u := &User{id: userID, s: s}
 	return u.GetLobby()
-}
\ No newline at end of file
+}
+
+// JanitorT is how the lobbies nobody uses are cleaned up
+type JanitorT struct {
+	// TTL is how long an idle or ended lobby is kept, 0 keeps them forever
+	TTL time.Duration
+	// Sweep is how often the lobbies past their TTL are looked for
+	Sweep time.Duration
+}
+
+// Validate checks that the ttl is not negative and that a ttl is swept every so often
+func (j JanitorT) Validate() error {
+	return validator.Janitor(j.TTL, j.Sweep)
+}
+
+// ExpireLobbies deletes the lobbies, ended or not, that nobody has used since before and frees their codes, then resets
+// the lobby of the users who are not members of it anymore, it returns the ids of the deleted lobbies
+func ExpireLobbies(s Store, before time.Time) ([]int64, error) {
+	ids, err := s.ListIdleLobbyIDs(before)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if err := s.DeleteLobby(id); err != nil {
+			return ids[:i], err
+		}
+	}
+	if _, err := s.ResetStaleUserLobbies(); err != nil {
+		return ids, err
+	}
+	return ids, nil
+}
+
+const (
+	// RoleHost runs the lobby, a lobby has one host
+	RoleHost = "host"
+	// RoleCoHost helps the host run the lobby, it can do what the host can but to the host and the other co-hosts
+	RoleCoHost = "co-host"
+	// RolePlayer plays the lobby's games
+	RolePlayer = "player"
+)
+
+// roleRank orders the roles, a member can only act on the members of a lower role
+var roleRank = map[string]int{RolePlayer: 0, RoleCoHost: 1, RoleHost: 2}
+
+// IsHost checks if the user is the lobby's host
+func (l *Lobby) IsHost(userID int64) (bool, error) {
+	hostID, err := l.GetHostID()
+	if err != nil {
+		return false, err
+	}
+	return hostID == userID, nil
+}
+
+// GetRole gets the member's role, ErrUserNotInLobby is returned for a user who is not a member
+func (l *Lobby) GetRole(userID int64) (string, error) {
+	member, err := l.IsMember(userID)
+	if err != nil {
+		return "", err
+	}
+	if !member {
+		return "", ErrUserNotInLobby
+	}
+	host, err := l.IsHost(userID)
+	if err != nil {
+		return "", err
+	}
+	if host {
+		return RoleHost, nil
+	}
+	cohosts, err := l.s.ListLobbyCoHosts(l.id)
+	if err != nil {
+		return "", err
+	}
+	if containsID(cohosts, userID) {
+		return RoleCoHost, nil
+	}
+	return RolePlayer, nil
+}
+
+// canManage checks that the user is the host or a co-host, ErrLobbyPermission is returned otherwise
+func (l *Lobby) canManage(userID int64) error {
+	role, err := l.GetRole(userID)
+	if err == ErrUserNotInLobby {
+		return ErrLobbyPermission
+	}
+	if err != nil {
+		return err
+	}
+	if roleRank[role] < roleRank[RoleCoHost] {
+		return ErrLobbyPermission
+	}
+	return nil
+}
+
+// canActOn checks that the user can manage the lobby and outranks the member, ErrUserNotInLobby is returned if the
+// member is not in the lobby
+func (l *Lobby) canActOn(byID, userID int64) error {
+	if err := l.canManage(byID); err != nil {
+		return err
+	}
+	by, err := l.GetRole(byID)
+	if err != nil {
+		return err
+	}
+	role, err := l.GetRole(userID)
+	if err != nil {
+		return err
+	}
+	if roleRank[by] <= roleRank[role] {
+		return ErrLobbyPermission
+	}
+	return nil
+}
+
+// KickMember lets the host or a co-host make a member of a lower role leave, a banned user cannot join again until the
+// ban is lifted
+func (l *Lobby) KickMember(byID, userID int64, ban bool) error {
+	if err := l.canActOn(byID, userID); err != nil {
+		return err
+	}
+	if ban {
+		if err := l.s.SetLobbyBan(l.id, userID, true); err != nil {
+			return err
+		}
+	}
+	return l.LeaveLobby(userID)
+}
+
+// Unban lets the host or a co-host lift the user's ban
+func (l *Lobby) Unban(byID, userID int64) error {
+	if err := l.canManage(byID); err != nil {
+		return err
+	}
+	return l.s.SetLobbyBan(l.id, userID, false)
+}
+
+// SetCoHost lets the host give a member the co-host role or take it away
+func (l *Lobby) SetCoHost(byID, userID int64, cohost bool) error {
+	host, err := l.IsHost(byID)
+	if err != nil {
+		return err
+	}
+	if !host {
+		return ErrLobbyPermission
+	}
+	if err := l.canActOn(byID, userID); err != nil {
+		return err
+	}
+	return l.s.SetLobbyCoHost(l.id, userID, cohost)
+}
+
+// TransferHost lets the host hand the lobby over to another member, the old host stays on as a co-host
+func (l *Lobby) TransferHost(byID, userID int64) error {
+	host, err := l.IsHost(byID)
+	if err != nil {
+		return err
+	}
+	if !host {
+		return ErrLobbyPermission
+	}
+	if err := l.canActOn(byID, userID); err != nil {
+		return err
+	}
+
+	if err := l.setHost(userID); err != nil {
+		return err
+	}
+	return l.s.SetLobbyCoHost(l.id, byID, true)
+}
+
+// usernames gets the usernames of the users
+func (l *Lobby) usernames(ids []int64) ([]string, error) {
+	names := []string{}
+	for _, id := range ids {
+		u, err := l.s.GetUser(id)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, u.Username)
+	}
+	return names, nil
+}
+
+// GetCoHosts gets the co-hosts' usernames
+func (l *Lobby) GetCoHosts() ([]string, error) {
+	ids, err := l.s.ListLobbyCoHosts(l.id)
+	if err != nil {
+		return nil, err
+	}
+	return l.usernames(ids)
+}
+
+// GetBans gets the usernames of the users banned from the lobby
+func (l *Lobby) GetBans() ([]string, error) {
+	ids, err := l.s.ListLobbyBans(l.id)
+	if err != nil {
+		return nil, err
+	}
+	return l.usernames(ids)
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
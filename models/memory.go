@@ -0,0 +1,1373 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store kept in the process memory, meant for development and tests
+type MemoryStore struct {
+	mu sync.Mutex
+
+	users           map[int64]*UserRecord
+	usersByUsername map[string]int64
+
+	questions            map[int64]*QuestionT
+	questionsByStatement map[string]int64
+	questionIDs          []int64
+
+	userQuestions       map[int64]*UserQuestionRecord
+	userQuestionsByUser map[int64]int64
+	askedQuestionIDs    map[int64][]int64
+	misses              map[int64]map[int64]int64
+	timedOut            map[int64][]int64
+
+	lobbies       map[int64]*LobbyRecord
+	lobbiesByCode map[string]int64
+	lobbyMembers  map[int64][]int64
+	lobbyCoHosts  map[int64]map[int64]bool
+	lobbyBans     map[int64]map[int64]bool
+	lobbyReady    map[int64]map[int64]bool
+
+	updates       map[int64]*UpdateRecord
+	updateIDs     []int64
+	userUpdateIDs map[int64][]int64
+
+	scores map[int64]int64
+
+	answers map[int64][]AnswerRecord
+
+	cards map[int64]map[int64]CardRecord
+
+	quizzes      map[int64]*QuizT
+	quizIDs      []int64
+	quizProgress map[int64]map[int64]*QuizProgressRecord
+
+	games       map[int64]*GameRecord
+	gamePlayers map[int64]map[int64]*GamePlayerRecord
+
+	chats      map[int64][]ChatRecord
+	lobbyMutes map[int64]map[int64]bool
+
+	nextUserID, nextQuestionID, nextUserQuestionID, nextLobbyID, nextUpdateID, nextAnswerID, nextQuizID, nextChatID int64
+}
+
+// NewMemoryStore creates an empty in-memory Store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:                map[int64]*UserRecord{},
+		usersByUsername:      map[string]int64{},
+		questions:            map[int64]*QuestionT{},
+		questionsByStatement: map[string]int64{},
+		userQuestions:        map[int64]*UserQuestionRecord{},
+		userQuestionsByUser:  map[int64]int64{},
+		askedQuestionIDs:     map[int64][]int64{},
+		misses:               map[int64]map[int64]int64{},
+		timedOut:             map[int64][]int64{},
+		lobbies:              map[int64]*LobbyRecord{},
+		lobbiesByCode:        map[string]int64{},
+		lobbyMembers:         map[int64][]int64{},
+		lobbyCoHosts:         map[int64]map[int64]bool{},
+		lobbyBans:            map[int64]map[int64]bool{},
+		lobbyReady:           map[int64]map[int64]bool{},
+		updates:              map[int64]*UpdateRecord{},
+		userUpdateIDs:        map[int64][]int64{},
+		scores:               map[int64]int64{},
+		answers:              map[int64][]AnswerRecord{},
+		cards:                map[int64]map[int64]CardRecord{},
+		quizzes:              map[int64]*QuizT{},
+		quizProgress:         map[int64]map[int64]*QuizProgressRecord{},
+		games:                map[int64]*GameRecord{},
+		gamePlayers:          map[int64]map[int64]*GamePlayerRecord{},
+		chats:                map[int64][]ChatRecord{},
+		lobbyMutes:           map[int64]map[int64]bool{},
+	}
+}
+
+// prepend mimics the redis LPUSH so the latest entries come first
+func prepend(ids []int64, id int64) []int64 {
+	return append([]int64{id}, ids...)
+}
+
+func firstN(ids []int64, count int64) []int64 {
+	if count < 0 || count > int64(len(ids)) {
+		count = int64(len(ids))
+	}
+	return append([]int64{}, ids[:count]...)
+}
+
+// copyQuestion keeps the stored question apart from the callers' slices
+func copyQuestion(q *QuestionT) *QuestionT {
+	cp := *q
+	cp.Choices = append([]string(nil), q.Choices...)
+	cp.Tags = append([]string(nil), q.Tags...)
+	cp.Answers = append([]string(nil), q.Answers...)
+	cp.Links = append([]string(nil), q.Links...)
+	return &cp
+}
+
+// CreateUser implements UserStore
+func (s *MemoryStore) CreateUser(username string, hash []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.usersByUsername[username]; ok {
+		return 0, ErrUsernameTaken
+	}
+
+	s.nextUserID++
+	id := s.nextUserID
+	s.users[id] = &UserRecord{
+		ID:       id,
+		Username: username,
+		Hash:     append([]byte{}, hash...),
+		LobbyID:  -1,
+	}
+	s.usersByUsername[username] = id
+	return id, nil
+}
+
+// GetUser implements UserStore
+func (s *MemoryStore) GetUser(id int64) (*UserRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+// GetUserIDByUsername implements UserStore
+func (s *MemoryStore) GetUserIDByUsername(username string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.usersByUsername[username]
+	if !ok {
+		return 0, ErrUserNotFound
+	}
+	return id, nil
+}
+
+// CreateQuestion implements QuestionStore
+func (s *MemoryStore) CreateQuestion(q *QuestionT) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.questionsByStatement[q.Statement]; ok {
+		return 0, ErrQuestionDuplicate
+	}
+
+	s.nextQuestionID++
+	id := s.nextQuestionID
+	s.questions[id] = copyQuestion(q)
+	s.questionsByStatement[q.Statement] = id
+	s.questionIDs = prepend(s.questionIDs, id)
+	return id, nil
+}
+
+// GetQuestion implements QuestionStore
+func (s *MemoryStore) GetQuestion(id int64) (*QuestionT, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.questions[id]
+	if !ok {
+		return nil, ErrQuestionNotFound
+	}
+	return copyQuestion(q), nil
+}
+
+// ListQuestionIDs implements QuestionStore
+func (s *MemoryStore) ListQuestionIDs() ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return firstN(s.questionIDs, -1), nil
+}
+
+// ListCategoryQuestionIDs implements QuestionStore
+func (s *MemoryStore) ListCategoryQuestionIDs(category string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []int64{}
+	for _, id := range s.questionIDs {
+		if strings.EqualFold(s.questions[id].Category, category) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// ListCategories implements QuestionStore
+func (s *MemoryStore) ListCategories() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[string]bool{}
+	categories := []string{}
+	for _, q := range s.questions {
+		if q.Category != "" && !seen[q.Category] {
+			seen[q.Category] = true
+			categories = append(categories, q.Category)
+		}
+	}
+	return categories, nil
+}
+
+// UpdateQuestion implements QuestionStore
+func (s *MemoryStore) UpdateQuestion(id int64, q *QuestionT) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.questions[id]
+	if !ok {
+		return ErrQuestionNotFound
+	}
+	if other, ok := s.questionsByStatement[q.Statement]; ok && other != id {
+		return ErrQuestionDuplicate
+	}
+
+	delete(s.questionsByStatement, old.Statement)
+	s.questions[id] = copyQuestion(q)
+	s.questionsByStatement[q.Statement] = id
+	return nil
+}
+
+// DeleteQuestion implements QuestionStore
+func (s *MemoryStore) DeleteQuestion(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.questions[id]
+	if !ok {
+		return ErrQuestionNotFound
+	}
+
+	delete(s.questions, id)
+	delete(s.questionsByStatement, q.Statement)
+	for i, qid := range s.questionIDs {
+		if qid == id {
+			s.questionIDs = append(s.questionIDs[:i:i], s.questionIDs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// CreateUserQuestion implements UserQuestionStore
+func (s *MemoryStore) CreateUserQuestion(userID, questionID int64, category string, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextUserQuestionID++
+	id := s.nextUserQuestionID
+	s.userQuestions[id] = &UserQuestionRecord{
+		ID:         id,
+		UserID:     userID,
+		QuestionID: questionID,
+		StartedAt:  at,
+		AssignedAt: at,
+		Category:   category,
+	}
+	s.userQuestionsByUser[userID] = id
+	s.askedQuestionIDs[userID] = []int64{questionID}
+	s.misses[id] = map[int64]int64{}
+	return id, nil
+}
+
+// GetUserQuestion implements UserQuestionStore
+func (s *MemoryStore) GetUserQuestion(id int64) (*UserQuestionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return nil, ErrEmptyUserQuestion
+	}
+	cp := *uq
+	cp.Hidden = append([]string(nil), uq.Hidden...)
+	return &cp, nil
+}
+
+// GetUserQuestionIDByUserID implements UserQuestionStore
+func (s *MemoryStore) GetUserQuestionIDByUserID(userID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.userQuestionsByUser[userID]
+	if !ok {
+		return 0, ErrEmptyUserQuestion
+	}
+	return id, nil
+}
+
+// ListAskedQuestionIDs implements UserQuestionStore
+func (s *MemoryStore) ListAskedQuestionIDs(userID int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return firstN(s.askedQuestionIDs[userID], -1), nil
+}
+
+// AssignQuestion implements UserQuestionStore
+func (s *MemoryStore) AssignQuestion(id, questionID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return ErrEmptyUserQuestion
+	}
+	uq.QuestionID = questionID
+	uq.Hidden = nil
+	uq.Hinted = false
+	s.askedQuestionIDs[uq.UserID] = prepend(s.askedQuestionIDs[uq.UserID], questionID)
+	return nil
+}
+
+// AddPoints implements UserQuestionStore
+func (s *MemoryStore) AddPoints(id, amount int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return 0, ErrEmptyUserQuestion
+	}
+	uq.Points += amount
+	return uq.Points, nil
+}
+
+// AdvanceUserQuestion implements UserQuestionStore
+func (s *MemoryStore) AdvanceUserQuestion(id, fromQuestionID, nextQuestionID, amount int64, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return 0, ErrEmptyUserQuestion
+	}
+	if uq.QuestionID != fromQuestionID {
+		return 0, ErrStaleAnswer
+	}
+	uq.Attempts++
+	uq.Points += amount
+	uq.Streak++
+	uq.QuestionID = nextQuestionID
+	uq.AssignedAt = at
+	uq.Deadline = time.Time{}
+	uq.Hidden = nil
+	uq.Hinted = false
+	if nextQuestionID == 0 {
+		uq.FinishedAt = at
+	} else {
+		s.askedQuestionIDs[uq.UserID] = prepend(s.askedQuestionIDs[uq.UserID], nextQuestionID)
+	}
+	s.scores[uq.UserID] = uq.Points
+	return uq.Points, nil
+}
+
+// SkipQuestion implements UserQuestionStore
+func (s *MemoryStore) SkipQuestion(id, fromQuestionID, nextQuestionID int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return ErrEmptyUserQuestion
+	}
+	if uq.QuestionID != fromQuestionID {
+		return ErrStaleAnswer
+	}
+	uq.QuestionID = nextQuestionID
+	uq.AssignedAt = at
+	uq.Deadline = time.Time{}
+	uq.Hidden = nil
+	uq.Hinted = false
+	if nextQuestionID == 0 {
+		uq.FinishedAt = at
+	} else {
+		s.askedQuestionIDs[uq.UserID] = prepend(s.askedQuestionIDs[uq.UserID], nextQuestionID)
+	}
+	return nil
+}
+
+// TimeOutQuestion implements UserQuestionStore
+func (s *MemoryStore) TimeOutQuestion(id, fromQuestionID, nextQuestionID, penalty int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return ErrEmptyUserQuestion
+	}
+	if uq.QuestionID != fromQuestionID {
+		return ErrStaleAnswer
+	}
+	uq.QuestionID = nextQuestionID
+	uq.AssignedAt = at
+	uq.Deadline = time.Time{}
+	uq.Hidden = nil
+	uq.Hinted = false
+	uq.Streak = 0
+	if nextQuestionID == 0 {
+		uq.FinishedAt = at
+	} else {
+		s.askedQuestionIDs[uq.UserID] = prepend(s.askedQuestionIDs[uq.UserID], nextQuestionID)
+	}
+	s.timedOut[id] = append(s.timedOut[id], fromQuestionID)
+	if penalty != 0 {
+		uq.Points -= penalty
+		s.scores[uq.UserID] = uq.Points
+	}
+	return nil
+}
+
+// ListTimedOut implements UserQuestionStore
+func (s *MemoryStore) ListTimedOut(id int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int64(nil), s.timedOut[id]...), nil
+}
+
+// ServeQuestion implements UserQuestionStore
+func (s *MemoryStore) ServeQuestion(id, questionID int64, deadline, examDeadline time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return ErrEmptyUserQuestion
+	}
+	if uq.QuestionID != questionID {
+		return ErrStaleAnswer
+	}
+	if uq.Deadline.IsZero() {
+		uq.Deadline = deadline
+	}
+	if uq.ExamDeadline.IsZero() {
+		uq.ExamDeadline = examDeadline
+	}
+	return nil
+}
+
+// RecordMiss implements UserQuestionStore
+func (s *MemoryStore) RecordMiss(id, questionID, penalty int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return ErrEmptyUserQuestion
+	}
+	if uq.QuestionID != questionID {
+		return ErrStaleAnswer
+	}
+	uq.Attempts++
+	uq.Streak = 0
+	s.misses[id][questionID]++
+	if penalty != 0 {
+		uq.Points -= penalty
+		s.scores[uq.UserID] = uq.Points
+	}
+	return nil
+}
+
+// ListMisses implements UserQuestionStore
+func (s *MemoryStore) ListMisses(id int64) (map[int64]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	misses := map[int64]int64{}
+	for q, n := range s.misses[id] {
+		misses[q] = n
+	}
+	return misses, nil
+}
+
+// UseFiftyFifty implements UserQuestionStore
+func (s *MemoryStore) UseFiftyFifty(id, questionID, limit int64, hidden []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return ErrEmptyUserQuestion
+	}
+	if uq.QuestionID != questionID {
+		return ErrStaleAnswer
+	}
+	if len(uq.Hidden) > 0 {
+		return ErrLifelineUsed
+	}
+	if uq.FiftyFifties >= limit {
+		return ErrNoLifelines
+	}
+	uq.FiftyFifties++
+	uq.Hidden = append([]string(nil), hidden...)
+	return nil
+}
+
+// UseHint implements UserQuestionStore
+func (s *MemoryStore) UseHint(id, questionID, limit int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uq, ok := s.userQuestions[id]
+	if !ok {
+		return ErrEmptyUserQuestion
+	}
+	if uq.QuestionID != questionID {
+		return ErrStaleAnswer
+	}
+	if uq.Hinted {
+		return ErrLifelineUsed
+	}
+	if uq.Hints >= limit {
+		return ErrNoLifelines
+	}
+	uq.Hints++
+	uq.Hinted = true
+	return nil
+}
+
+// CreateLobby implements LobbyStore
+func (s *MemoryStore) CreateLobby(hostID int64, code string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lobbiesByCode[code]; ok {
+		return 0, ErrLobbyCodeTaken
+	}
+	s.nextLobbyID++
+	id := s.nextLobbyID
+	s.lobbies[id] = &LobbyRecord{
+		ID:       id,
+		Code:     code,
+		HostID:   hostID,
+		Status:   StatusWaiting,
+		ActiveAt: time.Now(),
+	}
+	s.lobbiesByCode[code] = id
+	s.lobbyMembers[id] = []int64{hostID}
+	if u, ok := s.users[hostID]; ok {
+		u.LobbyID = id
+	}
+	return id, nil
+}
+
+// GetLobby implements LobbyStore
+func (s *MemoryStore) GetLobby(id int64) (*LobbyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return nil, ErrLobbyNotFound
+	}
+	cp := *l
+	return &cp, nil
+}
+
+// GetLobbyIDByCode implements LobbyStore
+func (s *MemoryStore) GetLobbyIDByCode(code string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.lobbiesByCode[code]
+	if !ok {
+		return 0, ErrLobbyNotFound
+	}
+	return id, nil
+}
+
+// SetLobbyHost implements LobbyStore
+func (s *MemoryStore) SetLobbyHost(id, hostID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	l.HostID = hostID
+	return nil
+}
+
+// SetLobbyStartsAt implements LobbyStore
+func (s *MemoryStore) SetLobbyStartsAt(id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	l.StartsAt = at
+	return nil
+}
+
+// SetLobbyStatus implements LobbyStore
+func (s *MemoryStore) SetLobbyStatus(id, status int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	l.Status = status
+	return nil
+}
+
+// AddLobbyMember implements LobbyStore
+func (s *MemoryStore) AddLobbyMember(id, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member := false
+	for _, m := range s.lobbyMembers[id] {
+		member = member || m == userID
+	}
+	if !member {
+		if l, ok := s.lobbies[id]; ok && l.Settings.MaxPlayers > 0 &&
+			int64(len(s.lobbyMembers[id])) >= l.Settings.MaxPlayers {
+			return ErrLobbyFull
+		}
+		s.lobbyMembers[id] = append(s.lobbyMembers[id], userID)
+	}
+	if u, ok := s.users[userID]; ok {
+		u.LobbyID = id
+	}
+	return nil
+}
+
+// ListPublicLobbyIDs implements LobbyStore
+func (s *MemoryStore) ListPublicLobbyIDs() ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []int64{}
+	for id, l := range s.lobbies {
+		if l.Settings.Public && l.Status == StatusWaiting {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// SetLobbySettings implements LobbyStore
+func (s *MemoryStore) SetLobbySettings(id int64, settings LobbySettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	l.Settings = settings
+	return nil
+}
+
+// RemoveLobbyMember implements LobbyStore
+func (s *MemoryStore) RemoveLobbyMember(id, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userID]; ok {
+		u.LobbyID = -1
+	}
+	delete(s.lobbyCoHosts[id], userID)
+	delete(s.lobbyReady[id], userID)
+	members := s.lobbyMembers[id]
+	for i, m := range members {
+		if m == userID {
+			s.lobbyMembers[id] = append(members[:i:i], members[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// SwapLobbyStatus implements LobbyStore
+func (s *MemoryStore) SwapLobbyStatus(id, from, to int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	if l.Status != from {
+		return ErrLobbyStatus
+	}
+	l.Status = to
+	return nil
+}
+
+// IsLobbyMember implements LobbyStore
+func (s *MemoryStore) IsLobbyMember(id, userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.lobbyMembers[id] {
+		if m == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListLobbyMembers implements LobbyStore
+func (s *MemoryStore) ListLobbyMembers(id int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return firstN(s.lobbyMembers[id], -1), nil
+}
+
+// setFlag adds the id to the lobby's set of flagged ids or removes it
+func setFlag(flags map[int64]map[int64]bool, id, userID int64, on bool) {
+	if !on {
+		delete(flags[id], userID)
+		return
+	}
+	if flags[id] == nil {
+		flags[id] = map[int64]bool{}
+	}
+	flags[id][userID] = true
+}
+
+// flagged lists the lobby's flagged ids in order
+func flagged(flags map[int64]map[int64]bool, id int64) []int64 {
+	ids := []int64{}
+	for userID := range flags[id] {
+		ids = append(ids, userID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// SetLobbyCoHost implements LobbyStore
+func (s *MemoryStore) SetLobbyCoHost(id, userID int64, cohost bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFlag(s.lobbyCoHosts, id, userID, cohost)
+	return nil
+}
+
+// ListLobbyCoHosts implements LobbyStore
+func (s *MemoryStore) ListLobbyCoHosts(id int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return flagged(s.lobbyCoHosts, id), nil
+}
+
+// SetLobbyReady implements LobbyStore
+func (s *MemoryStore) SetLobbyReady(id, userID int64, ready bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFlag(s.lobbyReady, id, userID, ready)
+	return nil
+}
+
+// ListLobbyReady implements LobbyStore
+func (s *MemoryStore) ListLobbyReady(id int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return flagged(s.lobbyReady, id), nil
+}
+
+// SetLobbyBan implements LobbyStore
+func (s *MemoryStore) SetLobbyBan(id, userID int64, banned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFlag(s.lobbyBans, id, userID, banned)
+	return nil
+}
+
+// IsLobbyBanned implements LobbyStore
+func (s *MemoryStore) IsLobbyBanned(id, userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lobbyBans[id][userID], nil
+}
+
+// ListLobbyBans implements LobbyStore
+func (s *MemoryStore) ListLobbyBans(id int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return flagged(s.lobbyBans, id), nil
+}
+
+// TouchLobby implements LobbyStore
+func (s *MemoryStore) TouchLobby(id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	l.ActiveAt = at
+	return nil
+}
+
+// ListIdleLobbyIDs implements LobbyStore
+func (s *MemoryStore) ListIdleLobbyIDs(before time.Time) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []int64{}
+	for id, l := range s.lobbies {
+		if l.ActiveAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// DeleteLobby implements LobbyStore
+func (s *MemoryStore) DeleteLobby(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lobbies[id]
+	if !ok {
+		return nil
+	}
+	for _, m := range s.lobbyMembers[id] {
+		if u, ok := s.users[m]; ok && u.LobbyID == id {
+			u.LobbyID = -1
+		}
+	}
+	if s.lobbiesByCode[l.Code] == id {
+		delete(s.lobbiesByCode, l.Code)
+	}
+	delete(s.lobbies, id)
+	delete(s.lobbyMembers, id)
+	delete(s.lobbyCoHosts, id)
+	delete(s.lobbyBans, id)
+	delete(s.lobbyReady, id)
+	delete(s.lobbyMutes, id)
+	delete(s.chats, id)
+	delete(s.games, id)
+	delete(s.gamePlayers, id)
+	return nil
+}
+
+// ResetStaleUserLobbies implements LobbyStore
+func (s *MemoryStore) ResetStaleUserLobbies() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, u := range s.users {
+		if u.LobbyID == -1 {
+			continue
+		}
+		member := false
+		for _, m := range s.lobbyMembers[u.LobbyID] {
+			member = member || m == id
+		}
+		if !member {
+			u.LobbyID = -1
+			n++
+		}
+	}
+	return n, nil
+}
+
+// CreateUpdate implements UpdateStore
+func (s *MemoryStore) CreateUpdate(userID int64, body string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextUpdateID++
+	id := s.nextUpdateID
+	s.updates[id] = &UpdateRecord{ID: id, UserID: userID, Body: body}
+	s.updateIDs = prepend(s.updateIDs, id)
+	s.userUpdateIDs[userID] = prepend(s.userUpdateIDs[userID], id)
+	return id, nil
+}
+
+// GetUpdate implements UpdateStore
+func (s *MemoryStore) GetUpdate(id int64) (*UpdateRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.updates[id]
+	if !ok {
+		return nil, ErrUpdateNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+// ListUpdateIDs implements UpdateStore
+func (s *MemoryStore) ListUpdateIDs(count int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return firstN(s.updateIDs, count), nil
+}
+
+// ListUserUpdateIDs implements UpdateStore
+func (s *MemoryStore) ListUserUpdateIDs(userID, count int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return firstN(s.userUpdateIDs[userID], count), nil
+}
+
+// SetScore implements RankStore
+func (s *MemoryStore) SetScore(userID, score int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scores[userID] = score
+	return nil
+}
+
+// sortedScores orders the leaderboard the way a redis sorted set does
+func (s *MemoryStore) sortedScores() []ScoreRecord {
+	scores := make([]ScoreRecord, 0, len(s.scores))
+	for id, score := range s.scores {
+		scores = append(scores, ScoreRecord{UserID: id, Score: score})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score < scores[j].Score
+		}
+		return scores[i].UserID < scores[j].UserID
+	})
+	return scores
+}
+
+// scoreRange slices the scores by an inclusive range with redis' negative index rules
+func scoreRange(scores []ScoreRecord, start, stop int64) []ScoreRecord {
+	n := int64(len(scores))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []ScoreRecord{}
+	}
+	return scores[start : stop+1]
+}
+
+// GetRank implements RankStore
+func (s *MemoryStore) GetRank(userID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, score := range s.sortedScores() {
+		if score.UserID == userID {
+			return int64(i), nil
+		}
+	}
+	return 0, ErrUserNotRanked
+}
+
+// ListScores implements RankStore
+func (s *MemoryStore) ListScores(start, stop int64) ([]ScoreRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return scoreRange(s.sortedScores(), start, stop), nil
+}
+
+// ListTopScores implements RankStore
+func (s *MemoryStore) ListTopScores(start, stop int64) ([]ScoreRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scores := s.sortedScores()
+	for i, j := 0, len(scores)-1; i < j; i, j = i+1, j-1 {
+		scores[i], scores[j] = scores[j], scores[i]
+	}
+	return scoreRange(scores, start, stop), nil
+}
+
+// CreateAnswer implements AnswerStore
+func (s *MemoryStore) CreateAnswer(a *AnswerRecord) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextAnswerID++
+	cp := *a
+	cp.ID = s.nextAnswerID
+	s.answers[a.UserID] = append(s.answers[a.UserID], cp)
+	return cp.ID, nil
+}
+
+// ListAnswers implements AnswerStore
+func (s *MemoryStore) ListAnswers(userID, offset, count int64) ([]AnswerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	answers := []AnswerRecord{}
+	all := s.answers[userID]
+	for i := int64(len(all)) - 1 - offset; i >= 0 && int64(len(answers)) < count; i-- {
+		answers = append(answers, all[i])
+	}
+	return answers, nil
+}
+
+// CountAnswers implements AnswerStore
+func (s *MemoryStore) CountAnswers(userID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.answers[userID])), nil
+}
+
+// SaveCard implements StudyStore
+func (s *MemoryStore) SaveCard(c *CardRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cards[c.UserID] == nil {
+		s.cards[c.UserID] = map[int64]CardRecord{}
+	}
+	s.cards[c.UserID][c.QuestionID] = *c
+	return nil
+}
+
+// GetCard implements StudyStore
+func (s *MemoryStore) GetCard(userID, questionID int64) (*CardRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cards[userID][questionID]
+	if !ok {
+		return nil, ErrCardNotFound
+	}
+	return &c, nil
+}
+
+// ListCards implements StudyStore
+func (s *MemoryStore) ListCards(userID int64) ([]CardRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cards := []CardRecord{}
+	for _, c := range s.cards[userID] {
+		cards = append(cards, c)
+	}
+	sortCards(cards)
+	return cards, nil
+}
+
+func copyQuiz(q *QuizT) *QuizT {
+	cp := *q
+	cp.QuestionIDs = append([]int64(nil), q.QuestionIDs...)
+	return &cp
+}
+
+// CreateQuiz implements QuizStore
+func (s *MemoryStore) CreateQuiz(q *QuizT) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextQuizID++
+	id := s.nextQuizID
+	s.quizzes[id] = copyQuiz(q)
+	s.quizIDs = append(s.quizIDs, id)
+	return id, nil
+}
+
+// GetQuiz implements QuizStore
+func (s *MemoryStore) GetQuiz(id int64) (*QuizT, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quizzes[id]
+	if !ok {
+		return nil, ErrQuizNotFound
+	}
+	return copyQuiz(q), nil
+}
+
+// ListQuizIDs implements QuizStore
+func (s *MemoryStore) ListQuizIDs() ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int64{}, s.quizIDs...), nil
+}
+
+// UpdateQuiz implements QuizStore
+func (s *MemoryStore) UpdateQuiz(id int64, q *QuizT) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.quizzes[id]; !ok {
+		return ErrQuizNotFound
+	}
+	s.quizzes[id] = copyQuiz(q)
+	return nil
+}
+
+// DeleteQuiz implements QuizStore
+func (s *MemoryStore) DeleteQuiz(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.quizzes[id]; !ok {
+		return ErrQuizNotFound
+	}
+	delete(s.quizzes, id)
+	delete(s.quizProgress, id)
+	for i, v := range s.quizIDs {
+		if v == id {
+			s.quizIDs = append(s.quizIDs[:i:i], s.quizIDs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// StartQuiz implements QuizStore
+func (s *MemoryStore) StartQuiz(userID, quizID int64, questionIDs []int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.quizProgress[quizID] == nil {
+		s.quizProgress[quizID] = map[int64]*QuizProgressRecord{}
+	}
+	s.quizProgress[quizID][userID] = &QuizProgressRecord{
+		UserID:      userID,
+		QuizID:      quizID,
+		QuestionIDs: append([]int64(nil), questionIDs...),
+		StartedAt:   at,
+		AskedAt:     at,
+	}
+	return nil
+}
+
+// GetQuizProgress implements QuizStore
+func (s *MemoryStore) GetQuizProgress(userID, quizID int64) (*QuizProgressRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.quizProgress[quizID][userID]
+	if !ok {
+		return nil, ErrQuizNotStarted
+	}
+	cp := *p
+	cp.QuestionIDs = append([]int64(nil), p.QuestionIDs...)
+	return &cp, nil
+}
+
+func (s *MemoryStore) advanceQuiz(userID, quizID, position, points int64, correct, answered bool, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.quizProgress[quizID][userID]
+	if !ok {
+		return ErrQuizNotStarted
+	}
+	if p.Position != position {
+		return ErrStaleAnswer
+	}
+	p.Position++
+	p.AskedAt = at
+	if answered {
+		p.Answered++
+		p.Points += points
+		if correct {
+			p.Correct++
+			p.Streak++
+		} else {
+			p.Streak = 0
+		}
+	}
+	if p.Position >= int64(len(p.QuestionIDs)) {
+		p.FinishedAt = at
+	}
+	return nil
+}
+
+// AdvanceQuiz implements QuizStore
+func (s *MemoryStore) AdvanceQuiz(userID, quizID, position, points int64, correct bool, at time.Time) error {
+	return s.advanceQuiz(userID, quizID, position, points, correct, true, at)
+}
+
+// SkipQuizQuestion implements QuizStore
+func (s *MemoryStore) SkipQuizQuestion(userID, quizID, position int64, at time.Time) error {
+	return s.advanceQuiz(userID, quizID, position, 0, false, false, at)
+}
+
+// CreateGame implements GameStore
+func (s *MemoryStore) CreateGame(g *GameRecord, playerIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *g
+	cp.QuestionIDs = firstN(g.QuestionIDs, -1)
+	s.games[g.LobbyID] = &cp
+	players := map[int64]*GamePlayerRecord{}
+	for _, id := range playerIDs {
+		players[id] = &GamePlayerRecord{UserID: id, AnsweredRound: -1}
+	}
+	s.gamePlayers[g.LobbyID] = players
+	return nil
+}
+
+// GetGame implements GameStore
+func (s *MemoryStore) GetGame(lobbyID int64) (*GameRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[lobbyID]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	cp := *g
+	cp.QuestionIDs = firstN(g.QuestionIDs, -1)
+	return &cp, nil
+}
+
+// AnswerRound implements GameStore
+func (s *MemoryStore) AnswerRound(lobbyID, userID, round, points int64, correct bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[lobbyID]
+	if !ok {
+		return ErrGameNotFound
+	}
+	if g.Round != round || round >= int64(len(g.QuestionIDs)) {
+		return ErrStaleAnswer
+	}
+	p, ok := s.gamePlayers[lobbyID][userID]
+	if !ok {
+		return ErrNotPlaying
+	}
+	if p.AnsweredRound >= round {
+		return ErrAlreadyAnswered
+	}
+	p.AnsweredRound = round
+	p.Points += points
+	if correct {
+		p.Correct++
+	}
+	return nil
+}
+
+// AdvanceRound implements GameStore
+func (s *MemoryStore) AdvanceRound(lobbyID, round int64, startedAt, endsAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[lobbyID]
+	if !ok {
+		return ErrGameNotFound
+	}
+	if g.Round != round || round >= int64(len(g.QuestionIDs)) {
+		return ErrStaleAnswer
+	}
+	g.Round++
+	if g.Round >= int64(len(g.QuestionIDs)) {
+		g.EndedAt = startedAt
+		return nil
+	}
+	g.RoundStartedAt, g.RoundEndsAt = startedAt, endsAt
+	return nil
+}
+
+// ListGamePlayers implements GameStore
+func (s *MemoryStore) ListGamePlayers(lobbyID int64) ([]GamePlayerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	players := []GamePlayerRecord{}
+	for _, p := range s.gamePlayers[lobbyID] {
+		players = append(players, *p)
+	}
+	sortGamePlayers(players)
+	return players, nil
+}
+
+// AddChatMessage implements ChatStore
+func (s *MemoryStore) AddChatMessage(lobbyID int64, m *ChatRecord, limit int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextChatID++
+	cp := *m
+	cp.ID = s.nextChatID
+	chat := append(s.chats[lobbyID], cp)
+	if n := int64(len(chat)); n > limit {
+		chat = append([]ChatRecord{}, chat[n-limit:]...)
+	}
+	s.chats[lobbyID] = chat
+	return cp.ID, nil
+}
+
+// ListChatMessages implements ChatStore
+func (s *MemoryStore) ListChatMessages(lobbyID int64) ([]ChatRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]ChatRecord{}, s.chats[lobbyID]...), nil
+}
+
+// DeleteChatMessage implements ChatStore
+func (s *MemoryStore) DeleteChatMessage(lobbyID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chat := s.chats[lobbyID]
+	for i, m := range chat {
+		if m.ID == id {
+			s.chats[lobbyID] = append(chat[:i:i], chat[i+1:]...)
+			return nil
+		}
+	}
+	return ErrChatNotFound
+}
+
+// SetLobbyMute implements ChatStore
+func (s *MemoryStore) SetLobbyMute(lobbyID, userID int64, muted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFlag(s.lobbyMutes, lobbyID, userID, muted)
+	return nil
+}
+
+// ListLobbyMutes implements ChatStore
+func (s *MemoryStore) ListLobbyMutes(lobbyID int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return flagged(s.lobbyMutes, lobbyID), nil
+}
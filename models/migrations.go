@@ -0,0 +1,296 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// migration is a single versioned step of the sql schema, never edit one that has been released
+type migration struct {
+	version int
+	up      string
+}
+
+// migrations are applied in order, the placeholders are replaced per dialect:
+// {{serial}} an auto-incrementing primary key, {{blob}} a binary column
+var migrations = []migration{
+	{1, `
+CREATE TABLE users (
+	id {{serial}},
+	username TEXT NOT NULL UNIQUE,
+	hash {{blob}} NOT NULL,
+	lobby_id BIGINT NOT NULL DEFAULT -1
+);
+CREATE TABLE questions (
+	id {{serial}},
+	statement TEXT NOT NULL UNIQUE,
+	answer TEXT NOT NULL,
+	choices TEXT NOT NULL
+);
+CREATE TABLE user_questions (
+	id {{serial}},
+	user_id BIGINT NOT NULL,
+	question_id BIGINT NOT NULL,
+	points BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX user_questions_user_id ON user_questions (user_id);
+CREATE TABLE asked_questions (
+	id {{serial}},
+	user_id BIGINT NOT NULL,
+	question_id BIGINT NOT NULL
+);
+CREATE INDEX asked_questions_user_id ON asked_questions (user_id);
+CREATE TABLE lobbies (
+	id {{serial}},
+	code TEXT NOT NULL UNIQUE,
+	host_id BIGINT NOT NULL,
+	status BIGINT NOT NULL
+);
+CREATE TABLE lobby_members (
+	id {{serial}},
+	lobby_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	UNIQUE (lobby_id, user_id)
+);
+CREATE TABLE updates (
+	id {{serial}},
+	user_id BIGINT NOT NULL,
+	body TEXT NOT NULL
+);
+CREATE INDEX updates_user_id ON updates (user_id);
+CREATE TABLE leaderboard (
+	user_id BIGINT PRIMARY KEY,
+	score BIGINT NOT NULL
+);
+CREATE INDEX leaderboard_score ON leaderboard (score, user_id);
+`},
+	{2, `
+ALTER TABLE user_questions ADD COLUMN attempts BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_questions ADD COLUMN started_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_questions ADD COLUMN finished_at BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE user_question_misses (
+	user_question_id BIGINT NOT NULL,
+	question_id BIGINT NOT NULL,
+	misses BIGINT NOT NULL,
+	PRIMARY KEY (user_question_id, question_id)
+);
+`},
+	{3, `
+ALTER TABLE user_questions ADD COLUMN assigned_at BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE answers (
+	id {{serial}},
+	user_id BIGINT NOT NULL,
+	question_id BIGINT NOT NULL,
+	choice TEXT NOT NULL,
+	correct BOOLEAN NOT NULL,
+	answered_at BIGINT NOT NULL,
+	elapsed BIGINT NOT NULL
+);
+CREATE INDEX answers_user_id ON answers (user_id, id);
+`},
+	{4, `
+ALTER TABLE questions ADD COLUMN category TEXT NOT NULL DEFAULT '';
+ALTER TABLE questions ADD COLUMN tags TEXT NOT NULL DEFAULT 'null';
+ALTER TABLE user_questions ADD COLUMN category TEXT NOT NULL DEFAULT '';
+`},
+	{5, `
+ALTER TABLE questions ADD COLUMN type TEXT NOT NULL DEFAULT '';
+ALTER TABLE questions ADD COLUMN answers TEXT NOT NULL DEFAULT 'null';
+ALTER TABLE questions ADD COLUMN partial_credit BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE questions ADD COLUMN tolerance DOUBLE PRECISION NOT NULL DEFAULT 0;
+`},
+	{6, `
+ALTER TABLE questions ADD COLUMN explanation TEXT NOT NULL DEFAULT '';
+ALTER TABLE questions ADD COLUMN links TEXT NOT NULL DEFAULT 'null';
+`},
+	{7, `
+ALTER TABLE user_questions ADD COLUMN deadline BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_questions ADD COLUMN exam_deadline BIGINT NOT NULL DEFAULT 0;
+`},
+	{8, `
+CREATE TABLE cards (
+	user_id BIGINT NOT NULL,
+	question_id BIGINT NOT NULL,
+	box BIGINT NOT NULL,
+	reviews BIGINT NOT NULL,
+	lapses BIGINT NOT NULL,
+	due_at BIGINT NOT NULL,
+	reviewed_at BIGINT NOT NULL,
+	PRIMARY KEY (user_id, question_id)
+);
+CREATE INDEX cards_due_at ON cards (user_id, due_at);
+`},
+	{9, `
+CREATE TABLE quizzes (
+	id {{serial}},
+	title TEXT NOT NULL,
+	description TEXT NOT NULL,
+	question_ids TEXT NOT NULL,
+	shuffle BOOLEAN NOT NULL,
+	pass_mark BIGINT NOT NULL,
+	published BOOLEAN NOT NULL
+);
+CREATE TABLE quiz_progress (
+	user_id BIGINT NOT NULL,
+	quiz_id BIGINT NOT NULL,
+	question_ids TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	position BIGINT NOT NULL DEFAULT 0,
+	answered BIGINT NOT NULL DEFAULT 0,
+	correct BIGINT NOT NULL DEFAULT 0,
+	points BIGINT NOT NULL DEFAULT 0,
+	started_at BIGINT NOT NULL,
+	finished_at BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, quiz_id)
+);
+`},
+	{10, `
+ALTER TABLE questions ADD COLUMN difficulty BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_questions ADD COLUMN streak BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE quizzes ADD COLUMN scoring TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE quiz_progress ADD COLUMN streak BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE quiz_progress ADD COLUMN asked_at BIGINT NOT NULL DEFAULT 0;
+`},
+	{11, `
+ALTER TABLE questions ADD COLUMN hint TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_questions ADD COLUMN hidden TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE user_questions ADD COLUMN hinted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_questions ADD COLUMN fifty_fifties BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_questions ADD COLUMN hints BIGINT NOT NULL DEFAULT 0;
+`},
+	{12, `
+CREATE TABLE games (
+	lobby_id BIGINT PRIMARY KEY,
+	question_ids TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	round BIGINT NOT NULL DEFAULT 0,
+	round_started_at BIGINT NOT NULL DEFAULT 0,
+	round_ends_at BIGINT NOT NULL DEFAULT 0,
+	started_at BIGINT NOT NULL,
+	ended_at BIGINT NOT NULL DEFAULT 0
+);
+CREATE TABLE game_players (
+	lobby_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	points BIGINT NOT NULL DEFAULT 0,
+	correct BIGINT NOT NULL DEFAULT 0,
+	answered_round BIGINT NOT NULL DEFAULT -1,
+	PRIMARY KEY (lobby_id, user_id)
+);
+`},
+	{13, `
+ALTER TABLE lobby_members ADD COLUMN cohost BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE lobby_bans (
+	lobby_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	PRIMARY KEY (lobby_id, user_id)
+);
+`},
+	{14, `
+ALTER TABLE lobbies ADD COLUMN max_players BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE lobbies ADD COLUMN public BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE lobbies ADD COLUMN rounds BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE lobbies ADD COLUMN round_time BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE lobbies ADD COLUMN category TEXT NOT NULL DEFAULT '';
+`},
+	{15, `
+CREATE TABLE lobby_chats (
+	id {{serial}},
+	lobby_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	body TEXT NOT NULL,
+	sent_at BIGINT NOT NULL
+);
+CREATE INDEX lobby_chats_lobby_id ON lobby_chats (lobby_id);
+CREATE TABLE lobby_mutes (
+	lobby_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	PRIMARY KEY (lobby_id, user_id)
+);
+`},
+	{16, `
+ALTER TABLE lobbies ADD COLUMN active_at BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX lobbies_active_at ON lobbies (active_at);
+`},
+	{17, `
+ALTER TABLE lobby_members ADD COLUMN ready BOOLEAN NOT NULL DEFAULT FALSE;
+`},
+	{18, `
+CREATE TABLE user_question_timeouts (
+	user_question_id BIGINT NOT NULL,
+	question_id BIGINT NOT NULL,
+	PRIMARY KEY (user_question_id, question_id)
+);
+`},
+	{19, `
+ALTER TABLE lobbies ADD COLUMN starts_at BIGINT NOT NULL DEFAULT 0;
+`},
+	{20, `
+CREATE INDEX questions_category ON questions (LOWER(category));
+`},
+}
+
+// dialect holds the column types and the locking clause that differ between the sql servers
+type dialect struct {
+	serial string
+	blob   string
+	// forUpdate locks the selected rows until the transaction ends, sqlite has a single writer and needs none
+	forUpdate string
+}
+
+var dialects = map[string]dialect{
+	"sqlite3":  {serial: "INTEGER PRIMARY KEY AUTOINCREMENT", blob: "BLOB"},
+	"postgres": {serial: "BIGSERIAL PRIMARY KEY", blob: "BYTEA", forUpdate: "FOR UPDATE"},
+}
+
+func (d dialect) expand(query string) string {
+	return strings.NewReplacer(
+		"{{serial}}", d.serial,
+		"{{blob}}", d.blob,
+	).Replace(query)
+}
+
+// migrate applies every migration newer than the recorded schema version
+func migrate(db *sql.DB, d dialect) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, d, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, d dialect, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range strings.Split(d.expand(m.up), ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
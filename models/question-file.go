@@ -0,0 +1,246 @@
+package models
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvColumns is the column layout of a questions csv file, named as the csv tags of QuestionT
+// only statement is required, the columns can be in any order after the header
+var csvColumns = []string{
+	"statement", "type", "answer", "choices", "answers", "partial_credit", "tolerance",
+	"category", "tags", "explanation", "links", "difficulty", "hint",
+}
+
+// csvListSep separates the items of the list columns: choices, answers, tags and links
+const csvListSep = "|"
+
+// ErrCSVHeader gives error message when the header of a questions csv file cannot be read
+var ErrCSVHeader = errors.New("csv header must name the columns, statement is required: " + strings.Join(csvColumns, ","))
+
+// QuestionFileT is the layout of questions.json
+type QuestionFileT struct {
+	Questions []QuestionT `json:"questions"`
+}
+
+// RowErrorT is why a row of an imported file was not imported, the header of a csv file is row 1 and the rows of
+// a json file are its questions counted from 1
+type RowErrorT struct {
+	Row int
+	Err error
+}
+
+// ImportReportT is the outcome of importing a questions file
+type ImportReportT struct {
+	Created    int
+	Duplicates int
+	Errors     []RowErrorT
+}
+
+// Error lists the rows that were not imported so the report can be returned as an error when any failed
+func (r *ImportReportT) Error() string {
+	msgs := make([]string, len(r.Errors))
+	for i, e := range r.Errors {
+		msgs[i] = fmt.Sprintf("row %d: %v", e.Row, e.Err)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ImportQuestionsCSV validates and creates the questions of every row, the invalid rows are reported and skipped
+// and the statements already in the bank are counted as duplicates, see csvColumns for the layout
+func ImportQuestionsCSV(s Store, r io.Reader) (*ImportReportT, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	// the rows with missing or extra cells are reported instead of failing the whole file
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, ErrCSVHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cols := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !contains(csvColumns, name) {
+			return nil, fmt.Errorf("%w, unknown column %q", ErrCSVHeader, name)
+		}
+		cols[name] = i
+	}
+	if _, ok := cols["statement"]; !ok {
+		return nil, ErrCSVHeader
+	}
+
+	report := &ImportReportT{}
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if pe, ok := err.(*csv.ParseError); ok {
+			report.Errors = append(report.Errors, RowErrorT{Row: row, Err: pe.Err})
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		if len(record) != len(header) {
+			err := fmt.Errorf("row has %d cells, the header has %d", len(record), len(header))
+			report.Errors = append(report.Errors, RowErrorT{Row: row, Err: err})
+			continue
+		}
+
+		q, err := parseCSVQuestion(cols, record)
+		if err == nil {
+			_, err = AddQuestion(s, q)
+		}
+		switch err {
+		case nil:
+			report.Created++
+		case ErrQuestionDuplicate:
+			report.Duplicates++
+		default:
+			report.Errors = append(report.Errors, RowErrorT{Row: row, Err: err})
+		}
+	}
+	return report, nil
+}
+
+// ImportQuestionsJSON is ImportQuestionsCSV for the layout of questions.json
+func ImportQuestionsJSON(s Store, r io.Reader) (*ImportReportT, error) {
+	var qf QuestionFileT
+	if err := json.NewDecoder(r).Decode(&qf); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReportT{}
+	for i := range qf.Questions {
+		_, err := AddQuestion(s, &qf.Questions[i])
+		switch err {
+		case nil:
+			report.Created++
+		case ErrQuestionDuplicate:
+			report.Duplicates++
+		default:
+			report.Errors = append(report.Errors, RowErrorT{Row: i + 1, Err: err})
+		}
+	}
+	return report, nil
+}
+
+func parseCSVQuestion(cols map[string]int, record []string) (*QuestionT, error) {
+	cell := func(name string) string {
+		if i, ok := cols[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	list := func(name string) []string {
+		var vals []string
+		for _, v := range strings.Split(cell(name), csvListSep) {
+			if v = strings.TrimSpace(v); v != "" {
+				vals = append(vals, v)
+			}
+		}
+		return vals
+	}
+
+	q := &QuestionT{
+		Statement:   cell("statement"),
+		Type:        cell("type"),
+		Answer:      cell("answer"),
+		Choices:     list("choices"),
+		Answers:     list("answers"),
+		Category:    cell("category"),
+		Tags:        list("tags"),
+		Explanation: cell("explanation"),
+		Links:       list("links"),
+		Hint:        cell("hint"),
+	}
+
+	var err error
+	if v := cell("partial_credit"); v != "" {
+		if q.PartialCredit, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("partial_credit %q is not true or false", v)
+		}
+	}
+	if v := cell("tolerance"); v != "" {
+		if q.Tolerance, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("tolerance %q is not a number", v)
+		}
+	}
+	if v := cell("difficulty"); v != "" {
+		if q.Difficulty, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("difficulty %q is not a number", v)
+		}
+	}
+	return q, nil
+}
+
+// ListQuestions gets the whole question bank, oldest first
+func ListQuestions(s Store) ([]QuestionT, error) {
+	items, err := SearchQuestions(s, "")
+	if err != nil {
+		return nil, err
+	}
+
+	questions := make([]QuestionT, len(items))
+	for i, item := range items {
+		questions[i] = item.QuestionT
+	}
+	return questions, nil
+}
+
+// ExportQuestionsCSV writes the whole question bank in the layout ImportQuestionsCSV reads
+func ExportQuestionsCSV(s Store, w io.Writer) error {
+	questions, err := ListQuestions(s)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, q := range questions {
+		var tolerance, difficulty string
+		if q.Tolerance != 0 {
+			tolerance = strconv.FormatFloat(q.Tolerance, 'f', -1, 64)
+		}
+		if q.Difficulty != 0 {
+			difficulty = strconv.FormatInt(q.Difficulty, 10)
+		}
+		err := cw.Write([]string{
+			q.Statement, q.kind(), q.Answer,
+			strings.Join(q.Choices, csvListSep), strings.Join(q.Answers, csvListSep),
+			strconv.FormatBool(q.PartialCredit), tolerance,
+			q.Category, strings.Join(q.Tags, csvListSep), q.Explanation, strings.Join(q.Links, csvListSep),
+			difficulty, q.Hint,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportQuestionsJSON writes the whole question bank in the layout of questions.json
+func ExportQuestionsJSON(s Store, w io.Writer) error {
+	questions, err := ListQuestions(s)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(QuestionFileT{Questions: questions})
+}
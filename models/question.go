@@ -1,50 +1,80 @@
 package models
 
 import (
-	"encoding/json"
-	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // Question is a manager for accessing questions in the database
 type Question struct {
 	id int64
+	s  Store
 }
 
 // NewQuestion creates a new question, saves it to the database, and returns the newly created question
-func NewQuestion(statement, answer string, choices []string) error {
-	exists, err := client.HExists("question:by-statement", statement).Result()
-	if err != nil {
-		return err
-	}
-	if exists {
-		return ErrQuestionDuplicate
+func NewQuestion(s Store, q *QuestionT) error {
+	_, err := s.CreateQuestion(normalizeQuestion(q))
+	return err
+}
+
+// AddQuestion validates the question before saving it, unlike NewQuestion which trusts the migrated questions
+func AddQuestion(s Store, q *QuestionT) (int64, error) {
+	q = normalizeQuestion(q)
+	if err := validateQuestion(q); err != nil {
+		return 0, err
 	}
+	return s.CreateQuestion(q)
+}
 
-	id, err := client.Incr("question:next-id").Result()
-	if err != nil {
+// EditQuestion validates and replaces the question, the users currently given it keep it with the new content
+func EditQuestion(s Store, id int64, q *QuestionT) error {
+	q = normalizeQuestion(q)
+	if err := validateQuestion(q); err != nil {
 		return err
 	}
+	return s.UpdateQuestion(id, q)
+}
 
-	choicesBin, err := json.Marshal(choices)
-	if err != nil {
-		return err
+// normalizeQuestion trims the category, the explanation, the hint, the tags and the links and drops the empty tags and
+// links and the repeated tags, a true or false question gets the True and False choices with its answer as one of them
+func normalizeQuestion(q *QuestionT) *QuestionT {
+	cp := *q
+	cp.Category = strings.TrimSpace(q.Category)
+	cp.Tags = nil
+	for _, tag := range q.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !contains(cp.Tags, tag) {
+			cp.Tags = append(cp.Tags, tag)
+		}
 	}
 
-	key := fmt.Sprintf("question:%d", id)
-	pipe := client.Pipeline()
-	pipe.HSet(key, "id", id)
-	pipe.HSet(key, "statement", statement)
-	pipe.HSet(key, "answer", answer)
-	pipe.HSet(key, "choices", choicesBin)
-	pipe.HSet("question:by-statement", statement, id)
-	pipe.LPush("questions", id)
-	_, err = pipe.Exec()
-	if err != nil {
-		return err
+	cp.Explanation = strings.TrimSpace(q.Explanation)
+	cp.Hint = strings.TrimSpace(q.Hint)
+	cp.Links = nil
+	for _, link := range q.Links {
+		if link = strings.TrimSpace(link); link != "" {
+			cp.Links = append(cp.Links, link)
+		}
 	}
 
-	return nil
+	cp.Type = q.kind()
+	if cp.Type == TypeTrueFalse {
+		cp.Choices = []string{"True", "False"}
+		if b, err := strconv.ParseBool(strings.TrimSpace(q.Answer)); err == nil {
+			cp.Answer = cp.Choices[0]
+			if !b {
+				cp.Answer = cp.Choices[1]
+			}
+		}
+	}
+	return &cp
+}
+
+// DeleteQuestion removes the question from the bank, the users currently given it are moved on to another one
+// the next time they see the exam, see UserQuestion.SkipDeletedQuestion
+func DeleteQuestion(s Store, id int64) error {
+	return s.DeleteQuestion(id)
 }
 
 // GetQuestionID QuestionID getter
@@ -52,87 +82,158 @@ func (q *Question) GetQuestionID() int64 { return q.id }
 
 // GetStatement Statement getter
 func (q *Question) GetStatement() (string, error) {
-	key := fmt.Sprintf("question:%d", q.id)
-	return client.HGet(key, "statement").Result()
+	qt, err := q.s.GetQuestion(q.id)
+	if err != nil {
+		return "", err
+	}
+	return qt.Statement, nil
 }
 
 // GetAnswer Answer getter
 func (q *Question) GetAnswer() (string, error) {
-	key := fmt.Sprintf("question:%d", q.id)
-	return client.HGet(key, "answer").Result()
+	qt, err := q.s.GetQuestion(q.id)
+	if err != nil {
+		return "", err
+	}
+	return qt.Answer, nil
 }
 
 // GetChoices Choices getter
 func (q *Question) GetChoices() ([]string, error) {
-	key := fmt.Sprintf("question:%d", q.id)
-	b, err := client.HGet(key, "choices").Bytes()
+	qt, err := q.s.GetQuestion(q.id)
 	if err != nil {
 		return nil, err
 	}
+	return qt.Choices, nil
+}
 
-	var choices []string
-	if err := json.Unmarshal(b, &choices); err != nil {
-		return nil, err
+func toQuestions(s Store, ids []int64) []*Question {
+	questions := make([]*Question, len(ids))
+	for i, id := range ids {
+		questions[i] = &Question{id: id, s: s}
 	}
-
-	return choices, nil
+	return questions
 }
 
-func queryQuestions(key string) ([]*Question, error) {
-	questionIDs, err := client.LRange(key, 0, -1).Result()
+// GetAllQuestions All Updates getter
+func GetAllQuestions(s Store) ([]*Question, error) {
+	ids, err := s.ListQuestionIDs()
 	if err != nil {
 		return nil, err
 	}
-
-	questions := make([]*Question, len(questionIDs))
-	for i, val := range questionIDs {
-		id, err := strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		questions[i] = &Question{id: id}
-	}
-	return questions, nil
-}
-
-// GetAllQuestions All Updates getter
-func GetAllQuestions() ([]*Question, error) {
-	return queryQuestions("questions")
+	return toQuestions(s, ids), nil
 }
 
 // GetQuestions gets all updates related to the user
-func GetQuestions(userID int64) ([]*Question, error) {
-	key := fmt.Sprintf("user:%d:questions", userID)
-	return queryQuestions(key)
+func GetQuestions(s Store, userID int64) ([]*Question, error) {
+	ids, err := s.ListAskedQuestionIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return toQuestions(s, ids), nil
 }
 
-// QuestionT is a unit for the exam
+// QuestionT is a unit for the exam, see grade.go for how each type is answered
 type QuestionT struct {
 	Statement string   `csv:"statement" json:"statement"`
 	Answer    string   `csv:"answer" json:"answer"`
 	Choices   []string `csv:"choices" json:"choices"`
+	Category  string   `csv:"category" json:"category"`
+	Tags      []string `csv:"tags" json:"tags"`
+	// Type is one of the Type constants, empty is TypeSingle
+	Type string `csv:"type" json:"type"`
+	// Answers are the correct choices of TypeMultiple or the other accepted answers of TypeText
+	Answers []string `csv:"answers" json:"answers"`
+	// PartialCredit gives TypeMultiple a point for each correct choice instead of all or nothing, a fully right answer
+	// is worth as many points as there are Answers
+	PartialCredit bool `csv:"partial_credit" json:"partial_credit"`
+	// Tolerance is how far a TypeNumeric answer can be from Answer
+	Tolerance float64 `csv:"tolerance" json:"tolerance"`
+	// Explanation is shown once the question is answered, along with the Links to read more
+	Explanation string   `csv:"explanation" json:"explanation"`
+	Links       []string `csv:"links" json:"links"`
+	// Difficulty weighs the points when the scoring rules say so, from 1 easy to 5 hard, 0 is 1
+	Difficulty int64 `csv:"difficulty" json:"difficulty,omitempty"`
+	// Hint is shown before answering to the users who spend a lifeline on it
+	Hint string `csv:"hint" json:"hint,omitempty"`
 }
 
 // GetQuestion retrieves a whole struct of question from the database
 func GetQuestion(q *Question) (*QuestionT, error) {
-	s, err := q.GetStatement()
+	return q.s.GetQuestion(q.id)
+}
+
+// QuestionItemT is a question of the bank along with its id
+type QuestionItemT struct {
+	ID int64
+	QuestionT
+}
+
+// SearchQuestions lists the questions, oldest first, whose statement, answer, choices, category or tags contain the
+// query regardless of case, an empty query lists the whole bank
+func SearchQuestions(s Store, query string) ([]QuestionItemT, error) {
+	ids, err := s.ListQuestionIDs()
 	if err != nil {
 		return nil, err
 	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	items := []QuestionItemT{}
+	for _, id := range ids {
+		qt, err := s.GetQuestion(id)
+		if err == ErrQuestionNotFound {
+			// deleted while listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if query != "" && !matchQuestion(qt, query) {
+			continue
+		}
+		items = append(items, QuestionItemT{ID: id, QuestionT: *qt})
+	}
+	return items, nil
+}
 
-	c, err := q.GetChoices()
-	if err != nil {
-		return nil, err
+func matchQuestion(qt *QuestionT, query string) bool {
+	fields := append([]string{qt.Statement, qt.Answer, qt.Category}, qt.Choices...)
+	for _, f := range append(fields, qt.Tags...) {
+		if strings.Contains(strings.ToLower(f), query) {
+			return true
+		}
 	}
+	return false
+}
 
-	a, err := q.GetAnswer()
+// ListCategories lists the categories used by the questions in alphabetical order, a category spelled in several
+// cases is listed once
+func ListCategories(s Store) ([]string, error) {
+	all, err := s.ListCategories()
 	if err != nil {
 		return nil, err
 	}
+	sort.Slice(all, func(i, j int) bool {
+		if a, b := strings.ToLower(all[i]), strings.ToLower(all[j]); a != b {
+			return a < b
+		}
+		return all[i] < all[j]
+	})
 
-	return &QuestionT{
-		Statement: s,
-		Choices:   c,
-		Answer:    a,
-	}, nil
+	categories := []string{}
+	for _, c := range all {
+		if len(categories) == 0 || !strings.EqualFold(categories[len(categories)-1], c) {
+			categories = append(categories, c)
+		}
+	}
+	return categories, nil
+}
+
+// categoryQuestionIDs lists the questions of the category regardless of case, every question if it is empty
+func categoryQuestionIDs(s Store, category string) ([]int64, error) {
+	if category == "" {
+		return s.ListQuestionIDs()
+	}
+	return s.ListCategoryQuestionIDs(category)
 }
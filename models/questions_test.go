@@ -1,12 +1,30 @@
 package models
 
 import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestLoadQuestions(t *testing.T) {
-	NewRedisDB()
-	t.Log(MigrateQuestions(client, "../private/questions.json"))
+	s := NewMemoryStore()
+	if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+		t.Fatal(err)
+	}
+	// migrating twice must skip the duplicates
+	if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := GetUserQuestionsLen(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("not same: expected=%d, result=%d", 3, n)
+	}
 }
 
 func TestDiff(t *testing.T) {
@@ -21,3 +39,114 @@ func TestDiff(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadQuestionsCSV(t *testing.T) {
+	s := NewMemoryStore()
+	if err := MigrateQuestions(s, "../private-examples/questions.csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	csvQuestions, err := ListQuestions(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js := NewMemoryStore()
+	if err := MigrateQuestions(js, "../private-examples/questions.json"); err != nil {
+		t.Fatal(err)
+	}
+	jsonQuestions, err := ListQuestions(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(csvQuestions, jsonQuestions) {
+		t.Errorf("csv and json examples not same:\n%+v\n%+v", csvQuestions, jsonQuestions)
+	}
+}
+
+func TestImportQuestionsCSV(t *testing.T) {
+	s := NewMemoryStore()
+	if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	file := `Statement,Choices,Answer,Type,Tolerance
+What is 1 + 1?,1|2|3,2,,
+What is not part of United Kingdom?,Wales|Norway,Norway,,
+What is 2 + 2?,1|2|3,4,,
+What is pi?,,3.14,numeric,a bit
+What is e?,,2.72,numeric,0.01,extra
+"What is ""quoted""?",yes|no,yes,,
+`
+	report, err := ImportQuestionsCSV(s, strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 2 || report.Duplicates != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	rows := []int{}
+	for _, e := range report.Errors {
+		rows = append(rows, e.Row)
+	}
+	if !reflect.DeepEqual(rows, []int{4, 5, 6}) {
+		t.Errorf("rows not same: expected=%v, result=%v (%v)", []int{4, 5, 6}, rows, report)
+	}
+
+	if _, err := ImportQuestionsCSV(s, strings.NewReader("statement,points\n")); !errors.Is(err, ErrCSVHeader) {
+		t.Errorf("expected=%v, result=%v", ErrCSVHeader, err)
+	}
+}
+
+func TestExportQuestions(t *testing.T) {
+	s := NewMemoryStore()
+	if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := AddQuestion(s, &QuestionT{Statement: "Which are in Scandinavia?", Type: TypeMultiple,
+		Choices: []string{"Wales", "Norway", "Sweden"}, Answers: []string{"Norway", "Sweden"}, PartialCredit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = AddQuestion(s, &QuestionT{Statement: "What is pi?", Type: TypeNumeric, Answer: "3.14", Tolerance: 0.005})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ListQuestions(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var csvFile, jsonFile bytes.Buffer
+	if err := ExportQuestionsCSV(s, &csvFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportQuestionsJSON(s, &jsonFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, imp := range map[string]func(Store) (*ImportReportT, error){
+		"csv": func(s Store) (*ImportReportT, error) { return ImportQuestionsCSV(s, bytes.NewReader(csvFile.Bytes())) },
+		"json": func(s Store) (*ImportReportT, error) {
+			return ImportQuestionsJSON(s, bytes.NewReader(jsonFile.Bytes()))
+		},
+	} {
+		is := NewMemoryStore()
+		report, err := imp(is)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Created != len(expected) || len(report.Errors) != 0 {
+			t.Errorf("%s: unexpected report: %+v", name, report)
+		}
+		result, err := ListQuestions(is)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%s: questions not same:\n%+v\n%+v", name, expected, result)
+		}
+	}
+}
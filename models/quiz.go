@@ -0,0 +1,264 @@
+package models
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gocs/davy/validator"
+)
+
+// QuizT is a named set of questions from the bank
+type QuizT struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	QuestionIDs []int64 `json:"question_ids"`
+	// Shuffle asks the questions in a random order picked when each user starts the quiz, otherwise in the given order
+	Shuffle bool `json:"shuffle"`
+	// PassMark is the percentage of right answers needed to pass
+	PassMark int64 `json:"pass_mark"`
+	// Published quizzes are listed to the users and can be started
+	Published bool `json:"published"`
+	// Scoring gives the points of the answers, the zero value is the deployment's default
+	Scoring ScoringT `json:"scoring"`
+}
+
+// QuizItemT is a quiz with its id
+type QuizItemT struct {
+	ID int64
+	QuizT
+}
+
+// QuizResultT is how the user has done on a quiz so far
+type QuizResultT struct {
+	Answered int64
+	Correct  int64
+	Points   int64
+	// Score is the percentage of right answers
+	Score    float64
+	Passed   bool
+	Finished bool
+}
+
+// normalizeQuiz trims the title and the description and drops the repeated questions
+func normalizeQuiz(q *QuizT) *QuizT {
+	cp := *q
+	cp.Title = strings.TrimSpace(q.Title)
+	cp.Description = strings.TrimSpace(q.Description)
+	cp.QuestionIDs = nil
+	seen := map[int64]bool{}
+	for _, id := range q.QuestionIDs {
+		if !seen[id] {
+			seen[id] = true
+			cp.QuestionIDs = append(cp.QuestionIDs, id)
+		}
+	}
+	return &cp
+}
+
+func validateQuiz(s Store, q *QuizT) error {
+	if err := validator.Quiz(q.Title, len(q.QuestionIDs), q.PassMark); err != nil {
+		return err
+	}
+	if err := q.Scoring.Validate(); err != nil {
+		return err
+	}
+	for _, id := range q.QuestionIDs {
+		_, err := s.GetQuestion(id)
+		if err == ErrQuestionNotFound {
+			return ErrQuizQuestion
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddQuiz validates and saves the quiz, every question must be in the bank
+func AddQuiz(s Store, q *QuizT) (int64, error) {
+	q = normalizeQuiz(q)
+	if err := validateQuiz(s, q); err != nil {
+		return 0, err
+	}
+	return s.CreateQuiz(q)
+}
+
+// EditQuiz validates and replaces the quiz, the users who have started it keep the questions they were given
+func EditQuiz(s Store, id int64, q *QuizT) error {
+	q = normalizeQuiz(q)
+	if err := validateQuiz(s, q); err != nil {
+		return err
+	}
+	return s.UpdateQuiz(id, q)
+}
+
+// DeleteQuiz removes the quiz and everyone's progress through it
+func DeleteQuiz(s Store, id int64) error {
+	return s.DeleteQuiz(id)
+}
+
+// ListQuizzes gets the quizzes oldest first, only the published ones unless all is set
+func ListQuizzes(s Store, all bool) ([]QuizItemT, error) {
+	ids, err := s.ListQuizIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	quizzes := []QuizItemT{}
+	for _, id := range ids {
+		q, err := s.GetQuiz(id)
+		if err == ErrQuizNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if all || q.Published {
+			quizzes = append(quizzes, QuizItemT{ID: id, QuizT: *q})
+		}
+	}
+	return quizzes, nil
+}
+
+// GetPublishedQuiz gets the quiz as the users see it, ErrQuizNotFound is returned if it is not published
+func GetPublishedQuiz(s Store, id int64) (*QuizT, error) {
+	q, err := s.GetQuiz(id)
+	if err != nil {
+		return nil, err
+	}
+	if !q.Published {
+		return nil, ErrQuizNotFound
+	}
+	return q, nil
+}
+
+// StartQuiz starts the user's progress through the published quiz over, the questions deleted from the bank since
+// the quiz was written are left out
+func StartQuiz(s Store, userID, quizID int64) error {
+	q, err := GetPublishedQuiz(s, quizID)
+	if err != nil {
+		return err
+	}
+
+	ids := []int64{}
+	for _, id := range q.QuestionIDs {
+		_, err := s.GetQuestion(id)
+		if err == ErrQuestionNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return ErrEmptyQuiz
+	}
+	if q.Shuffle {
+		rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	}
+
+	return s.StartQuiz(userID, quizID, ids, time.Now())
+}
+
+// CurrentQuizQuestion gets the question the user is at in the quiz, skipping the ones deleted from the bank since
+// the quiz was started, the id is 0 once the quiz is finished
+func CurrentQuizQuestion(s Store, userID, quizID int64) (int64, *QuestionT, error) {
+	for {
+		p, err := s.GetQuizProgress(userID, quizID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if p.Position >= int64(len(p.QuestionIDs)) {
+			return 0, nil, nil
+		}
+
+		id := p.QuestionIDs[p.Position]
+		qt, err := s.GetQuestion(id)
+		if err == nil {
+			return id, qt, nil
+		}
+		if err != ErrQuestionNotFound {
+			return 0, nil, err
+		}
+
+		err = s.SkipQuizQuestion(userID, quizID, p.Position, time.Now())
+		if err != nil && err != ErrStaleAnswer {
+			return 0, nil, err
+		}
+	}
+}
+
+// AnswerQuiz grades the user's answer to the quiz question and moves on to the next one whether it is right or
+// not, questionID and choices are as in UserConfirmAnswer
+func AnswerQuiz(s Store, userID, quizID, questionID int64, choices ...string) (bool, error) {
+	return AnswerQuizScored(s, ScoringT{}, userID, quizID, questionID, choices...)
+}
+
+// AnswerQuizScored is AnswerQuiz with the points given by the quiz's scoring rules, or by def if the quiz has none
+func AnswerQuizScored(s Store, def ScoringT, userID, quizID, questionID int64, choices ...string) (bool, error) {
+	q, err := s.GetQuiz(quizID)
+	if err != nil {
+		return false, err
+	}
+	sc := q.Scoring
+	if sc == (ScoringT{}) {
+		sc = def
+	}
+
+	p, err := s.GetQuizProgress(userID, quizID)
+	if err != nil {
+		return false, err
+	}
+	if p.Position >= int64(len(p.QuestionIDs)) {
+		return false, ErrExamFinished
+	}
+	if questionID == 0 {
+		questionID = p.QuestionIDs[p.Position]
+	}
+	if questionID != p.QuestionIDs[p.Position] {
+		return false, ErrStaleAnswer
+	}
+
+	qt, err := s.GetQuestion(questionID)
+	if err == ErrQuestionNotFound {
+		// deleted from the bank, the user is moved on the next time they see the quiz
+		return false, ErrStaleAnswer
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	grade := qt.Grade(choices)
+	points := sc.Points(grade, qt, p.Streak, now.Sub(p.AskedAt))
+	if err := s.AdvanceQuiz(userID, quizID, p.Position, points, grade > 0, now); err != nil {
+		return false, err
+	}
+	return grade > 0, nil
+}
+
+// GetQuizResult gets how the user has done on the quiz against its pass mark
+func GetQuizResult(s Store, userID, quizID int64) (*QuizResultT, error) {
+	q, err := s.GetQuiz(quizID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.GetQuizProgress(userID, quizID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &QuizResultT{
+		Answered: p.Answered,
+		Correct:  p.Correct,
+		Points:   p.Points,
+		Finished: p.Position >= int64(len(p.QuestionIDs)),
+	}
+	if p.Answered > 0 {
+		res.Score = float64(p.Correct) / float64(p.Answered) * 100
+	}
+	res.Passed = res.Finished && p.Answered > 0 && p.Correct*100 >= q.PassMark*p.Answered
+	return res, nil
+}
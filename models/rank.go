@@ -1,24 +1,14 @@
 package models
 
-import (
-	"fmt"
-	"strconv"
-
-	"github.com/go-redis/redis"
-)
-
-const leaderboard = "leaderboard"
-
 // UpdateRank replaces the user's points with a new value
-func UpdateRank(userID, points int64) error {
-	z := redis.Z{Score: float64(points), Member: userID}
-	_, err := client.ZAdd(leaderboard, z).Result()
-	return err
+func UpdateRank(s Store, userID, points int64) error {
+	return s.SetScore(userID, points)
 }
 
 // GetRank returns the current rank of the user
-func GetRank(userID int64) int64 {
-	return client.ZRank(leaderboard, fmt.Sprint(userID)).Val()
+func GetRank(s Store, userID int64) int64 {
+	rank, _ := s.GetRank(userID)
+	return rank
 }
 
 // RankT is a simple data struct for a sorted leaderboard
@@ -28,19 +18,10 @@ type RankT struct {
 	Score int64
 }
 
-func listLeaderboard(z *redis.ZSliceCmd) ([]RankT, error) {
+func listLeaderboard(s Store, scores []ScoreRecord) ([]RankT, error) {
 	ut := []RankT{}
-	for i, data := range z.Val() {
-		s, ok := data.Member.(string)
-		if !ok {
-			return nil, ErrTypeMismatch
-		}
-		id, err := strconv.ParseInt(s, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-
-		u, err := GetUserByUserID(id)
+	for i, data := range scores {
+		u, err := GetUserByUserID(s, data.UserID)
 		if err != nil {
 			return nil, err
 		}
@@ -50,23 +31,32 @@ func listLeaderboard(z *redis.ZSliceCmd) ([]RankT, error) {
 			return nil, err
 		}
 
-		ut = append(ut, RankT{Rank: i + 1, Name: un, Score: int64(data.Score)})
+		ut = append(ut, RankT{Rank: i + 1, Name: un, Score: data.Score})
 	}
 	return ut, nil
 }
 
 // TopRanks lists the overall top 25
-func TopRanks() ([]RankT, error) {
-	z := client.ZRevRangeWithScores(leaderboard, 0, 24)
-	return listLeaderboard(z)
+func TopRanks(s Store) ([]RankT, error) {
+	scores, err := s.ListTopScores(0, 24)
+	if err != nil {
+		return nil, err
+	}
+	return listLeaderboard(s, scores)
 }
 
 // GetCurrentStandings list the raks of the 12 users above and below your current standing
-func GetCurrentStandings(userID int64) ([]RankT, error) {
-	zRank := client.ZRank(leaderboard, fmt.Sprint(userID))
-	lower := zRank.Val() - 12
-	upper := zRank.Val() + 12
+func GetCurrentStandings(s Store, userID int64) ([]RankT, error) {
+	rank := GetRank(s, userID)
+	lower := rank - 12
+	if lower < 0 {
+		lower = 0
+	}
+	upper := rank + 12
 
-	z := client.ZRangeWithScores(leaderboard, lower, upper)
-	return listLeaderboard(z)
+	scores, err := s.ListScores(lower, upper)
+	if err != nil {
+		return nil, err
+	}
+	return listLeaderboard(s, scores)
 }
@@ -0,0 +1,2061 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const leaderboard = "leaderboard"
+
+// RedisStore is a Store kept in redis hashes, lists, sets and a sorted set
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a Store using the given redis client
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// notFound replaces redis.Nil with the models' own not found error
+func notFound(err, replacement error) error {
+	if err == redis.Nil {
+		return replacement
+	}
+	return err
+}
+
+func parseIDs(vals []string) ([]int64, error) {
+	ids := make([]int64, len(vals))
+	for i, val := range vals {
+		id, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// CreateUser implements UserStore
+func (s *RedisStore) CreateUser(username string, hash []byte) (int64, error) {
+	exists, err := s.client.HExists("user:by-username", username).Result()
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrUsernameTaken
+	}
+
+	id, err := s.client.Incr("user:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+	key := fmt.Sprintf("user:%d", id)
+	pipe := s.client.Pipeline()
+	pipe.HSet(key, "id", id)
+	pipe.HSet(key, "username", username)
+	pipe.HSet(key, "hash", hash)
+	pipe.HSet(key, "lobby", -1)
+	pipe.HSet("user:by-username", username, id)
+	_, err = pipe.Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetUser implements UserStore
+func (s *RedisStore) GetUser(id int64) (*UserRecord, error) {
+	key := fmt.Sprintf("user:%d", id)
+	vals, err := s.client.HGetAll(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	lobbyID, err := strconv.ParseInt(vals["lobby"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserRecord{
+		ID:       id,
+		Username: vals["username"],
+		Hash:     []byte(vals["hash"]),
+		LobbyID:  lobbyID,
+	}, nil
+}
+
+// GetUserIDByUsername implements UserStore
+func (s *RedisStore) GetUserIDByUsername(username string) (int64, error) {
+	id, err := s.client.HGet("user:by-username", username).Int64()
+	return id, notFound(err, ErrUserNotFound)
+}
+
+// questionFields are the hash fields of question:%d, the lists are kept as json
+func questionFields(q *QuestionT) (map[string]interface{}, error) {
+	choicesBin, err := json.Marshal(q.Choices)
+	if err != nil {
+		return nil, err
+	}
+	tagsBin, err := json.Marshal(q.Tags)
+	if err != nil {
+		return nil, err
+	}
+	answersBin, err := json.Marshal(q.Answers)
+	if err != nil {
+		return nil, err
+	}
+	linksBin, err := json.Marshal(q.Links)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"statement":      q.Statement,
+		"answer":         q.Answer,
+		"choices":        choicesBin,
+		"category":       q.Category,
+		"tags":           tagsBin,
+		"type":           q.Type,
+		"answers":        answersBin,
+		"partial_credit": q.PartialCredit,
+		"tolerance":      q.Tolerance,
+		"explanation":    q.Explanation,
+		"links":          linksBin,
+		"difficulty":     q.Difficulty,
+		"hint":           q.Hint,
+	}, nil
+}
+
+// categoryKey is the set of the questions of the category whatever its case
+func categoryKey(category string) string {
+	return "question:category:" + strings.ToLower(category)
+}
+
+// categoryScript moves the question from its old category's set to its new one's, question:categories maps each
+// category in lower case to how it is spelled while any question is in it
+// KEYS: old category set, new category set, question:categories
+// ARGV: question id, old category in lower case, new category in lower case, new category, empty if there is none
+var categoryScript = redis.NewScript(`
+if ARGV[2] ~= "" then
+	redis.call("SREM", KEYS[1], ARGV[1])
+	if redis.call("SCARD", KEYS[1]) == 0 then
+		redis.call("HDEL", KEYS[3], ARGV[2])
+	end
+end
+if ARGV[3] ~= "" then
+	redis.call("SADD", KEYS[2], ARGV[1])
+	redis.call("HSET", KEYS[3], ARGV[3], ARGV[4])
+end
+return 1
+`)
+
+// indexCategory runs categoryScript for the question moving from one category to another, on a pipeline its error
+// comes with Exec
+func indexCategory(c redis.Cmdable, id int64, from, to string) error {
+	keys := []string{categoryKey(from), categoryKey(to), "question:categories"}
+	return categoryScript.Eval(c, keys, id, strings.ToLower(from), strings.ToLower(to), to).Err()
+}
+
+// CreateQuestion implements QuestionStore
+func (s *RedisStore) CreateQuestion(q *QuestionT) (int64, error) {
+	exists, err := s.client.HExists("question:by-statement", q.Statement).Result()
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrQuestionDuplicate
+	}
+
+	fields, err := questionFields(q)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := s.client.Incr("question:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+	fields["id"] = id
+
+	key := fmt.Sprintf("question:%d", id)
+	pipe := s.client.Pipeline()
+	pipe.HMSet(key, fields)
+	pipe.HSet("question:by-statement", q.Statement, id)
+	pipe.LPush("questions", id)
+	indexCategory(pipe, id, "", q.Category)
+	_, err = pipe.Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetQuestion implements QuestionStore
+func (s *RedisStore) GetQuestion(id int64) (*QuestionT, error) {
+	key := fmt.Sprintf("question:%d", id)
+	vals, err := s.client.HGetAll(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, ErrQuestionNotFound
+	}
+
+	q := &QuestionT{
+		Statement:     vals["statement"],
+		Answer:        vals["answer"],
+		Category:      vals["category"],
+		Type:          vals["type"],
+		PartialCredit: vals["partial_credit"] == "1",
+		Explanation:   vals["explanation"],
+		Hint:          vals["hint"],
+	}
+	if err := json.Unmarshal([]byte(vals["choices"]), &q.Choices); err != nil {
+		return nil, err
+	}
+
+	// questions created before these fields existed have none
+	if vals["tags"] != "" {
+		if err := json.Unmarshal([]byte(vals["tags"]), &q.Tags); err != nil {
+			return nil, err
+		}
+	}
+	if vals["answers"] != "" {
+		if err := json.Unmarshal([]byte(vals["answers"]), &q.Answers); err != nil {
+			return nil, err
+		}
+	}
+	if vals["links"] != "" {
+		if err := json.Unmarshal([]byte(vals["links"]), &q.Links); err != nil {
+			return nil, err
+		}
+	}
+	if vals["tolerance"] != "" {
+		q.Tolerance, err = strconv.ParseFloat(vals["tolerance"], 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if vals["difficulty"] != "" {
+		q.Difficulty, err = strconv.ParseInt(vals["difficulty"], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+// ListQuestionIDs implements QuestionStore
+func (s *RedisStore) ListQuestionIDs() ([]int64, error) {
+	vals, err := s.client.LRange("questions", 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIDs(vals)
+}
+
+// backfillCategories indexes the categories of the questions created before the categories were indexed once
+func (s *RedisStore) backfillCategories() error {
+	first, err := s.client.SetNX("question:categories:backfilled", 1, 0).Result()
+	if err != nil || !first {
+		return err
+	}
+	ids, err := s.ListQuestionIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		category, err := s.client.HGet(fmt.Sprintf("question:%d", id), "category").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if category == "" {
+			continue
+		}
+		if err := indexCategory(s.client, id, "", category); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListCategoryQuestionIDs implements QuestionStore
+func (s *RedisStore) ListCategoryQuestionIDs(category string) ([]int64, error) {
+	if err := s.backfillCategories(); err != nil {
+		return nil, err
+	}
+	vals, err := s.client.SMembers(categoryKey(category)).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseIDs(vals)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return ids, nil
+}
+
+// ListCategories implements QuestionStore
+func (s *RedisStore) ListCategories() ([]string, error) {
+	if err := s.backfillCategories(); err != nil {
+		return nil, err
+	}
+	return s.client.HVals("question:categories").Result()
+}
+
+// UpdateQuestion implements QuestionStore
+func (s *RedisStore) UpdateQuestion(id int64, q *QuestionT) error {
+	key := fmt.Sprintf("question:%d", id)
+	old, err := s.client.HGet(key, "statement").Result()
+	if err != nil {
+		return notFound(err, ErrQuestionNotFound)
+	}
+	category, err := s.client.HGet(key, "category").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	other, err := s.client.HGet("question:by-statement", q.Statement).Int64()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err == nil && other != id {
+		return ErrQuestionDuplicate
+	}
+
+	fields, err := questionFields(q)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HDel("question:by-statement", old)
+	pipe.HMSet(key, fields)
+	pipe.HSet("question:by-statement", q.Statement, id)
+	indexCategory(pipe, id, category, q.Category)
+	_, err = pipe.Exec()
+	return err
+}
+
+// DeleteQuestion implements QuestionStore
+func (s *RedisStore) DeleteQuestion(id int64) error {
+	key := fmt.Sprintf("question:%d", id)
+	statement, err := s.client.HGet(key, "statement").Result()
+	if err != nil {
+		return notFound(err, ErrQuestionNotFound)
+	}
+	category, err := s.client.HGet(key, "category").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(key)
+	pipe.HDel("question:by-statement", statement)
+	pipe.LRem("questions", 0, id)
+	indexCategory(pipe, id, category, "")
+	_, err = pipe.Exec()
+	return err
+}
+
+// CreateUserQuestion implements UserQuestionStore
+func (s *RedisStore) CreateUserQuestion(userID, questionID int64, category string, at time.Time) (int64, error) {
+	id, err := s.client.Incr("user-question:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+
+	key := fmt.Sprintf("user-question:%d", id)
+	pipe := s.client.Pipeline()
+	pipe.HSet(key, "id", id)
+	pipe.HSet(key, "user_id", userID)
+	pipe.HSet(key, "question_id", questionID)
+	pipe.HSet(key, "points", 0)
+	pipe.HSet(key, "rank", 0)
+	pipe.HSet(key, "attempts", 0)
+	pipe.HSet(key, "started_at", unixNano(at))
+	pipe.HSet(key, "assigned_at", unixNano(at))
+	pipe.HSet(key, "finished_at", 0)
+	pipe.HSet(key, "category", category)
+	pipe.Del(fmt.Sprintf("user:%d:questions", userID))
+	pipe.LPush(fmt.Sprintf("user:%d:questions", userID), questionID)
+	pipe.LPush(fmt.Sprintf("user:%d:user-question", userID), id)
+	_, err = pipe.Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetUserQuestion implements UserQuestionStore
+func (s *RedisStore) GetUserQuestion(id int64) (*UserQuestionRecord, error) {
+	key := fmt.Sprintf("user-question:%d", id)
+	vals, err := s.client.HMGet(key, "user_id", "question_id", "points", "attempts",
+		"started_at", "finished_at", "assigned_at", "deadline", "exam_deadline", "streak", "fifty_fifties", "hints",
+		"hidden", "hinted", "category").Result()
+	if err != nil {
+		return nil, err
+	}
+	if vals[0] == nil {
+		return nil, ErrEmptyUserQuestion
+	}
+
+	// fields added after the user-question was created are missing, those count as 0 or empty
+	category, _ := vals[len(vals)-1].(string)
+	hinted := vals[len(vals)-2] != nil
+	var hidden []string
+	if v, ok := vals[len(vals)-3].(string); ok {
+		if err := json.Unmarshal([]byte(v), &hidden); err != nil {
+			return nil, err
+		}
+	}
+	nums := make([]int64, len(vals)-3)
+	for i, v := range vals[:len(nums)] {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		nums[i], err = strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &UserQuestionRecord{
+		ID:           id,
+		UserID:       nums[0],
+		QuestionID:   nums[1],
+		Points:       nums[2],
+		Attempts:     nums[3],
+		StartedAt:    unixTime(nums[4]),
+		FinishedAt:   unixTime(nums[5]),
+		AssignedAt:   unixTime(nums[6]),
+		Deadline:     unixTime(nums[7]),
+		ExamDeadline: unixTime(nums[8]),
+		Streak:       nums[9],
+		FiftyFifties: nums[10],
+		Hints:        nums[11],
+		Hidden:       hidden,
+		Hinted:       hinted,
+		Category:     category,
+	}, nil
+}
+
+// GetUserQuestionIDByUserID implements UserQuestionStore
+func (s *RedisStore) GetUserQuestionIDByUserID(userID int64) (int64, error) {
+	key := fmt.Sprintf("user:%d:user-question", userID)
+	vals, err := s.client.LRange(key, 0, 0).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) == 0 {
+		return 0, ErrEmptyUserQuestion
+	}
+	return strconv.ParseInt(vals[0], 10, 64)
+}
+
+// ListAskedQuestionIDs implements UserQuestionStore
+func (s *RedisStore) ListAskedQuestionIDs(userID int64) ([]int64, error) {
+	key := fmt.Sprintf("user:%d:questions", userID)
+	vals, err := s.client.LRange(key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIDs(vals)
+}
+
+// AssignQuestion implements UserQuestionStore
+func (s *RedisStore) AssignQuestion(id, questionID int64) error {
+	key := fmt.Sprintf("user-question:%d", id)
+	userID, err := s.client.HGet(key, "user_id").Int64()
+	if err != nil {
+		return notFound(err, ErrEmptyUserQuestion)
+	}
+
+	pipe := s.client.Pipeline()
+	pipe.HSet(key, "question_id", questionID)
+	pipe.HDel(key, "hidden", "hinted")
+	pipe.LPush(fmt.Sprintf("user:%d:questions", userID), questionID)
+	_, err = pipe.Exec()
+	return err
+}
+
+// AddPoints implements UserQuestionStore
+func (s *RedisStore) AddPoints(id, amount int64) (int64, error) {
+	key := fmt.Sprintf("user-question:%d", id)
+	return s.client.HIncrBy(key, "points", amount).Result()
+}
+
+// advanceScript compares and swaps the current question so that concurrent answers score only once
+// KEYS: user-question hash, user's asked questions list, leaderboard
+// ARGV: from question id, next question id, points to add, user id, assign or finish time
+var advanceScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "question_id") ~= ARGV[1] then
+	return false
+end
+redis.call("HINCRBY", KEYS[1], "attempts", 1)
+redis.call("HINCRBY", KEYS[1], "streak", 1)
+local points = redis.call("HINCRBY", KEYS[1], "points", ARGV[3])
+redis.call("HSET", KEYS[1], "question_id", ARGV[2])
+redis.call("HSET", KEYS[1], "assigned_at", ARGV[5])
+redis.call("HSET", KEYS[1], "deadline", 0)
+redis.call("HDEL", KEYS[1], "hidden", "hinted")
+if ARGV[2] == "0" then
+	redis.call("HSET", KEYS[1], "finished_at", ARGV[5])
+else
+	redis.call("LPUSH", KEYS[2], ARGV[2])
+end
+redis.call("ZADD", KEYS[3], points, ARGV[4])
+return points
+`)
+
+// AdvanceUserQuestion implements UserQuestionStore
+func (s *RedisStore) AdvanceUserQuestion(id, fromQuestionID, nextQuestionID, amount int64, at time.Time) (int64, error) {
+	key := fmt.Sprintf("user-question:%d", id)
+	userID, err := s.client.HGet(key, "user_id").Int64()
+	if err != nil {
+		return 0, notFound(err, ErrEmptyUserQuestion)
+	}
+
+	keys := []string{key, fmt.Sprintf("user:%d:questions", userID), leaderboard}
+	points, err := advanceScript.Run(s.client, keys, fromQuestionID, nextQuestionID, amount, userID, unixNano(at)).Int64()
+	return points, notFound(err, ErrStaleAnswer)
+}
+
+// skipScript is advanceScript without the attempt, the points and the leaderboard
+// KEYS: user-question hash, user's asked questions list
+// ARGV: from question id, next question id, assign or finish time
+var skipScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "question_id") ~= ARGV[1] then
+	return false
+end
+redis.call("HSET", KEYS[1], "question_id", ARGV[2])
+redis.call("HSET", KEYS[1], "assigned_at", ARGV[3])
+redis.call("HSET", KEYS[1], "deadline", 0)
+redis.call("HDEL", KEYS[1], "hidden", "hinted")
+if ARGV[2] == "0" then
+	redis.call("HSET", KEYS[1], "finished_at", ARGV[3])
+else
+	redis.call("LPUSH", KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// SkipQuestion implements UserQuestionStore
+func (s *RedisStore) SkipQuestion(id, fromQuestionID, nextQuestionID int64, at time.Time) error {
+	key := fmt.Sprintf("user-question:%d", id)
+	userID, err := s.client.HGet(key, "user_id").Int64()
+	if err != nil {
+		return notFound(err, ErrEmptyUserQuestion)
+	}
+
+	keys := []string{key, fmt.Sprintf("user:%d:questions", userID)}
+	err = skipScript.Run(s.client, keys, fromQuestionID, nextQuestionID, unixNano(at)).Err()
+	return notFound(err, ErrStaleAnswer)
+}
+
+// timeoutScript is skipScript that also records the question as timed out, breaks the streak and takes the penalty
+// off the points and the leaderboard
+// KEYS: user-question hash, user's asked questions list, timed out set, leaderboard
+// ARGV: from question id, next question id, assign or finish time, penalty, user id
+var timeoutScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "question_id") ~= ARGV[1] then
+	return false
+end
+redis.call("HSET", KEYS[1], "question_id", ARGV[2])
+redis.call("HSET", KEYS[1], "assigned_at", ARGV[3])
+redis.call("HSET", KEYS[1], "deadline", 0)
+redis.call("HSET", KEYS[1], "streak", 0)
+redis.call("HDEL", KEYS[1], "hidden", "hinted")
+if ARGV[2] == "0" then
+	redis.call("HSET", KEYS[1], "finished_at", ARGV[3])
+else
+	redis.call("LPUSH", KEYS[2], ARGV[2])
+end
+redis.call("SADD", KEYS[3], ARGV[1])
+if ARGV[4] ~= "0" then
+	local points = redis.call("HINCRBY", KEYS[1], "points", -tonumber(ARGV[4]))
+	redis.call("ZADD", KEYS[4], points, ARGV[5])
+end
+return 1
+`)
+
+// TimeOutQuestion implements UserQuestionStore
+func (s *RedisStore) TimeOutQuestion(id, fromQuestionID, nextQuestionID, penalty int64, at time.Time) error {
+	key := fmt.Sprintf("user-question:%d", id)
+	userID, err := s.client.HGet(key, "user_id").Int64()
+	if err != nil {
+		return notFound(err, ErrEmptyUserQuestion)
+	}
+
+	keys := []string{key, fmt.Sprintf("user:%d:questions", userID), fmt.Sprintf("user-question:%d:timed-out", id),
+		leaderboard}
+	err = timeoutScript.Run(s.client, keys, fromQuestionID, nextQuestionID, unixNano(at), penalty, userID).Err()
+	return notFound(err, ErrStaleAnswer)
+}
+
+// ListTimedOut implements UserQuestionStore
+func (s *RedisStore) ListTimedOut(id int64) ([]int64, error) {
+	ids, err := s.client.SMembers(fmt.Sprintf("user-question:%d:timed-out", id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIDs(ids)
+}
+
+// serveScript sets the deadlines that are not set yet while the question is still the current one
+// KEYS: user-question hash
+// ARGV: question id, question deadline, exam deadline
+var serveScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "question_id") ~= ARGV[1] then
+	return false
+end
+local deadline = redis.call("HGET", KEYS[1], "deadline")
+if not deadline or deadline == "0" then
+	redis.call("HSET", KEYS[1], "deadline", ARGV[2])
+end
+local examDeadline = redis.call("HGET", KEYS[1], "exam_deadline")
+if not examDeadline or examDeadline == "0" then
+	redis.call("HSET", KEYS[1], "exam_deadline", ARGV[3])
+end
+return 1
+`)
+
+// ServeQuestion implements UserQuestionStore
+func (s *RedisStore) ServeQuestion(id, questionID int64, deadline, examDeadline time.Time) error {
+	key := fmt.Sprintf("user-question:%d", id)
+	err := serveScript.Run(s.client, []string{key}, questionID, unixNano(deadline), unixNano(examDeadline)).Err()
+	return notFound(err, ErrStaleAnswer)
+}
+
+// missScript counts the wrong attempt and takes the penalty off the points and the leaderboard at once, only while the
+// question is still the current one
+// KEYS: user-question hash, misses hash, leaderboard
+// ARGV: question id, penalty, user id
+var missScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "question_id") ~= ARGV[1] then
+	return false
+end
+redis.call("HINCRBY", KEYS[1], "attempts", 1)
+redis.call("HSET", KEYS[1], "streak", 0)
+redis.call("HINCRBY", KEYS[2], ARGV[1], 1)
+if ARGV[2] ~= "0" then
+	local points = redis.call("HINCRBY", KEYS[1], "points", -tonumber(ARGV[2]))
+	redis.call("ZADD", KEYS[3], points, ARGV[3])
+end
+return 1
+`)
+
+// RecordMiss implements UserQuestionStore
+func (s *RedisStore) RecordMiss(id, questionID, penalty int64) error {
+	key := fmt.Sprintf("user-question:%d", id)
+	userID, err := s.client.HGet(key, "user_id").Int64()
+	if err != nil {
+		return notFound(err, ErrEmptyUserQuestion)
+	}
+
+	keys := []string{key, fmt.Sprintf("user-question:%d:misses", id), leaderboard}
+	err = missScript.Run(s.client, keys, questionID, penalty, userID).Err()
+	return notFound(err, ErrStaleAnswer)
+}
+
+// lifelineScript counts the lifeline and marks it used on the current question only if it can be used, the marks are
+// deleted when the next question is assigned
+// KEYS: user-question hash
+// ARGV: question id, mark field, count field, limit, mark
+// returns 0 once used, 1 if the question is stale, 2 if the lifeline has been used on it or 3 if none is left
+var lifelineScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "question_id") ~= ARGV[1] then
+	return 1
+end
+if redis.call("HEXISTS", KEYS[1], ARGV[2]) == 1 then
+	return 2
+end
+if tonumber(redis.call("HGET", KEYS[1], ARGV[3]) or "0") >= tonumber(ARGV[4]) then
+	return 3
+end
+redis.call("HINCRBY", KEYS[1], ARGV[3], 1)
+redis.call("HSET", KEYS[1], ARGV[2], ARGV[5])
+return 0
+`)
+
+func (s *RedisStore) useLifeline(id, questionID int64, mark, count string, limit int64, value interface{}) error {
+	key := fmt.Sprintf("user-question:%d", id)
+	if _, err := s.client.HGet(key, "user_id").Result(); err != nil {
+		return notFound(err, ErrEmptyUserQuestion)
+	}
+
+	res, err := lifelineScript.Run(s.client, []string{key}, questionID, mark, count, limit, value).Int64()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 1:
+		return ErrStaleAnswer
+	case 2:
+		return ErrLifelineUsed
+	case 3:
+		return ErrNoLifelines
+	}
+	return nil
+}
+
+// UseFiftyFifty implements UserQuestionStore
+func (s *RedisStore) UseFiftyFifty(id, questionID, limit int64, hidden []string) error {
+	hiddenBin, err := json.Marshal(hidden)
+	if err != nil {
+		return err
+	}
+	return s.useLifeline(id, questionID, "hidden", "fifty_fifties", limit, string(hiddenBin))
+}
+
+// UseHint implements UserQuestionStore
+func (s *RedisStore) UseHint(id, questionID, limit int64) error {
+	return s.useLifeline(id, questionID, "hinted", "hints", limit, 1)
+}
+
+// ListMisses implements UserQuestionStore
+func (s *RedisStore) ListMisses(id int64) (map[int64]int64, error) {
+	vals, err := s.client.HGetAll(fmt.Sprintf("user-question:%d:misses", id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	misses := map[int64]int64{}
+	for k, v := range vals {
+		questionID, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		misses[questionID] = n
+	}
+	return misses, nil
+}
+
+// CreateLobby implements LobbyStore
+func (s *RedisStore) CreateLobby(hostID int64, code string) (int64, error) {
+	id, err := s.client.Incr("lobby:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+	// the code is claimed first so that two lobbies never share it
+	claimed, err := s.client.HSetNX("lobby:by-code", code, id).Result()
+	if err != nil {
+		return 0, err
+	}
+	if !claimed {
+		return 0, ErrLobbyCodeTaken
+	}
+
+	now := time.Now().UnixNano()
+	key := fmt.Sprintf("lobby:%d", id)
+	pipe := s.client.Pipeline()
+	pipe.HSet(key, "id", id)
+	pipe.HSet(key, "code", code)
+	pipe.HSet(key, "host_id", hostID)
+	pipe.HSet(key, "status", StatusWaiting)
+	pipe.HSet(key, "active_at", now)
+	pipe.ZAdd("lobby:active", redis.Z{Score: float64(now), Member: id})
+	pipe.HSet(fmt.Sprintf("user:%d", hostID), "lobby", id)
+	pipe.ZAdd(fmt.Sprintf("lobby:%d:roster", id), redis.Z{Score: float64(now), Member: hostID})
+	_, err = pipe.Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetLobby implements LobbyStore
+func (s *RedisStore) GetLobby(id int64) (*LobbyRecord, error) {
+	key := fmt.Sprintf("lobby:%d", id)
+	vals, err := s.client.HGetAll(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, ErrLobbyNotFound
+	}
+
+	hostID, err := strconv.ParseInt(vals["host_id"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	status, err := strconv.ParseInt(vals["status"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	// the settings of a lobby that has never been set up are missing, those count as 0 or empty
+	nums := map[string]int64{}
+	for _, f := range []string{"max_players", "rounds", "round_time", "active_at", "starts_at"} {
+		if v, ok := vals[f]; ok {
+			if nums[f], err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &LobbyRecord{
+		ID:     id,
+		Code:   vals["code"],
+		HostID: hostID,
+		Status: status,
+		Settings: LobbySettings{
+			MaxPlayers: nums["max_players"],
+			Public:     vals["public"] == "1",
+			Rounds:     nums["rounds"],
+			RoundTime:  time.Duration(nums["round_time"]),
+			Category:   vals["category"],
+		},
+		ActiveAt: unixTime(nums["active_at"]),
+		StartsAt: unixTime(nums["starts_at"]),
+	}, nil
+}
+
+// SetLobbySettings implements LobbyStore
+func (s *RedisStore) SetLobbySettings(id int64, settings LobbySettings) error {
+	key := fmt.Sprintf("lobby:%d", id)
+	pipe := s.client.Pipeline()
+	pipe.HMSet(key, map[string]interface{}{
+		"max_players": settings.MaxPlayers,
+		"public":      settings.Public,
+		"rounds":      settings.Rounds,
+		"round_time":  int64(settings.RoundTime),
+		"category":    settings.Category,
+	})
+	// the public lobbies are indexed whatever their status, the status is checked when they are listed
+	if settings.Public {
+		pipe.SAdd("lobby:public", id)
+	} else {
+		pipe.SRem("lobby:public", id)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// ListPublicLobbyIDs implements LobbyStore
+func (s *RedisStore) ListPublicLobbyIDs() ([]int64, error) {
+	vals, err := s.client.SMembers("lobby:public").Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseIDs(vals)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	waiting := []int64{}
+	for _, id := range ids {
+		status, err := s.client.HGet(fmt.Sprintf("lobby:%d", id), "status").Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if status == StatusWaiting {
+			waiting = append(waiting, id)
+		}
+	}
+	return waiting, nil
+}
+
+// GetLobbyIDByCode implements LobbyStore
+func (s *RedisStore) GetLobbyIDByCode(code string) (int64, error) {
+	id, err := s.client.HGet("lobby:by-code", code).Int64()
+	return id, notFound(err, ErrLobbyNotFound)
+}
+
+// SetLobbyHost implements LobbyStore
+func (s *RedisStore) SetLobbyHost(id, hostID int64) error {
+	key := fmt.Sprintf("lobby:%d", id)
+	return s.client.HSet(key, "host_id", hostID).Err()
+}
+
+// SetLobbyStatus implements LobbyStore
+func (s *RedisStore) SetLobbyStatus(id, status int64) error {
+	key := fmt.Sprintf("lobby:%d", id)
+	return s.client.HSet(key, "status", status).Err()
+}
+
+// SetLobbyStartsAt implements LobbyStore
+func (s *RedisStore) SetLobbyStartsAt(id int64, at time.Time) error {
+	key := fmt.Sprintf("lobby:%d", id)
+	return s.client.HSet(key, "starts_at", unixNano(at)).Err()
+}
+
+// migrateRosterScript moves the members of a lobby from before the roster, which kept them in a set, onto the roster as
+// joined before anybody else
+// KEYS: members set, roster
+// returns how many members are moved
+var migrateRosterScript = redis.NewScript(`
+local members = redis.call("SMEMBERS", KEYS[1])
+for _, m in ipairs(members) do
+	redis.call("ZADD", KEYS[2], "NX", 0, m)
+end
+redis.call("DEL", KEYS[1])
+return #members
+`)
+
+// migrateRoster moves the lobby's members onto the roster if it is from before the roster, see migrateRosterScript
+func (s *RedisStore) migrateRoster(id int64) error {
+	keys := []string{fmt.Sprintf("lobby:%d:members", id), fmt.Sprintf("lobby:%d:roster", id)}
+	return migrateRosterScript.Run(s.client, keys).Err()
+}
+
+// addMemberScript adds the member while the lobby has room for it, the members are kept in the order they joined and
+// joining again does not move them
+// KEYS: lobby hash, roster, user hash
+// ARGV: user id, join time, lobby id
+// returns 0 once added or 1 if the lobby is full
+var addMemberScript = redis.NewScript(`
+if not redis.call("ZSCORE", KEYS[2], ARGV[1]) then
+	local max = tonumber(redis.call("HGET", KEYS[1], "max_players") or "0")
+	if max > 0 and redis.call("ZCARD", KEYS[2]) >= max then
+		return 1
+	end
+	redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+end
+redis.call("HSET", KEYS[3], "lobby", ARGV[3])
+return 0
+`)
+
+// AddLobbyMember implements LobbyStore
+func (s *RedisStore) AddLobbyMember(id, userID int64) error {
+	if err := s.migrateRoster(id); err != nil {
+		return err
+	}
+	keys := []string{fmt.Sprintf("lobby:%d", id), fmt.Sprintf("lobby:%d:roster", id), fmt.Sprintf("user:%d", userID)}
+	res, err := addMemberScript.Run(s.client, keys, userID, time.Now().UnixNano(), id).Int64()
+	if err != nil {
+		return err
+	}
+	if res == 1 {
+		return ErrLobbyFull
+	}
+	return nil
+}
+
+// RemoveLobbyMember implements LobbyStore
+func (s *RedisStore) RemoveLobbyMember(id, userID int64) error {
+	if err := s.migrateRoster(id); err != nil {
+		return err
+	}
+	pipe := s.client.Pipeline()
+	pipe.HSet(fmt.Sprintf("user:%d", userID), "lobby", -1)
+	pipe.ZRem(fmt.Sprintf("lobby:%d:roster", id), userID)
+	pipe.SRem(fmt.Sprintf("lobby:%d:cohosts", id), userID)
+	pipe.SRem(fmt.Sprintf("lobby:%d:ready", id), userID)
+	_, err := pipe.Exec()
+	return err
+}
+
+// swapStatusScript sets the lobby's status only if it is still the expected one
+// KEYS: lobby hash
+// ARGV: from, to
+// returns 0 once set, 1 if the status is another one or 2 if there is no such lobby
+var swapStatusScript = redis.NewScript(`
+local status = redis.call("HGET", KEYS[1], "status")
+if not status then
+	return 2
+end
+if status ~= ARGV[1] then
+	return 1
+end
+redis.call("HSET", KEYS[1], "status", ARGV[2])
+return 0
+`)
+
+// SwapLobbyStatus implements LobbyStore
+func (s *RedisStore) SwapLobbyStatus(id, from, to int64) error {
+	key := fmt.Sprintf("lobby:%d", id)
+	res, err := swapStatusScript.Run(s.client, []string{key}, from, to).Int64()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 1:
+		return ErrLobbyStatus
+	case 2:
+		return ErrLobbyNotFound
+	}
+	return nil
+}
+
+// IsLobbyMember implements LobbyStore
+func (s *RedisStore) IsLobbyMember(id, userID int64) (bool, error) {
+	if err := s.migrateRoster(id); err != nil {
+		return false, err
+	}
+	err := s.client.ZScore(fmt.Sprintf("lobby:%d:roster", id), strconv.FormatInt(userID, 10)).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListLobbyMembers implements LobbyStore
+func (s *RedisStore) ListLobbyMembers(id int64) ([]int64, error) {
+	if err := s.migrateRoster(id); err != nil {
+		return nil, err
+	}
+	vals, err := s.client.ZRange(fmt.Sprintf("lobby:%d:roster", id), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIDs(vals)
+}
+
+// setFlag adds the user to the lobby's set or removes it
+func (s *RedisStore) setFlag(key string, userID int64, on bool) error {
+	if on {
+		return s.client.SAdd(key, userID).Err()
+	}
+	return s.client.SRem(key, userID).Err()
+}
+
+// flagged lists the lobby's set in order
+func (s *RedisStore) flagged(key string) ([]int64, error) {
+	vals, err := s.client.SMembers(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseIDs(vals)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// SetLobbyCoHost implements LobbyStore
+func (s *RedisStore) SetLobbyCoHost(id, userID int64, cohost bool) error {
+	return s.setFlag(fmt.Sprintf("lobby:%d:cohosts", id), userID, cohost)
+}
+
+// ListLobbyCoHosts implements LobbyStore
+func (s *RedisStore) ListLobbyCoHosts(id int64) ([]int64, error) {
+	return s.flagged(fmt.Sprintf("lobby:%d:cohosts", id))
+}
+
+// SetLobbyReady implements LobbyStore
+func (s *RedisStore) SetLobbyReady(id, userID int64, ready bool) error {
+	return s.setFlag(fmt.Sprintf("lobby:%d:ready", id), userID, ready)
+}
+
+// ListLobbyReady implements LobbyStore
+func (s *RedisStore) ListLobbyReady(id int64) ([]int64, error) {
+	return s.flagged(fmt.Sprintf("lobby:%d:ready", id))
+}
+
+// SetLobbyBan implements LobbyStore
+func (s *RedisStore) SetLobbyBan(id, userID int64, banned bool) error {
+	return s.setFlag(fmt.Sprintf("lobby:%d:bans", id), userID, banned)
+}
+
+// IsLobbyBanned implements LobbyStore
+func (s *RedisStore) IsLobbyBanned(id, userID int64) (bool, error) {
+	return s.client.SIsMember(fmt.Sprintf("lobby:%d:bans", id), userID).Result()
+}
+
+// ListLobbyBans implements LobbyStore
+func (s *RedisStore) ListLobbyBans(id int64) ([]int64, error) {
+	return s.flagged(fmt.Sprintf("lobby:%d:bans", id))
+}
+
+// touchLobbyScript marks the lobby as used without bringing a deleted lobby back
+// KEYS: lobby hash, lobby:active
+// ARGV: lobby id, time
+// returns 0 once marked or 1 if there is no such lobby
+var touchLobbyScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 1
+end
+redis.call("HSET", KEYS[1], "active_at", ARGV[2])
+redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+return 0
+`)
+
+// TouchLobby implements LobbyStore
+func (s *RedisStore) TouchLobby(id int64, at time.Time) error {
+	keys := []string{fmt.Sprintf("lobby:%d", id), "lobby:active"}
+	res, err := touchLobbyScript.Run(s.client, keys, id, unixNano(at)).Int64()
+	if err != nil {
+		return err
+	}
+	if res == 1 {
+		return ErrLobbyNotFound
+	}
+	return nil
+}
+
+// backfillActive adds the lobbies created before lobby:active was kept to it once, as idle since ever
+func (s *RedisStore) backfillActive() error {
+	first, err := s.client.SetNX("lobby:active:backfilled", 1, 0).Result()
+	if err != nil || !first {
+		return err
+	}
+	last, err := s.client.Get("lobby:next-id").Int64()
+	if err != nil {
+		return notFound(err, nil)
+	}
+	for id := int64(1); id <= last; id++ {
+		n, err := s.client.Exists(fmt.Sprintf("lobby:%d", id)).Result()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if err := s.client.ZAddNX("lobby:active", redis.Z{Score: 0, Member: id}).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListIdleLobbyIDs implements LobbyStore
+func (s *RedisStore) ListIdleLobbyIDs(before time.Time) ([]int64, error) {
+	if err := s.backfillActive(); err != nil {
+		return nil, err
+	}
+	vals, err := s.client.ZRangeByScore("lobby:active", redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("(%d", unixNano(before)),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseIDs(vals)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// resetStaleScript resets the user's lobby if it still is the given lobby and the user is not on its roster
+// KEYS: user hash, roster
+// ARGV: lobby id, user id
+// returns 1 once reset or 0 if the user's lobby is not stale
+var resetStaleScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "lobby") ~= ARGV[1] then
+	return 0
+end
+if redis.call("ZSCORE", KEYS[2], ARGV[2]) then
+	return 0
+end
+redis.call("HSET", KEYS[1], "lobby", -1)
+return 1
+`)
+
+// resetStale resets the user's lobby if it is stale, see resetStaleScript
+func (s *RedisStore) resetStale(lobbyID, userID int64) (int64, error) {
+	keys := []string{fmt.Sprintf("user:%d", userID), fmt.Sprintf("lobby:%d:roster", lobbyID)}
+	return resetStaleScript.Run(s.client, keys, lobbyID, userID).Int64()
+}
+
+// DeleteLobby implements LobbyStore
+func (s *RedisStore) DeleteLobby(id int64) error {
+	key := fmt.Sprintf("lobby:%d", id)
+	code, err := s.client.HGet(key, "code").Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	roster := fmt.Sprintf("lobby:%d:roster", id)
+	members, err := s.client.ZRange(roster, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	// lobbies from before the roster kept their members in a set
+	legacy, err := s.client.SMembers(fmt.Sprintf("lobby:%d:members", id)).Result()
+	if err != nil {
+		return err
+	}
+	players, err := s.client.SMembers(fmt.Sprintf("lobby:%d:game:players", id)).Result()
+	if err != nil {
+		return err
+	}
+	owner, err := s.client.HGet("lobby:by-code", code).Int64()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	for _, p := range players {
+		pipe.Del(fmt.Sprintf("lobby:%d:game:player:%s", id, p))
+	}
+	pipe.Del(key, roster, fmt.Sprintf("lobby:%d:members", id), fmt.Sprintf("lobby:%d:cohosts", id),
+		fmt.Sprintf("lobby:%d:ready", id), fmt.Sprintf("lobby:%d:bans", id), fmt.Sprintf("lobby:%d:mutes", id),
+		fmt.Sprintf("lobby:%d:chat", id), fmt.Sprintf("lobby:%d:game", id), fmt.Sprintf("lobby:%d:game:players", id))
+	pipe.ZRem("lobby:active", id)
+	pipe.SRem("lobby:public", id)
+	if owner == id {
+		pipe.HDel("lobby:by-code", code)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return err
+	}
+
+	userIDs, err := parseIDs(append(members, legacy...))
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if _, err := s.resetStale(id, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetStaleUserLobbies implements LobbyStore
+func (s *RedisStore) ResetStaleUserLobbies() (int64, error) {
+	vals, err := s.client.HVals("user:by-username").Result()
+	if err != nil {
+		return 0, err
+	}
+	userIDs, err := parseIDs(vals)
+	if err != nil {
+		return 0, err
+	}
+	var reset int64
+	for _, userID := range userIDs {
+		lobbyID, err := s.client.HGet(fmt.Sprintf("user:%d", userID), "lobby").Int64()
+		if err == redis.Nil || lobbyID == -1 {
+			continue
+		}
+		if err != nil {
+			return reset, err
+		}
+		if err := s.migrateRoster(lobbyID); err != nil {
+			return reset, err
+		}
+		n, err := s.resetStale(lobbyID, userID)
+		if err != nil {
+			return reset, err
+		}
+		reset += n
+	}
+	return reset, nil
+}
+
+// CreateUpdate implements UpdateStore
+func (s *RedisStore) CreateUpdate(userID int64, body string) (int64, error) {
+	id, err := s.client.Incr("update:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+	key := fmt.Sprintf("update:%d", id)
+	pipe := s.client.Pipeline()
+	pipe.HSet(key, "id", id)
+	pipe.HSet(key, "user_id", userID)
+	pipe.HSet(key, "body", body)
+	pipe.LPush("updates", id)
+	pipe.LPush(fmt.Sprintf("user:%d:updates", userID), id)
+	_, err = pipe.Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetUpdate implements UpdateStore
+func (s *RedisStore) GetUpdate(id int64) (*UpdateRecord, error) {
+	key := fmt.Sprintf("update:%d", id)
+	vals, err := s.client.HGetAll(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, ErrUpdateNotFound
+	}
+
+	userID, err := strconv.ParseInt(vals["user_id"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpdateRecord{ID: id, UserID: userID, Body: vals["body"]}, nil
+}
+
+// ListUpdateIDs implements UpdateStore
+func (s *RedisStore) ListUpdateIDs(count int64) ([]int64, error) {
+	vals, err := s.client.LRange("updates", 0, count-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIDs(vals)
+}
+
+// ListUserUpdateIDs implements UpdateStore
+func (s *RedisStore) ListUserUpdateIDs(userID, count int64) ([]int64, error) {
+	key := fmt.Sprintf("user:%d:updates", userID)
+	vals, err := s.client.LRange(key, 0, count-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIDs(vals)
+}
+
+// SetScore implements RankStore
+func (s *RedisStore) SetScore(userID, score int64) error {
+	z := redis.Z{Score: float64(score), Member: userID}
+	return s.client.ZAdd(leaderboard, z).Err()
+}
+
+// GetRank implements RankStore
+func (s *RedisStore) GetRank(userID int64) (int64, error) {
+	rank, err := s.client.ZRank(leaderboard, fmt.Sprint(userID)).Result()
+	return rank, notFound(err, ErrUserNotRanked)
+}
+
+// ListScores implements RankStore
+func (s *RedisStore) ListScores(start, stop int64) ([]ScoreRecord, error) {
+	return scoreRecords(s.client.ZRangeWithScores(leaderboard, start, stop))
+}
+
+// ListTopScores implements RankStore
+func (s *RedisStore) ListTopScores(start, stop int64) ([]ScoreRecord, error) {
+	return scoreRecords(s.client.ZRevRangeWithScores(leaderboard, start, stop))
+}
+
+func scoreRecords(z *redis.ZSliceCmd) ([]ScoreRecord, error) {
+	zs, err := z.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]ScoreRecord, len(zs))
+	for i, data := range zs {
+		member, ok := data.Member.(string)
+		if !ok {
+			return nil, ErrTypeMismatch
+		}
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		scores[i] = ScoreRecord{UserID: id, Score: int64(data.Score)}
+	}
+	return scores, nil
+}
+
+// CreateAnswer implements AnswerStore
+func (s *RedisStore) CreateAnswer(a *AnswerRecord) (int64, error) {
+	id, err := s.client.Incr("answer:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+
+	correct := 0
+	if a.Correct {
+		correct = 1
+	}
+
+	key := fmt.Sprintf("answer:%d", id)
+	pipe := s.client.Pipeline()
+	pipe.HSet(key, "id", id)
+	pipe.HSet(key, "user_id", a.UserID)
+	pipe.HSet(key, "question_id", a.QuestionID)
+	pipe.HSet(key, "choice", a.Choice)
+	pipe.HSet(key, "correct", correct)
+	pipe.HSet(key, "answered_at", unixNano(a.AnsweredAt))
+	pipe.HSet(key, "elapsed", int64(a.Elapsed))
+	pipe.LPush(fmt.Sprintf("user:%d:answers", a.UserID), id)
+	_, err = pipe.Exec()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// ListAnswers implements AnswerStore
+func (s *RedisStore) ListAnswers(userID, offset, count int64) ([]AnswerRecord, error) {
+	key := fmt.Sprintf("user:%d:answers", userID)
+	vals, err := s.client.LRange(key, offset, offset+count-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseIDs(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(fmt.Sprintf("answer:%d", id))
+	}
+	if len(ids) > 0 {
+		if _, err := pipe.Exec(); err != nil {
+			return nil, err
+		}
+	}
+
+	answers := make([]AnswerRecord, len(ids))
+	for i, cmd := range cmds {
+		m := cmd.Val()
+		nums := map[string]int64{}
+		for _, field := range []string{"question_id", "correct", "answered_at", "elapsed"} {
+			nums[field], err = strconv.ParseInt(m[field], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		answers[i] = AnswerRecord{
+			ID:         ids[i],
+			UserID:     userID,
+			QuestionID: nums["question_id"],
+			Choice:     m["choice"],
+			Correct:    nums["correct"] == 1,
+			AnsweredAt: unixTime(nums["answered_at"]),
+			Elapsed:    time.Duration(nums["elapsed"]),
+		}
+	}
+	return answers, nil
+}
+
+// CountAnswers implements AnswerStore
+func (s *RedisStore) CountAnswers(userID int64) (int64, error) {
+	return s.client.LLen(fmt.Sprintf("user:%d:answers", userID)).Result()
+}
+
+// SaveCard implements StudyStore
+func (s *RedisStore) SaveCard(c *CardRecord) error {
+	key := fmt.Sprintf("user:%d:card:%d", c.UserID, c.QuestionID)
+	pipe := s.client.TxPipeline()
+	pipe.HMSet(key, map[string]interface{}{
+		"box":         c.Box,
+		"reviews":     c.Reviews,
+		"lapses":      c.Lapses,
+		"due_at":      unixNano(c.DueAt),
+		"reviewed_at": unixNano(c.ReviewedAt),
+	})
+	pipe.SAdd(fmt.Sprintf("user:%d:cards", c.UserID), c.QuestionID)
+	_, err := pipe.Exec()
+	return err
+}
+
+// GetCard implements StudyStore
+func (s *RedisStore) GetCard(userID, questionID int64) (*CardRecord, error) {
+	m, err := s.client.HGetAll(fmt.Sprintf("user:%d:card:%d", userID, questionID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, ErrCardNotFound
+	}
+	return parseCard(userID, questionID, m)
+}
+
+func parseCard(userID, questionID int64, m map[string]string) (*CardRecord, error) {
+	nums := map[string]int64{}
+	for _, field := range []string{"box", "reviews", "lapses", "due_at", "reviewed_at"} {
+		n, err := strconv.ParseInt(m[field], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		nums[field] = n
+	}
+	return &CardRecord{
+		UserID:     userID,
+		QuestionID: questionID,
+		Box:        nums["box"],
+		Reviews:    nums["reviews"],
+		Lapses:     nums["lapses"],
+		DueAt:      unixTime(nums["due_at"]),
+		ReviewedAt: unixTime(nums["reviewed_at"]),
+	}, nil
+}
+
+// ListCards implements StudyStore
+func (s *RedisStore) ListCards(userID int64) ([]CardRecord, error) {
+	vals, err := s.client.SMembers(fmt.Sprintf("user:%d:cards", userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseIDs(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(fmt.Sprintf("user:%d:card:%d", userID, id))
+	}
+	if len(ids) > 0 {
+		if _, err := pipe.Exec(); err != nil {
+			return nil, err
+		}
+	}
+
+	cards := make([]CardRecord, len(ids))
+	for i, cmd := range cmds {
+		c, err := parseCard(userID, ids[i], cmd.Val())
+		if err != nil {
+			return nil, err
+		}
+		cards[i] = *c
+	}
+	sortCards(cards)
+	return cards, nil
+}
+
+func quizFields(q *QuizT) (map[string]interface{}, error) {
+	idsBin, err := json.Marshal(q.QuestionIDs)
+	if err != nil {
+		return nil, err
+	}
+	scoringBin, err := json.Marshal(q.Scoring)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"title":        q.Title,
+		"description":  q.Description,
+		"question_ids": string(idsBin),
+		"shuffle":      q.Shuffle,
+		"pass_mark":    q.PassMark,
+		"published":    q.Published,
+		"scoring":      string(scoringBin),
+	}, nil
+}
+
+// CreateQuiz implements QuizStore
+func (s *RedisStore) CreateQuiz(q *QuizT) (int64, error) {
+	fields, err := quizFields(q)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := s.client.Incr("quiz:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+	fields["id"] = id
+
+	pipe := s.client.TxPipeline()
+	pipe.HMSet(fmt.Sprintf("quiz:%d", id), fields)
+	pipe.RPush("quizzes", id)
+	if _, err := pipe.Exec(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetQuiz implements QuizStore
+func (s *RedisStore) GetQuiz(id int64) (*QuizT, error) {
+	m, err := s.client.HGetAll(fmt.Sprintf("quiz:%d", id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, ErrQuizNotFound
+	}
+
+	q := &QuizT{
+		Title:       m["title"],
+		Description: m["description"],
+		Shuffle:     m["shuffle"] == "1",
+		Published:   m["published"] == "1",
+	}
+	if q.PassMark, err = strconv.ParseInt(m["pass_mark"], 10, 64); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(m["question_ids"]), &q.QuestionIDs); err != nil {
+		return nil, err
+	}
+	// quizzes saved before the scoring rules keep the default ones
+	if m["scoring"] != "" {
+		if err := json.Unmarshal([]byte(m["scoring"]), &q.Scoring); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// ListQuizIDs implements QuizStore
+func (s *RedisStore) ListQuizIDs() ([]int64, error) {
+	vals, err := s.client.LRange("quizzes", 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseIDs(vals)
+}
+
+// UpdateQuiz implements QuizStore
+func (s *RedisStore) UpdateQuiz(id int64, q *QuizT) error {
+	key := fmt.Sprintf("quiz:%d", id)
+	exists, err := s.client.Exists(key).Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrQuizNotFound
+	}
+
+	fields, err := quizFields(q)
+	if err != nil {
+		return err
+	}
+	return s.client.HMSet(key, fields).Err()
+}
+
+// DeleteQuiz implements QuizStore
+func (s *RedisStore) DeleteQuiz(id int64) error {
+	n, err := s.client.Del(fmt.Sprintf("quiz:%d", id)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrQuizNotFound
+	}
+
+	usersKey := fmt.Sprintf("quiz:%d:users", id)
+	vals, err := s.client.SMembers(usersKey).Result()
+	if err != nil {
+		return err
+	}
+	userIDs, err := parseIDs(vals)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.LRem("quizzes", 0, id)
+	for _, userID := range userIDs {
+		pipe.Del(fmt.Sprintf("quiz:%d:user:%d", id, userID))
+	}
+	pipe.Del(usersKey)
+	_, err = pipe.Exec()
+	return err
+}
+
+// StartQuiz implements QuizStore
+func (s *RedisStore) StartQuiz(userID, quizID int64, questionIDs []int64, at time.Time) error {
+	idsBin, err := json.Marshal(questionIDs)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("quiz:%d:user:%d", quizID, userID)
+	pipe := s.client.TxPipeline()
+	pipe.Del(key)
+	pipe.HMSet(key, map[string]interface{}{
+		"question_ids": string(idsBin),
+		"size":         len(questionIDs),
+		"position":     0,
+		"answered":     0,
+		"correct":      0,
+		"points":       0,
+		"started_at":   unixNano(at),
+		"finished_at":  0,
+		"streak":       0,
+		"asked_at":     unixNano(at),
+	})
+	pipe.SAdd(fmt.Sprintf("quiz:%d:users", quizID), userID)
+	_, err = pipe.Exec()
+	return err
+}
+
+// GetQuizProgress implements QuizStore
+func (s *RedisStore) GetQuizProgress(userID, quizID int64) (*QuizProgressRecord, error) {
+	m, err := s.client.HGetAll(fmt.Sprintf("quiz:%d:user:%d", quizID, userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, ErrQuizNotStarted
+	}
+
+	nums := map[string]int64{}
+	for _, field := range []string{"position", "answered", "correct", "points", "started_at", "finished_at", "streak",
+		"asked_at"} {
+		// a field added after the progress was started is missing, it counts as 0
+		if v, ok := m[field]; ok {
+			if nums[field], err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p := &QuizProgressRecord{
+		UserID:     userID,
+		QuizID:     quizID,
+		Position:   nums["position"],
+		Answered:   nums["answered"],
+		Correct:    nums["correct"],
+		Points:     nums["points"],
+		StartedAt:  unixTime(nums["started_at"]),
+		FinishedAt: unixTime(nums["finished_at"]),
+		Streak:     nums["streak"],
+		AskedAt:    unixTime(nums["asked_at"]),
+	}
+	if err := json.Unmarshal([]byte(m["question_ids"]), &p.QuestionIDs); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// advanceQuizScript moves the user on to the next question of the quiz only if they are still at the position
+// KEYS: quiz progress hash
+// ARGV: position, answered, correct, points, answered or finished at
+var advanceQuizScript = redis.NewScript(`
+local position = redis.call("HGET", KEYS[1], "position")
+if not position then
+	return redis.error_reply("not started")
+end
+if position ~= ARGV[1] then
+	return false
+end
+position = redis.call("HINCRBY", KEYS[1], "position", 1)
+redis.call("HINCRBY", KEYS[1], "answered", ARGV[2])
+redis.call("HINCRBY", KEYS[1], "correct", ARGV[3])
+redis.call("HINCRBY", KEYS[1], "points", ARGV[4])
+redis.call("HSET", KEYS[1], "asked_at", ARGV[5])
+if ARGV[2] == "1" then
+	if ARGV[3] == "1" then
+		redis.call("HINCRBY", KEYS[1], "streak", 1)
+	else
+		redis.call("HSET", KEYS[1], "streak", 0)
+	end
+end
+if position >= tonumber(redis.call("HGET", KEYS[1], "size")) then
+	redis.call("HSET", KEYS[1], "finished_at", ARGV[5])
+end
+return position
+`)
+
+func (s *RedisStore) advanceQuiz(userID, quizID, position, answered, points, correct int64, at time.Time) error {
+	key := fmt.Sprintf("quiz:%d:user:%d", quizID, userID)
+	err := advanceQuizScript.Run(s.client, []string{key}, position, answered, correct, points, unixNano(at)).Err()
+	if err != nil && err.Error() == "not started" {
+		return ErrQuizNotStarted
+	}
+	return notFound(err, ErrStaleAnswer)
+}
+
+// AdvanceQuiz implements QuizStore
+func (s *RedisStore) AdvanceQuiz(userID, quizID, position, points int64, correct bool, at time.Time) error {
+	var right int64
+	if correct {
+		right = 1
+	}
+	return s.advanceQuiz(userID, quizID, position, 1, points, right, at)
+}
+
+// SkipQuizQuestion implements QuizStore
+func (s *RedisStore) SkipQuizQuestion(userID, quizID, position int64, at time.Time) error {
+	return s.advanceQuiz(userID, quizID, position, 0, 0, 0, at)
+}
+
+// CreateGame implements GameStore
+func (s *RedisStore) CreateGame(g *GameRecord, playerIDs []int64) error {
+	idsBin, err := json.Marshal(g.QuestionIDs)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("lobby:%d:game", g.LobbyID)
+	playersKey := fmt.Sprintf("lobby:%d:game:players", g.LobbyID)
+	previous, err := s.client.SMembers(playersKey).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	for _, id := range previous {
+		pipe.Del(fmt.Sprintf("lobby:%d:game:player:%s", g.LobbyID, id))
+	}
+	pipe.Del(key, playersKey)
+	pipe.HMSet(key, map[string]interface{}{
+		"question_ids":     string(idsBin),
+		"size":             len(g.QuestionIDs),
+		"round":            g.Round,
+		"round_started_at": unixNano(g.RoundStartedAt),
+		"round_ends_at":    unixNano(g.RoundEndsAt),
+		"started_at":       unixNano(g.StartedAt),
+		"ended_at":         unixNano(g.EndedAt),
+	})
+	for _, id := range playerIDs {
+		pipe.HMSet(fmt.Sprintf("lobby:%d:game:player:%d", g.LobbyID, id), map[string]interface{}{
+			"points":         0,
+			"correct":        0,
+			"answered_round": -1,
+		})
+		pipe.SAdd(playersKey, id)
+	}
+	_, err = pipe.Exec()
+	return err
+}
+
+// GetGame implements GameStore
+func (s *RedisStore) GetGame(lobbyID int64) (*GameRecord, error) {
+	m, err := s.client.HGetAll(fmt.Sprintf("lobby:%d:game", lobbyID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, ErrGameNotFound
+	}
+
+	nums := map[string]int64{}
+	for _, field := range []string{"round", "round_started_at", "round_ends_at", "started_at", "ended_at"} {
+		if nums[field], err = strconv.ParseInt(m[field], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	g := &GameRecord{
+		LobbyID:        lobbyID,
+		Round:          nums["round"],
+		RoundStartedAt: unixTime(nums["round_started_at"]),
+		RoundEndsAt:    unixTime(nums["round_ends_at"]),
+		StartedAt:      unixTime(nums["started_at"]),
+		EndedAt:        unixTime(nums["ended_at"]),
+	}
+	if err := json.Unmarshal([]byte(m["question_ids"]), &g.QuestionIDs); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// answerRoundScript adds the player's answer only while the round is the current one and the player has not answered
+// it yet
+// KEYS: game hash, player hash
+// ARGV: round, points, correct
+// returns 0 once added, 1 if the round is stale, 2 if the player has answered it, 3 if the user is not a player or 4
+// if there is no game
+var answerRoundScript = redis.NewScript(`
+local round = redis.call("HGET", KEYS[1], "round")
+if not round then
+	return 4
+end
+if round ~= ARGV[1] or tonumber(round) >= tonumber(redis.call("HGET", KEYS[1], "size")) then
+	return 1
+end
+local answered = redis.call("HGET", KEYS[2], "answered_round")
+if not answered then
+	return 3
+end
+if tonumber(answered) >= tonumber(round) then
+	return 2
+end
+redis.call("HSET", KEYS[2], "answered_round", round)
+redis.call("HINCRBY", KEYS[2], "points", ARGV[2])
+redis.call("HINCRBY", KEYS[2], "correct", ARGV[3])
+return 0
+`)
+
+// AnswerRound implements GameStore
+func (s *RedisStore) AnswerRound(lobbyID, userID, round, points int64, correct bool) error {
+	var right int64
+	if correct {
+		right = 1
+	}
+	keys := []string{fmt.Sprintf("lobby:%d:game", lobbyID), fmt.Sprintf("lobby:%d:game:player:%d", lobbyID, userID)}
+	res, err := answerRoundScript.Run(s.client, keys, round, points, right).Int64()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 1:
+		return ErrStaleAnswer
+	case 2:
+		return ErrAlreadyAnswered
+	case 3:
+		return ErrNotPlaying
+	case 4:
+		return ErrGameNotFound
+	}
+	return nil
+}
+
+// advanceRoundScript moves the game past the round only if it is still the current one
+// KEYS: game hash
+// ARGV: round, next round started at or game ended at, next round ends at
+// returns 0 once moved, 1 if the round is stale or 2 if there is no game
+var advanceRoundScript = redis.NewScript(`
+local round = redis.call("HGET", KEYS[1], "round")
+if not round then
+	return 2
+end
+local size = tonumber(redis.call("HGET", KEYS[1], "size"))
+if round ~= ARGV[1] or tonumber(round) >= size then
+	return 1
+end
+round = redis.call("HINCRBY", KEYS[1], "round", 1)
+if round >= size then
+	redis.call("HSET", KEYS[1], "ended_at", ARGV[2])
+else
+	redis.call("HSET", KEYS[1], "round_started_at", ARGV[2])
+	redis.call("HSET", KEYS[1], "round_ends_at", ARGV[3])
+end
+return 0
+`)
+
+// AdvanceRound implements GameStore
+func (s *RedisStore) AdvanceRound(lobbyID, round int64, startedAt, endsAt time.Time) error {
+	key := fmt.Sprintf("lobby:%d:game", lobbyID)
+	res, err := advanceRoundScript.Run(s.client, []string{key}, round, unixNano(startedAt), unixNano(endsAt)).Int64()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 1:
+		return ErrStaleAnswer
+	case 2:
+		return ErrGameNotFound
+	}
+	return nil
+}
+
+// ListGamePlayers implements GameStore
+func (s *RedisStore) ListGamePlayers(lobbyID int64) ([]GamePlayerRecord, error) {
+	vals, err := s.client.SMembers(fmt.Sprintf("lobby:%d:game:players", lobbyID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseIDs(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	players := []GamePlayerRecord{}
+	for _, id := range ids {
+		m, err := s.client.HGetAll(fmt.Sprintf("lobby:%d:game:player:%d", lobbyID, id)).Result()
+		if err != nil {
+			return nil, err
+		}
+		p := GamePlayerRecord{UserID: id}
+		if p.Points, err = strconv.ParseInt(m["points"], 10, 64); err != nil {
+			return nil, err
+		}
+		if p.Correct, err = strconv.ParseInt(m["correct"], 10, 64); err != nil {
+			return nil, err
+		}
+		if p.AnsweredRound, err = strconv.ParseInt(m["answered_round"], 10, 64); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	sortGamePlayers(players)
+	return players, nil
+}
+
+// chatEntry is a chat message as it is kept in the lobby's chat list
+type chatEntry struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	Body   string `json:"body"`
+	SentAt int64  `json:"sent_at"`
+}
+
+// AddChatMessage implements ChatStore
+func (s *RedisStore) AddChatMessage(lobbyID int64, m *ChatRecord, limit int64) (int64, error) {
+	id, err := s.client.Incr("chat:next-id").Result()
+	if err != nil {
+		return 0, err
+	}
+	b, err := json.Marshal(chatEntry{ID: id, UserID: m.UserID, Body: m.Body, SentAt: unixNano(m.SentAt)})
+	if err != nil {
+		return 0, err
+	}
+
+	key := fmt.Sprintf("lobby:%d:chat", lobbyID)
+	pipe := s.client.Pipeline()
+	pipe.RPush(key, b)
+	if limit > 0 {
+		pipe.LTrim(key, -limit, -1)
+	} else {
+		pipe.Del(key)
+	}
+	_, err = pipe.Exec()
+	return id, err
+}
+
+// chatEntries reads the lobby's chat list
+func (s *RedisStore) chatEntries(lobbyID int64) ([]string, []chatEntry, error) {
+	vals, err := s.client.LRange(fmt.Sprintf("lobby:%d:chat", lobbyID), 0, -1).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := make([]chatEntry, len(vals))
+	for i, v := range vals {
+		if err := json.Unmarshal([]byte(v), &entries[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return vals, entries, nil
+}
+
+// ListChatMessages implements ChatStore
+func (s *RedisStore) ListChatMessages(lobbyID int64) ([]ChatRecord, error) {
+	_, entries, err := s.chatEntries(lobbyID)
+	if err != nil {
+		return nil, err
+	}
+	chat := []ChatRecord{}
+	for _, e := range entries {
+		chat = append(chat, ChatRecord{ID: e.ID, UserID: e.UserID, Body: e.Body, SentAt: unixTime(e.SentAt)})
+	}
+	return chat, nil
+}
+
+// DeleteChatMessage implements ChatStore
+func (s *RedisStore) DeleteChatMessage(lobbyID, id int64) error {
+	vals, entries, err := s.chatEntries(lobbyID)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.ID != id {
+			continue
+		}
+		n, err := s.client.LRem(fmt.Sprintf("lobby:%d:chat", lobbyID), 1, vals[i]).Result()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// deleted or trimmed away meanwhile
+			return ErrChatNotFound
+		}
+		return nil
+	}
+	return ErrChatNotFound
+}
+
+// SetLobbyMute implements ChatStore
+func (s *RedisStore) SetLobbyMute(lobbyID, userID int64, muted bool) error {
+	return s.setFlag(fmt.Sprintf("lobby:%d:mutes", lobbyID), userID, muted)
+}
+
+// ListLobbyMutes implements ChatStore
+func (s *RedisStore) ListLobbyMutes(lobbyID int64) ([]int64, error) {
+	return s.flagged(fmt.Sprintf("lobby:%d:mutes", lobbyID))
+}
@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// OutcomeT is how a single question of the exam went, a question that has timed out was never answered right
+type OutcomeT struct {
+	Statement   string
+	Answer      string
+	Explanation string
+	Links       []string
+	Misses      int64
+	TimedOut    bool
+}
+
+// ResultT is the summary of the user's exam
+type ResultT struct {
+	Points   int64
+	Attempts int64
+	Correct  int64
+	Accuracy float64
+	Duration time.Duration
+	Outcomes []OutcomeT
+}
+
+// GetResult summarizes the user's exam, the duration runs until now if it has not finished yet
+func GetResult(s Store, userID int64) (*ResultT, error) {
+	uq, err := GetUserQuestion(s, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.GetUserQuestion(uq.id)
+	if err != nil {
+		return nil, err
+	}
+
+	misses, err := s.ListMisses(uq.id)
+	if err != nil {
+		return nil, err
+	}
+
+	timedOut, err := s.ListTimedOut(uq.id)
+	if err != nil {
+		return nil, err
+	}
+	late := map[int64]bool{}
+	for _, id := range timedOut {
+		late[id] = true
+	}
+
+	ids, err := s.ListAskedQuestionIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ResultT{Points: r.Points, Attempts: r.Attempts}
+
+	// the asked questions are listed latest first
+	for i := len(ids) - 1; i >= 0; i-- {
+		qt, err := s.GetQuestion(ids[i])
+		if err == ErrQuestionNotFound {
+			// deleted from the bank since
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Outcomes = append(res.Outcomes, OutcomeT{
+			Statement:   qt.Statement,
+			Answer:      qt.CorrectAnswer(),
+			Explanation: qt.Explanation,
+			Links:       qt.Links,
+			Misses:      misses[ids[i]],
+			TimedOut:    late[ids[i]],
+		})
+	}
+
+	// a question that has timed out is not an attempt
+	res.Correct = res.Attempts
+	for _, n := range misses {
+		res.Correct -= n
+	}
+	if res.Attempts > 0 {
+		res.Accuracy = float64(res.Correct) / float64(res.Attempts) * 100
+	}
+
+	end := r.FinishedAt
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if !r.StartedAt.IsZero() {
+		res.Duration = end.Sub(r.StartedAt).Round(time.Second)
+	}
+
+	return res, nil
+}
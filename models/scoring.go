@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocs/davy/validator"
+)
+
+// ScoringT is the rules that turn a graded answer into points, the zero value scores what QuestionT.Grade gives
+// and nothing for a wrong answer
+type ScoringT struct {
+	// Weighted multiplies the points of a right answer by the question's difficulty
+	Weighted bool `json:"weighted"`
+	// Penalty is taken off for every wrong answer
+	Penalty int64 `json:"penalty"`
+	// StreakEvery raises the multiplier of a right answer by one for every so many right answers in a row, 0 is
+	// no streak bonus
+	StreakEvery int64 `json:"streak_every"`
+	// StreakMax caps the streak multiplier, 0 is no cap
+	StreakMax int64 `json:"streak_max"`
+	// TimeBonus is added to a right answer given within BonusWithin of the question being asked
+	TimeBonus   int64         `json:"time_bonus"`
+	BonusWithin time.Duration `json:"bonus_within"`
+}
+
+// Points gives the points of an answer, grade is what QuestionT.Grade gave it, streak counts the right answers in a
+// row before it and elapsed is how long it took to answer, a wrong answer gives the penalty as negative points
+func (sc ScoringT) Points(grade int64, q *QuestionT, streak int64, elapsed time.Duration) int64 {
+	if grade <= 0 {
+		return -sc.Penalty
+	}
+
+	points := grade
+	if sc.Weighted && q.Difficulty > 1 {
+		points *= q.Difficulty
+	}
+	if sc.TimeBonus > 0 && elapsed >= 0 && elapsed <= sc.BonusWithin {
+		points += sc.TimeBonus
+	}
+	if sc.StreakEvery > 0 {
+		// this answer is part of the streak
+		multiplier := 1 + (streak+1)/sc.StreakEvery
+		if sc.StreakMax > 0 && multiplier > sc.StreakMax {
+			multiplier = sc.StreakMax
+		}
+		points *= multiplier
+	}
+	return points
+}
+
+// Validate checks that no rule is negative
+func (sc ScoringT) Validate() error {
+	return validator.Scoring(sc.Penalty, sc.StreakEvery, sc.StreakMax, sc.TimeBonus, sc.BonusWithin)
+}
@@ -0,0 +1,1427 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// SQLStore is a Store kept in a relational database, either sqlite3 or postgres
+type SQLStore struct {
+	db *sql.DB
+	d  dialect
+}
+
+// NewSQLStore opens the database using a registered driver and migrates its schema to the latest version
+func NewSQLStore(driver, dsn string) (*SQLStore, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, ErrUnknownStore
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite3" {
+		// sqlite only has a single writer, sharing one connection avoids "database is locked"
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := migrate(db, d); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLStore{db: db, d: d}, nil
+}
+
+// Close closes the underlying database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// notFoundRow replaces sql.ErrNoRows with the models' own not found error
+func notFoundRow(err, replacement error) error {
+	if err == sql.ErrNoRows {
+		return replacement
+	}
+	return err
+}
+
+func (s *SQLStore) listIDs(query string, args ...interface{}) ([]int64, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CreateUser implements UserStore
+func (s *SQLStore) CreateUser(username string, hash []byte) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`, username).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrUsernameTaken
+	}
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO users (username, hash) VALUES ($1, $2) RETURNING id`, username, hash).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GetUser implements UserStore
+func (s *SQLStore) GetUser(id int64) (*UserRecord, error) {
+	u := &UserRecord{}
+	err := s.db.QueryRow(`SELECT id, username, hash, lobby_id FROM users WHERE id = $1`, id).
+		Scan(&u.ID, &u.Username, &u.Hash, &u.LobbyID)
+	if err != nil {
+		return nil, notFoundRow(err, ErrUserNotFound)
+	}
+	return u, nil
+}
+
+// GetUserIDByUsername implements UserStore
+func (s *SQLStore) GetUserIDByUsername(username string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT id FROM users WHERE username = $1`, username).Scan(&id)
+	return id, notFoundRow(err, ErrUserNotFound)
+}
+
+// CreateQuestion implements QuestionStore
+func (s *SQLStore) CreateQuestion(q *QuestionT) (int64, error) {
+	choicesBin, err := json.Marshal(q.Choices)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM questions WHERE statement = $1)`, q.Statement).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrQuestionDuplicate
+	}
+
+	tagsBin, err := json.Marshal(q.Tags)
+	if err != nil {
+		return 0, err
+	}
+	answersBin, err := json.Marshal(q.Answers)
+	if err != nil {
+		return 0, err
+	}
+	linksBin, err := json.Marshal(q.Links)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO questions (statement, answer, choices, category, tags, type, answers,
+		partial_credit, tolerance, explanation, links, difficulty, hint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+		q.Statement, q.Answer, string(choicesBin), q.Category, string(tagsBin), q.Type, string(answersBin),
+		q.PartialCredit, q.Tolerance, q.Explanation, string(linksBin), q.Difficulty, q.Hint).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GetQuestion implements QuestionStore
+func (s *SQLStore) GetQuestion(id int64) (*QuestionT, error) {
+	q := &QuestionT{}
+	var choices, tags, answers, links string
+	err := s.db.QueryRow(`SELECT statement, answer, choices, category, tags, type, answers, partial_credit, tolerance,
+		explanation, links, difficulty, hint FROM questions WHERE id = $1`, id).
+		Scan(&q.Statement, &q.Answer, &choices, &q.Category, &tags, &q.Type, &answers, &q.PartialCredit, &q.Tolerance,
+			&q.Explanation, &links, &q.Difficulty, &q.Hint)
+	if err != nil {
+		return nil, notFoundRow(err, ErrQuestionNotFound)
+	}
+	if err := json.Unmarshal([]byte(choices), &q.Choices); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags), &q.Tags); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(answers), &q.Answers); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(links), &q.Links); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// ListQuestionIDs implements QuestionStore
+func (s *SQLStore) ListQuestionIDs() ([]int64, error) {
+	return s.listIDs(`SELECT id FROM questions ORDER BY id DESC`)
+}
+
+// ListCategoryQuestionIDs implements QuestionStore
+func (s *SQLStore) ListCategoryQuestionIDs(category string) ([]int64, error) {
+	return s.listIDs(`SELECT id FROM questions WHERE LOWER(category) = LOWER($1) ORDER BY id DESC`, category)
+}
+
+// ListCategories implements QuestionStore
+func (s *SQLStore) ListCategories() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT category FROM questions WHERE category <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// UpdateQuestion implements QuestionStore
+func (s *SQLStore) UpdateQuestion(id int64, q *QuestionT) error {
+	choicesBin, err := json.Marshal(q.Choices)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM questions WHERE statement = $1 AND id <> $2)`,
+		q.Statement, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrQuestionDuplicate
+	}
+
+	tagsBin, err := json.Marshal(q.Tags)
+	if err != nil {
+		return err
+	}
+	answersBin, err := json.Marshal(q.Answers)
+	if err != nil {
+		return err
+	}
+	linksBin, err := json.Marshal(q.Links)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE questions SET statement = $1, answer = $2, choices = $3, category = $4, tags = $5,
+		type = $6, answers = $7, partial_credit = $8, tolerance = $9, explanation = $10, links = $11,
+		difficulty = $12, hint = $13 WHERE id = $14`,
+		q.Statement, q.Answer, string(choicesBin), q.Category, string(tagsBin), q.Type, string(answersBin),
+		q.PartialCredit, q.Tolerance, q.Explanation, string(linksBin), q.Difficulty, q.Hint, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrQuestionNotFound
+	}
+	return tx.Commit()
+}
+
+// DeleteQuestion implements QuestionStore
+func (s *SQLStore) DeleteQuestion(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM questions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrQuestionNotFound
+	}
+	return nil
+}
+
+// CreateUserQuestion implements UserQuestionStore
+func (s *SQLStore) CreateUserQuestion(userID, questionID int64, category string, at time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO user_questions (user_id, question_id, started_at, assigned_at, category)
+		VALUES ($1, $2, $3, $3, $4) RETURNING id`, userID, questionID, unixNano(at), category).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM asked_questions WHERE user_id = $1`, userID); err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`INSERT INTO asked_questions (user_id, question_id) VALUES ($1, $2)`, userID, questionID)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GetUserQuestion implements UserQuestionStore
+func (s *SQLStore) GetUserQuestion(id int64) (*UserQuestionRecord, error) {
+	uq := &UserQuestionRecord{}
+	var startedAt, finishedAt, assignedAt int64
+	var deadline, examDeadline int64
+	var hidden string
+	err := s.db.QueryRow(`SELECT id, user_id, question_id, points, attempts, started_at, finished_at, assigned_at,
+		category, deadline, exam_deadline, streak, hidden, hinted, fifty_fifties, hints
+		FROM user_questions WHERE id = $1`, id).
+		Scan(&uq.ID, &uq.UserID, &uq.QuestionID, &uq.Points, &uq.Attempts, &startedAt, &finishedAt, &assignedAt,
+			&uq.Category, &deadline, &examDeadline, &uq.Streak, &hidden, &uq.Hinted, &uq.FiftyFifties, &uq.Hints)
+	if err != nil {
+		return nil, notFoundRow(err, ErrEmptyUserQuestion)
+	}
+	if err := json.Unmarshal([]byte(hidden), &uq.Hidden); err != nil {
+		return nil, err
+	}
+	uq.StartedAt = unixTime(startedAt)
+	uq.FinishedAt = unixTime(finishedAt)
+	uq.AssignedAt = unixTime(assignedAt)
+	uq.Deadline = unixTime(deadline)
+	uq.ExamDeadline = unixTime(examDeadline)
+	return uq, nil
+}
+
+// GetUserQuestionIDByUserID implements UserQuestionStore
+func (s *SQLStore) GetUserQuestionIDByUserID(userID int64) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT id FROM user_questions WHERE user_id = $1 ORDER BY id DESC LIMIT 1`, userID).Scan(&id)
+	return id, notFoundRow(err, ErrEmptyUserQuestion)
+}
+
+// ListAskedQuestionIDs implements UserQuestionStore
+func (s *SQLStore) ListAskedQuestionIDs(userID int64) ([]int64, error) {
+	return s.listIDs(`SELECT question_id FROM asked_questions WHERE user_id = $1 ORDER BY id DESC`, userID)
+}
+
+// AssignQuestion implements UserQuestionStore
+func (s *SQLStore) AssignQuestion(id, questionID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`SELECT user_id FROM user_questions WHERE id = $1`, id).Scan(&userID)
+	if err != nil {
+		return notFoundRow(err, ErrEmptyUserQuestion)
+	}
+	_, err = tx.Exec(`UPDATE user_questions SET question_id = $1, hidden = '[]', hinted = FALSE WHERE id = $2`,
+		questionID, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO asked_questions (user_id, question_id) VALUES ($1, $2)`, userID, questionID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddPoints implements UserQuestionStore
+func (s *SQLStore) AddPoints(id, amount int64) (int64, error) {
+	var points int64
+	err := s.db.QueryRow(`UPDATE user_questions SET points = points + $1 WHERE id = $2 RETURNING points`, amount, id).
+		Scan(&points)
+	return points, notFoundRow(err, ErrEmptyUserQuestion)
+}
+
+// AdvanceUserQuestion implements UserQuestionStore
+func (s *SQLStore) AdvanceUserQuestion(id, fromQuestionID, nextQuestionID, amount int64, at time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var finishedAt int64
+	if nextQuestionID == 0 {
+		finishedAt = unixNano(at)
+	}
+
+	var userID, points int64
+	err = tx.QueryRow(`UPDATE user_questions
+		SET attempts = attempts + 1, points = points + $1, question_id = $2, finished_at = $3, assigned_at = $4,
+			deadline = 0, streak = streak + 1, hidden = '[]', hinted = FALSE
+		WHERE id = $5 AND question_id = $6 RETURNING user_id, points`,
+		amount, nextQuestionID, finishedAt, unixNano(at), id, fromQuestionID).Scan(&userID, &points)
+	if err != nil {
+		return 0, notFoundRow(err, ErrStaleAnswer)
+	}
+	if nextQuestionID != 0 {
+		_, err = tx.Exec(`INSERT INTO asked_questions (user_id, question_id) VALUES ($1, $2)`, userID, nextQuestionID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO leaderboard (user_id, score) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET score = excluded.score`, userID, points)
+	if err != nil {
+		return 0, err
+	}
+	return points, tx.Commit()
+}
+
+// SkipQuestion implements UserQuestionStore
+func (s *SQLStore) SkipQuestion(id, fromQuestionID, nextQuestionID int64, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var finishedAt int64
+	if nextQuestionID == 0 {
+		finishedAt = unixNano(at)
+	}
+
+	var userID int64
+	err = tx.QueryRow(`UPDATE user_questions SET question_id = $1, finished_at = $2, assigned_at = $3, deadline = 0,
+			hidden = '[]', hinted = FALSE
+		WHERE id = $4 AND question_id = $5 RETURNING user_id`,
+		nextQuestionID, finishedAt, unixNano(at), id, fromQuestionID).Scan(&userID)
+	if err != nil {
+		return notFoundRow(err, ErrStaleAnswer)
+	}
+	if nextQuestionID != 0 {
+		_, err = tx.Exec(`INSERT INTO asked_questions (user_id, question_id) VALUES ($1, $2)`, userID, nextQuestionID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TimeOutQuestion implements UserQuestionStore
+func (s *SQLStore) TimeOutQuestion(id, fromQuestionID, nextQuestionID, penalty int64, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var finishedAt int64
+	if nextQuestionID == 0 {
+		finishedAt = unixNano(at)
+	}
+
+	var userID, points int64
+	err = tx.QueryRow(`UPDATE user_questions SET question_id = $1, finished_at = $2, assigned_at = $3, deadline = 0,
+			hidden = '[]', hinted = FALSE, streak = 0, points = points - $4
+		WHERE id = $5 AND question_id = $6 RETURNING user_id, points`,
+		nextQuestionID, finishedAt, unixNano(at), penalty, id, fromQuestionID).Scan(&userID, &points)
+	if err != nil {
+		return notFoundRow(err, ErrStaleAnswer)
+	}
+	if nextQuestionID != 0 {
+		_, err = tx.Exec(`INSERT INTO asked_questions (user_id, question_id) VALUES ($1, $2)`, userID, nextQuestionID)
+		if err != nil {
+			return err
+		}
+	}
+	if penalty != 0 {
+		_, err = tx.Exec(`INSERT INTO leaderboard (user_id, score) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET score = excluded.score`, userID, points)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO user_question_timeouts (user_question_id, question_id) VALUES ($1, $2)
+		ON CONFLICT (user_question_id, question_id) DO NOTHING`, id, fromQuestionID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListTimedOut implements UserQuestionStore
+func (s *SQLStore) ListTimedOut(id int64) ([]int64, error) {
+	return s.listIDs(`SELECT question_id FROM user_question_timeouts WHERE user_question_id = $1`, id)
+}
+
+// ServeQuestion implements UserQuestionStore
+func (s *SQLStore) ServeQuestion(id, questionID int64, deadline, examDeadline time.Time) error {
+	res, err := s.db.Exec(`UPDATE user_questions
+		SET deadline = CASE WHEN deadline = 0 THEN $1 ELSE deadline END,
+			exam_deadline = CASE WHEN exam_deadline = 0 THEN $2 ELSE exam_deadline END
+		WHERE id = $3 AND question_id = $4`, unixNano(deadline), unixNano(examDeadline), id, questionID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStaleAnswer
+	}
+	return nil
+}
+
+// RecordMiss implements UserQuestionStore
+func (s *SQLStore) RecordMiss(id, questionID, penalty int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID, points int64
+	err = tx.QueryRow(`UPDATE user_questions SET attempts = attempts + 1, streak = 0, points = points - $1
+		WHERE id = $2 AND question_id = $3 RETURNING user_id, points`, penalty, id, questionID).Scan(&userID, &points)
+	if err != nil {
+		return notFoundRow(err, ErrStaleAnswer)
+	}
+	if penalty != 0 {
+		_, err = tx.Exec(`INSERT INTO leaderboard (user_id, score) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET score = excluded.score`, userID, points)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO user_question_misses (user_question_id, question_id, misses) VALUES ($1, $2, 1)
+		ON CONFLICT (user_question_id, question_id) DO UPDATE SET misses = user_question_misses.misses + 1`,
+		id, questionID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// useLifeline runs the update that counts the lifeline only if it can be used, otherwise tells why it cannot, used
+// tells whether the lifeline has been used on the current question
+func (s *SQLStore) useLifeline(id, questionID int64, used func(uq *UserQuestionRecord) bool, query string,
+	args ...interface{}) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	uq, err := s.GetUserQuestion(id)
+	if err != nil {
+		return err
+	}
+	if uq.QuestionID != questionID {
+		return ErrStaleAnswer
+	}
+	if used(uq) {
+		return ErrLifelineUsed
+	}
+	return ErrNoLifelines
+}
+
+// UseFiftyFifty implements UserQuestionStore
+func (s *SQLStore) UseFiftyFifty(id, questionID, limit int64, hidden []string) error {
+	hiddenBin, err := json.Marshal(hidden)
+	if err != nil {
+		return err
+	}
+	return s.useLifeline(id, questionID, func(uq *UserQuestionRecord) bool { return len(uq.Hidden) > 0 },
+		`UPDATE user_questions SET hidden = $1, fifty_fifties = fifty_fifties + 1
+		WHERE id = $2 AND question_id = $3 AND hidden = '[]' AND fifty_fifties < $4`,
+		string(hiddenBin), id, questionID, limit)
+}
+
+// UseHint implements UserQuestionStore
+func (s *SQLStore) UseHint(id, questionID, limit int64) error {
+	return s.useLifeline(id, questionID, func(uq *UserQuestionRecord) bool { return uq.Hinted },
+		`UPDATE user_questions SET hinted = TRUE, hints = hints + 1
+		WHERE id = $1 AND question_id = $2 AND hinted = FALSE AND hints < $3`,
+		id, questionID, limit)
+}
+
+// ListMisses implements UserQuestionStore
+func (s *SQLStore) ListMisses(id int64) (map[int64]int64, error) {
+	rows, err := s.db.Query(`SELECT question_id, misses FROM user_question_misses WHERE user_question_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	misses := map[int64]int64{}
+	for rows.Next() {
+		var questionID, n int64
+		if err := rows.Scan(&questionID, &n); err != nil {
+			return nil, err
+		}
+		misses[questionID] = n
+	}
+	return misses, rows.Err()
+}
+
+// CreateLobby implements LobbyStore
+func (s *SQLStore) CreateLobby(hostID int64, code string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO lobbies (code, host_id, status, active_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (code) DO NOTHING RETURNING id`, code, hostID, StatusWaiting, unixNano(time.Now())).Scan(&id)
+	if err != nil {
+		return 0, notFoundRow(err, ErrLobbyCodeTaken)
+	}
+	if _, err := tx.Exec(`UPDATE users SET lobby_id = $1 WHERE id = $2`, id, hostID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`INSERT INTO lobby_members (lobby_id, user_id) VALUES ($1, $2)`, id, hostID); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GetLobby implements LobbyStore
+func (s *SQLStore) GetLobby(id int64) (*LobbyRecord, error) {
+	l := &LobbyRecord{}
+	var roundTime, activeAt, startsAt int64
+	err := s.db.QueryRow(`SELECT id, code, host_id, status, max_players, public, rounds, round_time, category,
+		active_at, starts_at FROM lobbies WHERE id = $1`, id).
+		Scan(&l.ID, &l.Code, &l.HostID, &l.Status, &l.Settings.MaxPlayers, &l.Settings.Public, &l.Settings.Rounds,
+			&roundTime, &l.Settings.Category, &activeAt, &startsAt)
+	if err != nil {
+		return nil, notFoundRow(err, ErrLobbyNotFound)
+	}
+	l.Settings.RoundTime = time.Duration(roundTime)
+	l.ActiveAt = unixTime(activeAt)
+	l.StartsAt = unixTime(startsAt)
+	return l, nil
+}
+
+// ListPublicLobbyIDs implements LobbyStore
+func (s *SQLStore) ListPublicLobbyIDs() ([]int64, error) {
+	return s.listIDs(`SELECT id FROM lobbies WHERE public AND status = $1 ORDER BY id`, StatusWaiting)
+}
+
+// SetLobbySettings implements LobbyStore
+func (s *SQLStore) SetLobbySettings(id int64, settings LobbySettings) error {
+	_, err := s.db.Exec(`UPDATE lobbies SET max_players = $1, public = $2, rounds = $3, round_time = $4, category = $5
+		WHERE id = $6`, settings.MaxPlayers, settings.Public, settings.Rounds, int64(settings.RoundTime),
+		settings.Category, id)
+	return err
+}
+
+// GetLobbyIDByCode implements LobbyStore
+func (s *SQLStore) GetLobbyIDByCode(code string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT id FROM lobbies WHERE code = $1`, code).Scan(&id)
+	return id, notFoundRow(err, ErrLobbyNotFound)
+}
+
+// SetLobbyHost implements LobbyStore
+func (s *SQLStore) SetLobbyHost(id, hostID int64) error {
+	_, err := s.db.Exec(`UPDATE lobbies SET host_id = $1 WHERE id = $2`, hostID, id)
+	return err
+}
+
+// SetLobbyStatus implements LobbyStore
+func (s *SQLStore) SetLobbyStatus(id, status int64) error {
+	_, err := s.db.Exec(`UPDATE lobbies SET status = $1 WHERE id = $2`, status, id)
+	return err
+}
+
+// SetLobbyStartsAt implements LobbyStore
+func (s *SQLStore) SetLobbyStartsAt(id int64, at time.Time) error {
+	_, err := s.db.Exec(`UPDATE lobbies SET starts_at = $1 WHERE id = $2`, unixNano(at), id)
+	return err
+}
+
+// AddLobbyMember implements LobbyStore
+func (s *SQLStore) AddLobbyMember(id, userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the lobby is locked first so that the members of concurrent joins are counted one join after another
+	var locked int64
+	if err := tx.QueryRow(`SELECT id FROM lobbies WHERE id = $1 `+s.d.forUpdate, id).Scan(&locked); err != nil {
+		return notFoundRow(err, ErrLobbyNotFound)
+	}
+
+	// the member is only inserted while the lobby has room for it
+	res, err := tx.Exec(`INSERT INTO lobby_members (lobby_id, user_id)
+		SELECT $1, $2 FROM lobbies
+		WHERE id = $1 AND (max_players = 0 OR (SELECT COUNT(*) FROM lobby_members WHERE lobby_id = $1) < max_players)
+		ON CONFLICT (lobby_id, user_id) DO NOTHING`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var member bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM lobby_members WHERE lobby_id = $1 AND user_id = $2)`, id, userID).
+			Scan(&member)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return ErrLobbyFull
+		}
+	}
+	if _, err := tx.Exec(`UPDATE users SET lobby_id = $1 WHERE id = $2`, id, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveLobbyMember implements LobbyStore
+func (s *SQLStore) RemoveLobbyMember(id, userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET lobby_id = -1 WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM lobby_members WHERE lobby_id = $1 AND user_id = $2`, id, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SwapLobbyStatus implements LobbyStore
+func (s *SQLStore) SwapLobbyStatus(id, from, to int64) error {
+	res, err := s.db.Exec(`UPDATE lobbies SET status = $1 WHERE id = $2 AND status = $3`, to, id, from)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.GetLobby(id); err != nil {
+			return err
+		}
+		return ErrLobbyStatus
+	}
+	return nil
+}
+
+// IsLobbyMember implements LobbyStore
+func (s *SQLStore) IsLobbyMember(id, userID int64) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM lobby_members WHERE lobby_id = $1 AND user_id = $2)`,
+		id, userID).Scan(&exists)
+	return exists, err
+}
+
+// ListLobbyMembers implements LobbyStore
+func (s *SQLStore) ListLobbyMembers(id int64) ([]int64, error) {
+	return s.listIDs(`SELECT user_id FROM lobby_members WHERE lobby_id = $1 ORDER BY id`, id)
+}
+
+// SetLobbyCoHost implements LobbyStore
+func (s *SQLStore) SetLobbyCoHost(id, userID int64, cohost bool) error {
+	_, err := s.db.Exec(`UPDATE lobby_members SET cohost = $1 WHERE lobby_id = $2 AND user_id = $3`, cohost, id, userID)
+	return err
+}
+
+// ListLobbyCoHosts implements LobbyStore
+func (s *SQLStore) ListLobbyCoHosts(id int64) ([]int64, error) {
+	return s.listIDs(`SELECT user_id FROM lobby_members WHERE lobby_id = $1 AND cohost ORDER BY user_id`, id)
+}
+
+// SetLobbyReady implements LobbyStore
+func (s *SQLStore) SetLobbyReady(id, userID int64, ready bool) error {
+	_, err := s.db.Exec(`UPDATE lobby_members SET ready = $1 WHERE lobby_id = $2 AND user_id = $3`, ready, id, userID)
+	return err
+}
+
+// ListLobbyReady implements LobbyStore
+func (s *SQLStore) ListLobbyReady(id int64) ([]int64, error) {
+	return s.listIDs(`SELECT user_id FROM lobby_members WHERE lobby_id = $1 AND ready ORDER BY user_id`, id)
+}
+
+// SetLobbyBan implements LobbyStore
+func (s *SQLStore) SetLobbyBan(id, userID int64, banned bool) error {
+	if !banned {
+		_, err := s.db.Exec(`DELETE FROM lobby_bans WHERE lobby_id = $1 AND user_id = $2`, id, userID)
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO lobby_bans (lobby_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (lobby_id, user_id) DO NOTHING`, id, userID)
+	return err
+}
+
+// IsLobbyBanned implements LobbyStore
+func (s *SQLStore) IsLobbyBanned(id, userID int64) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM lobby_bans WHERE lobby_id = $1 AND user_id = $2)`,
+		id, userID).Scan(&exists)
+	return exists, err
+}
+
+// ListLobbyBans implements LobbyStore
+func (s *SQLStore) ListLobbyBans(id int64) ([]int64, error) {
+	return s.listIDs(`SELECT user_id FROM lobby_bans WHERE lobby_id = $1 ORDER BY user_id`, id)
+}
+
+// TouchLobby implements LobbyStore
+func (s *SQLStore) TouchLobby(id int64, at time.Time) error {
+	res, err := s.db.Exec(`UPDATE lobbies SET active_at = $1 WHERE id = $2`, unixNano(at), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLobbyNotFound
+	}
+	return nil
+}
+
+// ListIdleLobbyIDs implements LobbyStore
+func (s *SQLStore) ListIdleLobbyIDs(before time.Time) ([]int64, error) {
+	return s.listIDs(`SELECT id FROM lobbies WHERE active_at < $1 ORDER BY id`, unixNano(before))
+}
+
+// DeleteLobby implements LobbyStore
+func (s *SQLStore) DeleteLobby(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET lobby_id = -1 WHERE lobby_id = $1`, id); err != nil {
+		return err
+	}
+	for _, table := range []string{"lobby_members", "lobby_bans", "lobby_mutes", "lobby_chats", "game_players", "games"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE lobby_id = $1`, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM lobbies WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetStaleUserLobbies implements LobbyStore
+func (s *SQLStore) ResetStaleUserLobbies() (int64, error) {
+	res, err := s.db.Exec(`UPDATE users SET lobby_id = -1 WHERE lobby_id <> -1 AND NOT EXISTS
+		(SELECT 1 FROM lobby_members WHERE lobby_members.lobby_id = users.lobby_id AND lobby_members.user_id = users.id)`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CreateUpdate implements UpdateStore
+func (s *SQLStore) CreateUpdate(userID int64, body string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO updates (user_id, body) VALUES ($1, $2) RETURNING id`, userID, body).Scan(&id)
+	return id, err
+}
+
+// GetUpdate implements UpdateStore
+func (s *SQLStore) GetUpdate(id int64) (*UpdateRecord, error) {
+	u := &UpdateRecord{}
+	err := s.db.QueryRow(`SELECT id, user_id, body FROM updates WHERE id = $1`, id).Scan(&u.ID, &u.UserID, &u.Body)
+	if err != nil {
+		return nil, notFoundRow(err, ErrUpdateNotFound)
+	}
+	return u, nil
+}
+
+// ListUpdateIDs implements UpdateStore
+func (s *SQLStore) ListUpdateIDs(count int64) ([]int64, error) {
+	return s.listIDs(`SELECT id FROM updates ORDER BY id DESC LIMIT $1`, count)
+}
+
+// ListUserUpdateIDs implements UpdateStore
+func (s *SQLStore) ListUserUpdateIDs(userID, count int64) ([]int64, error) {
+	return s.listIDs(`SELECT id FROM updates WHERE user_id = $1 ORDER BY id DESC LIMIT $2`, userID, count)
+}
+
+// SetScore implements RankStore
+func (s *SQLStore) SetScore(userID, score int64) error {
+	_, err := s.db.Exec(`INSERT INTO leaderboard (user_id, score) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET score = excluded.score`, userID, score)
+	return err
+}
+
+// GetRank implements RankStore
+func (s *SQLStore) GetRank(userID int64) (int64, error) {
+	var score int64
+	err := s.db.QueryRow(`SELECT score FROM leaderboard WHERE user_id = $1`, userID).Scan(&score)
+	if err != nil {
+		return 0, notFoundRow(err, ErrUserNotRanked)
+	}
+
+	var rank int64
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM leaderboard WHERE score < $1 OR (score = $1 AND user_id < $2)`,
+		score, userID).Scan(&rank)
+	return rank, err
+}
+
+// listScores reads the scores, only non-negative ranks are supported unlike redis
+func (s *SQLStore) listScores(order string, start, stop int64) ([]ScoreRecord, error) {
+	if start < 0 {
+		start = 0
+	}
+	if stop < start {
+		return []ScoreRecord{}, nil
+	}
+
+	rows, err := s.db.Query(`SELECT user_id, score FROM leaderboard ORDER BY `+order+` LIMIT $1 OFFSET $2`,
+		stop-start+1, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := []ScoreRecord{}
+	for rows.Next() {
+		var sr ScoreRecord
+		if err := rows.Scan(&sr.UserID, &sr.Score); err != nil {
+			return nil, err
+		}
+		scores = append(scores, sr)
+	}
+	return scores, rows.Err()
+}
+
+// ListScores implements RankStore
+func (s *SQLStore) ListScores(start, stop int64) ([]ScoreRecord, error) {
+	return s.listScores("score, user_id", start, stop)
+}
+
+// ListTopScores implements RankStore
+func (s *SQLStore) ListTopScores(start, stop int64) ([]ScoreRecord, error) {
+	return s.listScores("score DESC, user_id DESC", start, stop)
+}
+
+// CreateAnswer implements AnswerStore
+func (s *SQLStore) CreateAnswer(a *AnswerRecord) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO answers (user_id, question_id, choice, correct, answered_at, elapsed)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		a.UserID, a.QuestionID, a.Choice, a.Correct, unixNano(a.AnsweredAt), int64(a.Elapsed)).Scan(&id)
+	return id, err
+}
+
+// ListAnswers implements AnswerStore
+func (s *SQLStore) ListAnswers(userID, offset, count int64) ([]AnswerRecord, error) {
+	rows, err := s.db.Query(`SELECT id, user_id, question_id, choice, correct, answered_at, elapsed
+		FROM answers WHERE user_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3`, userID, count, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	answers := []AnswerRecord{}
+	for rows.Next() {
+		var a AnswerRecord
+		var answeredAt, elapsed int64
+		if err := rows.Scan(&a.ID, &a.UserID, &a.QuestionID, &a.Choice, &a.Correct, &answeredAt, &elapsed); err != nil {
+			return nil, err
+		}
+		a.AnsweredAt = unixTime(answeredAt)
+		a.Elapsed = time.Duration(elapsed)
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
+
+// CountAnswers implements AnswerStore
+func (s *SQLStore) CountAnswers(userID int64) (int64, error) {
+	var n int64
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM answers WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+// SaveCard implements StudyStore
+func (s *SQLStore) SaveCard(c *CardRecord) error {
+	_, err := s.db.Exec(`INSERT INTO cards (user_id, question_id, box, reviews, lapses, due_at, reviewed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, question_id) DO UPDATE SET box = excluded.box, reviews = excluded.reviews,
+			lapses = excluded.lapses, due_at = excluded.due_at, reviewed_at = excluded.reviewed_at`,
+		c.UserID, c.QuestionID, c.Box, c.Reviews, c.Lapses, unixNano(c.DueAt), unixNano(c.ReviewedAt))
+	return err
+}
+
+// GetCard implements StudyStore
+func (s *SQLStore) GetCard(userID, questionID int64) (*CardRecord, error) {
+	c := &CardRecord{UserID: userID, QuestionID: questionID}
+	var dueAt, reviewedAt int64
+	err := s.db.QueryRow(`SELECT box, reviews, lapses, due_at, reviewed_at FROM cards
+		WHERE user_id = $1 AND question_id = $2`, userID, questionID).
+		Scan(&c.Box, &c.Reviews, &c.Lapses, &dueAt, &reviewedAt)
+	if err != nil {
+		return nil, notFoundRow(err, ErrCardNotFound)
+	}
+	c.DueAt = unixTime(dueAt)
+	c.ReviewedAt = unixTime(reviewedAt)
+	return c, nil
+}
+
+// ListCards implements StudyStore
+func (s *SQLStore) ListCards(userID int64) ([]CardRecord, error) {
+	rows, err := s.db.Query(`SELECT question_id, box, reviews, lapses, due_at, reviewed_at FROM cards
+		WHERE user_id = $1 ORDER BY due_at, question_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := []CardRecord{}
+	for rows.Next() {
+		c := CardRecord{UserID: userID}
+		var dueAt, reviewedAt int64
+		if err := rows.Scan(&c.QuestionID, &c.Box, &c.Reviews, &c.Lapses, &dueAt, &reviewedAt); err != nil {
+			return nil, err
+		}
+		c.DueAt = unixTime(dueAt)
+		c.ReviewedAt = unixTime(reviewedAt)
+		cards = append(cards, c)
+	}
+	return cards, rows.Err()
+}
+
+// CreateQuiz implements QuizStore
+func (s *SQLStore) CreateQuiz(q *QuizT) (int64, error) {
+	idsBin, err := json.Marshal(q.QuestionIDs)
+	if err != nil {
+		return 0, err
+	}
+	scoringBin, err := json.Marshal(q.Scoring)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = s.db.QueryRow(`INSERT INTO quizzes (title, description, question_ids, shuffle, pass_mark, published, scoring)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		q.Title, q.Description, string(idsBin), q.Shuffle, q.PassMark, q.Published, string(scoringBin)).Scan(&id)
+	return id, err
+}
+
+// GetQuiz implements QuizStore
+func (s *SQLStore) GetQuiz(id int64) (*QuizT, error) {
+	q := &QuizT{}
+	var ids, scoring string
+	err := s.db.QueryRow(`SELECT title, description, question_ids, shuffle, pass_mark, published, scoring
+		FROM quizzes WHERE id = $1`, id).
+		Scan(&q.Title, &q.Description, &ids, &q.Shuffle, &q.PassMark, &q.Published, &scoring)
+	if err != nil {
+		return nil, notFoundRow(err, ErrQuizNotFound)
+	}
+	if err := json.Unmarshal([]byte(ids), &q.QuestionIDs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scoring), &q.Scoring); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// ListQuizIDs implements QuizStore
+func (s *SQLStore) ListQuizIDs() ([]int64, error) {
+	return s.listIDs(`SELECT id FROM quizzes ORDER BY id`)
+}
+
+// UpdateQuiz implements QuizStore
+func (s *SQLStore) UpdateQuiz(id int64, q *QuizT) error {
+	idsBin, err := json.Marshal(q.QuestionIDs)
+	if err != nil {
+		return err
+	}
+	scoringBin, err := json.Marshal(q.Scoring)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec(`UPDATE quizzes SET title = $1, description = $2, question_ids = $3, shuffle = $4,
+		pass_mark = $5, published = $6, scoring = $7 WHERE id = $8`,
+		q.Title, q.Description, string(idsBin), q.Shuffle, q.PassMark, q.Published, string(scoringBin), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrQuizNotFound
+	}
+	return nil
+}
+
+// DeleteQuiz implements QuizStore
+func (s *SQLStore) DeleteQuiz(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM quizzes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrQuizNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM quiz_progress WHERE quiz_id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// StartQuiz implements QuizStore
+func (s *SQLStore) StartQuiz(userID, quizID int64, questionIDs []int64, at time.Time) error {
+	idsBin, err := json.Marshal(questionIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO quiz_progress (user_id, quiz_id, question_ids, size, started_at, asked_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (user_id, quiz_id) DO UPDATE SET question_ids = excluded.question_ids, size = excluded.size,
+			position = 0, answered = 0, correct = 0, points = 0, started_at = excluded.started_at, finished_at = 0,
+			streak = 0, asked_at = excluded.asked_at`,
+		userID, quizID, string(idsBin), len(questionIDs), unixNano(at))
+	return err
+}
+
+// GetQuizProgress implements QuizStore
+func (s *SQLStore) GetQuizProgress(userID, quizID int64) (*QuizProgressRecord, error) {
+	p := &QuizProgressRecord{UserID: userID, QuizID: quizID}
+	var ids string
+	var startedAt, finishedAt, askedAt int64
+	err := s.db.QueryRow(`SELECT question_ids, position, answered, correct, points, started_at, finished_at, streak,
+			asked_at
+		FROM quiz_progress WHERE user_id = $1 AND quiz_id = $2`, userID, quizID).
+		Scan(&ids, &p.Position, &p.Answered, &p.Correct, &p.Points, &startedAt, &finishedAt, &p.Streak, &askedAt)
+	if err != nil {
+		return nil, notFoundRow(err, ErrQuizNotStarted)
+	}
+	if err := json.Unmarshal([]byte(ids), &p.QuestionIDs); err != nil {
+		return nil, err
+	}
+	p.StartedAt = unixTime(startedAt)
+	p.FinishedAt = unixTime(finishedAt)
+	p.AskedAt = unixTime(askedAt)
+	return p, nil
+}
+
+func (s *SQLStore) advanceQuiz(userID, quizID, position, answered, points, correct int64, at time.Time) error {
+	res, err := s.db.Exec(`UPDATE quiz_progress SET position = position + 1, answered = answered + $1,
+			correct = correct + $2, points = points + $3, asked_at = $4,
+			finished_at = CASE WHEN position + 1 >= size THEN $4 ELSE finished_at END,
+			streak = CASE WHEN $1 = 0 THEN streak WHEN $2 = 1 THEN streak + 1 ELSE 0 END
+		WHERE user_id = $5 AND quiz_id = $6 AND position = $7`,
+		answered, correct, points, unixNano(at), userID, quizID, position)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.GetQuizProgress(userID, quizID); err != nil {
+			return err
+		}
+		return ErrStaleAnswer
+	}
+	return nil
+}
+
+// AdvanceQuiz implements QuizStore
+func (s *SQLStore) AdvanceQuiz(userID, quizID, position, points int64, correct bool, at time.Time) error {
+	var right int64
+	if correct {
+		right = 1
+	}
+	return s.advanceQuiz(userID, quizID, position, 1, points, right, at)
+}
+
+// SkipQuizQuestion implements QuizStore
+func (s *SQLStore) SkipQuizQuestion(userID, quizID, position int64, at time.Time) error {
+	return s.advanceQuiz(userID, quizID, position, 0, 0, 0, at)
+}
+
+// CreateGame implements GameStore
+func (s *SQLStore) CreateGame(g *GameRecord, playerIDs []int64) error {
+	idsBin, err := json.Marshal(g.QuestionIDs)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO games (lobby_id, question_ids, size, round, round_started_at, round_ends_at,
+			started_at, ended_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (lobby_id) DO UPDATE SET question_ids = excluded.question_ids, size = excluded.size,
+			round = excluded.round, round_started_at = excluded.round_started_at,
+			round_ends_at = excluded.round_ends_at, started_at = excluded.started_at, ended_at = excluded.ended_at`,
+		g.LobbyID, string(idsBin), len(g.QuestionIDs), g.Round, unixNano(g.RoundStartedAt), unixNano(g.RoundEndsAt),
+		unixNano(g.StartedAt), unixNano(g.EndedAt))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM game_players WHERE lobby_id = $1`, g.LobbyID); err != nil {
+		return err
+	}
+	for _, id := range playerIDs {
+		_, err := tx.Exec(`INSERT INTO game_players (lobby_id, user_id) VALUES ($1, $2)`, g.LobbyID, id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetGame implements GameStore
+func (s *SQLStore) GetGame(lobbyID int64) (*GameRecord, error) {
+	g := &GameRecord{LobbyID: lobbyID}
+	var ids string
+	var roundStartedAt, roundEndsAt, startedAt, endedAt int64
+	err := s.db.QueryRow(`SELECT question_ids, round, round_started_at, round_ends_at, started_at, ended_at
+		FROM games WHERE lobby_id = $1`, lobbyID).
+		Scan(&ids, &g.Round, &roundStartedAt, &roundEndsAt, &startedAt, &endedAt)
+	if err != nil {
+		return nil, notFoundRow(err, ErrGameNotFound)
+	}
+	if err := json.Unmarshal([]byte(ids), &g.QuestionIDs); err != nil {
+		return nil, err
+	}
+	g.RoundStartedAt = unixTime(roundStartedAt)
+	g.RoundEndsAt = unixTime(roundEndsAt)
+	g.StartedAt = unixTime(startedAt)
+	g.EndedAt = unixTime(endedAt)
+	return g, nil
+}
+
+// AnswerRound implements GameStore
+func (s *SQLStore) AnswerRound(lobbyID, userID, round, points int64, correct bool) error {
+	var right int64
+	if correct {
+		right = 1
+	}
+	res, err := s.db.Exec(`UPDATE game_players SET answered_round = $1, points = points + $2, correct = correct + $3
+		WHERE lobby_id = $4 AND user_id = $5 AND answered_round < $1
+			AND EXISTS (SELECT 1 FROM games WHERE lobby_id = $4 AND round = $1 AND round < size)`,
+		round, points, right, lobbyID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	g, err := s.GetGame(lobbyID)
+	if err != nil {
+		return err
+	}
+	if g.Round != round || round >= int64(len(g.QuestionIDs)) {
+		return ErrStaleAnswer
+	}
+	var answered int64
+	err = s.db.QueryRow(`SELECT answered_round FROM game_players WHERE lobby_id = $1 AND user_id = $2`,
+		lobbyID, userID).Scan(&answered)
+	if err != nil {
+		return notFoundRow(err, ErrNotPlaying)
+	}
+	return ErrAlreadyAnswered
+}
+
+// AdvanceRound implements GameStore
+func (s *SQLStore) AdvanceRound(lobbyID, round int64, startedAt, endsAt time.Time) error {
+	res, err := s.db.Exec(`UPDATE games SET round = round + 1,
+			round_started_at = CASE WHEN round + 1 >= size THEN round_started_at ELSE $1 END,
+			round_ends_at = CASE WHEN round + 1 >= size THEN round_ends_at ELSE $2 END,
+			ended_at = CASE WHEN round + 1 >= size THEN $1 ELSE ended_at END
+		WHERE lobby_id = $3 AND round = $4 AND round < size`,
+		unixNano(startedAt), unixNano(endsAt), lobbyID, round)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.GetGame(lobbyID); err != nil {
+			return err
+		}
+		return ErrStaleAnswer
+	}
+	return nil
+}
+
+// ListGamePlayers implements GameStore
+func (s *SQLStore) ListGamePlayers(lobbyID int64) ([]GamePlayerRecord, error) {
+	rows, err := s.db.Query(`SELECT user_id, points, correct, answered_round FROM game_players
+		WHERE lobby_id = $1 ORDER BY points DESC, correct DESC, user_id`, lobbyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	players := []GamePlayerRecord{}
+	for rows.Next() {
+		var p GamePlayerRecord
+		if err := rows.Scan(&p.UserID, &p.Points, &p.Correct, &p.AnsweredRound); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// AddChatMessage implements ChatStore
+func (s *SQLStore) AddChatMessage(lobbyID int64, m *ChatRecord, limit int64) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO lobby_chats (lobby_id, user_id, body, sent_at) VALUES ($1, $2, $3, $4) RETURNING id`,
+		lobbyID, m.UserID, m.Body, unixNano(m.SentAt)).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`DELETE FROM lobby_chats WHERE lobby_id = $1 AND id NOT IN
+		(SELECT id FROM lobby_chats WHERE lobby_id = $1 ORDER BY id DESC LIMIT $2)`, lobbyID, limit)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// ListChatMessages implements ChatStore
+func (s *SQLStore) ListChatMessages(lobbyID int64) ([]ChatRecord, error) {
+	rows, err := s.db.Query(`SELECT id, user_id, body, sent_at FROM lobby_chats WHERE lobby_id = $1 ORDER BY id`,
+		lobbyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chat := []ChatRecord{}
+	for rows.Next() {
+		var m ChatRecord
+		var sentAt int64
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Body, &sentAt); err != nil {
+			return nil, err
+		}
+		m.SentAt = unixTime(sentAt)
+		chat = append(chat, m)
+	}
+	return chat, rows.Err()
+}
+
+// DeleteChatMessage implements ChatStore
+func (s *SQLStore) DeleteChatMessage(lobbyID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM lobby_chats WHERE lobby_id = $1 AND id = $2`, lobbyID, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrChatNotFound
+	}
+	return nil
+}
+
+// SetLobbyMute implements ChatStore
+func (s *SQLStore) SetLobbyMute(lobbyID, userID int64, muted bool) error {
+	if !muted {
+		_, err := s.db.Exec(`DELETE FROM lobby_mutes WHERE lobby_id = $1 AND user_id = $2`, lobbyID, userID)
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO lobby_mutes (lobby_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (lobby_id, user_id) DO NOTHING`, lobbyID, userID)
+	return err
+}
+
+// ListLobbyMutes implements ChatStore
+func (s *SQLStore) ListLobbyMutes(lobbyID int64) ([]int64, error) {
+	return s.listIDs(`SELECT user_id FROM lobby_mutes WHERE lobby_id = $1 ORDER BY user_id`, lobbyID)
+}
@@ -0,0 +1,424 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Store is the persistence layer behind every manager in this package
+type Store interface {
+	UserStore
+	QuestionStore
+	UserQuestionStore
+	LobbyStore
+	UpdateStore
+	RankStore
+	AnswerStore
+	StudyStore
+	QuizStore
+	GameStore
+	ChatStore
+}
+
+// UserRecord is the stored form of a user
+type UserRecord struct {
+	ID       int64
+	Username string
+	Hash     []byte
+	LobbyID  int64
+}
+
+// UserStore persists the users
+type UserStore interface {
+	// CreateUser saves a new user which is not in a lobby, returns ErrUsernameTaken if the username already existed
+	CreateUser(username string, hash []byte) (int64, error)
+	// GetUser returns ErrUserNotFound if the user does not exist
+	GetUser(id int64) (*UserRecord, error)
+	// GetUserIDByUsername returns ErrUserNotFound if the username does not exist
+	GetUserIDByUsername(username string) (int64, error)
+}
+
+// QuestionStore persists the question bank
+type QuestionStore interface {
+	// CreateQuestion returns ErrQuestionDuplicate if the statement already existed
+	CreateQuestion(q *QuestionT) (int64, error)
+	// GetQuestion returns ErrQuestionNotFound if the question does not exist
+	GetQuestion(id int64) (*QuestionT, error)
+	// ListQuestionIDs lists every question in the bank
+	ListQuestionIDs() ([]int64, error)
+	// ListCategoryQuestionIDs lists the questions of the category whatever its case, the latest first
+	ListCategoryQuestionIDs(category string) ([]int64, error)
+	// ListCategories lists the categories the questions are in, a category may come in several cases
+	ListCategories() ([]string, error)
+	// UpdateQuestion replaces the question, returns ErrQuestionNotFound if it does not exist or
+	// ErrQuestionDuplicate if another question already has the statement
+	UpdateQuestion(id int64, q *QuestionT) error
+	// DeleteQuestion removes the question from the bank, returns ErrQuestionNotFound if it does not exist
+	DeleteQuestion(id int64) error
+}
+
+// UserQuestionRecord is the stored form of a user's exam progress, QuestionID is 0 once the exam is finished
+type UserQuestionRecord struct {
+	ID         int64
+	UserID     int64
+	QuestionID int64
+	Points     int64
+	Attempts   int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// AssignedAt is when the current question was given
+	AssignedAt time.Time
+	// Category limits the exam to the questions of the category, empty means every question
+	Category string
+	// Deadline is when the time to answer the current question runs out, zero if it has not been served with one
+	Deadline time.Time
+	// ExamDeadline is when the time of the whole exam runs out, zero if it is not timed
+	ExamDeadline time.Time
+	// Streak counts the right answers in a row
+	Streak int64
+	// Hidden is the wrong choices of the current question taken away by the 50/50
+	Hidden []string
+	// Hinted tells whether the hint of the current question has been shown
+	Hinted bool
+	// FiftyFifties and Hints count the lifelines used during the exam
+	FiftyFifties int64
+	Hints        int64
+}
+
+// UserQuestionStore persists the users' exam progress
+type UserQuestionStore interface {
+	// CreateUserQuestion starts the user's progress on the given question, forgetting the questions given before,
+	// the exam only gives questions of the category unless it is empty
+	CreateUserQuestion(userID, questionID int64, category string, at time.Time) (int64, error)
+	// GetUserQuestion returns ErrEmptyUserQuestion if the progress does not exist
+	GetUserQuestion(id int64) (*UserQuestionRecord, error)
+	// GetUserQuestionIDByUserID returns ErrEmptyUserQuestion if the user has no progress yet
+	GetUserQuestionIDByUserID(userID int64) (int64, error)
+	// ListAskedQuestionIDs lists the questions already given to the user
+	ListAskedQuestionIDs(userID int64) ([]int64, error)
+	// AssignQuestion sets the current question and records it as given to the user
+	AssignQuestion(id, questionID int64) error
+	// AddPoints increments the points and returns the new total
+	AddPoints(id, amount int64) (int64, error)
+	// AdvanceUserQuestion atomically counts the attempt, adds the points and to the streak, assigns the next
+	// question at the given time and puts the new total on the leaderboard, returns ErrStaleAnswer if the current
+	// question is no longer fromQuestionID, a nextQuestionID of 0 finishes the exam instead
+	AdvanceUserQuestion(id, fromQuestionID, nextQuestionID, amount int64, at time.Time) (int64, error)
+	// SkipQuestion is AdvanceUserQuestion without counting an attempt or adding points, e.g. when the current
+	// question has been deleted
+	SkipQuestion(id, fromQuestionID, nextQuestionID int64, at time.Time) error
+	// TimeOutQuestion is SkipQuestion for a question whose time has run out, it is recorded as timed out, the streak
+	// is broken and a penalty is taken off the points and the leaderboard, it is not counted as an attempt
+	TimeOutQuestion(id, fromQuestionID, nextQuestionID, penalty int64, at time.Time) error
+	// ListTimedOut lists the questions whose time has run out before they were answered right
+	ListTimedOut(id int64) ([]int64, error)
+	// ServeQuestion sets the deadlines unless they are already set, the question's is cleared whenever the next
+	// question is assigned, returns ErrStaleAnswer if the current question is no longer questionID
+	ServeQuestion(id, questionID int64, deadline, examDeadline time.Time) error
+	// RecordMiss counts a wrong attempt on the question and breaks the streak, a penalty is taken off the points
+	// and the leaderboard, returns ErrStaleAnswer if the current question is no longer questionID
+	RecordMiss(id, questionID, penalty int64) error
+	// ListMisses maps the questions to their wrong attempts
+	ListMisses(id int64) (map[int64]int64, error)
+	// UseFiftyFifty hides the choices of the current question and counts the lifeline, returns ErrStaleAnswer if the
+	// current question is no longer questionID, ErrLifelineUsed if it has been used on the question already or
+	// ErrNoLifelines if the exam has used limit of them, the lifelines are forgotten once the next question is assigned
+	UseFiftyFifty(id, questionID, limit int64, hidden []string) error
+	// UseHint is UseFiftyFifty for showing the hint of the current question
+	UseHint(id, questionID, limit int64) error
+}
+
+// LobbySettings are how the host has set the lobby up, a new lobby has the zero settings
+type LobbySettings struct {
+	// MaxPlayers caps the members, 0 leaves the lobby uncapped
+	MaxPlayers int64
+	// Public lobbies are listed for anybody to join, private ones are joined by their code only
+	Public bool
+	// Rounds and RoundTime override the server's game rules unless 0
+	Rounds    int64
+	RoundTime time.Duration
+	// Category limits the game to the questions of the category, empty means every question
+	Category string
+}
+
+// LobbyRecord is the stored form of a lobby
+type LobbyRecord struct {
+	ID       int64
+	Code     string
+	HostID   int64
+	Status   int64
+	Settings LobbySettings
+	// ActiveAt is when the lobby was last used, the janitor deletes the lobbies left idle for too long
+	ActiveAt time.Time
+	// StartsAt is when the starting lobby's countdown runs out and its game begins
+	StartsAt time.Time
+}
+
+// LobbyStore persists the lobbies and their members
+type LobbyStore interface {
+	// CreateLobby saves a waiting lobby with the host as its first member, active from now, returns ErrLobbyCodeTaken
+	// if a lobby still has the code
+	CreateLobby(hostID int64, code string) (int64, error)
+	// GetLobby returns ErrLobbyNotFound if the lobby does not exist
+	GetLobby(id int64) (*LobbyRecord, error)
+	// GetLobbyIDByCode returns ErrLobbyNotFound if no lobby has the code
+	GetLobbyIDByCode(code string) (int64, error)
+	SetLobbyHost(id, hostID int64) error
+	SetLobbyStatus(id, status int64) error
+	// SetLobbyStartsAt sets when the starting lobby's game begins
+	SetLobbyStartsAt(id int64, at time.Time) error
+	// SwapLobbyStatus sets the status only if it is still from, returns ErrLobbyStatus otherwise so that a lobby
+	// moves on once when several requests try
+	SwapLobbyStatus(id, from, to int64) error
+	// SetLobbySettings replaces the lobby's settings
+	SetLobbySettings(id int64, settings LobbySettings) error
+	// ListPublicLobbyIDs lists the public lobbies that are waiting, the oldest first
+	ListPublicLobbyIDs() ([]int64, error)
+	// AddLobbyMember adds the member and points the user's lobby to it, ErrLobbyFull is returned if the lobby already
+	// has its MaxPlayers members, even when several users join at once
+	AddLobbyMember(id, userID int64) error
+	// RemoveLobbyMember removes the member along with its co-host role and its ready mark and resets the user's lobby
+	RemoveLobbyMember(id, userID int64) error
+	IsLobbyMember(id, userID int64) (bool, error)
+	// ListLobbyMembers lists the members in the order they joined
+	ListLobbyMembers(id int64) ([]int64, error)
+	// SetLobbyCoHost gives the member the co-host role or takes it away
+	SetLobbyCoHost(id, userID int64, cohost bool) error
+	ListLobbyCoHosts(id int64) ([]int64, error)
+	// SetLobbyReady marks the member as ready for the game or not, a member is not ready once it has left
+	SetLobbyReady(id, userID int64, ready bool) error
+	ListLobbyReady(id int64) ([]int64, error)
+	// SetLobbyBan bans the user from joining the lobby or lifts the ban
+	SetLobbyBan(id, userID int64, banned bool) error
+	IsLobbyBanned(id, userID int64) (bool, error)
+	ListLobbyBans(id int64) ([]int64, error)
+	// TouchLobby marks the lobby as used at the time, returns ErrLobbyNotFound if the lobby does not exist
+	TouchLobby(id int64, at time.Time) error
+	// ListIdleLobbyIDs lists the lobbies last used before the time
+	ListIdleLobbyIDs(before time.Time) ([]int64, error)
+	// DeleteLobby deletes the lobby along with its members, roles, bans, chat and game, and frees its code, the members
+	// whose lobby is still this one are reset
+	DeleteLobby(id int64) error
+	// ResetStaleUserLobbies resets the lobby of the users who are not members of it anymore, returns how many it reset
+	ResetStaleUserLobbies() (int64, error)
+}
+
+// UpdateRecord is the stored form of an update
+type UpdateRecord struct {
+	ID     int64
+	UserID int64
+	Body   string
+}
+
+// UpdateStore persists the updates posted by the users
+type UpdateStore interface {
+	CreateUpdate(userID int64, body string) (int64, error)
+	// GetUpdate returns ErrUpdateNotFound if the update does not exist
+	GetUpdate(id int64) (*UpdateRecord, error)
+	// ListUpdateIDs lists up to count of the latest updates
+	ListUpdateIDs(count int64) ([]int64, error)
+	// ListUserUpdateIDs lists up to count of the latest updates of the user
+	ListUserUpdateIDs(userID, count int64) ([]int64, error)
+}
+
+// ScoreRecord is a single entry of the leaderboard
+type ScoreRecord struct {
+	UserID int64
+	Score  int64
+}
+
+// RankStore persists the leaderboard
+type RankStore interface {
+	// SetScore replaces the user's score
+	SetScore(userID, score int64) error
+	// GetRank returns the zero-based ascending rank, or ErrUserNotRanked
+	GetRank(userID int64) (int64, error)
+	// ListScores lists the scores between the ascending ranks start and stop inclusive
+	ListScores(start, stop int64) ([]ScoreRecord, error)
+	// ListTopScores lists the scores between the descending ranks start and stop inclusive
+	ListTopScores(start, stop int64) ([]ScoreRecord, error)
+}
+
+// AnswerRecord is a single graded submission of the exam
+type AnswerRecord struct {
+	ID         int64
+	UserID     int64
+	QuestionID int64
+	Choice     string
+	Correct    bool
+	AnsweredAt time.Time
+	// Elapsed is the time it took since the question was given
+	Elapsed time.Duration
+}
+
+// AnswerStore persists the append-only history of the exam submissions
+type AnswerStore interface {
+	CreateAnswer(a *AnswerRecord) (int64, error)
+	// ListAnswers lists the user's answers latest first, skipping offset and up to count
+	ListAnswers(userID, offset, count int64) ([]AnswerRecord, error)
+	CountAnswers(userID int64) (int64, error)
+}
+
+// CardRecord is the user's spaced-repetition schedule of a single question
+type CardRecord struct {
+	UserID     int64
+	QuestionID int64
+	// Box is the Leitner box, 1 is reviewed the most often
+	Box        int64
+	Reviews    int64
+	Lapses     int64
+	DueAt      time.Time
+	ReviewedAt time.Time
+}
+
+// StudyStore persists the users' study schedules
+type StudyStore interface {
+	// SaveCard creates or replaces the card of the user and question
+	SaveCard(c *CardRecord) error
+	// GetCard returns ErrCardNotFound if the user has not studied the question
+	GetCard(userID, questionID int64) (*CardRecord, error)
+	// ListCards lists the user's cards, the soonest due first
+	ListCards(userID int64) ([]CardRecord, error)
+}
+
+// QuizProgressRecord is the stored form of a user's progress through a quiz, it is finished once Position has
+// gone past the last of QuestionIDs
+type QuizProgressRecord struct {
+	UserID int64
+	QuizID int64
+	// QuestionIDs is the order the questions are asked in, shuffled when the quiz was started if the quiz says so
+	QuestionIDs []int64
+	Position    int64
+	// Answered counts the questions answered, the ones deleted from the bank meanwhile are skipped unanswered
+	Answered   int64
+	Correct    int64
+	Points     int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// Streak counts the right answers in a row
+	Streak int64
+	// AskedAt is when the current question came up, at the start or the last answer or skip
+	AskedAt time.Time
+}
+
+// QuizStore persists the quizzes and the users' progress through them
+type QuizStore interface {
+	CreateQuiz(q *QuizT) (int64, error)
+	// GetQuiz returns ErrQuizNotFound if the quiz does not exist
+	GetQuiz(id int64) (*QuizT, error)
+	// ListQuizIDs lists every quiz, oldest first
+	ListQuizIDs() ([]int64, error)
+	// UpdateQuiz replaces the quiz, returns ErrQuizNotFound if it does not exist
+	UpdateQuiz(id int64, q *QuizT) error
+	// DeleteQuiz removes the quiz and everyone's progress through it, returns ErrQuizNotFound if it does not exist
+	DeleteQuiz(id int64) error
+
+	// StartQuiz starts the user's progress through the quiz over on the given questions
+	StartQuiz(userID, quizID int64, questionIDs []int64, at time.Time) error
+	// GetQuizProgress returns ErrQuizNotStarted if the user has not started the quiz
+	GetQuizProgress(userID, quizID int64) (*QuizProgressRecord, error)
+	// AdvanceQuiz counts the answer of the question at position and moves on to the next, the quiz is finished at
+	// the last one, a right answer adds to the streak and a wrong one breaks it, returns ErrStaleAnswer if the user
+	// is no longer at position
+	AdvanceQuiz(userID, quizID, position, points int64, correct bool, at time.Time) error
+	// SkipQuizQuestion is AdvanceQuiz without counting an answer, e.g. when the question has been deleted
+	SkipQuizQuestion(userID, quizID, position int64, at time.Time) error
+}
+
+// GameRecord is the stored form of a lobby's game, Round indexes the current question of QuestionIDs and reaches its
+// length once the game is over
+type GameRecord struct {
+	LobbyID     int64
+	QuestionIDs []int64
+	Round       int64
+	// RoundStartedAt and RoundEndsAt is the window the answers to the current round are taken in
+	RoundStartedAt time.Time
+	RoundEndsAt    time.Time
+	StartedAt      time.Time
+	EndedAt        time.Time
+}
+
+// GamePlayerRecord is a player's score in a lobby's game
+type GamePlayerRecord struct {
+	UserID  int64
+	Points  int64
+	Correct int64
+	// AnsweredRound is the last round the player has answered, -1 before the first answer
+	AnsweredRound int64
+}
+
+// GameStore persists the games played in the lobbies, a lobby has one game at a time
+type GameStore interface {
+	// CreateGame starts the lobby's game over with the players and opens its first round
+	CreateGame(g *GameRecord, playerIDs []int64) error
+	// GetGame returns ErrGameNotFound if the lobby has not started a game
+	GetGame(lobbyID int64) (*GameRecord, error)
+	// AnswerRound adds the points of the player's answer to the round, returns ErrStaleAnswer if the round is not the
+	// current one, ErrAlreadyAnswered if the player has answered it or ErrNotPlaying if the user is not a player
+	AnswerRound(lobbyID, userID, round, points int64, correct bool) error
+	// AdvanceRound moves the game past the round and opens the next one's window, past the last round the game ends
+	// at startedAt instead, returns ErrStaleAnswer if the game has moved past the round already
+	AdvanceRound(lobbyID, round int64, startedAt, endsAt time.Time) error
+	// ListGamePlayers lists the players of the lobby's game, see sortGamePlayers
+	ListGamePlayers(lobbyID int64) ([]GamePlayerRecord, error)
+}
+
+// ChatRecord is the stored form of a message in a lobby's chat
+type ChatRecord struct {
+	ID     int64
+	UserID int64
+	Body   string
+	SentAt time.Time
+}
+
+// ChatStore persists the lobbies' chat and the members muted in it
+type ChatStore interface {
+	// AddChatMessage saves the message under a new id and drops the lobby's oldest messages past the limit
+	AddChatMessage(lobbyID int64, m *ChatRecord, limit int64) (int64, error)
+	// ListChatMessages lists the lobby's messages the oldest first
+	ListChatMessages(lobbyID int64) ([]ChatRecord, error)
+	// DeleteChatMessage returns ErrChatNotFound if the lobby has no such message
+	DeleteChatMessage(lobbyID, id int64) error
+	// SetLobbyMute mutes the member in the lobby's chat or lets it talk again
+	SetLobbyMute(lobbyID, userID int64, muted bool) error
+	ListLobbyMutes(lobbyID int64) ([]int64, error)
+}
+
+// unixNano stores a time as nanoseconds, the zero time as 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// unixTime reads a time stored by unixNano
+func unixTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// sortCards orders the cards the soonest due first, the ties by question
+func sortCards(cards []CardRecord) {
+	sort.Slice(cards, func(i, j int) bool {
+		if !cards[i].DueAt.Equal(cards[j].DueAt) {
+			return cards[i].DueAt.Before(cards[j].DueAt)
+		}
+		return cards[i].QuestionID < cards[j].QuestionID
+	})
+}
+
+// sortGamePlayers orders the players the most points first, the ties by right answers and then by user
+func sortGamePlayers(players []GamePlayerRecord) {
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].Points != players[j].Points {
+			return players[i].Points > players[j].Points
+		}
+		if players[i].Correct != players[j].Correct {
+			return players[i].Correct > players[j].Correct
+		}
+		return players[i].UserID < players[j].UserID
+	})
+}
@@ -0,0 +1,1917 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// stores lists every backend the conformance tests run against
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	sqlite, err := NewSQLStore("sqlite3", filepath.Join(t.TempDir(), "davy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	return map[string]Store{
+		"memory":  NewMemoryStore(),
+		"sqlite3": sqlite,
+		"redis":   NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+}
+
+func TestStoreUsers(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != ErrUsernameTaken {
+				t.Errorf("expected=%v, result=%v", ErrUsernameTaken, err)
+			}
+
+			u, err := AuthenticateUser(s, "alice", "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := AuthenticateUser(s, "alice", "wrong"); err != ErrInvalidLogin {
+				t.Errorf("expected=%v, result=%v", ErrInvalidLogin, err)
+			}
+			if _, err := GetUserByUsername(s, "bob"); err != ErrUserNotFound {
+				t.Errorf("expected=%v, result=%v", ErrUserNotFound, err)
+			}
+			if ok, _ := IsUser(s, u.GetUserID()+1); ok {
+				t.Error("unknown user id is a user")
+			}
+			if _, err := u.GetLobby(); err != ErrUserNotInLobby {
+				t.Errorf("expected=%v, result=%v", ErrUserNotInLobby, err)
+			}
+		})
+	}
+}
+
+func TestStoreUserQuestions(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, err := GetUserByUsername(s, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			uq, err := GetUserQuestion(s, u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := uq.GetQuestion()
+			if err != nil {
+				t.Fatal(err)
+			}
+			qt, err := GetQuestion(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qt.Answer != "Norway" || len(qt.Choices) != 4 {
+				t.Errorf("unexpected question: %+v", qt)
+			}
+
+			ok, err := UserConfirmAnswer(s, u.GetUserID(), 0, "Norway")
+			if err != nil || !ok {
+				t.Fatalf("expected a correct answer: ok=%v err=%v", ok, err)
+			}
+			if p, _ := uq.GetPoints(); p != 1 {
+				t.Errorf("points not same: expected=%d, result=%d", 1, p)
+			}
+
+			qs, err := uq.GetUnansweredQuestions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(qs) != 1 {
+				t.Errorf("unanswered not same: expected=%d, result=%d", 1, len(qs))
+			}
+		})
+	}
+}
+
+// answerAll answers the user's questions until the exam finishes, each with one wrong choice first
+func answerAll(t *testing.T, s Store, userID int64) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		uq, err := GetUserQuestion(s, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if finished, _ := uq.IsFinished(); finished {
+			return
+		}
+		q, _ := uq.GetQuestion()
+		qt, err := GetQuestion(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := UserConfirmAnswer(s, userID, 0, "wrong"); ok || err != nil {
+			t.Fatalf("expected a wrong answer: ok=%v err=%v", ok, err)
+		}
+		if ok, err := UserConfirmAnswer(s, userID, 0, qt.Answer); !ok || err != nil {
+			t.Fatalf("expected a correct answer: ok=%v err=%v", ok, err)
+		}
+	}
+	t.Fatal("exam did not finish")
+}
+
+func TestStoreFinishExam(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, _ := GetUserByUsername(s, "alice")
+			answerAll(t, s, u.GetUserID())
+
+			if n, _ := s.CountAnswers(u.GetUserID()); n != 6 {
+				t.Errorf("answers not same: expected=%d, result=%d", 6, n)
+			}
+
+			if _, err := UserConfirmAnswer(s, u.GetUserID(), 0, "Norway"); err != ErrExamFinished {
+				t.Errorf("expected=%v, result=%v", ErrExamFinished, err)
+			}
+
+			res, err := GetResult(s, u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Points != 3 || res.Attempts != 6 || res.Correct != 3 || res.Accuracy != 50 {
+				t.Errorf("unexpected result: %+v", res)
+			}
+			if len(res.Outcomes) != 3 || res.Outcomes[0].Answer != "Norway" || res.Outcomes[0].Misses != 1 {
+				t.Errorf("unexpected outcomes: %+v", res.Outcomes)
+			}
+
+			if err := RestartExam(s, u.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			uq, _ := GetUserQuestion(s, u.GetUserID())
+			if finished, _ := uq.IsFinished(); finished {
+				t.Error("restarted exam is finished")
+			}
+			if qs, _ := uq.GetUnansweredQuestions(); len(qs) != 2 {
+				t.Errorf("unanswered not same: expected=%d, result=%d", 2, len(qs))
+			}
+			if ranks, _ := TopRanks(s); len(ranks) != 1 || ranks[0].Score != 0 {
+				t.Errorf("unexpected leaderboard: %v", ranks)
+			}
+		})
+	}
+}
+
+func TestStoreQuestionBank(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, err := GetUserByUsername(s, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			choices := []string{"Wales", "Sweden", "England"}
+			edited := &QuestionT{Statement: "What is not in United Kingdom?", Answer: "Sweden", Choices: choices}
+			if err := EditQuestion(s, 1, edited); err != nil {
+				t.Fatal(err)
+			}
+			edited.Statement = "What is the biggest island in the world?"
+			if err := EditQuestion(s, 1, edited); err != ErrQuestionDuplicate {
+				t.Errorf("expected=%v, result=%v", ErrQuestionDuplicate, err)
+			}
+			if err := EditQuestion(s, 99, &QuestionT{Statement: "Unknown?", Answer: "Sweden", Choices: choices}); err != ErrQuestionNotFound {
+				t.Errorf("expected=%v, result=%v", ErrQuestionNotFound, err)
+			}
+			// the old statement is free again while the new one is taken
+			if _, err := s.CreateQuestion(&QuestionT{Statement: "What is not in United Kingdom?"}); err != ErrQuestionDuplicate {
+				t.Errorf("expected=%v, result=%v", ErrQuestionDuplicate, err)
+			}
+			added := &QuestionT{Statement: "What is not part of United Kingdom?", Answer: "Norway", Choices: []string{"Norway", "Wales"}}
+			if _, err := AddQuestion(s, added); err != nil {
+				t.Fatal(err)
+			}
+
+			qt, err := s.GetQuestion(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qt.Answer != "Sweden" || !reflect.DeepEqual(qt.Choices, choices) {
+				t.Errorf("question is not updated: %+v", qt)
+			}
+
+			items, err := SearchQuestions(s, "united KINGDOM")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 2 || items[0].ID != 1 || items[1].ID != 4 {
+				t.Errorf("unexpected search: %+v", items)
+			}
+
+			// alice is on the first question when it is deleted
+			if err := DeleteQuestion(s, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := DeleteQuestion(s, 1); err != ErrQuestionNotFound {
+				t.Errorf("expected=%v, result=%v", ErrQuestionNotFound, err)
+			}
+			if _, err := s.GetQuestion(1); err != ErrQuestionNotFound {
+				t.Errorf("expected=%v, result=%v", ErrQuestionNotFound, err)
+			}
+			if ids, _ := s.ListQuestionIDs(); len(ids) != 3 {
+				t.Errorf("deleted question is still listed: %v", ids)
+			}
+			if _, err := s.CreateQuestion(&QuestionT{Statement: "What is not in United Kingdom?"}); err != nil {
+				t.Errorf("statement of the deleted question is still taken: %v", err)
+			}
+
+			if _, err := UserConfirmAnswer(s, u.GetUserID(), 1, "Sweden"); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			uq, err := GetUserQuestion(s, u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := uq.SkipDeletedQuestion(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := s.GetUserQuestion(uq.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.QuestionID == 1 || r.QuestionID == 0 || r.Attempts != 0 {
+				t.Errorf("deleted question is not skipped: %+v", r)
+			}
+			if _, err := s.GetQuestion(r.QuestionID); err != nil {
+				t.Errorf("skipped to a missing question: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreCategories(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, err := GetUserByUsername(s, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			qt, err := s.GetQuestion(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qt.Category != "Geography" || !reflect.DeepEqual(qt.Tags, []string{"europe", "countries"}) {
+				t.Errorf("category and tags are not loaded: %+v", qt)
+			}
+			if !strings.Contains(qt.Explanation, "Norway is a separate Scandinavian country") ||
+				!reflect.DeepEqual(qt.Links, []string{"https://en.wikipedia.org/wiki/Countries_of_the_United_Kingdom"}) {
+				t.Errorf("explanation and links are not loaded: %+v", qt)
+			}
+
+			q := &QuestionT{Statement: "What is 1 + 1?", Answer: "2", Choices: []string{"1", "2"},
+				Category: " Math ", Tags: []string{" numbers", "", "numbers", "easy"}}
+			id, err := AddQuestion(s, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qt, _ := s.GetQuestion(id); qt.Category != "Math" || !reflect.DeepEqual(qt.Tags, []string{"numbers", "easy"}) {
+				t.Errorf("category and tags are not normalized: %+v", qt)
+			}
+
+			categories, err := ListCategories(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(categories, []string{"Culture", "Geography", "Math"}) {
+				t.Errorf("unexpected categories: %v", categories)
+			}
+
+			if err := StartExam(s, u.GetUserID(), "Sports"); err != ErrEmptyCategory {
+				t.Errorf("expected=%v, result=%v", ErrEmptyCategory, err)
+			}
+			if err := StartExam(s, u.GetUserID(), "geography"); err != nil {
+				t.Fatal(err)
+			}
+			uq, err := GetUserQuestion(s, u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c, _ := uq.GetCategory(); c != "Geography" {
+				t.Errorf("category not same: expected=%s, result=%s", "Geography", c)
+			}
+
+			// only the other geography question is left after the first one
+			qs, err := uq.GetUnansweredQuestions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(qs) != 1 {
+				t.Fatalf("unanswered questions not same: expected=%d, result=%d", 1, len(qs))
+			}
+			if qt, _ := GetQuestion(qs[0]); qt.Category != "Geography" {
+				t.Errorf("question of another category is given: %+v", qt)
+			}
+
+			answerAll(t, s, u.GetUserID())
+			res, err := GetResult(s, u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Outcomes) != 2 || res.Points != 2 {
+				t.Errorf("unexpected result: %+v", res)
+			}
+
+			if err := RestartExam(s, u.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			if uq, err = GetUserQuestion(s, u.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			if finished, _ := uq.IsFinished(); finished {
+				t.Error("exam is not restarted")
+			}
+			if c, _ := uq.GetCategory(); c != "Geography" {
+				t.Errorf("category is not kept on restart: %s", c)
+			}
+
+			ids, err := s.ListCategoryQuestionIDs("geography")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 2 || ids[0] < ids[1] {
+				t.Errorf("unexpected geography questions: %v", ids)
+			}
+
+			// the index follows a question moved to another category and a deleted one
+			q.Category = "Geography"
+			if err := EditQuestion(s, id, q); err != nil {
+				t.Fatal(err)
+			}
+			if ids, _ := s.ListCategoryQuestionIDs("Geography"); len(ids) != 3 || ids[0] != id {
+				t.Errorf("edited question is not indexed: %v", ids)
+			}
+			if ids, _ := s.ListCategoryQuestionIDs("Math"); len(ids) != 0 {
+				t.Errorf("edited question is left in its old category: %v", ids)
+			}
+			if err := DeleteQuestion(s, id); err != nil {
+				t.Fatal(err)
+			}
+			if ids, _ := s.ListCategoryQuestionIDs("Geography"); len(ids) != 2 {
+				t.Errorf("deleted question is still indexed: %v", ids)
+			}
+			if categories, _ := ListCategories(s); !reflect.DeepEqual(categories, []string{"Culture", "Geography"}) {
+				t.Errorf("unexpected categories: %v", categories)
+			}
+		})
+	}
+}
+
+func TestStoreQuestionTypes(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, err := GetUserByUsername(s, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			multiple := &QuestionT{Statement: "Which are in Scandinavia?", Type: TypeMultiple,
+				Choices: []string{"Wales", "Norway", "Sweden"}, Answers: []string{"Norway", "Sweden"}, PartialCredit: true}
+			if _, err := AddQuestion(s, multiple); err != nil {
+				t.Fatal(err)
+			}
+			numeric := &QuestionT{Statement: "What is pi?", Type: TypeNumeric, Answer: "3.14", Tolerance: 0.005}
+			if _, err := AddQuestion(s, numeric); err != nil {
+				t.Fatal(err)
+			}
+
+			for id, want := range map[int64]*QuestionT{1: multiple, 2: numeric} {
+				qt, err := s.GetQuestion(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if qt.Type != want.Type || !reflect.DeepEqual(qt.Answers, want.Answers) ||
+					qt.PartialCredit != want.PartialCredit || qt.Tolerance != want.Tolerance {
+					t.Errorf("question not same: expected=%+v, result=%+v", want, qt)
+				}
+			}
+
+			// the first question is the multiple-select one
+			if ok, err := UserConfirmAnswer(s, u.GetUserID(), 1, "Norway", "Wales"); ok || err != nil {
+				t.Fatalf("expected a wrong answer: ok=%v err=%v", ok, err)
+			}
+			if ok, err := UserConfirmAnswer(s, u.GetUserID(), 1, "Norway", "Sweden"); !ok || err != nil {
+				t.Fatalf("expected a correct answer: ok=%v err=%v", ok, err)
+			}
+			if ok, err := UserConfirmAnswer(s, u.GetUserID(), 2, "3.141"); !ok || err != nil {
+				t.Fatalf("expected a correct answer: ok=%v err=%v", ok, err)
+			}
+
+			res, err := GetResult(s, u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the multiple-select question gives partial credit, a point for each of its 2 answers
+			if res.Points != 3 || res.Outcomes[0].Answer != "Norway, Sweden" {
+				t.Errorf("unexpected result: %+v", res)
+			}
+
+			page, err := GetAnswerPage(s, u.GetUserID(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != 3 || page.Answers[1].Choice != "Norway, Sweden" {
+				t.Errorf("unexpected answers: %+v", page.Answers)
+			}
+		})
+	}
+}
+
+func TestStoreAnswerHistory(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			at := time.Unix(1600000000, 0)
+			for i := 0; i < answersPerPage+5; i++ {
+				_, err := s.CreateAnswer(&AnswerRecord{
+					UserID:     7,
+					QuestionID: 1,
+					Choice:     fmt.Sprint(i),
+					Correct:    i%2 == 0,
+					AnsweredAt: at.Add(time.Duration(i) * time.Second),
+					Elapsed:    1500 * time.Millisecond,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			page, err := GetAnswerPage(s, 7, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != answersPerPage+5 || page.Pages != 2 || len(page.Answers) != answersPerPage {
+				t.Errorf("unexpected page: total=%d pages=%d len=%d", page.Total, page.Pages, len(page.Answers))
+			}
+			latest := page.Answers[0]
+			if latest.Choice != fmt.Sprint(answersPerPage+4) || !latest.Correct || latest.TimeToAnswer != 1.5 ||
+				latest.Statement != "What is not part of United Kingdom?" ||
+				!latest.AnsweredAt.Equal(at.Add((answersPerPage+4)*time.Second)) {
+				t.Errorf("unexpected latest answer: %+v", latest)
+			}
+
+			page, err = GetAnswerPage(s, 7, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Answers) != 5 || page.Answers[4].Choice != "0" || page.HasNext() {
+				t.Errorf("unexpected last page: %+v", page)
+			}
+		})
+	}
+}
+
+func TestStoreTimedExam(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, _ := GetUserByUsername(s, "alice")
+			id, err := s.GetUserQuestionIDByUserID(u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deadline, examDeadline := time.Unix(1600000000, 0), time.Unix(1600000600, 0)
+			if err := s.ServeQuestion(id, 2, deadline, examDeadline); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			if err := s.ServeQuestion(id, 1, deadline, examDeadline); err != nil {
+				t.Fatal(err)
+			}
+			// serving again keeps the clock running
+			if err := s.ServeQuestion(id, 1, deadline.Add(time.Minute), examDeadline.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			r, _ := s.GetUserQuestion(id)
+			if !r.Deadline.Equal(deadline) || !r.ExamDeadline.Equal(examDeadline) {
+				t.Errorf("unexpected deadlines: %v, %v", r.Deadline, r.ExamDeadline)
+			}
+
+			if _, err := s.AdvanceUserQuestion(id, 1, 2, 1, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			r, _ = s.GetUserQuestion(id)
+			if !r.Deadline.IsZero() || !r.ExamDeadline.Equal(examDeadline) {
+				t.Errorf("unexpected deadlines after answer: %v, %v", r.Deadline, r.ExamDeadline)
+			}
+
+			// the exam is started over untimed
+			if err := RestartExam(s, u.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			uq, _ := GetUserQuestion(s, u.GetUserID())
+			id = uq.id
+			limits := LimitsT{Question: time.Minute, Exam: time.Hour}
+			served, err := uq.ServeQuestion(limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if until := time.Until(served); until <= 0 || until > time.Minute {
+				t.Errorf("unexpected deadline: %v", served)
+			}
+
+			// an answer after the question's time is wrong however right it is, the next question is served
+			if err := RestartExam(s, u.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			uq, _ = GetUserQuestion(s, u.GetUserID())
+			id = uq.id
+			if _, err := uq.ServeQuestion(LimitsT{Question: time.Millisecond}); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			r, _ = s.GetUserQuestion(id)
+			qt, _ := s.GetQuestion(r.QuestionID)
+			if _, err := UserConfirmAnswer(s, u.GetUserID(), 0, qt.CorrectAnswer()); err != ErrAnswerLate {
+				t.Errorf("expected=%v, result=%v", ErrAnswerLate, err)
+			}
+			next, _ := s.GetUserQuestion(id)
+			if next.QuestionID == r.QuestionID || next.QuestionID == 0 || next.Points != 0 {
+				t.Errorf("late answer is not skipped: %+v", next)
+			}
+			if misses, _ := s.ListMisses(id); misses[r.QuestionID] != 0 {
+				t.Errorf("late answer is a miss: %v", misses)
+			}
+			if ids, _ := s.ListTimedOut(id); !reflect.DeepEqual(ids, []int64{r.QuestionID}) {
+				t.Errorf("late answer is not timed out: %v", ids)
+			}
+			res, err := GetResult(s, u.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Attempts != 0 || res.Correct != 0 || len(res.Outcomes) != 2 || !res.Outcomes[0].TimedOut ||
+				res.Outcomes[0].Misses != 0 || res.Outcomes[1].TimedOut {
+				t.Errorf("unexpected result: %+v", res)
+			}
+
+			// once the exam's time has run out it is finished when the question is served again
+			if err := RestartExam(s, u.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			uq, _ = GetUserQuestion(s, u.GetUserID())
+			id = uq.id
+			if _, err := uq.ServeQuestion(LimitsT{Exam: time.Millisecond}); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			r, _ = s.GetUserQuestion(id)
+			if served, err := uq.ServeQuestion(limits); err != nil || !served.IsZero() {
+				t.Errorf("unexpected deadline: %v, %v", served, err)
+			}
+			if finished, _ := uq.IsFinished(); !finished {
+				t.Error("exam is not finished after its time has run out")
+			}
+			if ids, _ := s.ListTimedOut(id); !reflect.DeepEqual(ids, []int64{r.QuestionID}) {
+				t.Errorf("unanswered question is not timed out: %v", ids)
+			}
+			if res, _ := GetResult(s, u.GetUserID()); len(res.Outcomes) != 1 || !res.Outcomes[0].TimedOut {
+				t.Errorf("unexpected result: %+v", res)
+			}
+		})
+	}
+}
+
+func TestStoreStudy(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.GetCard(7, 1); err != ErrCardNotFound {
+				t.Errorf("expected=%v, result=%v", ErrCardNotFound, err)
+			}
+			at := time.Unix(1600000000, 0)
+			for _, c := range []CardRecord{
+				{UserID: 7, QuestionID: 2, Box: 1, DueAt: at.Add(time.Hour), ReviewedAt: at},
+				{UserID: 7, QuestionID: 1, Box: 1, DueAt: at.Add(2 * time.Hour), ReviewedAt: at},
+				{UserID: 7, QuestionID: 2, Box: 2, Reviews: 1, DueAt: at.Add(3 * time.Hour), ReviewedAt: at},
+			} {
+				if err := s.SaveCard(&c); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cards, err := s.ListCards(7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cards) != 2 || cards[0].QuestionID != 1 || cards[1].Box != 2 || !cards[1].DueAt.Equal(at.Add(3*time.Hour)) {
+				t.Errorf("unexpected cards: %+v", cards)
+			}
+			if cards, _ := s.ListCards(8); len(cards) != 0 {
+				t.Errorf("unexpected cards of another user: %+v", cards)
+			}
+
+			// the overdue questions come before the ones never studied
+			st, err := GetStudy(s, 7, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Next == nil || st.Next.QuestionID != 1 || st.Due != 2 || st.New != 1 {
+				t.Fatalf("unexpected study: %+v", st)
+			}
+
+			correct, c, err := ReviewQuestion(s, 7, 1, "Wales")
+			if err != nil || correct {
+				t.Fatalf("wrong answer is not graded: %v, %v", correct, err)
+			}
+			if c.Box != 1 || c.Lapses != 1 || !c.DueAt.After(time.Now()) {
+				t.Errorf("unexpected card: %+v", c)
+			}
+			if _, _, err := ReviewQuestion(s, 7, 1, "Norway"); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+
+			correct, c, err = ReviewQuestion(s, 7, 2, "Greenland")
+			if err != nil || !correct || c.Box != 3 || c.Reviews != 2 {
+				t.Errorf("unexpected review: %v, %+v, %v", correct, c, err)
+			}
+
+			st, _ = GetStudy(s, 7, "")
+			if st.Next == nil || st.Next.QuestionID != 3 || st.Due != 0 || st.New != 1 || st.NextDueAt.IsZero() {
+				t.Fatalf("unexpected study: %+v", st)
+			}
+			if _, _, err := ReviewQuestion(s, 7, 3, "January 1"); err != nil {
+				t.Fatal(err)
+			}
+			if st, _ = GetStudy(s, 7, ""); st.Next != nil {
+				t.Errorf("nothing should be due: %+v", st.Next)
+			}
+		})
+	}
+}
+
+func TestStoreQuizzes(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := AddQuiz(s, &QuizT{Title: "Europe", QuestionIDs: []int64{1, 99}}); err != ErrQuizQuestion {
+				t.Errorf("expected=%v, result=%v", ErrQuizQuestion, err)
+			}
+			draft := &QuizT{Title: " Europe ", Description: "Countries", QuestionIDs: []int64{3, 1, 3}, PassMark: 50}
+			id, err := AddQuiz(s, draft)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := s.GetQuiz(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := QuizT{Title: "Europe", Description: "Countries", QuestionIDs: []int64{3, 1}, PassMark: 50}
+			if !reflect.DeepEqual(*q, want) {
+				t.Errorf("quiz not same: expected=%+v, result=%+v", want, *q)
+			}
+
+			// a draft is not listed to the users nor can be started
+			if quizzes, _ := ListQuizzes(s, false); len(quizzes) != 0 {
+				t.Errorf("draft is listed: %+v", quizzes)
+			}
+			if err := StartQuiz(s, 7, id); err != ErrQuizNotFound {
+				t.Errorf("expected=%v, result=%v", ErrQuizNotFound, err)
+			}
+
+			want.Published = true
+			if err := EditQuiz(s, id, &want); err != nil {
+				t.Fatal(err)
+			}
+			if quizzes, _ := ListQuizzes(s, false); len(quizzes) != 1 || quizzes[0].ID != id {
+				t.Errorf("published quiz is not listed: %+v", quizzes)
+			}
+			if _, err := s.GetQuizProgress(7, id); err != ErrQuizNotStarted {
+				t.Errorf("expected=%v, result=%v", ErrQuizNotStarted, err)
+			}
+			if err := StartQuiz(s, 7, id); err != nil {
+				t.Fatal(err)
+			}
+
+			// the questions are asked in order, each once whether the answer is right or not
+			questionID, qt, err := CurrentQuizQuestion(s, 7, id)
+			if err != nil || questionID != 3 || qt.Answer != "January 1" {
+				t.Fatalf("unexpected question: %d, %+v, %v", questionID, qt, err)
+			}
+			if correct, err := AnswerQuiz(s, 7, id, 3, "December 31"); err != nil || correct {
+				t.Errorf("wrong answer is not graded: %v, %v", correct, err)
+			}
+			if _, err := AnswerQuiz(s, 7, id, 3, "January 1"); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			if err := s.AdvanceQuiz(7, id, 0, 1, true, time.Now()); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			res, _ := GetQuizResult(s, 7, id)
+			if res.Finished || res.Passed || res.Answered != 1 {
+				t.Errorf("unexpected result: %+v", res)
+			}
+			if correct, err := AnswerQuiz(s, 7, id, 0, "Norway"); err != nil || !correct {
+				t.Errorf("right answer is not graded: %v, %v", correct, err)
+			}
+			if questionID, _, _ := CurrentQuizQuestion(s, 7, id); questionID != 0 {
+				t.Errorf("finished quiz asks question %d", questionID)
+			}
+			res, _ = GetQuizResult(s, 7, id)
+			if !res.Finished || !res.Passed || res.Correct != 1 || res.Score != 50 || res.Points != 1 {
+				t.Errorf("unexpected result: %+v", res)
+			}
+			p, _ := s.GetQuizProgress(7, id)
+			if p.FinishedAt.IsZero() || p.StartedAt.IsZero() {
+				t.Errorf("unexpected progress: %+v", p)
+			}
+
+			// another user's progress is separate, and the deleted questions are skipped
+			if err := StartQuiz(s, 8, id); err != nil {
+				t.Fatal(err)
+			}
+			if err := DeleteQuestion(s, 3); err != nil {
+				t.Fatal(err)
+			}
+			if questionID, _, _ := CurrentQuizQuestion(s, 8, id); questionID != 1 {
+				t.Errorf("deleted question is not skipped: %d", questionID)
+			}
+			if res, _ := GetQuizResult(s, 8, id); res.Answered != 0 {
+				t.Errorf("skipped question is counted: %+v", res)
+			}
+			if res, _ := GetQuizResult(s, 7, id); !res.Passed {
+				t.Errorf("another user's progress changed: %+v", res)
+			}
+
+			if err := DeleteQuiz(s, id); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.GetQuizProgress(7, id); err != ErrQuizNotStarted {
+				t.Errorf("expected=%v, result=%v", ErrQuizNotStarted, err)
+			}
+			if ids, _ := s.ListQuizIDs(); len(ids) != 0 {
+				t.Errorf("deleted quiz is listed: %v", ids)
+			}
+			if err := DeleteQuiz(s, id); err != ErrQuizNotFound {
+				t.Errorf("expected=%v, result=%v", ErrQuizNotFound, err)
+			}
+		})
+	}
+}
+
+func TestStoreScoring(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			ids, err := s.ListQuestionIDs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range ids {
+				qt, err := s.GetQuestion(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				qt.Difficulty = 3
+				if err := EditQuestion(s, id, qt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if qt, _ := s.GetQuestion(ids[0]); qt.Difficulty != 3 {
+				t.Errorf("difficulty not same: expected=%d, result=%d", 3, qt.Difficulty)
+			}
+
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, err := GetUserByUsername(s, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID := u.GetUserID()
+			uq, err := GetUserQuestion(s, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the streak multiplier goes up every 2 right answers, a wrong one takes 2 points off and breaks it
+			sc := ScoringT{Weighted: true, Penalty: 2, StreakEvery: 2}
+			answers := []struct {
+				right          bool
+				points, streak int64
+			}{
+				{false, -2, 0},
+				{true, 1, 1},
+				{true, 7, 2},
+				{false, 5, 0},
+				{true, 8, 1},
+			}
+			for i, a := range answers {
+				r, err := s.GetUserQuestion(uq.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				choice := "wrong"
+				if a.right {
+					qt, err := s.GetQuestion(r.QuestionID)
+					if err != nil {
+						t.Fatal(err)
+					}
+					choice = qt.Answer
+				}
+				if ok, err := UserConfirmAnswerScored(s, sc, userID, 0, choice); ok != a.right || err != nil {
+					t.Fatalf("answer %d not graded: ok=%v err=%v", i, ok, err)
+				}
+
+				if r, err = s.GetUserQuestion(uq.id); err != nil {
+					t.Fatal(err)
+				}
+				if r.Points != a.points || r.Streak != a.streak {
+					t.Errorf("answer %d: expected points=%d streak=%d, result points=%d streak=%d", i, a.points, a.streak,
+						r.Points, r.Streak)
+				}
+				scores, err := s.ListTopScores(0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(scores) != 1 || scores[0].Score != a.points {
+					t.Errorf("answer %d: leaderboard not same: expected=%d, result=%+v", i, a.points, scores)
+				}
+			}
+			if finished, _ := uq.IsFinished(); !finished {
+				t.Error("exam is not finished")
+			}
+
+			// a quiz's own rules are kept and used instead of the default ones
+			want := QuizT{Title: "Europe", QuestionIDs: ids[:2], Published: true,
+				Scoring: ScoringT{Penalty: 1, TimeBonus: 5, BonusWithin: time.Hour}}
+			id, err := AddQuiz(s, &want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q, _ := s.GetQuiz(id); !reflect.DeepEqual(*q, want) {
+				t.Errorf("quiz not same: expected=%+v, result=%+v", want, *q)
+			}
+			if err := StartQuiz(s, userID, id); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := AnswerQuizScored(s, sc, userID, id, 0, "wrong"); ok || err != nil {
+				t.Fatalf("expected a wrong answer: ok=%v err=%v", ok, err)
+			}
+			_, qt, err := CurrentQuizQuestion(s, userID, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := AnswerQuizScored(s, sc, userID, id, 0, qt.Answer); !ok || err != nil {
+				t.Fatalf("expected a right answer: ok=%v err=%v", ok, err)
+			}
+			p, err := s.GetQuizProgress(userID, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Points != 5 || p.Streak != 1 || p.AskedAt.IsZero() {
+				t.Errorf("unexpected progress: %+v", p)
+			}
+		})
+	}
+}
+
+func TestStoreLifelines(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, err := GetUserByUsername(s, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID := u.GetUserID()
+			uq, err := GetUserQuestion(s, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, _ := uq.GetQuestion()
+			qt, err := GetQuestion(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ll := LifelinesT{FiftyFifty: 1, FiftyFiftyCost: 2, Hint: 1, HintCost: 1}
+			st, err := uq.GetLifelines(ll)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !st.CanFiftyFifty || !st.CanHint || st.Hint != "" || len(st.Choices(qt)) != 4 {
+				t.Errorf("unexpected lifelines: %+v", st)
+			}
+
+			// the 50/50 leaves the answer and one wrong choice
+			if err := uq.UseFiftyFifty(ll, 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := uq.UseFiftyFifty(ll, 0); err != ErrLifelineUsed {
+				t.Errorf("expected=%v, result=%v", ErrLifelineUsed, err)
+			}
+			if st, _ = uq.GetLifelines(ll); st.CanFiftyFifty || st.FiftyFiftyLeft != 0 {
+				t.Errorf("50/50 is not used: %+v", st)
+			}
+			choices := st.Choices(qt)
+			if len(choices) != 2 || !contains(choices, "Norway") {
+				t.Errorf("50/50 left the wrong choices: %q", choices)
+			}
+
+			if err := uq.UseHint(ll, 99); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			if err := uq.UseHint(ll, q.GetQuestionID()); err != nil {
+				t.Fatal(err)
+			}
+			if st, _ = uq.GetLifelines(ll); st.Hint != qt.Hint || st.CanHint {
+				t.Errorf("hint is not shown: %+v", st)
+			}
+
+			// the costs are taken off the points and the leaderboard
+			if p, _ := uq.GetPoints(); p != -3 {
+				t.Errorf("points not same: expected=%d, result=%d", -3, p)
+			}
+			if scores, _ := s.ListTopScores(0, 0); len(scores) != 1 || scores[0].Score != -3 {
+				t.Errorf("leaderboard not same: expected=%d, result=%+v", -3, scores)
+			}
+
+			// the next question has every choice back and no hint, the exam has no lifelines left
+			if ok, err := UserConfirmAnswer(s, userID, 0, "Norway"); !ok || err != nil {
+				t.Fatalf("expected a correct answer: ok=%v err=%v", ok, err)
+			}
+			st, err = uq.GetLifelines(ll)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(st.Hidden) != 0 || st.Hint != "" || st.CanFiftyFifty || st.CanHint {
+				t.Errorf("lifelines are not reset: %+v", st)
+			}
+			if err := uq.UseFiftyFifty(ll, 0); err != ErrNoLifelines {
+				t.Errorf("expected=%v, result=%v", ErrNoLifelines, err)
+			}
+			// the other questions have no hint
+			ll.Hint = 2
+			if err := uq.UseHint(ll, 0); err != ErrLifelineUnavailable {
+				t.Errorf("expected=%v, result=%v", ErrLifelineUnavailable, err)
+			}
+		})
+	}
+}
+
+func TestStoreConcurrentAnswers(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			if err := RegisterUser(s, "alice", "password"); err != nil {
+				t.Fatal(err)
+			}
+			u, _ := GetUserByUsername(s, "alice")
+			uq, _ := GetUserQuestion(s, u.GetUserID())
+			q, _ := uq.GetQuestion()
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			correct, stale := 0, 0
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := UserConfirmAnswer(s, u.GetUserID(), q.GetQuestionID(), "Norway")
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == ErrStaleAnswer:
+						stale++
+					case err != nil:
+						t.Error(err)
+					case ok:
+						correct++
+					}
+				}()
+			}
+			wg.Wait()
+
+			if correct != 1 || stale != 19 {
+				t.Errorf("expected a single correct answer: correct=%d, stale=%d", correct, stale)
+			}
+			if p, _ := uq.GetPoints(); p != 1 {
+				t.Errorf("points not same: expected=%d, result=%d", 1, p)
+			}
+			ranks, _ := TopRanks(s)
+			if len(ranks) != 1 || ranks[0].Score != 1 {
+				t.Errorf("unexpected leaderboard: %v", ranks)
+			}
+			asked, _ := uq.GetUserQuestions()
+			if len(asked) != 2 {
+				t.Errorf("asked not same: expected=%d, result=%d", 2, len(asked))
+			}
+
+			// a wrong answer that comes in after the question has been answered counts nothing
+			if err := s.RecordMiss(uq.id, q.GetQuestionID(), 1); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			r, _ := s.GetUserQuestion(uq.id)
+			if r.Points != 1 || r.Attempts != 1 || r.Streak != 1 {
+				t.Errorf("stale miss is counted: %+v", r)
+			}
+			if misses, _ := s.ListMisses(uq.id); len(misses) != 0 {
+				t.Errorf("stale miss is counted: %v", misses)
+			}
+		})
+	}
+}
+
+func TestStoreLobbies(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, un := range []string{"host", "guest", "other"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			host, _ := GetUserByUsername(s, "host")
+			guest, _ := GetUserByUsername(s, "guest")
+			other, _ := GetUserByUsername(s, "other")
+
+			l, err := NewLobby(s, host.GetUserID(), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewLobby(s, host.GetUserID(), 5); err != ErrUserInLobby {
+				t.Errorf("expected=%v, result=%v", ErrUserInLobby, err)
+			}
+			code, err := l.GetCode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := JoinLobby(s, code, guest.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			if err := JoinLobby(s, code, guest.GetUserID()); err != ErrUserInLobby {
+				t.Errorf("expected=%v, result=%v", ErrUserInLobby, err)
+			}
+			// a member of a lobby has to leave it before joining another one
+			ol, err := NewLobby(s, other.GetUserID(), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherCode, _ := ol.GetCode()
+			if err := JoinLobby(s, otherCode, guest.GetUserID()); err != ErrUserInLobby {
+				t.Errorf("expected=%v, result=%v", ErrUserInLobby, err)
+			}
+			if members, _ := s.ListLobbyMembers(ol.id); len(members) != 1 {
+				t.Errorf("members not same: expected=%d, result=%d", 1, len(members))
+			}
+			if u, _ := s.GetUser(guest.GetUserID()); u.LobbyID != l.id {
+				t.Errorf("lobby not same: expected=%d, result=%d", l.id, u.LobbyID)
+			}
+			if _, err := GetLobbyByCode(s, "nope"); err != ErrLobbyNotFound {
+				t.Errorf("expected=%v, result=%v", ErrLobbyNotFound, err)
+			}
+
+			players, err := l.GetPlayers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(players, []string{"host", "guest"}) {
+				t.Errorf("unexpected players: %v", players)
+			}
+
+			if err := l.LeaveLobby(host.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			if hostID, _ := l.GetHostID(); hostID != guest.GetUserID() {
+				t.Errorf("host not same: expected=%d, result=%d", guest.GetUserID(), hostID)
+			}
+			if err := l.LeaveLobby(guest.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			if status, _ := l.GetStatus(); status != StatusEnded {
+				t.Errorf("status not same: expected=%d, result=%d", StatusEnded, status)
+			}
+			if err := JoinLobby(s, code, host.GetUserID()); err != ErrGameEnded {
+				t.Errorf("expected=%v, result=%v", ErrGameEnded, err)
+			}
+		})
+	}
+}
+
+func TestStoreLobbyRoles(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users := map[string]*User{}
+			for _, un := range []string{"host", "cohost", "player", "other"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+				users[un], _ = GetUserByUsername(s, un)
+			}
+			id := func(un string) int64 { return users[un].GetUserID() }
+
+			l, err := NewLobby(s, id("host"), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := l.GetCode()
+			for _, un := range []string{"player", "cohost", "other"} {
+				if err := JoinLobby(s, code, id(un)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := l.SetCoHost(id("player"), id("cohost"), true); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.SetCoHost(id("host"), id("cohost"), true); err != nil {
+				t.Fatal(err)
+			}
+			for un, expected := range map[string]string{"host": RoleHost, "cohost": RoleCoHost, "player": RolePlayer} {
+				if role, err := l.GetRole(id(un)); err != nil || role != expected {
+					t.Errorf("%s: role not same: expected=%s, result=%s, err=%v", un, expected, role, err)
+				}
+			}
+			if cohosts, _ := l.GetCoHosts(); !reflect.DeepEqual(cohosts, []string{"cohost"}) {
+				t.Errorf("unexpected co-hosts: %v", cohosts)
+			}
+
+			// only a higher role can kick
+			if err := l.KickMember(id("player"), id("other"), false); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.KickMember(id("cohost"), id("host"), false); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.KickMember(id("cohost"), id("other"), true); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.KickMember(id("cohost"), id("other"), false); err != ErrUserNotInLobby {
+				t.Errorf("expected=%v, result=%v", ErrUserNotInLobby, err)
+			}
+			if bans, _ := l.GetBans(); !reflect.DeepEqual(bans, []string{"other"}) {
+				t.Errorf("unexpected bans: %v", bans)
+			}
+			if err := JoinLobby(s, code, id("other")); err != ErrBanned {
+				t.Errorf("expected=%v, result=%v", ErrBanned, err)
+			}
+			if err := l.Unban(id("player"), id("other")); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.Unban(id("cohost"), id("other")); err != nil {
+				t.Fatal(err)
+			}
+			if err := JoinLobby(s, code, id("other")); err != nil {
+				t.Fatal(err)
+			}
+
+			// the co-host takes over from the host before the members who joined earlier
+			if err := l.LeaveLobby(id("host")); err != nil {
+				t.Fatal(err)
+			}
+			if hostID, _ := l.GetHostID(); hostID != id("cohost") {
+				t.Errorf("host not same: expected=%d, result=%d", id("cohost"), hostID)
+			}
+			if cohosts, _ := l.GetCoHosts(); len(cohosts) != 0 {
+				t.Errorf("unexpected co-hosts: %v", cohosts)
+			}
+
+			// the old host stays on as a co-host
+			if err := l.TransferHost(id("player"), id("other")); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.TransferHost(id("cohost"), id("player")); err != nil {
+				t.Fatal(err)
+			}
+			for un, expected := range map[string]string{"player": RoleHost, "cohost": RoleCoHost, "other": RolePlayer} {
+				if role, err := l.GetRole(id(un)); err != nil || role != expected {
+					t.Errorf("%s: role not same: expected=%s, result=%s, err=%v", un, expected, role, err)
+				}
+			}
+			if _, err := l.GetRole(id("host")); err != ErrUserNotInLobby {
+				t.Errorf("expected=%v, result=%v", ErrUserNotInLobby, err)
+			}
+		})
+	}
+}
+
+func TestStoreLobbySettings(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			users := map[string]*User{}
+			for _, un := range []string{"host", "guest", "third"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+				users[un], _ = GetUserByUsername(s, un)
+			}
+			id := func(un string) int64 { return users[un].GetUserID() }
+
+			l, err := NewLobby(s, id("host"), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := l.GetCode()
+			if settings, err := l.GetSettings(); err != nil || *settings != (LobbySettings{}) {
+				t.Errorf("unexpected settings: %+v, err=%v", settings, err)
+			}
+			if err := JoinLobby(s, code, id("guest")); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				settings LobbySettings
+				err      error
+			}{
+				{LobbySettings{MaxPlayers: 1}, ErrLobbySettings},
+				{LobbySettings{MaxPlayers: MaxLobbyPlayers + 1}, ErrLobbySettings},
+				{LobbySettings{Rounds: -1}, ErrLobbySettings},
+				{LobbySettings{RoundTime: time.Second}, ErrLobbySettings},
+				{LobbySettings{Category: "nope"}, ErrEmptyCategory},
+			}
+			for _, tt := range tests {
+				if err := l.SetSettings(id("host"), tt.settings); err != tt.err {
+					t.Errorf("%+v: expected=%v, result=%v", tt.settings, tt.err, err)
+				}
+			}
+			if err := l.SetSettings(id("guest"), LobbySettings{}); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+
+			expected := LobbySettings{MaxPlayers: 2, Public: true, Rounds: 1, RoundTime: 30 * time.Second,
+				Category: "Geography"}
+			if err := l.SetSettings(id("host"), expected); err != nil {
+				t.Fatal(err)
+			}
+			if settings, err := l.GetSettings(); err != nil || *settings != expected {
+				t.Errorf("settings not same: expected=%+v, result=%+v, err=%v", expected, settings, err)
+			}
+
+			// the lobby is full, a member joining again is not turned away
+			if err := JoinLobby(s, code, id("third")); err != ErrLobbyFull {
+				t.Errorf("expected=%v, result=%v", ErrLobbyFull, err)
+			}
+			if err := s.AddLobbyMember(l.id, id("guest")); err != nil {
+				t.Errorf("expected=%v, result=%v", nil, err)
+			}
+			if u, _ := s.GetUser(id("third")); u.LobbyID != -1 {
+				t.Errorf("lobby not same: expected=%d, result=%d", -1, u.LobbyID)
+			}
+
+			// the settings override the server's rules
+			if err := l.StartGame(id("host"), GameRulesT{Rounds: 3, RoundTime: time.Minute}); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.BeginGame(GameRulesT{Rounds: 3, RoundTime: time.Minute}); err != nil {
+				t.Fatal(err)
+			}
+			g, err := l.GetGame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Rounds != 1 || g.Question.Category != "Geography" {
+				t.Errorf("unexpected game: %+v", g)
+			}
+			if remaining := time.Until(g.EndsAt); remaining > 30*time.Second || remaining < 25*time.Second {
+				t.Errorf("unexpected round time: %v", remaining)
+			}
+			if err := l.SetSettings(id("host"), LobbySettings{}); err != ErrLobbyStatus {
+				t.Errorf("expected=%v, result=%v", ErrLobbyStatus, err)
+			}
+		})
+	}
+}
+
+func TestStoreConcurrentJoins(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			var userIDs []int64
+			for i := 0; i < 10; i++ {
+				un := fmt.Sprintf("user%d", i)
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+				u, _ := GetUserByUsername(s, un)
+				userIDs = append(userIDs, u.GetUserID())
+			}
+			l, err := NewLobby(s, userIDs[0], 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := l.SetSettings(userIDs[0], LobbySettings{MaxPlayers: 3}); err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			joined, full := 0, 0
+			for _, userID := range userIDs[1:] {
+				wg.Add(1)
+				go func(userID int64) {
+					defer wg.Done()
+					err := s.AddLobbyMember(l.id, userID)
+					mu.Lock()
+					defer mu.Unlock()
+					switch err {
+					case nil:
+						joined++
+					case ErrLobbyFull:
+						full++
+					default:
+						t.Error(err)
+					}
+				}(userID)
+			}
+			wg.Wait()
+
+			if joined != 2 || full != 7 {
+				t.Errorf("expected the lobby to fill up once: joined=%d, full=%d", joined, full)
+			}
+			if members, _ := s.ListLobbyMembers(l.id); len(members) != 3 {
+				t.Errorf("members not same: expected=%d, result=%d", 3, len(members))
+			}
+		})
+	}
+}
+
+func TestStorePublicLobbies(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			lobbies := map[string]*Lobby{}
+			for _, un := range []string{"public", "private", "started"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+				u, _ := GetUserByUsername(s, un)
+				l, err := NewLobby(s, u.GetUserID(), 5)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := l.SetSettings(u.GetUserID(), LobbySettings{Public: un != "private", MaxPlayers: 3}); err != nil {
+					t.Fatal(err)
+				}
+				lobbies[un] = l
+			}
+			started, _ := GetUserByUsername(s, "started")
+			if err := lobbies["started"].StartGame(started.GetUserID(), GameRulesT{RoundTime: time.Minute}); err != nil {
+				t.Fatal(err)
+			}
+
+			code, _ := lobbies["public"].GetCode()
+			listings, err := ListPublicLobbies(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []LobbyListingT{{Code: code, Host: "public", Players: 1, MaxPlayers: 3}}
+			if !reflect.DeepEqual(listings, expected) {
+				t.Errorf("listings not same: expected=%+v, result=%+v", expected, listings)
+			}
+
+			// made private again it is not listed
+			public, _ := GetUserByUsername(s, "public")
+			if err := lobbies["public"].SetSettings(public.GetUserID(), LobbySettings{}); err != nil {
+				t.Fatal(err)
+			}
+			if ids, err := s.ListPublicLobbyIDs(); err != nil || len(ids) != 0 {
+				t.Errorf("unexpected public lobbies: %v, err=%v", ids, err)
+			}
+		})
+	}
+}
+
+func TestStoreLobbyExpiry(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			users := map[string]*User{}
+			for _, un := range []string{"host", "guest", "active", "next"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+				users[un], _ = GetUserByUsername(s, un)
+			}
+			id := func(un string) int64 { return users[un].GetUserID() }
+
+			idle, err := NewLobby(s, id("host"), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := idle.GetCode()
+			if err := JoinLobby(s, code, id("guest")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := idle.SendChat(ChatRulesT{History: 10}, id("guest"), "hi"); err != nil {
+				t.Fatal(err)
+			}
+			if err := idle.StartGame(id("host"), GameRulesT{Rounds: 1, RoundTime: time.Minute}); err != nil {
+				t.Fatal(err)
+			}
+			if err := idle.BeginGame(GameRulesT{Rounds: 1, RoundTime: time.Minute}); err != nil {
+				t.Fatal(err)
+			}
+			active, err := NewLobby(s, id("active"), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a live lobby's code is not handed out again
+			if _, err := s.CreateLobby(id("next"), code); err != ErrLobbyCodeTaken {
+				t.Errorf("expected=%v, result=%v", ErrLobbyCodeTaken, err)
+			}
+
+			r, err := s.GetLobby(idle.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if since := time.Since(r.ActiveAt); since < 0 || since > time.Minute {
+				t.Errorf("unexpected active at: %v", r.ActiveAt)
+			}
+			if err := s.TouchLobby(idle.id, time.Now().Add(-2*time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			expired, err := ExpireLobbies(s, time.Now().Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(expired, []int64{idle.id}) {
+				t.Errorf("expired not same: expected=%v, result=%v", []int64{idle.id}, expired)
+			}
+			if _, err := s.GetLobby(idle.id); err != ErrLobbyNotFound {
+				t.Errorf("expected=%v, result=%v", ErrLobbyNotFound, err)
+			}
+			if _, err := s.GetLobbyIDByCode(code); err != ErrLobbyNotFound {
+				t.Errorf("expected=%v, result=%v", ErrLobbyNotFound, err)
+			}
+			if err := s.TouchLobby(idle.id, time.Now()); err != ErrLobbyNotFound {
+				t.Errorf("expected=%v, result=%v", ErrLobbyNotFound, err)
+			}
+			for _, un := range []string{"host", "guest"} {
+				if _, err := users[un].GetLobby(); err != ErrUserNotInLobby {
+					t.Errorf("%s: expected=%v, result=%v", un, ErrUserNotInLobby, err)
+				}
+			}
+			if ids, _ := s.ListLobbyMembers(idle.id); len(ids) != 0 {
+				t.Errorf("members left: %v", ids)
+			}
+			if chat, _ := s.ListChatMessages(idle.id); len(chat) != 0 {
+				t.Errorf("chat left: %v", chat)
+			}
+			if _, err := s.GetGame(idle.id); err != ErrGameNotFound {
+				t.Errorf("expected=%v, result=%v", ErrGameNotFound, err)
+			}
+			if l, err := GetLobbyByUserID(s, id("active")); err != nil || l.id != active.id {
+				t.Errorf("active lobby expired: err=%v", err)
+			}
+
+			// the expired lobby's code is free again
+			if _, err := s.CreateLobby(id("next"), code); err != nil {
+				t.Errorf("expected=%v, result=%v", nil, err)
+			}
+			if n, err := s.ResetStaleUserLobbies(); err != nil || n != 0 {
+				t.Errorf("unexpected reset: n=%d, err=%v", n, err)
+			}
+		})
+	}
+}
+
+func TestStoreChat(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, un := range []string{"host", "guest"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			host, _ := GetUserByUsername(s, "host")
+			guest, _ := GetUserByUsername(s, "guest")
+			l, err := NewLobby(s, host.GetUserID(), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rules := ChatRulesT{History: 2, MaxLength: 5}
+			if _, err := l.SendChat(rules, guest.GetUserID(), "hi"); err != ErrUserNotInLobby {
+				t.Errorf("expected=%v, result=%v", ErrUserNotInLobby, err)
+			}
+			code, _ := l.GetCode()
+			if err := JoinLobby(s, code, guest.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range []struct {
+				text string
+				err  error
+			}{{" \t", ErrChatEmpty}, {"hello!", ErrChatTooLong}, {"héllo", nil}} {
+				if _, err := l.SendChat(rules, guest.GetUserID(), tt.text); err != tt.err {
+					t.Errorf("%q: expected=%v, result=%v", tt.text, tt.err, err)
+				}
+			}
+			var ids []int64
+			for _, text := range []string{"one", "two"} {
+				m, err := l.SendChat(rules, host.GetUserID(), " "+text+" ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if m.Username != "host" || m.Text != text || m.SentAt.IsZero() {
+					t.Errorf("unexpected message: %+v", m)
+				}
+				ids = append(ids, m.ID)
+			}
+			chat, err := l.GetChat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chat) != 2 || chat[0].ID != ids[0] || chat[1].Text != "two" {
+				t.Errorf("unexpected chat: %+v", chat)
+			}
+
+			if err := l.DeleteChat(guest.GetUserID(), ids[0]); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.DeleteChat(host.GetUserID(), ids[0]); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.DeleteChat(host.GetUserID(), ids[0]); err != ErrChatNotFound {
+				t.Errorf("expected=%v, result=%v", ErrChatNotFound, err)
+			}
+			if chat, _ := l.GetChat(); len(chat) != 1 || chat[0].ID != ids[1] {
+				t.Errorf("unexpected chat: %+v", chat)
+			}
+
+			if err := l.Mute(guest.GetUserID(), host.GetUserID(), true); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.Mute(host.GetUserID(), guest.GetUserID(), true); err != nil {
+				t.Fatal(err)
+			}
+			if muted, _ := l.GetMuted(); !reflect.DeepEqual(muted, []string{"guest"}) {
+				t.Errorf("unexpected muted: %v", muted)
+			}
+			if _, err := l.SendChat(rules, guest.GetUserID(), "hi"); err != ErrMuted {
+				t.Errorf("expected=%v, result=%v", ErrMuted, err)
+			}
+			if err := l.Mute(host.GetUserID(), guest.GetUserID(), false); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := l.SendChat(rules, guest.GetUserID(), "hi"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestStoreGames(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+				t.Fatal(err)
+			}
+			for _, un := range []string{"host", "guest"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			host, _ := GetUserByUsername(s, "host")
+			guest, _ := GetUserByUsername(s, "guest")
+			l, err := NewLobby(s, host.GetUserID(), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := l.GetCode()
+			if err := JoinLobby(s, code, guest.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+
+			rules := GameRulesT{Rounds: 2, RoundTime: time.Minute, Quorum: 100}
+			if _, err := l.GetGame(); err != ErrGameNotFound {
+				t.Errorf("expected=%v, result=%v", ErrGameNotFound, err)
+			}
+			if err := l.StartGame(guest.GetUserID(), rules); err != ErrLobbyPermission {
+				t.Errorf("expected=%v, result=%v", ErrLobbyPermission, err)
+			}
+			if err := l.BeginGame(rules); err != ErrLobbyStatus {
+				t.Errorf("expected=%v, result=%v", ErrLobbyStatus, err)
+			}
+
+			// the host starting counts as ready, the guest has to be
+			if err := l.StartGame(host.GetUserID(), rules); err != ErrNotReady {
+				t.Errorf("expected=%v, result=%v", ErrNotReady, err)
+			}
+			half := GameRulesT{Rounds: 2, RoundTime: time.Minute, Quorum: 50}
+			if err := l.StartGame(host.GetUserID(), half); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.SetStatus(StatusWaiting); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.SetReady(guest.GetUserID(), true); err != nil {
+				t.Fatal(err)
+			}
+			if ready, err := l.GetReady(); err != nil || !reflect.DeepEqual(ready, []string{"guest"}) {
+				t.Errorf("ready not same: expected=%q, result=%q, err=%v", []string{"guest"}, ready, err)
+			}
+			rules.Countdown = 5 * time.Second
+			if err := l.StartGame(host.GetUserID(), rules); err != nil {
+				t.Fatal(err)
+			}
+			if status, _ := l.GetStatus(); status != StatusStarting {
+				t.Errorf("status not same: expected=%d, result=%d", StatusStarting, status)
+			}
+			// the countdown is kept with the lobby to be picked up again after a restart
+			if at, _ := l.GetStartsAt(); time.Until(at) <= 4*time.Second || time.Until(at) > 5*time.Second {
+				t.Errorf("unexpected start: %v", at)
+			}
+			if err := l.StartGame(host.GetUserID(), rules); err != ErrLobbyStatus {
+				t.Errorf("expected=%v, result=%v", ErrLobbyStatus, err)
+			}
+			if err := l.SetReady(guest.GetUserID(), false); err != ErrLobbyStatus {
+				t.Errorf("expected=%v, result=%v", ErrLobbyStatus, err)
+			}
+			if err := l.BeginGame(rules); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.BeginGame(rules); err != ErrLobbyStatus {
+				t.Errorf("expected=%v, result=%v", ErrLobbyStatus, err)
+			}
+			if status, _ := l.GetStatus(); status != StatusOngoing {
+				t.Errorf("status not same: expected=%d, result=%d", StatusOngoing, status)
+			}
+
+			g, err := l.GetGame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Round != 0 || g.Rounds != 2 || g.Ended || g.Question == nil || len(g.Players) != 2 {
+				t.Fatalf("unexpected game: %+v", g)
+			}
+
+			// every player answers once, the round is done when both have
+			if ok, err := l.AnswerGame(ScoringT{}, host.GetUserID(), 0, g.Question.Answer); !ok || err != nil {
+				t.Fatalf("expected a correct answer: ok=%v err=%v", ok, err)
+			}
+			if _, err := l.AnswerGame(ScoringT{}, host.GetUserID(), 0, g.Question.Answer); err != ErrAlreadyAnswered {
+				t.Errorf("expected=%v, result=%v", ErrAlreadyAnswered, err)
+			}
+			if _, err := l.AnswerGame(ScoringT{}, host.GetUserID(), 1, g.Question.Answer); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			if done, _ := l.RoundDone(0); done {
+				t.Error("round is done before every player has answered")
+			}
+			if ok, err := l.AnswerGame(ScoringT{Penalty: 1}, guest.GetUserID(), 0, "nope"); ok || err != nil {
+				t.Fatalf("expected a wrong answer: ok=%v err=%v", ok, err)
+			}
+			if err := s.AnswerRound(l.id, 99, 0, 1, true); err != ErrNotPlaying {
+				t.Errorf("expected=%v, result=%v", ErrNotPlaying, err)
+			}
+			if done, _ := l.RoundDone(0); !done {
+				t.Error("round is not done after every player has answered")
+			}
+
+			if ended, err := l.AdvanceGame(rules, 0); ended || err != nil {
+				t.Fatalf("expected the next round: ended=%v err=%v", ended, err)
+			}
+			if _, err := l.AdvanceGame(rules, 0); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+			g, _ = l.GetGame()
+			if g.Round != 1 || g.Players[0].Answered || g.Players[1].Answered {
+				t.Errorf("unexpected next round: %+v", g)
+			}
+			if done, _ := l.RoundDone(1); done {
+				t.Error("new round is done")
+			}
+			// a player who has left is not waited for
+			if err := l.LeaveLobby(guest.GetUserID()); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := l.AnswerGame(ScoringT{}, host.GetUserID(), 1, g.Question.Answer); err != nil {
+				t.Fatal(err)
+			}
+			if done, _ := l.RoundDone(1); !done {
+				t.Error("round waits for a player who has left")
+			}
+
+			if ended, err := l.AdvanceGame(rules, 1); !ended || err != nil {
+				t.Fatalf("expected the game to end: ended=%v err=%v", ended, err)
+			}
+			if status, _ := l.GetStatus(); status != StatusEnded {
+				t.Errorf("status not same: expected=%d, result=%d", StatusEnded, status)
+			}
+			g, err = l.GetGame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []GameScoreT{
+				{Username: "host", Points: 2, Correct: 2},
+				{Username: "guest", Points: -1},
+			}
+			if !g.Ended || g.Question != nil || !reflect.DeepEqual(g.Players, expected) {
+				t.Errorf("unexpected results: %+v", g)
+			}
+			if _, err := l.AnswerGame(ScoringT{}, host.GetUserID(), 2, "x"); err != ErrStaleAnswer {
+				t.Errorf("expected=%v, result=%v", ErrStaleAnswer, err)
+			}
+		})
+	}
+}
+
+func TestStoreUpdatesAndRanks(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, un := range []string{"alice", "bob", "carol"} {
+				if err := RegisterUser(s, un, "password"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			alice, _ := GetUserByUsername(s, "alice")
+			bob, _ := GetUserByUsername(s, "bob")
+			carol, _ := GetUserByUsername(s, "carol")
+
+			for i := 0; i < updatesLimit+2; i++ {
+				if err := PostUpdate(s, alice.GetUserID(), "hello"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := PostUpdate(s, bob.GetUserID(), "latest"); err != nil {
+				t.Fatal(err)
+			}
+			updates, err := GetAllUpdates(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(updates) != updatesLimit {
+				t.Errorf("updates not same: expected=%d, result=%d", updatesLimit, len(updates))
+			}
+			if body, _ := updates[0].GetBody(); body != "latest" {
+				t.Errorf("latest update is not first: %s", body)
+			}
+			if updates, _ := GetUpdates(s, bob.GetUserID()); len(updates) != 1 {
+				t.Errorf("user updates not same: expected=%d, result=%d", 1, len(updates))
+			}
+
+			UpdateRank(s, alice.GetUserID(), 5)
+			UpdateRank(s, bob.GetUserID(), 9)
+			UpdateRank(s, carol.GetUserID(), 1)
+			UpdateRank(s, carol.GetUserID(), 7)
+
+			ranks, err := TopRanks(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []RankT{{1, "bob", 9}, {2, "carol", 7}, {3, "alice", 5}}
+			if !reflect.DeepEqual(ranks, expected) {
+				t.Errorf("not same: expected=%v, result=%v", expected, ranks)
+			}
+			if rank := GetRank(s, alice.GetUserID()); rank != 0 {
+				t.Errorf("rank not same: expected=%d, result=%d", 0, rank)
+			}
+			standings, err := GetCurrentStandings(s, alice.GetUserID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(standings) != 3 || standings[0].Name != "alice" {
+				t.Errorf("unexpected standings: %v", standings)
+			}
+		})
+	}
+}
+
+func TestSQLMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "davy.db")
+	for i := 0; i < 2; i++ {
+		s, err := NewSQLStore("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var version int
+		if err := s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if expected := migrations[len(migrations)-1].version; version != expected {
+			t.Errorf("version not same: expected=%d, result=%d", expected, version)
+		}
+		s.Close()
+	}
+}
+
+func TestRedisLegacyMembers(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	s := NewRedisStore(client)
+
+	for _, un := range []string{"host", "guest"} {
+		if err := RegisterUser(s, un, "password"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	host, _ := GetUserByUsername(s, "host")
+	guest, _ := GetUserByUsername(s, "guest")
+	l, err := NewLobby(s, host.GetUserID(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lobbyID, _ := l.GetLobbyID()
+
+	// a lobby from before the roster kept its members in a set
+	if err := client.Del(fmt.Sprintf("lobby:%d:roster", lobbyID)).Err(); err != nil {
+		t.Fatal(err)
+	}
+	legacy := fmt.Sprintf("lobby:%d:members", lobbyID)
+	if err := client.SAdd(legacy, host.GetUserID(), guest.GetUserID()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.HSet(fmt.Sprintf("user:%d", guest.GetUserID()), "lobby", lobbyID).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if member, err := s.IsLobbyMember(lobbyID, guest.GetUserID()); err != nil || !member {
+		t.Errorf("legacy member is lost: member=%v err=%v", member, err)
+	}
+	members, err := s.ListLobbyMembers(lobbyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(members, []int64{host.GetUserID(), guest.GetUserID()}) {
+		t.Errorf("members not same: expected=%v, result=%v", []int64{host.GetUserID(), guest.GetUserID()}, members)
+	}
+	if n, _ := client.Exists(legacy).Result(); n != 0 {
+		t.Error("legacy members are not moved onto the roster")
+	}
+	if n, err := s.ResetStaleUserLobbies(); err != nil || n != 0 {
+		t.Errorf("legacy members are reset: n=%d err=%v", n, err)
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// studyIntervals is how long a question rests in each Leitner box before it is due again, a right answer moves
+// the question up a box and a wrong one puts it back in the first
+var studyIntervals = []time.Duration{
+	10 * time.Minute,
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+}
+
+// StudyItemT is a question to study
+type StudyItemT struct {
+	QuestionID int64
+	Question   QuestionT
+	// Card is nil for a question the user has never studied
+	Card *CardRecord
+}
+
+// StudyT is what the user has left to study
+type StudyT struct {
+	// Next is the question to study now, nil if nothing is due
+	Next *StudyItemT
+	// Due counts the studied questions that are due now
+	Due int
+	// New counts the questions that have never been studied
+	New int
+	// NextDueAt is when the next studied question is due, zero if none is waiting
+	NextDueAt time.Time
+}
+
+// GetStudy picks the user's next question of the category to study, the most overdue first and then the ones never
+// studied, an empty category studies every question
+func GetStudy(s Store, userID int64, category string) (*StudyT, error) {
+	ids, err := categoryQuestionIDs(s, category)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	inCategory := map[int64]bool{}
+	for _, id := range ids {
+		inCategory[id] = true
+	}
+
+	cards, err := s.ListCards(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &StudyT{}
+	now := time.Now()
+	studied := map[int64]bool{}
+	for i := range cards {
+		c := &cards[i]
+		// the cards of deleted questions and of other categories are left alone
+		if !inCategory[c.QuestionID] {
+			continue
+		}
+		studied[c.QuestionID] = true
+		if c.DueAt.After(now) {
+			if st.NextDueAt.IsZero() {
+				st.NextDueAt = c.DueAt
+			}
+			continue
+		}
+		st.Due++
+		if st.Next == nil {
+			st.Next = &StudyItemT{QuestionID: c.QuestionID, Card: c}
+		}
+	}
+	for _, id := range ids {
+		if studied[id] {
+			continue
+		}
+		st.New++
+		if st.Next == nil {
+			st.Next = &StudyItemT{QuestionID: id}
+		}
+	}
+
+	if st.Next != nil {
+		qt, err := s.GetQuestion(st.Next.QuestionID)
+		if err != nil {
+			return nil, err
+		}
+		st.Next.Question = *qt
+	}
+	return st, nil
+}
+
+// ReviewQuestion grades the user's answer to the studied question and schedules its next review, choices are as
+// in UserConfirmAnswer, ErrStaleAnswer is returned if the question is not due, e.g. when the same answer has been
+// submitted twice
+func ReviewQuestion(s Store, userID, questionID int64, choices ...string) (bool, *CardRecord, error) {
+	qt, err := s.GetQuestion(questionID)
+	if err != nil {
+		return false, nil, err
+	}
+
+	now := time.Now()
+	c, err := s.GetCard(userID, questionID)
+	if err == ErrCardNotFound {
+		c = &CardRecord{UserID: userID, QuestionID: questionID}
+	} else if err != nil {
+		return false, nil, err
+	}
+	if c.DueAt.After(now) {
+		return false, nil, ErrStaleAnswer
+	}
+
+	correct := qt.Grade(choices) > 0
+	c.Reviews++
+	if correct {
+		if c.Box < int64(len(studyIntervals)) {
+			c.Box++
+		}
+	} else {
+		c.Lapses++
+		c.Box = 1
+	}
+	c.DueAt = now.Add(studyIntervals[c.Box-1])
+	c.ReviewedAt = now
+
+	if err := s.SaveCard(c); err != nil {
+		return false, nil, err
+	}
+	return correct, c, nil
+}
@@ -1,83 +1,71 @@
 package models
 
-import (
-	"fmt"
-	"strconv"
-)
-
 // Update is a manager for accessing updates in the database
 type Update struct {
 	id int64
+	s  Store
 }
 
 // NewUpdate creates a new update, saves it to the database, and returns the newly created question
-func NewUpdate(userID int64, body string) (*Update, error) {
-	id, err := client.Incr("update:next-id").Result()
-	if err != nil {
-		return nil, err
-	}
-	key := fmt.Sprintf("update:%d", id)
-	pipe := client.Pipeline()
-	pipe.HSet(key, "id", id)
-	pipe.HSet(key, "user_id", userID)
-	pipe.HSet(key, "body", body)
-	pipe.LPush("updates", id)
-	pipe.LPush(fmt.Sprintf("user:%d:updates", userID), id)
-	_, err = pipe.Exec()
+func NewUpdate(s Store, userID int64, body string) (*Update, error) {
+	id, err := s.CreateUpdate(userID, body)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Update{id: id}, nil
+	return &Update{id: id, s: s}, nil
 }
 
 // GetBody Body getter
 func (u *Update) GetBody() (string, error) {
-	key := fmt.Sprintf("update:%d", u.id)
-	return client.HGet(key, "body").Result()
+	r, err := u.s.GetUpdate(u.id)
+	if err != nil {
+		return "", err
+	}
+	return r.Body, nil
 }
 
 // GetUser User getter
 func (u *Update) GetUser() (*User, error) {
-	key := fmt.Sprintf("update:%d", u.id)
-	id, err := client.HGet(key, "user_id").Int64()
+	r, err := u.s.GetUpdate(u.id)
 	if err != nil {
 		return nil, err
 	}
 
-	return &User{id: id}, nil
+	return &User{id: r.UserID, s: u.s}, nil
 }
 
-func queryUpdates(key string) ([]*Update, error) {
-	updateIDs, err := client.LRange(key, 0, 10).Result()
-	if err != nil {
-		return nil, err
-	}
+// updatesLimit is how many of the latest updates are listed
+const updatesLimit = 11
 
-	updates := make([]*Update, len(updateIDs))
-	for i, val := range updateIDs {
-		id, err := strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		updates[i] = &Update{id: id}
+func toUpdates(s Store, ids []int64) []*Update {
+	updates := make([]*Update, len(ids))
+	for i, id := range ids {
+		updates[i] = &Update{id: id, s: s}
 	}
-	return updates, nil
+	return updates
 }
 
 // GetAllUpdates All Updates getter
-func GetAllUpdates() ([]*Update, error) {
-	return queryUpdates("updates")
+func GetAllUpdates(s Store) ([]*Update, error) {
+	ids, err := s.ListUpdateIDs(updatesLimit)
+	if err != nil {
+		return nil, err
+	}
+	return toUpdates(s, ids), nil
 }
 
 // GetUpdates gets all updates related to the user
-func GetUpdates(userID int64) ([]*Update, error) {
-	key := fmt.Sprintf("user:%d:updates", userID)
-	return queryUpdates(key)
+func GetUpdates(s Store, userID int64) ([]*Update, error) {
+	ids, err := s.ListUserUpdateIDs(userID, updatesLimit)
+	if err != nil {
+		return nil, err
+	}
+	return toUpdates(s, ids), nil
 }
 
 // PostUpdate adds a new update
-func PostUpdate(userID int64, body string) error {
-	_, err := NewUpdate(userID, body)
+func PostUpdate(s Store, userID int64, body string) error {
+	_, err := NewUpdate(s, userID, body)
 	return err
 }
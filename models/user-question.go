@@ -2,9 +2,9 @@ package models
 
 import (
 	"errors"
-	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,101 +12,119 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+// firstQuestionID is the question every exam starts with
+const firstQuestionID = 1
+
+// LimitsT is how long the user has to answer, zero means no limit
+type LimitsT struct {
+	// Question is the time to answer each question from when it is first served
+	Question time.Duration
+	// Exam is the time of the whole exam from when its first question is served
+	Exam time.Duration
+}
+
 // UserQuestion is a manager for accessing users' current question status in the database
 type UserQuestion struct {
 	id int64
+	s  Store
 }
 
 // newUserQuestion creates a new question for the user, saves it to the database, and returns the newly created question
-func newUserQuestion(userID int64) (*UserQuestion, error) {
-	exists, err := client.HExists("user-question:by-username", fmt.Sprint(userID)).Result()
-	if err != nil {
-		return nil, err
-	}
-	if exists {
+func newUserQuestion(s Store, userID int64) (*UserQuestion, error) {
+	_, err := s.GetUserQuestionIDByUserID(userID)
+	if err == nil {
 		return nil, errors.New("question already given to the current user")
 	}
-	id, err := client.Incr("user-question:next-id").Result()
-	if err != nil {
+	if err != ErrEmptyUserQuestion {
 		return nil, err
 	}
 
-	key := fmt.Sprintf("user-question:%d", id)
-	pipe := client.Pipeline()
-	pipe.HSet(key, "id", id)
-	pipe.HSet(key, "user_id", userID)
-	pipe.HSet(key, "question_id", 1)
-	pipe.HSet(key, "points", 0)
-	pipe.HSet(key, "rank", 0)
-	pipe.LPush(fmt.Sprintf("user:%d:questions", userID), 1)
-	pipe.LPush(fmt.Sprintf("user:%d:user-question", userID), id)
-	_, err = pipe.Exec()
+	id, err := s.CreateUserQuestion(userID, firstQuestionID, "", time.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	return &UserQuestion{id: id}, nil
+	return &UserQuestion{id: id, s: s}, nil
 }
 
 // GetUser User getter
 func (uq *UserQuestion) GetUser() (*User, error) {
-	key := fmt.Sprintf("user-question:%d", uq.id)
-	id, err := client.HGet(key, "user_id").Int64()
+	r, err := uq.s.GetUserQuestion(uq.id)
 	if err != nil {
 		return nil, err
 	}
 
-	return &User{id: id}, nil
+	return &User{id: r.UserID, s: uq.s}, nil
 }
 
 // GetQuestion Question getter
 func (uq *UserQuestion) GetQuestion() (*Question, error) {
-	key := fmt.Sprintf("user-question:%d", uq.id)
-	id, err := client.HGet(key, "question_id").Int64()
+	r, err := uq.s.GetUserQuestion(uq.id)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Question{id: id}, nil
+	return &Question{id: r.QuestionID, s: uq.s}, nil
+}
+
+// IsFinished checks if every question has been answered
+func (uq *UserQuestion) IsFinished() (bool, error) {
+	r, err := uq.s.GetUserQuestion(uq.id)
+	if err != nil {
+		return false, err
+	}
+
+	return r.QuestionID == 0, nil
 }
 
 // GetUserQuestions Questions by the user getter
 func (uq *UserQuestion) GetUserQuestions() ([]*Question, error) {
-
-	userID, err := uq.GetUser()
+	u, err := uq.GetUser()
 	if err != nil {
 		return nil, err
 	}
 
 	// get questions given to the user
-	key := fmt.Sprintf("user-question:%d:questions", userID)
-	return queryQuestions(key)
+	return GetQuestions(uq.s, u.id)
 }
 
 // GetUserQuestionsLen Questions len getter
-func GetUserQuestionsLen() (int64, error) {
-	return client.LLen("questions").Result()
+func GetUserQuestionsLen(s Store) (int64, error) {
+	ids, err := s.ListQuestionIDs()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
 }
 
-// GetUnansweredQuestions gets all questions user haven't answered
+// GetCategory gets the category the exam is limited to, empty if it has all questions
+func (uq *UserQuestion) GetCategory() (string, error) {
+	r, err := uq.s.GetUserQuestion(uq.id)
+	if err != nil {
+		return "", err
+	}
+
+	return r.Category, nil
+}
+
+// GetUnansweredQuestions gets all questions of the exam's category user haven't answered
 func (uq *UserQuestion) GetUnansweredQuestions() ([]*Question, error) {
-	userID, err := uq.GetUser()
+	r, err := uq.s.GetUserQuestion(uq.id)
 	if err != nil {
 		return nil, err
 	}
 
-	key := fmt.Sprintf("user:%d:questions", userID)
-	userQuestionIDs, err := client.LRange(key, 0, -1).Result()
+	userQuestionIDs, err := uq.s.ListAskedQuestionIDs(r.UserID)
 	if err != nil {
 		return nil, err
 	}
 
-	questionIDs, err := client.LRange("questions", 0, -1).Result()
+	questionIDs, err := categoryQuestionIDs(uq.s, r.Category)
 	if err != nil {
 		return nil, err
 	}
 
-	ids := diff(questionIDs, userQuestionIDs)
+	ids := diff(formatIDs(questionIDs), formatIDs(userQuestionIDs))
 
 	questions := make([]*Question, len(ids))
 	for i, val := range ids {
@@ -114,26 +132,43 @@ func (uq *UserQuestion) GetUnansweredQuestions() ([]*Question, error) {
 		if err != nil {
 			return nil, err
 		}
-		questions[i] = &Question{id: id}
+		questions[i] = &Question{id: id, s: uq.s}
 	}
 	return questions, nil
 }
 
-// diff gets the list of items m that are not in m
+func formatIDs(ids []int64) []string {
+	vals := make([]string, len(ids))
+	for i, id := range ids {
+		vals[i] = strconv.FormatInt(id, 10)
+	}
+	return vals
+}
+
+// diff gets the list of items of minu that are not in subt
 // see test
 func diff(minu, subt []string) []string {
-	s := minu[:]
-	for i := 0; i < len(minu); i++ {
-		for j := 0; j < len(subt); j++ {
-			if minu[i] == subt[j] {
-				s = remove(s, i)
-				break
-			}
+	s := append([]string{}, minu...)
+	for i := 0; i < len(s); {
+		if contains(subt, s[i]) {
+			// the last item is swapped into i so it has to be checked again
+			s = remove(s, i)
+			continue
 		}
+		i++
 	}
 	return s
 }
 
+func contains(s []string, item string) bool {
+	for _, v := range s {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
 func remove(s []string, i int) []string {
 	s[i] = s[len(s)-1]
 	return s[:len(s)-1]
@@ -141,108 +176,282 @@ func remove(s []string, i int) []string {
 
 // RegisterQuestion Question setter
 func (uq *UserQuestion) RegisterQuestion(questionID int64) error {
-	key := fmt.Sprintf("user-question:%d", uq.id)
-	pipe := client.Pipeline()
-	pipe.HSet(key, "question_id", questionID)
-	pipe.LPush("questions", questionID)
-	_, err := pipe.Exec()
-	return err
+	return uq.s.AssignQuestion(uq.id, questionID)
 }
 
 // GetPoints Points getter
 func (uq *UserQuestion) GetPoints() (int64, error) {
-	key := fmt.Sprintf("user-question:%d", uq.id)
-	points, err := client.HGet(key, "points").Int64()
+	r, err := uq.s.GetUserQuestion(uq.id)
 	if err != nil {
 		return 0, err
 	}
 
-	return points, nil
+	return r.Points, nil
 }
 
 // AddPoints Points setter
 func (uq *UserQuestion) AddPoints(amount int64) error {
-	key := fmt.Sprintf("user-question:%d", uq.id)
+	_, err := uq.s.AddPoints(uq.id, amount)
+	return err
+}
 
-	currPts, err := uq.GetPoints()
+// GetUserQuestion gets UserQuestion using user id
+func GetUserQuestion(s Store, userID int64) (*UserQuestion, error) {
+	id, err := s.GetUserQuestionIDByUserID(userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	pipe := client.Pipeline()
-	pipe.HSet(key, "points", currPts+amount)
-	_, err = pipe.Exec()
-	return err
+	return &UserQuestion{id: id, s: s}, nil
 }
 
-// GetUserQuestion gets UserQuestion using user id
-func GetUserQuestion(userID int64) (*UserQuestion, error) {
-	key := fmt.Sprintf("user:%d:user-question", userID)
+// UserConfirmAnswer returns true of false if the answer is correct and it gives the user's points wtih new question as a result of choosing the right answer
+// questionID is the question the user has answered, zero means the current one, ErrStaleAnswer is returned if it is
+// no longer the current question, e.g. when the same answer has been submitted twice
+// choices are what the user has picked or typed, only a multiple-select question takes more than one, a partially
+// right one is correct if it is worth any points, see QuestionT.Grade
+func UserConfirmAnswer(s Store, userID, questionID int64, choices ...string) (bool, error) {
+	return UserConfirmAnswerScored(s, ScoringT{}, userID, questionID, choices...)
+}
 
-	userQuestionIDs, err := client.LRange(key, 0, 0).Result()
+// UserConfirmAnswerScored is UserConfirmAnswer with the points of a right answer and the penalty of a wrong or late
+// one given by the scoring rules, the user's rank follows their points
+func UserConfirmAnswerScored(s Store, sc ScoringT, userID, questionID int64, choices ...string) (bool, error) {
+	uq, err := GetUserQuestion(s, userID)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	if len(userQuestionIDs) == 0 {
-		return nil, ErrEmptyUserQuestion
+	r, err := s.GetUserQuestion(uq.id)
+	if err != nil {
+		return false, err
+	}
+	if r.QuestionID == 0 {
+		return false, ErrExamFinished
+	}
+	if questionID == 0 {
+		questionID = r.QuestionID
+	}
+	if questionID != r.QuestionID {
+		return false, ErrStaleAnswer
 	}
 
-	id, err := strconv.ParseInt(userQuestionIDs[0], 10, 64)
+	qt, err := s.GetQuestion(questionID)
+	if err == ErrQuestionNotFound {
+		// deleted from the bank, the user is moved on the next time they see the exam
+		return false, ErrStaleAnswer
+	}
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	return &UserQuestion{id: id}, nil
-}
+	now := time.Now()
+	choice := strings.Join(choices, ", ")
 
-// UserConfirmAnswer returns true of false if the answer is correct and it gives the user's points wtih new question as a result of choosing the right answer
-func UserConfirmAnswer(userID int64, choice string) (bool, error) {
-	uq, err := GetUserQuestion(userID)
+	// a late answer is wrong whatever it is and the user is moved on
+	if timeUp(r, now) {
+		err := uq.skipLateQuestion(r, sc.Penalty, now)
+		if err == ErrStaleAnswer {
+			return false, ErrAnswerLate
+		}
+		if err != nil {
+			return false, err
+		}
+		if err := logAnswer(s, userID, questionID, choice, false, r.AssignedAt, now); err != nil {
+			return false, err
+		}
+		return false, ErrAnswerLate
+	}
+
+	grade := qt.Grade(choices)
+
+	// if choice is incorrect return false without error
+	if grade == 0 {
+		if err := s.RecordMiss(uq.id, questionID, sc.Penalty); err != nil {
+			return false, err
+		}
+		return false, logAnswer(s, userID, questionID, choice, false, r.AssignedAt, now)
+	}
+
+	points := sc.Points(grade, qt, r.Streak, now.Sub(r.AssignedAt))
+	nextID, err := uq.nextQuestionID()
 	if err != nil {
 		return false, err
 	}
 
-	q, err := uq.GetQuestion()
-	if err != nil {
+	// the points, the next question and the leaderboard are written at once only if no other answer came first
+	if _, err := s.AdvanceUserQuestion(uq.id, questionID, nextID, points, now); err != nil {
 		return false, err
 	}
 
-	qt, err := GetQuestion(q)
+	return true, logAnswer(s, userID, questionID, choice, true, r.AssignedAt, now)
+}
+
+// nextQuestionID picks a random unanswered question, no next question finishes the exam so it is 0 then
+func (uq *UserQuestion) nextQuestionID() (int64, error) {
+	qs, err := uq.GetUnansweredQuestions()
 	if err != nil {
-		return false, err
+		return 0, err
 	}
+	if len(qs) == 0 {
+		return 0, nil
+	}
+	return qs[rand.Intn(len(qs))].id, nil
+}
 
-	// if choice is incorrect return false without error
-	if choice != qt.Answer {
-		return false, nil
+// SkipDeletedQuestion gives the user another question if the current one has been deleted from the bank
+func (uq *UserQuestion) SkipDeletedQuestion() error {
+	r, err := uq.s.GetUserQuestion(uq.id)
+	if err != nil {
+		return err
+	}
+	if r.QuestionID == 0 {
+		return nil
 	}
 
-	qs, err := uq.GetUnansweredQuestions()
+	_, err = uq.s.GetQuestion(r.QuestionID)
+	if err != ErrQuestionNotFound {
+		return err
+	}
+
+	nextID, err := uq.nextQuestionID()
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	currPts, err := uq.GetPoints()
+	err = uq.s.SkipQuestion(uq.id, r.QuestionID, nextID, time.Now())
+	if err == ErrStaleAnswer {
+		// another request has already moved the user on
+		return nil
+	}
+	return err
+}
+
+// passed tells whether the deadline is set and has gone by
+func passed(deadline, now time.Time) bool {
+	return !deadline.IsZero() && now.After(deadline)
+}
+
+// timeUp tells whether the time of the current question or of the whole exam has run out
+func timeUp(r *UserQuestionRecord, now time.Time) bool {
+	return passed(r.Deadline, now) || passed(r.ExamDeadline, now)
+}
+
+// skipLateQuestion moves the user past the current question whose time has run out and records it as timed out, the
+// exam is finished when its own time has, ErrStaleAnswer is returned if another request has moved the user on first
+func (uq *UserQuestion) skipLateQuestion(r *UserQuestionRecord, penalty int64, now time.Time) error {
+	var nextID int64
+	if !passed(r.ExamDeadline, now) {
+		var err error
+		if nextID, err = uq.nextQuestionID(); err != nil {
+			return err
+		}
+	}
+	return uq.s.TimeOutQuestion(uq.id, r.QuestionID, nextID, penalty, now)
+}
+
+// ServeQuestion starts the clock of the current question when it is shown, and of the exam on its first question,
+// a question whose time has run out unanswered is recorded as timed out and the next one is served instead
+// it returns when the time to answer runs out, zero if there is no limit or the exam is finished
+func (uq *UserQuestion) ServeQuestion(limits LimitsT) (time.Time, error) {
+	r, err := uq.s.GetUserQuestion(uq.id)
 	if err != nil {
-		return false, err
+		return time.Time{}, err
+	}
+	if r.QuestionID == 0 {
+		return time.Time{}, nil
 	}
 
-	// the ff. should not return true until all the steps are completed.
-	// FIXME: consider more atomic transaction
+	now := time.Now()
+	if timeUp(r, now) {
+		// a question left unanswered is not marked negatively
+		err := uq.skipLateQuestion(r, 0, now)
+		if err != nil && err != ErrStaleAnswer {
+			return time.Time{}, err
+		}
+		// a question that has not been served has not been answered, e.g. the exam ran out right after an answer
+		if err == nil && !r.Deadline.IsZero() {
+			if err := logAnswer(uq.s, r.UserID, r.QuestionID, "", false, r.AssignedAt, now); err != nil {
+				return time.Time{}, err
+			}
+		}
 
-	
-	questionID := qs[rand.Intn(len(qs))].id
-	
-	pipe := client.Pipeline()
-	
-	key := fmt.Sprintf("user-question:%d", uq.id)
-	pipe.HSet(key, "points", currPts+1)
-	pipe.HSet(key, "question_id", questionID)
-	pipe.LPush("questions", questionID)
-	if _, err := pipe.Exec(); err != nil {
-		return false, err
+		if r, err = uq.s.GetUserQuestion(uq.id); err != nil {
+			return time.Time{}, err
+		}
+		if r.QuestionID == 0 {
+			return time.Time{}, nil
+		}
+	}
+
+	examDeadline := r.ExamDeadline
+	if examDeadline.IsZero() && limits.Exam > 0 {
+		examDeadline = now.Add(limits.Exam)
+	}
+	var deadline time.Time
+	if limits.Question > 0 {
+		deadline = now.Add(limits.Question)
+	}
+	if !examDeadline.IsZero() && (deadline.IsZero() || examDeadline.Before(deadline)) {
+		deadline = examDeadline
+	}
+	if deadline.IsZero() {
+		return time.Time{}, nil
+	}
+
+	// the deadlines already set are kept so reloading the page does not restart the clock
+	err = uq.s.ServeQuestion(uq.id, r.QuestionID, deadline, examDeadline)
+	if err != nil && err != ErrStaleAnswer {
+		return time.Time{}, err
+	}
+
+	if r, err = uq.s.GetUserQuestion(uq.id); err != nil {
+		return time.Time{}, err
+	}
+	if r.QuestionID == 0 {
+		return time.Time{}, nil
+	}
+	return r.Deadline, nil
+}
+
+// RestartExam resets the user's progress and points to start the exam over in the same category
+func RestartExam(s Store, userID int64) error {
+	uq, err := GetUserQuestion(s, userID)
+	if err != nil {
+		return err
+	}
+
+	category, err := uq.GetCategory()
+	if err != nil {
+		return err
+	}
+	return StartExam(s, userID, category)
+}
+
+// StartExam resets the user's progress and points to start an exam of only the questions of the category,
+// an empty category starts on the first question and goes through every question
+func StartExam(s Store, userID int64, category string) error {
+	questionID := int64(firstQuestionID)
+	if category != "" {
+		ids, err := categoryQuestionIDs(s, category)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrEmptyCategory
+		}
+		questionID = ids[rand.Intn(len(ids))]
+
+		// the category is kept as the questions spell it
+		qt, err := s.GetQuestion(questionID)
+		if err != nil {
+			return err
+		}
+		category = qt.Category
 	}
 
-	return true, nil
+	if _, err := s.CreateUserQuestion(userID, questionID, category, time.Now()); err != nil {
+		return err
+	}
+	return s.SetScore(userID, 0)
 }
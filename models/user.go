@@ -1,8 +1,6 @@
 package models
 
 import (
-	"fmt"
-
 	"github.com/gocs/davy/validator"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -10,40 +8,28 @@ import (
 // User is a manager for accessing users in the database
 type User struct {
 	id int64
+	s  Store
 }
 
 // NewUser create a new user, saves it to the database, and returns the newly created user
-func NewUser(username string, hash []byte) (*User, error) {
-	exists, err := client.HExists("user:by-username", username).Result()
-	if err != nil {
-		return nil, err
-	}
-	if exists {
+func NewUser(s Store, username string, hash []byte) (*User, error) {
+	if _, err := s.GetUserIDByUsername(username); err == nil {
 		return nil, ErrUsernameTaken
-	}
-
-	err = validator.Username(username)
-	if err != nil {
+	} else if err != ErrUserNotFound {
 		return nil, err
 	}
 
-	id, err := client.Incr("user:next-id").Result()
+	err := validator.Username(username)
 	if err != nil {
 		return nil, err
 	}
-	key := fmt.Sprintf("user:%d", id)
-	pipe := client.Pipeline()
-	pipe.HSet(key, "id", id)
-	pipe.HSet(key, "username", username)
-	pipe.HSet(key, "hash", hash)
-	pipe.HSet(key, "lobby", -1)
-	pipe.HSet("user:by-username", username, id)
-	_, err = pipe.Exec()
+
+	id, err := s.CreateUser(username, hash)
 	if err != nil {
 		return nil, err
 	}
 
-	return &User{id: id}, nil
+	return &User{id: id, s: s}, nil
 }
 
 // GetUserID UserID getter
@@ -51,28 +37,32 @@ func (u *User) GetUserID() int64 { return u.id }
 
 // GetUsername Username getter
 func (u *User) GetUsername() (string, error) {
-	key := fmt.Sprintf("user:%d", u.id)
-	return client.HGet(key, "username").Result()
+	ur, err := u.s.GetUser(u.id)
+	if err != nil {
+		return "", err
+	}
+	return ur.Username, nil
 }
 
 // GetHash Hash getter
 func (u *User) GetHash() ([]byte, error) {
-	key := fmt.Sprintf("user:%d", u.id)
-	return client.HGet(key, "hash").Bytes()
+	ur, err := u.s.GetUser(u.id)
+	if err != nil {
+		return nil, err
+	}
+	return ur.Hash, nil
 }
 
 // GetLobby Lobby getter
 func (u *User) GetLobby() (*Lobby, error) {
-	key := fmt.Sprintf("user:%d", u.id)
-
-	id, err := client.HGet(key, "lobby").Int64()
+	ur, err := u.s.GetUser(u.id)
 	if err != nil {
 		return nil, err
 	}
-	if id == -1 {
+	if ur.LobbyID == -1 {
 		return nil, ErrUserNotInLobby
 	}
-	return &Lobby{id: id}, nil
+	return &Lobby{id: ur.LobbyID, s: u.s}, nil
 }
 
 // Authenticate will validates the login attempt
@@ -89,25 +79,25 @@ func (u *User) Authenticate(password string) error {
 }
 
 // RegisterUser register a valid user
-func RegisterUser(username, password string) error {
+func RegisterUser(s Store, username, password string) error {
 	cost := bcrypt.DefaultCost
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return err
 	}
 
-	u, err := NewUser(username, hash)
+	u, err := NewUser(s, username, hash)
 	if err != nil {
 		return err
 	}
 
-	_, err = newUserQuestion(u.id)
+	_, err = newUserQuestion(s, u.id)
 	return err
 }
 
 // IsUser checks if username has registered in this site
-func IsUser(userID int64) (bool, error) {
-	u := &User{id: userID}
+func IsUser(s Store, userID int64) (bool, error) {
+	u := &User{id: userID, s: s}
 	un, err := u.GetUsername()
 	if err != nil || un == "" {
 		return false, err
@@ -116,8 +106,8 @@ func IsUser(userID int64) (bool, error) {
 }
 
 // GetUserByUserID gets user using a user id
-func GetUserByUserID(userID int64) (*User, error) {
-	return &User{id: userID}, nil
+func GetUserByUserID(s Store, userID int64) (*User, error) {
+	return &User{id: userID, s: s}, nil
 }
 
 // GetUserIDByUser gets the user id using the user
@@ -126,20 +116,18 @@ func GetUserIDByUser(user *User) int64 {
 }
 
 // GetUserByUsername gets the user using the username
-func GetUserByUsername(username string) (*User, error) {
-	id, err := client.HGet("user:by-username", username).Int64()
-	if err == redisNil {
-		return nil, ErrUserNotFound
-	} else if err != nil {
+func GetUserByUsername(s Store, username string) (*User, error) {
+	id, err := s.GetUserIDByUsername(username)
+	if err != nil {
 		return nil, err
 	}
 
-	return &User{id: id}, nil
+	return &User{id: id, s: s}, nil
 }
 
 // AuthenticateUser authenticates the user by its username and password
-func AuthenticateUser(username, password string) (*User, error) {
-	user, err := GetUserByUsername(username)
+func AuthenticateUser(s Store, username, password string) (*User, error) {
+	user, err := GetUserByUsername(s, username)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,285 @@
+package router
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/servererrors"
+	"github.com/gocs/davy/validator"
+	"github.com/gorilla/csrf"
+)
+
+// AdminQuizzesPayload is the data to pass to the template of the quizzes
+type AdminQuizzesPayload struct {
+	CSRF      template.HTML
+	Title     string
+	User      string
+	Quizzes   []models.QuizItemT
+	Questions []models.QuestionItemT
+	Form      QuizForm
+	Error     string
+}
+
+// AdminQuizPayload is the data to pass to the template of a single quiz
+type AdminQuizPayload struct {
+	CSRF      template.HTML
+	Title     string
+	User      string
+	ID        int64
+	Questions []models.QuestionItemT
+	Form      QuizForm
+	Error     string
+}
+
+// QuizForm is a quiz as it is typed in the admin forms, the question ids are separated by commas or spaces in the
+// order they are asked, the scoring rules left empty are 0
+type QuizForm struct {
+	Title       string
+	Description string
+	QuestionIDs string
+	Shuffle     bool
+	PassMark    string
+	Published   bool
+	Weighted    bool
+	Penalty     string
+	StreakEvery string
+	StreakMax   string
+	TimeBonus   string
+	BonusWithin string
+}
+
+func newQuizForm(q *models.QuizT) QuizForm {
+	ids := make([]string, len(q.QuestionIDs))
+	for i, id := range q.QuestionIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	return QuizForm{
+		Title:       q.Title,
+		Description: q.Description,
+		QuestionIDs: strings.Join(ids, ", "),
+		Shuffle:     q.Shuffle,
+		PassMark:    strconv.FormatInt(q.PassMark, 10),
+		Published:   q.Published,
+		Weighted:    q.Scoring.Weighted,
+		Penalty:     formatRule(q.Scoring.Penalty),
+		StreakEvery: formatRule(q.Scoring.StreakEvery),
+		StreakMax:   formatRule(q.Scoring.StreakMax),
+		TimeBonus:   formatRule(q.Scoring.TimeBonus),
+		BonusWithin: formatRule(int64(q.Scoring.BonusWithin / time.Second)),
+	}
+}
+
+// formatRule leaves a rule that is off empty
+func formatRule(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// parseRule gives 0 for an empty rule and -1 for one that is not a number so it is left to the validation
+func parseRule(v string) int64 {
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func parseQuizForm(r *http.Request) QuizForm {
+	r.ParseForm()
+	return QuizForm{
+		Title:       strings.TrimSpace(r.PostForm.Get("title")),
+		Description: r.PostForm.Get("description"),
+		QuestionIDs: r.PostForm.Get("question_ids"),
+		Shuffle:     r.PostForm.Get("shuffle") != "",
+		PassMark:    strings.TrimSpace(r.PostForm.Get("pass_mark")),
+		Published:   r.PostForm.Get("published") != "",
+		Weighted:    r.PostForm.Get("weighted") != "",
+		Penalty:     strings.TrimSpace(r.PostForm.Get("penalty")),
+		StreakEvery: strings.TrimSpace(r.PostForm.Get("streak_every")),
+		StreakMax:   strings.TrimSpace(r.PostForm.Get("streak_max")),
+		TimeBonus:   strings.TrimSpace(r.PostForm.Get("time_bonus")),
+		BonusWithin: strings.TrimSpace(r.PostForm.Get("bonus_within")),
+	}
+}
+
+// quiz is the typed quiz, an id or a pass mark that is not a number is left to the validation
+func (f QuizForm) quiz() *models.QuizT {
+	passMark, err := strconv.ParseInt(f.PassMark, 10, 64)
+	if err != nil && f.PassMark != "" {
+		passMark = -1
+	}
+
+	ids := []int64{}
+	for _, v := range strings.FieldsFunc(f.QuestionIDs, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' }) {
+		// 0 is never a question so it is reported as not in the bank
+		id, _ := strconv.ParseInt(v, 10, 64)
+		ids = append(ids, id)
+	}
+
+	return &models.QuizT{
+		Title:       f.Title,
+		Description: f.Description,
+		QuestionIDs: ids,
+		Shuffle:     f.Shuffle,
+		PassMark:    passMark,
+		Published:   f.Published,
+		Scoring: models.ScoringT{
+			Weighted:    f.Weighted,
+			Penalty:     parseRule(f.Penalty),
+			StreakEvery: parseRule(f.StreakEvery),
+			StreakMax:   parseRule(f.StreakMax),
+			TimeBonus:   parseRule(f.TimeBonus),
+			BonusWithin: time.Duration(parseRule(f.BonusWithin)) * time.Second,
+		},
+	}
+}
+
+// quizFormError gives the message to show for the errors the admin can fix
+func quizFormError(err error) (string, bool) {
+	switch err {
+	case validator.ErrInvalidQuiz, validator.ErrInvalidScoring, models.ErrQuizQuestion:
+		return err.Error(), true
+	}
+	return "", false
+}
+
+func (a *App) renderAdminQuizzes(w http.ResponseWriter, r *http.Request, form QuizForm, e string) {
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	quizzes, err := models.ListQuizzes(a.store, true)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	questions, err := models.SearchQuestions(a.store, "")
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.tmpl.ExecuteTemplate(w, "admin-quizzes.html", AdminQuizzesPayload{
+		CSRF:      csrf.TemplateField(r),
+		Title:     "Quizzes",
+		User:      username,
+		Quizzes:   quizzes,
+		Questions: questions,
+		Form:      form,
+		Error:     e,
+	})
+}
+
+func (a *App) adminQuizzesGetHandler(w http.ResponseWriter, r *http.Request) {
+	a.renderAdminQuizzes(w, r, QuizForm{PassMark: "50"}, "")
+}
+
+func (a *App) adminQuizzesPostHandler(w http.ResponseWriter, r *http.Request) {
+	form := parseQuizForm(r)
+	_, err := models.AddQuiz(a.store, form.quiz())
+	if err != nil {
+		if e, ok := quizFormError(err); ok {
+			a.renderAdminQuizzes(w, r, form, e)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/admin/quizzes", http.StatusFound)
+}
+
+func (a *App) renderAdminQuiz(w http.ResponseWriter, r *http.Request, id int64, form QuizForm, e string) {
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	questions, err := models.SearchQuestions(a.store, "")
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.tmpl.ExecuteTemplate(w, "admin-quiz.html", AdminQuizPayload{
+		CSRF:      csrf.TemplateField(r),
+		Title:     "Edit quiz",
+		User:      username,
+		ID:        id,
+		Questions: questions,
+		Form:      form,
+		Error:     e,
+	})
+}
+
+func (a *App) adminQuizGetHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	q, err := a.store.GetQuiz(id)
+	if err != nil {
+		if err == models.ErrQuizNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.renderAdminQuiz(w, r, id, newQuizForm(q), "")
+}
+
+func (a *App) adminQuizPostHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	form := parseQuizForm(r)
+	err := models.EditQuiz(a.store, id, form.quiz())
+	if err != nil {
+		if e, ok := quizFormError(err); ok {
+			a.renderAdminQuiz(w, r, id, form, e)
+			return
+		}
+		if err == models.ErrQuizNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/admin/quizzes", http.StatusFound)
+}
+
+func (a *App) adminQuizDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := models.DeleteQuiz(a.store, id); err != nil && err != models.ErrQuizNotFound {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/admin/quizzes", http.StatusFound)
+}
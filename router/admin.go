@@ -0,0 +1,332 @@
+package router
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/servererrors"
+	"github.com/gocs/davy/validator"
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+)
+
+// AdminQuestionsPayload is the data to pass to the template of the question bank
+type AdminQuestionsPayload struct {
+	CSRF      template.HTML
+	Title     string
+	User      string
+	Query     string
+	Questions []models.QuestionItemT
+	Types     []string
+	Form      QuestionForm
+	Error     string
+	Report    *models.ImportReportT
+}
+
+// AdminQuestionPayload is the data to pass to the template of a single question
+type AdminQuestionPayload struct {
+	CSRF  template.HTML
+	Title string
+	User  string
+	ID    int64
+	Types []string
+	Form  QuestionForm
+	Error string
+}
+
+// QuestionForm is a question as it is typed in the admin forms, the choices and the answers are one per line and
+// the tags are comma separated
+type QuestionForm struct {
+	Statement     string
+	Type          string
+	Answer        string
+	Answers       string
+	Choices       string
+	PartialCredit bool
+	Tolerance     string
+	Difficulty    string
+	Category      string
+	Tags          string
+	Explanation   string
+	Links         string
+	Hint          string
+}
+
+func newQuestionForm(qt *models.QuestionT) QuestionForm {
+	return QuestionForm{
+		Statement:     qt.Statement,
+		Type:          qt.Type,
+		Answer:        qt.Answer,
+		Answers:       strings.Join(qt.Answers, "\n"),
+		Choices:       strings.Join(qt.Choices, "\n"),
+		PartialCredit: qt.PartialCredit,
+		Tolerance:     strconv.FormatFloat(qt.Tolerance, 'f', -1, 64),
+		Difficulty:    strconv.FormatInt(qt.Difficulty, 10),
+		Category:      qt.Category,
+		Tags:          strings.Join(qt.Tags, ", "),
+		Explanation:   qt.Explanation,
+		Links:         strings.Join(qt.Links, "\n"),
+		Hint:          qt.Hint,
+	}
+}
+
+func parseQuestionForm(r *http.Request) QuestionForm {
+	r.ParseForm()
+	return QuestionForm{
+		Statement:     strings.TrimSpace(r.PostForm.Get("statement")),
+		Type:          r.PostForm.Get("type"),
+		Answer:        strings.TrimSpace(r.PostForm.Get("answer")),
+		Answers:       r.PostForm.Get("answers"),
+		Choices:       r.PostForm.Get("choices"),
+		PartialCredit: r.PostForm.Get("partial_credit") != "",
+		Tolerance:     strings.TrimSpace(r.PostForm.Get("tolerance")),
+		Difficulty:    strings.TrimSpace(r.PostForm.Get("difficulty")),
+		Category:      r.PostForm.Get("category"),
+		Tags:          r.PostForm.Get("tags"),
+		Explanation:   r.PostForm.Get("explanation"),
+		Links:         r.PostForm.Get("links"),
+		Hint:          r.PostForm.Get("hint"),
+	}
+}
+
+// lines splits the lines of the textarea, blank lines are ignored
+func lines(text string) []string {
+	vals := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if v := strings.TrimSpace(line); v != "" {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// question is the typed question, a tolerance or a difficulty that is not a number is left to the validation
+func (f QuestionForm) question() *models.QuestionT {
+	tolerance, err := strconv.ParseFloat(f.Tolerance, 64)
+	if err != nil && f.Tolerance != "" {
+		tolerance = -1
+	}
+	difficulty, err := strconv.ParseInt(f.Difficulty, 10, 64)
+	if err != nil && f.Difficulty != "" {
+		difficulty = -1
+	}
+	return &models.QuestionT{
+		Statement:     f.Statement,
+		Type:          f.Type,
+		Answer:        f.Answer,
+		Answers:       lines(f.Answers),
+		Choices:       lines(f.Choices),
+		PartialCredit: f.PartialCredit,
+		Tolerance:     tolerance,
+		Difficulty:    difficulty,
+		Category:      f.Category,
+		Tags:          strings.Split(f.Tags, ","),
+		Explanation:   f.Explanation,
+		Links:         lines(f.Links),
+		Hint:          f.Hint,
+	}
+}
+
+// questionFormError gives the message to show for the errors the admin can fix, anything else is not the form's fault
+func questionFormError(err error) (string, bool) {
+	switch err {
+	case validator.ErrInvalidQuestion, validator.ErrInvalidLink, validator.ErrInvalidDifficulty,
+		models.ErrQuestionDuplicate:
+		return err.Error(), true
+	}
+	return "", false
+}
+
+func (a *App) sessionUsername(r *http.Request) (string, error) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return "", models.ErrTypeMismatch
+	}
+
+	user, err := models.GetUserByUserID(a.store, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.GetUsername()
+}
+
+func pathID(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	return id, err == nil
+}
+
+func (a *App) renderAdminQuestions(w http.ResponseWriter, r *http.Request, form QuestionForm, e string, report *models.ImportReportT) {
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	questions, err := models.SearchQuestions(a.store, query)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.tmpl.ExecuteTemplate(w, "admin-questions.html", AdminQuestionsPayload{
+		CSRF:      csrf.TemplateField(r),
+		Title:     "Questions",
+		User:      username,
+		Query:     query,
+		Questions: questions,
+		Types:     models.QuestionTypes,
+		Form:      form,
+		Error:     e,
+		Report:    report,
+	})
+}
+
+func (a *App) adminQuestionsGetHandler(w http.ResponseWriter, r *http.Request) {
+	a.renderAdminQuestions(w, r, QuestionForm{}, "", nil)
+}
+
+func (a *App) adminQuestionsPostHandler(w http.ResponseWriter, r *http.Request) {
+	form := parseQuestionForm(r)
+	_, err := models.AddQuestion(a.store, form.question())
+	if err != nil {
+		if e, ok := questionFormError(err); ok {
+			a.renderAdminQuestions(w, r, form, e, nil)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/admin/questions", http.StatusFound)
+}
+
+func (a *App) renderAdminQuestion(w http.ResponseWriter, r *http.Request, id int64, form QuestionForm, e string) {
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.tmpl.ExecuteTemplate(w, "admin-question.html", AdminQuestionPayload{
+		CSRF:  csrf.TemplateField(r),
+		Title: "Edit question",
+		User:  username,
+		ID:    id,
+		Types: models.QuestionTypes,
+		Form:  form,
+		Error: e,
+	})
+}
+
+func (a *App) adminQuestionGetHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	qt, err := a.store.GetQuestion(id)
+	if err != nil {
+		if err == models.ErrQuestionNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.renderAdminQuestion(w, r, id, newQuestionForm(qt), "")
+}
+
+func (a *App) adminQuestionPostHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	form := parseQuestionForm(r)
+	err := models.EditQuestion(a.store, id, form.question())
+	if err != nil {
+		if e, ok := questionFormError(err); ok {
+			a.renderAdminQuestion(w, r, id, form, e)
+			return
+		}
+		if err == models.ErrQuestionNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/admin/questions", http.StatusFound)
+}
+
+func (a *App) adminQuestionDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := models.DeleteQuestion(a.store, id); err != nil && err != models.ErrQuestionNotFound {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/admin/questions", http.StatusFound)
+}
+
+// importLimit is the largest questions file accepted by the import
+const importLimit = 10 << 20
+
+func (a *App) adminImportPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, importLimit)
+	f, header, err := r.FormFile("file")
+	if err != nil {
+		a.renderAdminQuestions(w, r, QuestionForm{}, "choose a .csv or .json questions file", nil)
+		return
+	}
+	defer f.Close()
+
+	var report *models.ImportReportT
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".csv":
+		report, err = models.ImportQuestionsCSV(a.store, f)
+	case ".json":
+		report, err = models.ImportQuestionsJSON(a.store, f)
+	default:
+		a.renderAdminQuestions(w, r, QuestionForm{}, "choose a .csv or .json questions file", nil)
+		return
+	}
+	if err != nil {
+		// the file itself cannot be read, e.g. a broken header
+		a.renderAdminQuestions(w, r, QuestionForm{}, err.Error(), report)
+		return
+	}
+
+	a.renderAdminQuestions(w, r, QuestionForm{}, "", report)
+}
+
+func (a *App) adminExportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="questions.csv"`)
+	if err := models.ExportQuestionsCSV(a.store, w); err != nil {
+		servererrors.InternalServerError(w, err.Error())
+	}
+}
+
+func (a *App) adminExportJSONHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="questions.json"`)
+	if err := models.ExportQuestionsJSON(a.store, w); err != nil {
+		servererrors.InternalServerError(w, err.Error())
+	}
+}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/servererrors"
+	"github.com/gorilla/csrf"
+)
+
+// AnswersPayload is the data to pass to the template of the answer history
+type AnswersPayload struct {
+	CSRF   template.HTML
+	Title  string
+	User   string
+	Points int64
+	Page   models.AnswerPageT
+}
+
+// answerPage gets the requested page of the session user's answers
+func (a *App) answerPage(r *http.Request) (int64, *models.AnswerPageT, error) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	u := session.Values["user_id"]
+	userID, ok := u.(int64)
+	if !ok {
+		return 0, nil, models.ErrTypeMismatch
+	}
+
+	page, err := strconv.ParseInt(r.URL.Query().Get("page"), 10, 64)
+	if err != nil {
+		page = 1
+	}
+
+	p, err := models.GetAnswerPage(a.store, userID, page)
+	return userID, p, err
+}
+
+func (a *App) answersGetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, page, err := a.answerPage(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	user, err := models.GetUserByUserID(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	username, err := user.GetUsername()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	uq, err := models.GetUserQuestion(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	p, err := uq.GetPoints()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.tmpl.ExecuteTemplate(w, "answers.html", AnswersPayload{
+		CSRF:   csrf.TemplateField(r),
+		Title:  "My answers",
+		User:   username,
+		Points: p,
+		Page:   *page,
+	})
+}
+
+func (a *App) answersJSONHandler(w http.ResponseWriter, r *http.Request) {
+	_, page, err := a.answerPage(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,154 @@
+package router
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gocs/davy/message"
+	"github.com/gocs/davy/models"
+	"gopkg.in/olahol/melody.v1"
+)
+
+// chatEnvelope is the room a chat message's json takes besides its text, more than any other message a client sends
+const chatEnvelope = 512
+
+// chatFrameSize is the largest websocket message a client can send, a chat message of maxLength characters each
+// escaped in json, up to 6 bytes as \u003c, so that a message the chat takes never closes the websocket
+func chatFrameSize(maxLength int) int64 {
+	return int64(maxLength)*6 + chatEnvelope
+}
+
+// chatLimiter keeps when each user has sent its latest chat messages to limit how fast it sends them
+type chatLimiter struct {
+	mu   sync.Mutex
+	sent map[int64][]time.Time
+}
+
+// allow records the message the user sends now unless it has sent rate messages within per already, a rate of 0 is no
+// limit, only the user's messages older than per are dropped
+func (cl *chatLimiter) allow(userID int64, rate int, per time.Duration, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.sent == nil {
+		cl.sent = map[int64][]time.Time{}
+	}
+	recent := []time.Time{}
+	for _, t := range cl.sent[userID] {
+		if now.Sub(t) < per {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= rate {
+		cl.sent[userID] = recent
+		return false
+	}
+	cl.sent[userID] = append(recent, now)
+	return true
+}
+
+// refund takes back the message allow has recorded at the time, the chat has not taken it
+func (cl *chatLimiter) refund(userID int64, at time.Time) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	sent := cl.sent[userID]
+	for i := len(sent) - 1; i >= 0; i-- {
+		if sent[i].Equal(at) {
+			sent = append(sent[:i], sent[i+1:]...)
+			break
+		}
+	}
+	if len(sent) == 0 {
+		delete(cl.sent, userID)
+		return
+	}
+	cl.sent[userID] = sent
+}
+
+// forget drops the messages of a user who is not in the lobby anymore
+func (cl *chatLimiter) forget(userID int64) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	delete(cl.sent, userID)
+}
+
+// newChatView is the chat message as the lobby's members see it
+func newChatView(m models.ChatMessageT) message.Chat {
+	return message.Chat{ID: m.ID, Username: m.Username, Text: m.Text, SentAt: m.SentAt.Unix()}
+}
+
+// chatHistory gets the lobby's chat as its members see it
+func chatHistory(l *models.Lobby) (message.Message, error) {
+	chat, err := l.GetChat()
+	if err != nil {
+		return message.Message{}, err
+	}
+	cs := []message.Chat{}
+	for _, m := range chat {
+		cs = append(cs, newChatView(m))
+	}
+	return message.ChatHistory(cs), nil
+}
+
+// handleChat takes the client's chat message or its moderation of the chat, the error is told to the client only
+func (a *App) handleChat(s *melody.Session, m *message.Message) error {
+	lobbyID, ok := wsLobbyID(s)
+	if !ok {
+		return models.ErrUserNotInLobby
+	}
+	u, _ := s.Get("user_id")
+	userID, ok := u.(int64)
+	if !ok {
+		return models.ErrTypeMismatch
+	}
+	l, err := models.GetLobbyByID(a.store, lobbyID)
+	if err != nil {
+		return err
+	}
+
+	switch m.Type {
+	case message.TypeChat:
+		if m.Chat == nil {
+			return message.ErrMalformed
+		}
+		now := time.Now()
+		if !a.chatLimits.allow(userID, a.chat.Rate, a.chat.Per, now) {
+			return models.ErrChatRate
+		}
+		sent, err := l.SendChat(a.chat, userID, m.Chat.Text)
+		if err != nil {
+			// a muted member's message or one that is empty or too long does not count towards the rate
+			a.chatLimits.refund(userID, now)
+			return err
+		}
+		a.broadcastLobby(lobbyID, message.NewChat(newChatView(*sent)))
+	case message.TypeDeleteChat:
+		if m.Chat == nil {
+			return message.ErrMalformed
+		}
+		if err := l.DeleteChat(userID, m.Chat.ID); err != nil {
+			return err
+		}
+		a.broadcastLobby(lobbyID, message.ChatDeleted(m.Chat.ID))
+	case message.TypeMute, message.TypeUnmute:
+		target, err := models.GetUserByUsername(a.store, m.Username)
+		if err != nil {
+			return err
+		}
+		if err := l.Mute(userID, target.GetUserID(), m.Type == message.TypeMute); err != nil {
+			return err
+		}
+		if err := a.pushLobby(l); err != nil {
+			log.Println(err)
+		}
+	default:
+		return message.ErrUnexpected
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package router
 
 import (
 	"html/template"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gocs/davy/models"
 	"github.com/gocs/davy/servererrors"
@@ -11,13 +15,36 @@ import (
 
 // ExamPayload is the data to pass to the template
 type ExamPayload struct {
-	CSRF        template.HTML
-	Title       string
-	User        string
-	Question    models.QuestionT
-	Correct     bool
-	Points      int64
-	Explanation string
+	CSRF       template.HTML
+	Title      string
+	User       string
+	QuestionID int64
+	Question   models.QuestionT
+	Correct    bool
+	Points     int64
+	Category   string
+	Categories []string
+	// Answered shows whether Correct and the question's explanation
+	Answered bool
+	// Late is an answer given after the time has run out
+	Late bool
+	// Remaining is the seconds left to answer, zero if the question is not timed
+	Remaining int64
+	// Lifelines is how the lifelines stand on the question, its choices are the ones the 50/50 has left
+	Lifelines models.LifelineStateT
+	// Costs is the points each lifeline costs
+	Costs models.LifelinesT
+}
+
+// ResultsPayload is the data to pass to the template of the finished exam
+type ResultsPayload struct {
+	CSRF       template.HTML
+	Title      string
+	User       string
+	Points     int64
+	Result     models.ResultT
+	Category   string
+	Categories []string
 }
 
 func (a *App) examGetHandler(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +56,7 @@ func (a *App) examGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := models.GetUserByUserID(userID)
+	user, err := models.GetUserByUserID(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -41,12 +68,61 @@ func (a *App) examGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uq, err := models.GetUserQuestion(userID)
+	uq, err := models.GetUserQuestion(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	category, err := uq.GetCategory()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	// choosing another category starts its exam over
+	if _, ok := r.URL.Query()["category"]; ok {
+		if c := strings.TrimSpace(r.URL.Query().Get("category")); !strings.EqualFold(c, category) {
+			err := models.StartExam(a.store, userID, c)
+			if err == models.ErrEmptyCategory {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				servererrors.InternalServerError(w, err.Error())
+				return
+			}
+		}
+		http.Redirect(w, r, "/exam", http.StatusFound)
+		return
+	}
+
+	if err := uq.SkipDeletedQuestion(); err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	deadline, err := uq.ServeQuestion(a.limits)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	finished, err := uq.IsFinished()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	categories, err := models.ListCategories(a.store)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
 
+	if finished {
+		a.renderResults(w, r, userID, username, category, categories)
+		return
+	}
+
 	question, err := uq.GetQuestion()
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
@@ -55,6 +131,7 @@ func (a *App) examGetHandler(w http.ResponseWriter, r *http.Request) {
 
 	p, err := uq.GetPoints()
 	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
 		return
 	}
 
@@ -63,17 +140,51 @@ func (a *App) examGetHandler(w http.ResponseWriter, r *http.Request) {
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
+	lifelines, err := a.examLifelines(uq, qt)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
 
 	a.tmpl.ExecuteTemplate(w, "exam.html", ExamPayload{
-		CSRF:     csrf.TemplateField(r),
-		Title:    "Question",
-		User:     username,
-		Question: *qt,
-		Points:   p,
+		CSRF:       csrf.TemplateField(r),
+		Title:      "Question",
+		User:       username,
+		QuestionID: question.GetQuestionID(),
+		Question:   *qt,
+		Points:     p,
+		Category:   category,
+		Categories: categories,
+		Remaining:  remaining(deadline),
+		Lifelines:  *lifelines,
+		Costs:      a.lifelines,
 	})
 
 }
 
+// examLifelines gets how the lifelines stand on the current question and takes the choices hidden by the 50/50 away
+// from the question
+func (a *App) examLifelines(uq *models.UserQuestion, qt *models.QuestionT) (*models.LifelineStateT, error) {
+	st, err := uq.GetLifelines(a.lifelines)
+	if err != nil {
+		return nil, err
+	}
+	qt.Choices = st.Choices(qt)
+	return st, nil
+}
+
+// remaining gives the whole seconds left until the deadline, at least 1 so a timed question still counts down
+func remaining(deadline time.Time) int64 {
+	if deadline.IsZero() {
+		return 0
+	}
+	secs := int64(math.Ceil(time.Until(deadline).Seconds()))
+	if secs < 1 {
+		return 1
+	}
+	return secs
+}
+
 func (a *App) examPostHandler(w http.ResponseWriter, r *http.Request) {
 	session, _ := a.sessions.Store.Get(r, "session")
 	u := session.Values["user_id"]
@@ -83,7 +194,7 @@ func (a *App) examPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := models.GetUserByUserID(userID)
+	user, err := models.GetUserByUserID(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -95,11 +206,26 @@ func (a *App) examPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uq, err := models.GetUserQuestion(userID)
+	uq, err := models.GetUserQuestion(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	if err := uq.SkipDeletedQuestion(); err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	finished, err := uq.IsFinished()
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
+	if finished {
+		http.Redirect(w, r, "/exam", http.StatusFound)
+		return
+	}
 
 	q, err := uq.GetQuestion()
 	if err != nil {
@@ -107,45 +233,138 @@ func (a *App) examPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r.ParseForm()
+	choices := r.PostForm["choice"]
+	questionID, err := strconv.ParseInt(r.PostForm.Get("question_id"), 10, 64)
+	if err != nil {
+		questionID = q.GetQuestionID()
+	}
+
 	qt, err := models.GetQuestion(q)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
 
-	r.ParseForm()
-	choice := r.PostForm.Get("choice")
+	category, err := uq.GetCategory()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
 
 	// TODO: set error whern choice is wrong
-	result, err := models.UserConfirmAnswer(userID, choice)
-	if err != nil {
+	result, err := models.UserConfirmAnswerScored(a.store, a.scoring, userID, questionID, choices...)
+	late := err == models.ErrAnswerLate
+	if err != nil && !late {
+		if err == models.ErrStaleAnswer || err == models.ErrExamFinished {
+			// the question was already answered by another submission, show the current one
+			http.Redirect(w, r, "/exam", http.StatusFound)
+			return
+		}
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
 
 	p, err := uq.GetPoints()
 	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
 		return
 	}
-
-	var e string
-	// if result is correct update rank else give an explanation
-	if result {
-		if err := models.UpdateRank(userID, p); err != nil {
+	// a wrong answer is tried again with the lifelines already used on the question
+	var lifelines models.LifelineStateT
+	if !result && !late {
+		st, err := a.examLifelines(uq, qt)
+		if err != nil {
 			servererrors.InternalServerError(w, err.Error())
 			return
 		}
-	} else {
-		e = "YOU HAVE ENTERED THE WRONG CHOICE!!"
+		lifelines = *st
 	}
 
 	a.tmpl.ExecuteTemplate(w, "exam.html", ExamPayload{
-		CSRF:        csrf.TemplateField(r),
-		Title:       "Question",
-		User:        username,
-		Question:    *qt,
-		Correct:     result,
-		Points:      p,
-		Explanation: e,
+		CSRF:       csrf.TemplateField(r),
+		Title:      "Question",
+		User:       username,
+		QuestionID: questionID,
+		Question:   *qt,
+		Correct:    result,
+		Points:     p,
+		Category:   category,
+		Answered:   true,
+		Late:       late,
+		Lifelines:  lifelines,
+		Costs:      a.lifelines,
+	})
+}
+
+func (a *App) renderResults(w http.ResponseWriter, r *http.Request, userID int64, username, category string, categories []string) {
+	res, err := models.GetResult(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.tmpl.ExecuteTemplate(w, "results.html", ResultsPayload{
+		CSRF:       csrf.TemplateField(r),
+		Title:      "Results",
+		User:       username,
+		Points:     res.Points,
+		Result:     *res,
+		Category:   category,
+		Categories: categories,
 	})
 }
+
+func (a *App) examRestartPostHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	u := session.Values["user_id"]
+	userID, ok := u.(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	if err := models.RestartExam(a.store, userID); err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/exam", http.StatusFound)
+}
+
+func (a *App) examLifelinePostHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	u := session.Values["user_id"]
+	userID, ok := u.(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	uq, err := models.GetUserQuestion(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	r.ParseForm()
+	questionID, _ := strconv.ParseInt(r.PostForm.Get("question_id"), 10, 64)
+	switch r.PostForm.Get("lifeline") {
+	case "fifty-fifty":
+		err = uq.UseFiftyFifty(a.lifelines, questionID)
+	case "hint":
+		err = uq.UseHint(a.lifelines, questionID)
+	default:
+		http.Error(w, "unknown lifeline", http.StatusBadRequest)
+		return
+	}
+
+	switch err {
+	case nil, models.ErrLifelineUsed, models.ErrNoLifelines, models.ErrLifelineUnavailable, models.ErrStaleAnswer,
+		models.ErrExamFinished, models.ErrAnswerLate:
+		// the exam shows what is left of the lifelines, the current question or that the time is up
+		http.Redirect(w, r, "/exam", http.StatusFound)
+	default:
+		servererrors.InternalServerError(w, err.Error())
+	}
+}
@@ -0,0 +1,321 @@
+package router
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocs/davy/message"
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/servererrors"
+	"gopkg.in/olahol/melody.v1"
+)
+
+func newGameView(g *models.GameT) *message.Game {
+	v := &message.Game{
+		Type:       "question",
+		Round:      g.Round,
+		Rounds:     g.Rounds,
+		LastAnswer: g.LastAnswer,
+		Players:    []message.Player{},
+	}
+	for _, p := range g.Players {
+		v.Players = append(v.Players, message.Player(p))
+	}
+	if g.Ended {
+		v.Type = "results"
+		return v
+	}
+	v.Remaining = remaining(g.EndsAt)
+	if g.Question != nil {
+		v.QuestionID = g.QuestionID
+		v.Statement = g.Question.Statement
+		v.QuestionType = g.Question.Type
+		v.Choices = g.Question.Choices
+	}
+	return v
+}
+
+// gameRunners keeps the wake up channel of every game run by this server, an answer wakes its game's runner up to
+// close the round early once every player has answered
+type gameRunners struct {
+	mu   sync.Mutex
+	wake map[int64]chan struct{}
+}
+
+// add registers the lobby's runner, false if the lobby already has one
+func (gr *gameRunners) add(lobbyID int64) (chan struct{}, bool) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	if gr.wake == nil {
+		gr.wake = map[int64]chan struct{}{}
+	}
+	if _, ok := gr.wake[lobbyID]; ok {
+		return nil, false
+	}
+	ch := make(chan struct{}, 1)
+	gr.wake[lobbyID] = ch
+	return ch, true
+}
+
+func (gr *gameRunners) remove(lobbyID int64) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	delete(gr.wake, lobbyID)
+}
+
+// notify wakes the lobby's runner up without waiting for it
+func (gr *gameRunners) notify(lobbyID int64) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	select {
+	case gr.wake[lobbyID] <- struct{}{}:
+	default:
+	}
+}
+
+// broadcastLobby writes the message to every websocket opened in the lobby
+func (a *App) broadcastLobby(lobbyID int64, msg message.Message) {
+	b, err := msg.Encode()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	a.broadcastRoom(lobbyID, b, nil)
+}
+
+// runGame runs the lobby's game unless this server already does, the runner is registered before the handler
+// returns so that no answer misses it
+func (a *App) runGame(l *models.Lobby, lobbyID int64) {
+	wake, ok := a.runners.add(lobbyID)
+	if !ok {
+		return
+	}
+	go func() {
+		defer a.runners.remove(lobbyID)
+		a.playRounds(l, lobbyID, wake)
+	}()
+}
+
+// playRounds pushes every round of the lobby's game to its members and closes it once its time has run out or
+// every player has answered, then pushes the results
+func (a *App) playRounds(l *models.Lobby, lobbyID int64, wake <-chan struct{}) {
+	for {
+		g, err := l.GetGame()
+		if err != nil {
+			log.Printf("game of lobby %d: %v", lobbyID, err)
+			return
+		}
+		a.broadcastLobby(lobbyID, message.NewGame(newGameView(g)))
+		if g.Ended {
+			// the lobby has ended along with the game
+			if err := a.pushLobby(l); err != nil {
+				log.Printf("game of lobby %d: %v", lobbyID, err)
+			}
+			return
+		}
+
+		timer := time.NewTimer(time.Until(g.EndsAt))
+		for done := false; !done; {
+			select {
+			case <-timer.C:
+				done = true
+			case <-wake:
+				if done, err = l.RoundDone(g.Round); err != nil {
+					log.Printf("game of lobby %d: %v", lobbyID, err)
+				}
+			}
+		}
+		timer.Stop()
+
+		// everybody has left the lobby
+		if status, err := l.GetStatus(); err != nil || status == models.StatusEnded {
+			return
+		}
+		_, err = l.AdvanceGame(a.game, g.Round)
+		if err != nil && err != models.ErrStaleAnswer {
+			log.Printf("game of lobby %d: %v", lobbyID, err)
+			return
+		}
+	}
+}
+
+// countDown tells the starting lobby the seconds left every second until its game begins and then runs the game,
+// unless this server already does, a lobby whose time has come begins before the handler returns
+func (a *App) countDown(l *models.Lobby, lobbyID int64) {
+	startsAt, err := l.GetStartsAt()
+	if err != nil {
+		log.Printf("game of lobby %d: %v", lobbyID, err)
+		return
+	}
+	// the runner is registered for the countdown too so that it is counted down once
+	wake, ok := a.runners.add(lobbyID)
+	if !ok {
+		return
+	}
+	left := time.Until(startsAt)
+	if left <= 0 {
+		a.beginGame(l, lobbyID, wake)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for n := int64((left + time.Second - 1) / time.Second); n > 0; n-- {
+			a.broadcastLobby(lobbyID, message.Countdown(n))
+			<-ticker.C
+		}
+		a.beginGame(l, lobbyID, wake)
+	}()
+}
+
+// resumeGame picks the countdown or the game of the lobby up again after the server has restarted, a member opening
+// the lobby's websocket resumes it so that merely reading the lobby page does not
+func (a *App) resumeGame(l *models.Lobby, lobbyID int64) {
+	status, err := l.GetStatus()
+	if err != nil {
+		log.Printf("game of lobby %d: %v", lobbyID, err)
+		return
+	}
+	switch status {
+	case models.StatusStarting:
+		a.countDown(l, lobbyID)
+	case models.StatusOngoing:
+		a.runGame(l, lobbyID)
+	}
+}
+
+// beginGame sets the starting lobby's game up and plays it on the lobby's runner, a game that cannot be set up leaves
+// the lobby waiting
+func (a *App) beginGame(l *models.Lobby, lobbyID int64, wake <-chan struct{}) {
+	err := l.BeginGame(a.game)
+	if err != nil {
+		log.Printf("game of lobby %d: %v", lobbyID, err)
+		a.broadcastLobby(lobbyID, message.Error(err))
+	}
+	if err := a.pushLobby(l); err != nil {
+		log.Printf("game of lobby %d: %v", lobbyID, err)
+	}
+	if err != nil {
+		a.runners.remove(lobbyID)
+		return
+	}
+	go func() {
+		defer a.runners.remove(lobbyID)
+		a.playRounds(l, lobbyID, wake)
+	}()
+}
+
+// handleReady takes the member's ready mark from its websocket
+func (a *App) handleReady(s *melody.Session, m *message.Message) error {
+	lobbyID, ok := wsLobbyID(s)
+	if !ok {
+		return models.ErrUserNotInLobby
+	}
+	u, _ := s.Get("user_id")
+	userID, ok := u.(int64)
+	if !ok {
+		return models.ErrTypeMismatch
+	}
+	l, err := models.GetLobbyByID(a.store, lobbyID)
+	if err != nil {
+		return err
+	}
+	if err := l.SetReady(userID, m.Type == message.TypeReady); err != nil {
+		return err
+	}
+	return a.pushLobby(l)
+}
+
+func (a *App) startPostHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	u := session.Values["user_id"]
+	userID, ok := u.(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	l, err := models.GetLobbyByUserID(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	lobbyID, err := l.GetLobbyID()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	switch err := l.StartGame(userID, a.game); err {
+	case nil:
+		if err := a.pushLobby(l); err != nil {
+			log.Println(err)
+		}
+		a.countDown(l, lobbyID)
+	case models.ErrLobbyPermission:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case models.ErrLobbyStatus, models.ErrEmptyGame, models.ErrNotReady:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/lobby", http.StatusFound)
+}
+
+func (a *App) gameAnswerPostHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	u := session.Values["user_id"]
+	userID, ok := u.(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	l, err := models.GetLobbyByUserID(a.store, userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	lobbyID, err := l.GetLobbyID()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	r.ParseForm()
+	round, err := strconv.ParseInt(r.PostForm.Get("round"), 10, 64)
+	if err != nil {
+		http.Error(w, "round is not a number", http.StatusBadRequest)
+		return
+	}
+
+	correct, err := l.AnswerGame(a.scoring, userID, round, r.PostForm["choice"]...)
+	switch err {
+	case nil:
+	case models.ErrNotPlaying:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case models.ErrGameNotFound, models.ErrStaleAnswer, models.ErrAlreadyAnswered, models.ErrAnswerLate:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	a.runners.notify(lobbyID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"correct": correct})
+}
@@ -0,0 +1,116 @@
+package router
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/gocs/davy/message"
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/servererrors"
+	"github.com/gorilla/csrf"
+	"gopkg.in/olahol/melody.v1"
+)
+
+// LobbiesPayload is the data to pass to the template
+type LobbiesPayload struct {
+	CSRF    template.HTML
+	Title   string
+	User    string
+	Lobbies []message.Lobby
+	// Joined tells that the user is in a lobby already and cannot join another
+	Joined bool
+}
+
+// lobbyListings gets the public lobbies waiting for players
+func (a *App) lobbyListings() ([]message.Lobby, error) {
+	listings, err := models.ListPublicLobbies(a.store)
+	if err != nil {
+		return nil, err
+	}
+	ls := []message.Lobby{}
+	for _, l := range listings {
+		ls = append(ls, message.Lobby{
+			Code:       l.Code,
+			Host:       l.Host,
+			Players:    l.Players,
+			MaxPlayers: l.MaxPlayers,
+			Category:   l.Category,
+		})
+	}
+	return ls, nil
+}
+
+func (a *App) lobbiesGetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.sessionUserID(r)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	ls, err := a.lobbyListings()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	_, err = models.GetLobbyByUserID(a.store, userID)
+	if err != nil && err != models.ErrUserNotInLobby {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.tmpl.ExecuteTemplate(w, "lobbies.html", LobbiesPayload{
+		CSRF:    csrf.TemplateField(r),
+		Title:   "Lobbies",
+		User:    username,
+		Lobbies: ls,
+		Joined:  err == nil,
+	})
+}
+
+func (a *App) lobbiesJSONHandler(w http.ResponseWriter, r *http.Request) {
+	ls, err := a.lobbyListings()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ls)
+}
+
+// isBrowser tells whether the websocket was opened by the lobby browser
+func isBrowser(s *melody.Session) bool {
+	_, ok := s.Get("browser")
+	return ok
+}
+
+// pushLobbies tells the lobby browsers the public lobbies waiting for players
+func (a *App) pushLobbies() error {
+	ls, err := a.lobbyListings()
+	if err != nil {
+		return err
+	}
+	b, err := message.NewLobbies(ls).Encode()
+	if err != nil {
+		return err
+	}
+	return a.m.BroadcastFilter(b, isBrowser)
+}
+
+// lobbiesWS opens the lobby browser's websocket, it shares the lobby websockets' handlers which tell it apart by its
+// browser key
+func (a *App) lobbiesWS(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.sessionUserID(r)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	a.m.HandleRequestWithKeys(w, r, map[string]interface{}{"user_id": userID, "browser": true})
+}
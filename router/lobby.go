@@ -6,9 +6,9 @@ import (
 	"log"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/gocs/davy/message"
 	"github.com/gocs/davy/models"
 	"github.com/gocs/davy/servererrors"
 	"github.com/gorilla/csrf"
@@ -22,6 +22,20 @@ type LobbyPayload struct {
 	User   string
 	Joined bool
 	Code   string
+	// Status is the lobby's, one of the models' Status constants
+	Status int64
+	IsHost bool
+	// Role is the user's role in the lobby, one of the models' Role constants
+	Role string
+	// Bans are the usernames banned from the lobby, only listed for the host and co-hosts
+	Bans     []string
+	Settings message.Settings
+	// Categories are the categories the game can be limited to
+	Categories []string
+	// ChatMaxLength caps a chat message's characters, 0 is no cap
+	ChatMaxLength int
+	// Game is the game being played or its results, nil before the host starts one
+	Game *message.Game
 }
 
 func (a *App) lobbyGetHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,7 +47,7 @@ func (a *App) lobbyGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := models.GetUserByUserID(userID)
+	user, err := models.GetUserByUserID(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -65,13 +79,58 @@ func (a *App) lobbyGetHandler(w http.ResponseWriter, r *http.Request) {
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
-
+	status, err := l.GetStatus()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	role, err := l.GetRole(userID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	var bans []string
+	if role != models.RolePlayer {
+		if bans, err = l.GetBans(); err != nil {
+			servererrors.InternalServerError(w, err.Error())
+			return
+		}
+	}
+	settings, err := l.GetSettings()
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	categories, err := models.ListCategories(a.store)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	var game *message.Game
+	g, err := l.GetGame()
+	if err != nil && err != models.ErrGameNotFound {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	if g != nil {
+		game = newGameView(g)
+	}
 	a.tmpl.ExecuteTemplate(w, "lobby.html", LobbyPayload{
 		CSRF:   csrf.TemplateField(r),
 		Title:  "Lobby",
 		User:   username,
 		Joined: true,
 		Code:   code,
+		Status: status,
+		IsHost: role == models.RoleHost,
+		Role:   role,
+		Bans:   bans,
+		Game:   game,
+
+		Settings:   newSettingsView(settings),
+		Categories: categories,
+
+		ChatMaxLength: a.chat.MaxLength,
 	})
 }
 
@@ -87,33 +146,191 @@ func (a *App) lobbyPostHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	choice := r.PostForm.Get("choice")
 	code := r.PostForm.Get("code")
-	if err := models.JoinOrCreateLobby(choice, code, userID); err != nil {
+	err := models.JoinOrCreateLobby(a.store, choice, code, userID)
+	if err == models.ErrBanned {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err == models.ErrLobbyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrLobbyFull || err == models.ErrUserInLobby {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
 		servererrors.InternalServerError(w, fmt.Sprintf("JoinOrCreateLobby: %v", err))
 		return
 	}
+	if choice == "join" {
+		if err := a.memberJoined(userID); err != nil {
+			servererrors.InternalServerError(w, err.Error())
+			return
+		}
+	}
 
-	http.Redirect(w, r, r.Referer(), http.StatusFound)
+	// the lobby browser joins from another page
+	http.Redirect(w, r, "/lobby", http.StatusFound)
 }
 
-func (a *App) kickPostHandler(w http.ResponseWriter, r *http.Request) {
+// lobbyTarget gets the caller's lobby and the member named by the form's username for the handlers that act on
+// another member, ok is false once the error has been written
+func (a *App) lobbyTarget(w http.ResponseWriter, r *http.Request) (l *models.Lobby, byID, userID int64, ok bool) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	byID, ok = session.Values["user_id"].(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return nil, 0, 0, false
+	}
+
+	l, err := models.GetLobbyByUserID(a.store, byID)
+	if err == models.ErrUserNotInLobby {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil, 0, 0, false
+	}
+	if err != nil {
+		servererrors.InternalServerError(w, fmt.Sprintf("GetLobbyByUserID: %v", err))
+		return nil, 0, 0, false
+	}
+
 	r.ParseForm()
-	username := r.PostForm.Get("username")
-	u, err := models.GetUserByUsername(username)
+	u, err := models.GetUserByUsername(a.store, r.PostForm.Get("username"))
+	if err == models.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, 0, 0, false
+	}
 	if err != nil {
 		servererrors.InternalServerError(w, fmt.Sprintf("GetUserByUsername: %v", err))
+		return nil, 0, 0, false
+	}
+	return l, byID, u.GetUserID(), true
+}
+
+// lobbyRoleError writes the error of a member acting on another
+func lobbyRoleError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrLobbyPermission:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case models.ErrUserNotInLobby:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		servererrors.InternalServerError(w, err.Error())
+	}
+}
+
+func (a *App) kickPostHandler(w http.ResponseWriter, r *http.Request) {
+	l, byID, userID, ok := a.lobbyTarget(w, r)
+	if !ok {
 		return
 	}
+	ban := r.PostForm.Get("ban") != ""
 
-	l, err := u.GetLobby()
+	if err := a.leaveLobby(l, userID, true, func() error { return l.KickMember(byID, userID, ban) }); err != nil {
+		lobbyRoleError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+func (a *App) unbanPostHandler(w http.ResponseWriter, r *http.Request) {
+	l, byID, userID, ok := a.lobbyTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := l.Unban(byID, userID); err != nil {
+		lobbyRoleError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+func (a *App) rolePostHandler(w http.ResponseWriter, r *http.Request) {
+	l, byID, userID, ok := a.lobbyTarget(w, r)
+	if !ok {
+		return
+	}
+	role := r.PostForm.Get("role")
+	if role != models.RoleCoHost && role != models.RolePlayer {
+		http.Error(w, fmt.Sprintf("role must be %q or %q", models.RoleCoHost, models.RolePlayer), http.StatusBadRequest)
+		return
+	}
+
+	if err := l.SetCoHost(byID, userID, role == models.RoleCoHost); err != nil {
+		lobbyRoleError(w, err)
+		return
+	}
+	if err := a.pushLobby(l); err != nil {
+		log.Println(err)
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+func (a *App) hostPostHandler(w http.ResponseWriter, r *http.Request) {
+	l, byID, userID, ok := a.lobbyTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := l.TransferHost(byID, userID); err != nil {
+		lobbyRoleError(w, err)
+		return
+	}
+	if err := a.pushLobby(l, message.HostChanged(r.PostForm.Get("username"))); err != nil {
+		log.Println(err)
+	}
+
+	http.Redirect(w, r, r.Referer(), http.StatusFound)
+}
+
+func (a *App) settingsPostHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	u := session.Values["user_id"]
+	userID, ok := u.(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	l, err := models.GetLobbyByUserID(a.store, userID)
+	if err == models.ErrUserNotInLobby {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		servererrors.InternalServerError(w, fmt.Sprintf("GetLobby: %v", err))
+		servererrors.InternalServerError(w, fmt.Sprintf("GetLobbyByUserID: %v", err))
 		return
 	}
 
-	userID := u.GetUserID()
-	if err := l.LeaveLobby(userID); err != nil {
-		servererrors.InternalServerError(w, fmt.Sprintf("LeaveLobby: %v", err))
+	r.ParseForm()
+	settings := models.LobbySettings{
+		MaxPlayers: parseRule(strings.TrimSpace(r.PostForm.Get("max_players"))),
+		Public:     r.PostForm.Get("public") != "",
+		Rounds:     parseRule(strings.TrimSpace(r.PostForm.Get("rounds"))),
+		RoundTime:  time.Duration(parseRule(strings.TrimSpace(r.PostForm.Get("round_time")))) * time.Second,
+		Category:   r.PostForm.Get("category"),
+	}
+	switch err := l.SetSettings(userID, settings); err {
+	case nil:
+	case models.ErrLobbyPermission:
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
+	case models.ErrLobbyStatus:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case models.ErrLobbySettings, models.ErrEmptyCategory:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+	if err := a.pushLobby(l); err != nil {
+		log.Println(err)
 	}
 
 	http.Redirect(w, r, r.Referer(), http.StatusFound)
@@ -128,13 +345,13 @@ func (a *App) leavePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	l, err := models.GetLobbyByUserID(userID)
+	l, err := models.GetLobbyByUserID(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, fmt.Sprintf("GetLobbyByUserID: %v", err))
 		return
 	}
 
-	if err := l.LeaveLobby(userID); err != nil {
+	if err := a.leaveLobby(l, userID, false, func() error { return l.LeaveLobby(userID) }); err != nil {
 		servererrors.InternalServerError(w, fmt.Sprintf("LeaveLobby: %v", err))
 		return
 	}
@@ -142,47 +359,292 @@ func (a *App) leavePostHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, r.Referer(), http.StatusFound)
 }
 
+// wsLobbyID is the lobby the websocket was opened in
+func wsLobbyID(s *melody.Session) (int64, bool) {
+	v, ok := s.Get("lobby_id")
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(int64)
+	return id, ok
+}
+
+// broadcastRoom writes the message to the websockets opened in the lobby but the one it came from, if any
+func (a *App) broadcastRoom(lobbyID int64, b []byte, from *melody.Session) {
+	a.m.BroadcastFilter(b, func(s *melody.Session) bool {
+		id, ok := wsLobbyID(s)
+		return ok && id == lobbyID && s != from
+	})
+}
+
+// closeSockets closes the user's websockets opened in the lobby
+func (a *App) closeSockets(lobbyID, userID int64) {
+	a.m.BroadcastFilter(nil, func(s *melody.Session) bool {
+		id, ok := wsLobbyID(s)
+		u, _ := s.Get("user_id")
+		if ok && id == lobbyID && u == userID {
+			s.Close()
+		}
+		return false
+	})
+}
+
+func username(s models.Store, userID int64) (string, error) {
+	u, err := models.GetUserByUserID(s, userID)
+	if err != nil {
+		return "", err
+	}
+	return u.GetUsername()
+}
+
+// lobbyState gets the lobby as its members see it
+func (a *App) lobbyState(l *models.Lobby) (message.State, error) {
+	code, err := l.GetCode()
+	if err != nil {
+		return message.State{}, err
+	}
+	hostID, err := l.GetHostID()
+	if err != nil {
+		return message.State{}, err
+	}
+	host, err := username(a.store, hostID)
+	if err != nil {
+		return message.State{}, err
+	}
+	members, err := l.GetPlayers()
+	if err != nil {
+		return message.State{}, err
+	}
+	cohosts, err := l.GetCoHosts()
+	if err != nil {
+		return message.State{}, err
+	}
+	status, err := l.GetStatus()
+	if err != nil {
+		return message.State{}, err
+	}
+	settings, err := l.GetSettings()
+	if err != nil {
+		return message.State{}, err
+	}
+	muted, err := l.GetMuted()
+	if err != nil {
+		return message.State{}, err
+	}
+	presence, err := a.lobbyPresence(l)
+	if err != nil {
+		return message.State{}, err
+	}
+	ready, err := l.GetReady()
+	if err != nil {
+		return message.State{}, err
+	}
+	return message.State{
+		Code:     code,
+		Host:     host,
+		CoHosts:  cohosts,
+		Members:  members,
+		Status:   status,
+		Settings: newSettingsView(settings),
+		Muted:    muted,
+		Presence: presence,
+		Ready:    ready,
+	}, nil
+}
+
+// newSettingsView is the lobby's settings as its members see them
+func newSettingsView(s *models.LobbySettings) message.Settings {
+	return message.Settings{
+		MaxPlayers: s.MaxPlayers,
+		Public:     s.Public,
+		Rounds:     s.Rounds,
+		RoundTime:  int64(s.RoundTime / time.Second),
+		Category:   s.Category,
+	}
+}
+
+// pushLobby tells the lobby's websockets what has happened followed by the lobby's new state
+func (a *App) pushLobby(l *models.Lobby, events ...message.Message) error {
+	lobbyID, err := l.GetLobbyID()
+	if err != nil {
+		return err
+	}
+	st, err := a.lobbyState(l)
+	if err != nil {
+		return err
+	}
+	for _, m := range append(events, message.NewState(st)) {
+		a.broadcastLobby(lobbyID, m)
+	}
+	// the lobby's listing may have changed with its state
+	return a.pushLobbies()
+}
+
+// memberJoined tells the lobby the user has just joined
+func (a *App) memberJoined(userID int64) error {
+	l, err := models.GetLobbyByUserID(a.store, userID)
+	if err != nil {
+		return err
+	}
+	un, err := username(a.store, userID)
+	if err != nil {
+		return err
+	}
+	return a.pushLobby(l, message.MemberJoined(un))
+}
+
+// leaveLobby takes the user out of the lobby by leave and tells the lobby, along with its new host if the host has
+// left, kicked tells that the user was made to leave, the user's websockets are closed
+func (a *App) leaveLobby(l *models.Lobby, userID int64, kicked bool, leave func() error) error {
+	lobbyID, err := l.GetLobbyID()
+	if err != nil {
+		return err
+	}
+	un, err := username(a.store, userID)
+	if err != nil {
+		return err
+	}
+	hostID, err := l.GetHostID()
+	if err != nil {
+		return err
+	}
+
+	if err := leave(); err != nil {
+		return err
+	}
+
+	events := []message.Message{message.MemberLeft(un)}
+	if kicked {
+		events[0] = message.Kicked(un)
+	}
+	newHostID, err := l.GetHostID()
+	if err != nil {
+		return err
+	}
+	if newHostID != hostID {
+		host, err := username(a.store, newHostID)
+		if err != nil {
+			return err
+		}
+		events = append(events, message.HostChanged(host))
+	}
+	for _, m := range events {
+		a.broadcastLobby(lobbyID, m)
+	}
+	// the user is told it has left but not what the lobby is like without it
+	a.closeSockets(lobbyID, userID)
+	a.presence.forget(lobbyID, userID)
+	a.chatLimits.forget(userID)
+	return a.pushLobby(l)
+}
+
 func (a *App) lobbyWS() http.HandlerFunc {
-	lock := new(sync.Mutex)
+	a.m.HandleConnect(func(s *melody.Session) {
+		if isBrowser(s) {
+			ls, err := a.lobbyListings()
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			a.writeWS(s, message.NewLobbies(ls))
+			return
+		}
+		lobbyID, ok := wsLobbyID(s)
+		if !ok {
+			return
+		}
+		u, _ := s.Get("user_id")
+		userID, _ := u.(int64)
+		l, err := models.GetLobbyByID(a.store, lobbyID)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		back := a.presence.connect(lobbyID, userID)
+		st, err := a.lobbyState(l)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		a.writeWS(s, message.NewState(st))
+		history, err := chatHistory(l)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		a.writeWS(s, history)
+		// the rest of the lobby sees the member online again
+		if back {
+			b, err := message.NewState(st).Encode()
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			a.broadcastRoom(lobbyID, b, s)
+		}
+		a.resumeGame(l, lobbyID)
+	})
 
-	h := func(s *melody.Session) {
-		lock.Lock()
-		defer lock.Unlock()
+	a.m.HandleDisconnect(func(s *melody.Session) {
+		if !isBrowser(s) {
+			a.memberDisconnected(s)
+		}
+	})
+
+	a.m.HandleMessage(func(s *melody.Session, b []byte) {
+		m, err := message.Decode(b)
+		if err != nil {
+			a.writeWS(s, message.Error(err))
+			return
+		}
+		switch m.Type {
+		case message.TypePresence:
+			err = a.handlePresence(s, m)
+		case message.TypeReady, message.TypeUnready:
+			err = a.handleReady(s, m)
+		default:
+			err = a.handleChat(s, m)
+		}
+		if err != nil {
+			a.writeWS(s, message.Error(err))
+		}
+	})
 
-		session, _ := a.sessions.Store.Get(s.Request, "session")
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := a.sessions.Store.Get(r, "session")
 		u := session.Values["user_id"]
 		userID, ok := u.(int64)
 		if !ok {
-			log.Println("userID is not int64")
+			servererrors.InternalServerError(w, "userID is not int64")
 			return
 		}
 
-		l, err := models.GetLobbyByUserID(userID)
+		l, err := models.GetLobbyByUserID(a.store, userID)
+		if err == models.ErrUserNotInLobby {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		if err != nil {
+			servererrors.InternalServerError(w, err.Error())
 			return
 		}
-
-		ps, err := l.GetPlayers()
+		lobbyID, err := l.GetLobbyID()
 		if err != nil {
+			servererrors.InternalServerError(w, err.Error())
 			return
 		}
 
-		jstr := strings.Join(ps, " ")
-		s.Write([]byte(jstr))
+		// the websocket stays in the room of the lobby it was opened in, it is opened again after joining another
+		a.m.HandleRequestWithKeys(w, r, map[string]interface{}{"user_id": userID, "lobby_id": lobbyID})
 	}
+}
 
-	a.m.HandleConnect(h)
-	a.m.HandleDisconnect(h)
-
-	a.m.HandleMessage(func(s *melody.Session, b []byte) {
-		<-time.After(100 * time.Millisecond)
-
-		lock.Lock()
-		defer lock.Unlock()
-		a.m.BroadcastOthers(b, s)
-	})
-
-	return func(w http.ResponseWriter, r *http.Request) {
-		a.m.HandleRequest(w, r)
+// writeWS writes the message to the websocket only
+func (a *App) writeWS(s *melody.Session, msg message.Message) {
+	b, err := msg.Encode()
+	if err != nil {
+		log.Println(err)
+		return
 	}
+	s.Write(b)
 }
@@ -0,0 +1,245 @@
+package router
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gocs/davy/message"
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/validator"
+	"gopkg.in/olahol/melody.v1"
+)
+
+// PresenceT is how the lobby websockets are kept alive and how long a member who drops keeps its seat
+type PresenceT struct {
+	// Heartbeat is how often the websockets are pinged, a websocket that misses two pongs is closed, 0 keeps the
+	// websocket library's default
+	Heartbeat time.Duration
+	// Grace is how long a member with no websocket open keeps its seat before it is taken out of the lobby, 0 keeps it
+	// until it leaves
+	Grace time.Duration
+}
+
+// Validate checks that neither the heartbeat nor the grace is negative
+func (p PresenceT) Validate() error {
+	return validator.Presence(p.Heartbeat, p.Grace)
+}
+
+// seat is a member's presence in a lobby on this server
+type seat struct {
+	sockets int
+	away    bool
+	// leave takes the member out once the grace period is over, it is stopped when the member is back
+	leave *time.Timer
+}
+
+type seatKey struct {
+	lobbyID, userID int64
+}
+
+// presences keeps the presence of the members who have opened a websocket in their lobby
+type presences struct {
+	mu    sync.Mutex
+	seats map[seatKey]*seat
+}
+
+// connect counts the member's new websocket, it tells whether the member was disconnected
+func (p *presences) connect(lobbyID, userID int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.seats == nil {
+		p.seats = map[seatKey]*seat{}
+	}
+	k := seatKey{lobbyID, userID}
+	st, ok := p.seats[k]
+	if !ok {
+		st = &seat{}
+		p.seats[k] = st
+	}
+	if st.leave != nil {
+		st.leave.Stop()
+		st.leave = nil
+	}
+	st.sockets++
+	return st.sockets == 1
+}
+
+// disconnect uncounts the member's websocket, once the member has none left it is disconnected and leave is called
+// after the grace period unless the member is back by then, a grace of 0 never calls it, it tells whether the member
+// is disconnected now
+func (p *presences) disconnect(lobbyID, userID int64, grace time.Duration, leave func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := seatKey{lobbyID, userID}
+	st, ok := p.seats[k]
+	if !ok || st.sockets == 0 {
+		return false
+	}
+	st.sockets--
+	if st.sockets > 0 {
+		return false
+	}
+	st.away = false
+	if grace > 0 {
+		var t *time.Timer
+		t = time.AfterFunc(grace, func() {
+			p.mu.Lock()
+			// the member may be back or gone and the timer stopped too late
+			current, ok := p.seats[k]
+			expired := ok && current.leave == t
+			if expired {
+				delete(p.seats, k)
+			}
+			p.mu.Unlock()
+			if expired {
+				leave()
+			}
+		})
+		st.leave = t
+	}
+	return true
+}
+
+// forget drops the presence of a member who is not in the lobby anymore
+func (p *presences) forget(lobbyID, userID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := seatKey{lobbyID, userID}
+	if st, ok := p.seats[k]; ok && st.leave != nil {
+		st.leave.Stop()
+	}
+	delete(p.seats, k)
+}
+
+// setAway marks the connected member as away or online, it tells whether that changed
+func (p *presences) setAway(lobbyID, userID int64, away bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st, ok := p.seats[seatKey{lobbyID, userID}]
+	if !ok || st.sockets == 0 || st.away == away {
+		return false
+	}
+	st.away = away
+	return true
+}
+
+// presence is the member's presence, one of the message's Presence constants
+func (p *presences) presence(lobbyID, userID int64) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st, ok := p.seats[seatKey{lobbyID, userID}]
+	switch {
+	case !ok || st.sockets == 0:
+		return message.PresenceDisconnected
+	case st.away:
+		return message.PresenceAway
+	}
+	return message.PresenceOnline
+}
+
+// lobbyPresence gets the presence of each of the lobby's members by username
+func (a *App) lobbyPresence(l *models.Lobby) (map[string]string, error) {
+	lobbyID, err := l.GetLobbyID()
+	if err != nil {
+		return nil, err
+	}
+	members, err := l.GetMembers()
+	if err != nil {
+		return nil, err
+	}
+	presence := map[string]string{}
+	for _, m := range members {
+		un, err := m.GetUsername()
+		if err != nil {
+			return nil, err
+		}
+		presence[un] = a.presence.presence(lobbyID, m.GetUserID())
+	}
+	return presence, nil
+}
+
+// memberDisconnected uncounts the member's closed websocket, a member with none left is told to the lobby as
+// disconnected and is taken out of it once the grace period is over
+func (a *App) memberDisconnected(s *melody.Session) {
+	lobbyID, ok := wsLobbyID(s)
+	if !ok {
+		return
+	}
+	u, _ := s.Get("user_id")
+	userID, ok := u.(int64)
+	if !ok {
+		return
+	}
+	l, err := models.GetLobbyByID(a.store, lobbyID)
+	if err == models.ErrLobbyNotFound {
+		a.presence.forget(lobbyID, userID)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// a member who has left or been kicked is already told
+	member, err := l.IsMember(userID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !member {
+		a.presence.forget(lobbyID, userID)
+		return
+	}
+
+	if !a.presence.disconnect(lobbyID, userID, a.presenceRules.Grace, func() { a.seatExpired(lobbyID, userID) }) {
+		return
+	}
+	if err := a.pushLobby(l); err != nil {
+		log.Println(err)
+	}
+}
+
+// seatExpired takes the member who has not come back within the grace period out of the lobby
+func (a *App) seatExpired(lobbyID, userID int64) {
+	l, err := models.GetLobbyByID(a.store, lobbyID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	member, err := l.IsMember(userID)
+	if err != nil || !member {
+		return
+	}
+	if err := a.leaveLobby(l, userID, false, func() error { return l.LeaveLobby(userID) }); err != nil {
+		log.Println(err)
+	}
+}
+
+// handlePresence takes the member's presence from its websocket
+func (a *App) handlePresence(s *melody.Session, m *message.Message) error {
+	lobbyID, ok := wsLobbyID(s)
+	if !ok {
+		return models.ErrUserNotInLobby
+	}
+	u, _ := s.Get("user_id")
+	userID, ok := u.(int64)
+	if !ok {
+		return models.ErrTypeMismatch
+	}
+	if m.Presence != message.PresenceOnline && m.Presence != message.PresenceAway {
+		return message.ErrMalformed
+	}
+	if !a.presence.setAway(lobbyID, userID, m.Presence == message.PresenceAway) {
+		return nil
+	}
+	l, err := models.GetLobbyByID(a.store, lobbyID)
+	if err != nil {
+		return err
+	}
+	return a.pushLobby(l)
+}
@@ -0,0 +1,229 @@
+package router
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/servererrors"
+	"github.com/gorilla/csrf"
+)
+
+// QuizzesPayload is the data to pass to the template of the published quizzes
+type QuizzesPayload struct {
+	CSRF    template.HTML
+	Title   string
+	User    string
+	Quizzes []QuizEntry
+}
+
+// QuizEntry is a published quiz with how the user has done on it, Result is nil if the user has not started it
+type QuizEntry struct {
+	models.QuizItemT
+	Result *models.QuizResultT
+}
+
+// QuizPayload is the data to pass to the template of a single quiz
+type QuizPayload struct {
+	CSRF  template.HTML
+	Title string
+	User  string
+	ID    int64
+	Quiz  models.QuizT
+	// Result is nil if the user has not started the quiz
+	Result     *models.QuizResultT
+	QuestionID int64
+	Question   models.QuestionT
+	// Answered shows whether Correct and the question's explanation
+	Answered bool
+	Correct  bool
+	Answer   string
+}
+
+func (a *App) sessionUserID(r *http.Request) (int64, bool) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	userID, ok := session.Values["user_id"].(int64)
+	return userID, ok
+}
+
+func (a *App) quizzesGetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.sessionUserID(r)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	quizzes, err := models.ListQuizzes(a.store, false)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	entries := make([]QuizEntry, len(quizzes))
+	for i, q := range quizzes {
+		entries[i].QuizItemT = q
+		res, err := models.GetQuizResult(a.store, userID, q.ID)
+		if err != nil && err != models.ErrQuizNotStarted {
+			servererrors.InternalServerError(w, err.Error())
+			return
+		}
+		entries[i].Result = res
+	}
+
+	a.tmpl.ExecuteTemplate(w, "quizzes.html", QuizzesPayload{
+		CSRF:    csrf.TemplateField(r),
+		Title:   "Quizzes",
+		User:    username,
+		Quizzes: entries,
+	})
+}
+
+// renderQuiz shows the quiz with the user's current question, p has the quiz and the answer if one was given
+func (a *App) renderQuiz(w http.ResponseWriter, r *http.Request, userID int64, p QuizPayload) {
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	res, err := models.GetQuizResult(a.store, userID, p.ID)
+	if err != nil && err != models.ErrQuizNotStarted {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	if res != nil && !p.Answered {
+		questionID, qt, err := models.CurrentQuizQuestion(a.store, userID, p.ID)
+		if err != nil {
+			servererrors.InternalServerError(w, err.Error())
+			return
+		}
+		if questionID != 0 {
+			p.QuestionID = questionID
+			p.Question = *qt
+		} else if res, err = models.GetQuizResult(a.store, userID, p.ID); err != nil {
+			// the last questions may have just been skipped
+			servererrors.InternalServerError(w, err.Error())
+			return
+		}
+	}
+
+	p.CSRF = csrf.TemplateField(r)
+	p.Title = p.Quiz.Title
+	p.User = username
+	p.Result = res
+	a.tmpl.ExecuteTemplate(w, "quiz.html", p)
+}
+
+func (a *App) quizGetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.sessionUserID(r)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	q, err := models.GetPublishedQuiz(a.store, id)
+	if err != nil {
+		if err == models.ErrQuizNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.renderQuiz(w, r, userID, QuizPayload{ID: id, Quiz: *q})
+}
+
+func (a *App) quizStartPostHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.sessionUserID(r)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := models.StartQuiz(a.store, userID, id); err != nil {
+		if err == models.ErrQuizNotFound || err == models.ErrEmptyQuiz {
+			http.NotFound(w, r)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/quizzes/%d", id), http.StatusFound)
+}
+
+func (a *App) quizPostHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.sessionUserID(r)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+	id, ok := pathID(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	q, err := models.GetPublishedQuiz(a.store, id)
+	if err != nil {
+		if err == models.ErrQuizNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	r.ParseForm()
+	questionID, err := strconv.ParseInt(r.PostForm.Get("question_id"), 10, 64)
+	if err != nil {
+		http.Redirect(w, r, fmt.Sprintf("/quizzes/%d", id), http.StatusFound)
+		return
+	}
+	correct, err := models.AnswerQuizScored(a.store, a.scoring, userID, id, questionID, r.PostForm["choice"]...)
+	if err != nil {
+		switch err {
+		case models.ErrStaleAnswer, models.ErrExamFinished, models.ErrQuizNotStarted:
+			// already answered by another submission, show where the user is now
+			http.Redirect(w, r, fmt.Sprintf("/quizzes/%d", id), http.StatusFound)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	qt, err := a.store.GetQuestion(questionID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.renderQuiz(w, r, userID, QuizPayload{
+		ID:         id,
+		Quiz:       *q,
+		QuestionID: questionID,
+		Question:   *qt,
+		Answered:   true,
+		Correct:    correct,
+		Answer:     qt.CorrectAnswer(),
+	})
+}
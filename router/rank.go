@@ -18,7 +18,7 @@ type RankPayload struct {
 }
 
 func (a *App) listTopRank(w http.ResponseWriter, r *http.Request) {
-	urT, err := models.TopRanks()
+	urT, err := models.TopRanks(a.store)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -39,7 +39,7 @@ func (a *App) getCurrentStandings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	urT, err := models.GetCurrentStandings(userID)
+	urT, err := models.GetCurrentStandings(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
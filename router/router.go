@@ -3,7 +3,6 @@ package router
 import (
 	"net/http"
 
-	"github.com/go-redis/redis"
 	"github.com/gocs/davy/loader"
 	"github.com/gocs/davy/middleware"
 	"github.com/gocs/davy/models"
@@ -14,21 +13,76 @@ import (
 	"gopkg.in/olahol/melody.v1"
 )
 
-// NewRouter creates a new router to access some pages
-func NewRouter(sessionKey string) (*mux.Router, error) {
-	r := mux.NewRouter()
+// Config is what the router serves the pages with
+type Config struct {
+	// SessionKey is the key of the session cookie store
+	SessionKey string
+	Store      models.Store
+	// Admins are the usernames allowed to manage the questions
+	Admins []string
+	// Limits are the time limits of the exam
+	Limits models.LimitsT
+	// Scoring is used by the exam and by the quizzes without their own rules
+	Scoring models.ScoringT
+	// Lifelines are offered by the exam
+	Lifelines models.LifelinesT
+	// Game is used by the games played in the lobbies, Chat by their chat and Presence by their websockets
+	Game     models.GameRulesT
+	Chat     models.ChatRulesT
+	Presence PresenceT
+}
 
-	err := models.NewRedisDB() // shiiiiiiiiiiiiiiiiiiiiiiiiiitttttt
-	if err != nil {
+// Validate checks the rules of the config
+func (c Config) Validate() error {
+	if err := c.Scoring.Validate(); err != nil {
+		return err
+	}
+	if err := c.Lifelines.Validate(); err != nil {
+		return err
+	}
+	if err := c.Game.Validate(); err != nil {
+		return err
+	}
+	if err := c.Chat.Validate(); err != nil {
+		return err
+	}
+	return c.Presence.Validate()
+}
+
+// NewRouter creates a new router to access some pages by the config, which is validated first
+func NewRouter(c Config) (*mux.Router, error) {
+	if c.Store == nil {
+		return nil, models.ErrNilClient
+	}
+	if err := c.Validate(); err != nil {
 		return nil, err
 	}
-	a := App{
-		sessions: sessions.New(sessionKey),
-		tmpl:     loader.NewTemplates("templates/*.html"),
-		m:        melody.New(),
+	a := &App{
+		sessions:      sessions.New(c.SessionKey),
+		tmpl:          loader.NewTemplates("templates/*.html"),
+		m:             melody.New(),
+		store:         c.Store,
+		admins:        c.Admins,
+		limits:        c.Limits,
+		scoring:       c.Scoring,
+		lifelines:     c.Lifelines,
+		game:          c.Game,
+		chat:          c.Chat,
+		presenceRules: c.Presence,
+	}
+	if c.Presence.Heartbeat > 0 {
+		a.m.Config.PingPeriod = c.Presence.Heartbeat
+		a.m.Config.PongWait = 2 * c.Presence.Heartbeat
 	}
+	a.m.Config.MaxMessageSize = chatFrameSize(c.Chat.MaxLength)
+	return a.router(), nil
+}
+
+func (a *App) router() *mux.Router {
+	r := mux.NewRouter()
 
-	mar := middleware.AuthRequired(a.sessions.Store)
+	mar := middleware.AuthRequired(a.sessions.Store, a.store)
+	adm := middleware.AdminRequired(a.sessions.Store, a.store, a.admins)
 
 	r.HandleFunc("/", mar(a.indexGetHandler)).Methods("GET")
 	r.HandleFunc("/", mar(a.indexPostHandler)).Methods("POST")
@@ -40,12 +94,47 @@ func NewRouter(sessionKey string) (*mux.Router, error) {
 
 	r.HandleFunc("/exam", mar(a.examGetHandler)).Methods("GET")
 	r.HandleFunc("/exam", mar(a.examPostHandler)).Methods("POST")
+	r.HandleFunc("/exam/restart", mar(a.examRestartPostHandler)).Methods("POST")
+	r.HandleFunc("/exam/lifeline", mar(a.examLifelinePostHandler)).Methods("POST")
+	r.HandleFunc("/exam/answers", mar(a.answersGetHandler)).Methods("GET")
+	r.HandleFunc("/exam/answers.json", mar(a.answersJSONHandler)).Methods("GET")
+
+	r.HandleFunc("/study", mar(a.studyGetHandler)).Methods("GET")
+	r.HandleFunc("/study", mar(a.studyPostHandler)).Methods("POST")
+
+	r.HandleFunc("/quizzes", mar(a.quizzesGetHandler)).Methods("GET")
+	r.HandleFunc("/quizzes/{id:[0-9]+}", mar(a.quizGetHandler)).Methods("GET")
+	r.HandleFunc("/quizzes/{id:[0-9]+}", mar(a.quizPostHandler)).Methods("POST")
+	r.HandleFunc("/quizzes/{id:[0-9]+}/start", mar(a.quizStartPostHandler)).Methods("POST")
 
 	r.HandleFunc("/lobby", mar(a.lobbyGetHandler)).Methods("GET")
 	r.HandleFunc("/lobby", mar(a.lobbyPostHandler)).Methods("POST")
 	r.HandleFunc("/lobbyws", mar(a.lobbyWS())).Methods("GET")
 	r.HandleFunc("/lobby/kick", mar(a.kickPostHandler)).Methods("POST")
+	r.HandleFunc("/lobby/unban", mar(a.unbanPostHandler)).Methods("POST")
+	r.HandleFunc("/lobby/role", mar(a.rolePostHandler)).Methods("POST")
+	r.HandleFunc("/lobby/host", mar(a.hostPostHandler)).Methods("POST")
+	r.HandleFunc("/lobby/settings", mar(a.settingsPostHandler)).Methods("POST")
+	r.HandleFunc("/lobbies", mar(a.lobbiesGetHandler)).Methods("GET")
+	r.HandleFunc("/lobbies.json", mar(a.lobbiesJSONHandler)).Methods("GET")
+	r.HandleFunc("/lobbiesws", mar(a.lobbiesWS)).Methods("GET")
 	r.HandleFunc("/lobby/leave", mar(a.leavePostHandler)).Methods("POST")
+	r.HandleFunc("/lobby/start", mar(a.startPostHandler)).Methods("POST")
+	r.HandleFunc("/lobby/game/answer", mar(a.gameAnswerPostHandler)).Methods("POST")
+
+	r.HandleFunc("/admin/questions", mar(adm(a.adminQuestionsGetHandler))).Methods("GET")
+	r.HandleFunc("/admin/questions", mar(adm(a.adminQuestionsPostHandler))).Methods("POST")
+	r.HandleFunc("/admin/questions/import", mar(adm(a.adminImportPostHandler))).Methods("POST")
+	r.HandleFunc("/admin/questions/export.csv", mar(adm(a.adminExportCSVHandler))).Methods("GET")
+	r.HandleFunc("/admin/questions/export.json", mar(adm(a.adminExportJSONHandler))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id:[0-9]+}", mar(adm(a.adminQuestionGetHandler))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id:[0-9]+}", mar(adm(a.adminQuestionPostHandler))).Methods("POST")
+	r.HandleFunc("/admin/questions/{id:[0-9]+}/delete", mar(adm(a.adminQuestionDeletePostHandler))).Methods("POST")
+	r.HandleFunc("/admin/quizzes", mar(adm(a.adminQuizzesGetHandler))).Methods("GET")
+	r.HandleFunc("/admin/quizzes", mar(adm(a.adminQuizzesPostHandler))).Methods("POST")
+	r.HandleFunc("/admin/quizzes/{id:[0-9]+}", mar(adm(a.adminQuizGetHandler))).Methods("GET")
+	r.HandleFunc("/admin/quizzes/{id:[0-9]+}", mar(adm(a.adminQuizPostHandler))).Methods("POST")
+	r.HandleFunc("/admin/quizzes/{id:[0-9]+}/delete", mar(adm(a.adminQuizDeletePostHandler))).Methods("POST")
 
 	r.HandleFunc("/rank", a.listTopRank).Methods("GET")
 	r.HandleFunc("/rank/me", a.getCurrentStandings).Methods("GET")
@@ -55,14 +144,26 @@ func NewRouter(sessionKey string) (*mux.Router, error) {
 
 	r.HandleFunc("/{username}", mar(a.userGetHandler)).Methods("GET")
 
-	return r, nil
+	return r
 }
 
 // App handles the state of the application
 type App struct {
-	sessions *sessions.Session
-	tmpl     *loader.Templates
-	m        *melody.Melody
+	sessions   *sessions.Session
+	tmpl       *loader.Templates
+	m          *melody.Melody
+	store      models.Store
+	admins     []string
+	limits     models.LimitsT
+	scoring    models.ScoringT
+	lifelines  models.LifelinesT
+	game       models.GameRulesT
+	runners    gameRunners
+	chat       models.ChatRulesT
+	chatLimits chatLimiter
+	// presence keeps who is connected to the lobbies, by the presence rules
+	presence      presences
+	presenceRules PresenceT
 }
 
 // IndexPayload is the data to pass to the template
@@ -87,7 +188,7 @@ func (a *App) indexGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := models.GetUserByUserID(userID)
+	user, err := models.GetUserByUserID(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -96,7 +197,7 @@ func (a *App) indexGetHandler(w http.ResponseWriter, r *http.Request) {
 	username, err := user.GetUsername()
 	if err != nil {
 		switch err {
-		case redis.Nil:
+		case models.ErrUserNotFound:
 			session, err := a.sessions.Store.Get(r, "session")
 			if err != nil {
 				servererrors.InternalServerError(w, err.Error())
@@ -111,13 +212,13 @@ func (a *App) indexGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updates, err := models.GetAllUpdates()
+	updates, err := models.GetAllUpdates(a.store)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
 
-	uq, err := models.GetUserQuestion(userID)
+	uq, err := models.GetUserQuestion(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -151,7 +252,7 @@ func (a *App) indexPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	r.ParseForm()
 	body := r.PostForm.Get("update")
-	err = models.PostUpdate(userID, body)
+	err = models.PostUpdate(a.store, userID, body)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -180,7 +281,7 @@ func (a *App) userGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := models.GetUserByUsername(username)
+	user, err := models.GetUserByUsername(a.store, username)
 	if err != nil {
 		switch err {
 		case models.ErrUserNotFound:
@@ -193,13 +294,13 @@ func (a *App) userGetHandler(w http.ResponseWriter, r *http.Request) {
 
 	userID := user.GetUserID()
 
-	updates, err := models.GetUpdates(userID)
+	updates, err := models.GetUpdates(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
 	}
 
-	uq, err := models.GetUserQuestion(userID)
+	uq, err := models.GetUserQuestion(a.store, userID)
 	if err != nil {
 		servererrors.InternalServerError(w, err.Error())
 		return
@@ -226,7 +327,7 @@ func (a *App) loginPostHandler(w http.ResponseWriter, r *http.Request) {
 	username := r.PostForm.Get("username")
 	password := r.PostForm.Get("password")
 
-	user, err := models.AuthenticateUser(username, password)
+	user, err := models.AuthenticateUser(a.store, username, password)
 	if err != nil {
 		switch err {
 		case models.ErrUserNotFound:
@@ -278,7 +379,7 @@ func (a *App) registerPostHandler(w http.ResponseWriter, r *http.Request) {
 	username := r.PostForm.Get("username")
 	password := r.PostForm.Get("password")
 
-	err := models.RegisterUser(username, password)
+	err := models.RegisterUser(a.store, username, password)
 	if err != nil {
 		switch err {
 		case models.ErrUsernameTaken:
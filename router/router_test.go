@@ -0,0 +1,1380 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocs/davy/loader"
+	"github.com/gocs/davy/message"
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/sessions"
+	"github.com/gocs/davy/validator"
+	"github.com/gorilla/websocket"
+	"gopkg.in/olahol/melody.v1"
+)
+
+func newTestApp(t *testing.T) (*App, http.Handler) {
+	t.Helper()
+	s := models.NewMemoryStore()
+	if err := models.MigrateQuestions(s, "../private-examples/questions.json"); err != nil {
+		t.Fatal(err)
+	}
+	a := &App{
+		sessions: sessions.New("test-session-key"),
+		tmpl:     loader.NewTemplates("../templates/*.html"),
+		m:        melody.New(),
+		store:    s,
+		admins:   []string{"admin"},
+	}
+	return a, a.router()
+}
+
+func postForm(h http.Handler, path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func get(h http.Handler, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// registerAndLogin creates the user and returns its session cookies
+func registerAndLogin(t *testing.T, h http.Handler, username string) []*http.Cookie {
+	t.Helper()
+	form := url.Values{"username": {username}, "password": {"password"}}
+	if w := postForm(h, "/register", form, nil); w.Code != http.StatusFound {
+		t.Fatalf("register: status=%d body=%s", w.Code, w.Body)
+	}
+	w := postForm(h, "/login", form, nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status=%d body=%s", w.Code, w.Body)
+	}
+	return w.Result().Cookies()
+}
+
+func TestAuthRequired(t *testing.T) {
+	_, h := newTestApp(t)
+
+	w := get(h, "/exam", nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Errorf("expected redirect to login: status=%d location=%s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestNewRouterConfig(t *testing.T) {
+	valid := Config{
+		Store: models.NewMemoryStore(),
+		Game:  models.GameRulesT{RoundTime: 20 * time.Second, Quorum: 100, Countdown: 5 * time.Second},
+		Chat:  models.ChatRulesT{History: 100, MaxLength: 500, Rate: 5, Per: 10 * time.Second},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	given := map[error]func(c *Config){
+		models.ErrNilClient:           func(c *Config) { c.Store = nil },
+		validator.ErrInvalidScoring:   func(c *Config) { c.Scoring.Penalty = -1 },
+		validator.ErrInvalidLifelines: func(c *Config) { c.Lifelines.HintCost = -1 },
+		validator.ErrInvalidGameRules: func(c *Config) { c.Game.RoundTime = 0 },
+		validator.ErrInvalidChatRules: func(c *Config) { c.Chat.Per = 0 },
+		validator.ErrInvalidPresence:  func(c *Config) { c.Presence.Grace = -time.Second },
+	}
+	for expected, change := range given {
+		c := valid
+		change(&c)
+		if _, err := NewRouter(c); err != expected {
+			t.Errorf("expected=%v, result=%v", expected, err)
+		}
+	}
+}
+
+func TestExamHandlers(t *testing.T) {
+	a, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	w := get(h, "/exam", cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "What is not part of United Kingdom?") {
+		t.Errorf("question is not rendered: %s", w.Body)
+	}
+
+	w = postForm(h, "/exam", url.Values{"choice": {"Wales"}}, cookies)
+	if !strings.Contains(w.Body.String(), "YOU HAVE ENTERED THE WRONG CHOICE!!") {
+		t.Errorf("wrong choice is not explained: %s", w.Body)
+	}
+	// the question can still be answered so its explanation is kept back
+	if strings.Contains(w.Body.String(), "Norway is a separate Scandinavian country") {
+		t.Errorf("explanation is shown before the question is answered right: %s", w.Body)
+	}
+
+	w = postForm(h, "/exam", url.Values{"choice": {"Norway"}}, cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "Norway is a separate Scandinavian country") ||
+		!strings.Contains(w.Body.String(), `href="https://en.wikipedia.org/wiki/Countries_of_the_United_Kingdom"`) {
+		t.Errorf("explanation of the question is not shown: %s", w.Body)
+	}
+
+	ranks, err := models.TopRanks(a.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranks) != 1 || ranks[0].Name != "alice" || ranks[0].Score != 1 {
+		t.Errorf("unexpected leaderboard: %+v", ranks)
+	}
+}
+
+func TestExamResults(t *testing.T) {
+	a, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+	userID, err := a.store.GetUserIDByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		uq, err := models.GetUserQuestion(a.store, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, _ := uq.GetQuestion()
+		qt, err := models.GetQuestion(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		postForm(h, "/exam", url.Values{"choice": {qt.Answer}}, cookies)
+	}
+
+	w := get(h, "/exam", cookies)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Accuracy: 100%") {
+		t.Fatalf("results are not rendered: status=%d body=%s", w.Code, w.Body)
+	}
+	if w := postForm(h, "/exam", url.Values{"choice": {"Norway"}}, cookies); w.Code != http.StatusFound {
+		t.Errorf("answer after finishing is not redirected: status=%d", w.Code)
+	}
+
+	postForm(h, "/exam/restart", nil, cookies)
+	w = get(h, "/exam", cookies)
+	if !strings.Contains(w.Body.String(), "What is not part of United Kingdom?") {
+		t.Errorf("exam is not restarted: %s", w.Body)
+	}
+}
+
+func TestExamCategory(t *testing.T) {
+	_, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	if w := get(h, "/exam?category=Sports", cookies); w.Code != http.StatusNotFound {
+		t.Errorf("unknown category is found: status=%d", w.Code)
+	}
+	if w := get(h, "/exam?category=Culture", cookies); w.Code != http.StatusFound {
+		t.Fatalf("category is not chosen: status=%d body=%s", w.Code, w.Body)
+	}
+
+	w := get(h, "/exam", cookies)
+	if !strings.Contains(w.Body.String(), "When is the New Year&#39;s day?") {
+		t.Fatalf("question of the category is not given: %s", w.Body)
+	}
+	postForm(h, "/exam", url.Values{"choice": {"January 1"}}, cookies)
+
+	w = get(h, "/exam", cookies)
+	if !strings.Contains(w.Body.String(), "Category: Culture") || !strings.Contains(w.Body.String(), "Accuracy: 100%") {
+		t.Errorf("category exam is not finished: %s", w.Body)
+	}
+}
+
+func TestExamQuestionTypes(t *testing.T) {
+	a, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	_, err := models.AddQuestion(a.store, &models.QuestionT{Statement: "Which are in Scandinavia?",
+		Type: models.TypeMultiple, Choices: []string{"Wales", "Norway", "Sweden"}, Answers: []string{"Norway", "Sweden"},
+		Category: "Scandinavia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.AddQuestion(a.store, &models.QuestionT{Statement: "What is the capital of Norway?",
+		Type: models.TypeText, Answer: "Oslo", Category: "Capitals"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get(h, "/exam?category=Scandinavia", cookies)
+	w := get(h, "/exam", cookies)
+	if !strings.Contains(w.Body.String(), `type="checkbox" name="choice" value="Sweden"`) {
+		t.Fatalf("multiple-select is not rendered: %s", w.Body)
+	}
+	w = postForm(h, "/exam", url.Values{"choice": {"Norway", "Sweden"}}, cookies)
+	if strings.Contains(w.Body.String(), "YOU HAVE ENTERED THE WRONG CHOICE!!") {
+		t.Errorf("every correct choice is not accepted: %s", w.Body)
+	}
+
+	get(h, "/exam?category=Capitals", cookies)
+	w = get(h, "/exam", cookies)
+	if !strings.Contains(w.Body.String(), `type="text" name="choice"`) {
+		t.Fatalf("free-text is not rendered: %s", w.Body)
+	}
+	w = postForm(h, "/exam", url.Values{"choice": {" oslo."}}, cookies)
+	if strings.Contains(w.Body.String(), "YOU HAVE ENTERED THE WRONG CHOICE!!") {
+		t.Errorf("normalized answer is not accepted: %s", w.Body)
+	}
+}
+
+func TestExamTimeLimit(t *testing.T) {
+	a, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	a.limits = models.LimitsT{Question: time.Minute}
+	w := get(h, "/exam", cookies)
+	if !strings.Contains(w.Body.String(), `<span id="countdown">60</span>`) {
+		t.Fatalf("countdown is not shown: %s", w.Body)
+	}
+
+	// the clock is kept on reload so the question is started over with a shorter limit
+	if err := models.RestartExam(a.store, 1); err != nil {
+		t.Fatal(err)
+	}
+	a.limits = models.LimitsT{Question: time.Millisecond}
+	get(h, "/exam", cookies)
+	time.Sleep(5 * time.Millisecond)
+
+	w = postForm(h, "/exam", url.Values{"choice": {"Norway"}}, cookies)
+	if !strings.Contains(w.Body.String(), "TIME IS UP!!") {
+		t.Errorf("late answer is accepted: %s", w.Body)
+	}
+	uq, _ := models.GetUserQuestion(a.store, 1)
+	if p, _ := uq.GetPoints(); p != 0 {
+		t.Errorf("late answer scored %d points", p)
+	}
+
+	// the questions left run out one after another and none of them is shown as answered right
+	for i := 0; i < 2; i++ {
+		get(h, "/exam", cookies)
+		time.Sleep(5 * time.Millisecond)
+	}
+	w = get(h, "/exam", cookies)
+	if body := w.Body.String(); strings.Count(body, "Not answered in time") != 3 || strings.Contains(body, "Correct") {
+		t.Errorf("timed out questions are not shown: %s", body)
+	}
+}
+
+func TestExamLifelines(t *testing.T) {
+	a, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	w := get(h, "/exam", cookies)
+	if strings.Contains(w.Body.String(), "/exam/lifeline") {
+		t.Errorf("lifelines are offered without any: %s", w.Body)
+	}
+
+	a.lifelines = models.LifelinesT{FiftyFifty: 1, FiftyFiftyCost: 1, Hint: 1, HintCost: 1}
+	w = get(h, "/exam", cookies)
+	if !strings.Contains(w.Body.String(), "50/50 (-1 points, 1 left)") || !strings.Contains(w.Body.String(), "Hint (-1 points") {
+		t.Fatalf("lifelines are not offered: %s", w.Body)
+	}
+
+	for _, lifeline := range []string{"fifty-fifty", "hint"} {
+		w = postForm(h, "/exam/lifeline", url.Values{"question_id": {"1"}, "lifeline": {lifeline}}, cookies)
+		if w.Code != http.StatusFound {
+			t.Errorf("%s is not used: %d", lifeline, w.Code)
+		}
+	}
+
+	// the hidden choices are not sent at all
+	w = get(h, "/exam", cookies)
+	body := w.Body.String()
+	hidden := 0
+	for _, choice := range []string{"Wales", "Scotland", "England"} {
+		if !strings.Contains(body, `value="`+choice+`"`) {
+			hidden++
+		}
+	}
+	if hidden != 2 || !strings.Contains(body, "Hint: Three of them share the island of Great Britain.") ||
+		strings.Contains(body, "/exam/lifeline") {
+		t.Errorf("lifelines are not applied: %s", body)
+	}
+	if !strings.Contains(body, "Points: -2") {
+		t.Errorf("lifelines are not charged: %s", body)
+	}
+}
+
+func TestStudy(t *testing.T) {
+	_, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	w := get(h, "/study", cookies)
+	if !strings.Contains(w.Body.String(), "What is not part of United Kingdom?") ||
+		!strings.Contains(w.Body.String(), "New: 3") {
+		t.Fatalf("first question is not shown: %s", w.Body)
+	}
+
+	w = postForm(h, "/study", url.Values{"question_id": {"1"}, "choice": {"Wales"}}, cookies)
+	if !strings.Contains(w.Body.String(), "YOU HAVE ENTERED THE WRONG CHOICE!!") ||
+		!strings.Contains(w.Body.String(), "Answer: Norway") || !strings.Contains(w.Body.String(), "Box 1") {
+		t.Errorf("wrong answer is not reviewed: %s", w.Body)
+	}
+
+	// the missed question rests before it is due again
+	w = get(h, "/study", cookies)
+	if strings.Contains(w.Body.String(), "What is not part of United Kingdom?") || !strings.Contains(w.Body.String(), "New: 2") {
+		t.Errorf("missed question is shown again: %s", w.Body)
+	}
+
+	w = postForm(h, "/study", url.Values{"question_id": {"1"}, "choice": {"Norway"}}, cookies)
+	if w.Code != http.StatusFound {
+		t.Errorf("question that is not due is reviewed: %d", w.Code)
+	}
+}
+
+func TestQuizzes(t *testing.T) {
+	_, h := newTestApp(t)
+	admin := registerAndLogin(t, h, "admin")
+	cookies := registerAndLogin(t, h, "alice")
+
+	w := postForm(h, "/admin/quizzes", url.Values{"title": {"Europe"}, "question_ids": {"1"}, "pass_mark": {"50"}}, cookies)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin creates a quiz: %d", w.Code)
+	}
+	w = postForm(h, "/admin/quizzes", url.Values{"title": {"Europe"}, "question_ids": {"1, 42"}, "pass_mark": {"50"}}, admin)
+	if !strings.Contains(w.Body.String(), "quiz question is not in the bank") {
+		t.Errorf("missing question is not reported: %s", w.Body)
+	}
+	w = postForm(h, "/admin/quizzes", url.Values{"title": {"Europe"}, "description": {"Countries of Europe"},
+		"question_ids": {"1, 2"}, "pass_mark": {"50"}, "published": {"1"}}, admin)
+	if w.Code != http.StatusFound {
+		t.Fatalf("quiz is not created: %d %s", w.Code, w.Body)
+	}
+
+	w = get(h, "/quizzes", cookies)
+	if !strings.Contains(w.Body.String(), `<a href="/quizzes/1">Europe</a>`) {
+		t.Fatalf("published quiz is not listed: %s", w.Body)
+	}
+	w = get(h, "/quizzes/1", cookies)
+	if !strings.Contains(w.Body.String(), "Countries of Europe") || !strings.Contains(w.Body.String(), ">Start<") {
+		t.Fatalf("quiz is not shown: %s", w.Body)
+	}
+
+	postForm(h, "/quizzes/1/start", url.Values{}, cookies)
+	w = postForm(h, "/quizzes/1", url.Values{"question_id": {"1"}, "choice": {"Wales"}}, cookies)
+	if !strings.Contains(w.Body.String(), "YOU HAVE ENTERED THE WRONG CHOICE!!") || !strings.Contains(w.Body.String(), "Answer: Norway") {
+		t.Errorf("wrong answer is not shown: %s", w.Body)
+	}
+	w = postForm(h, "/quizzes/1", url.Values{"question_id": {"2"}, "choice": {"Greenland"}}, cookies)
+	if !strings.Contains(w.Body.String(), "Correct!") {
+		t.Errorf("right answer is not shown: %s", w.Body)
+	}
+
+	w = get(h, "/quizzes/1", cookies)
+	if !strings.Contains(w.Body.String(), "Right answers: 1 of 2 (50%)") || !strings.Contains(w.Body.String(), "Passed!") {
+		t.Errorf("result is not shown: %s", w.Body)
+	}
+	// the exam is a separate record
+	if w := get(h, "/exam", cookies); !strings.Contains(w.Body.String(), "What is not part of United Kingdom?") {
+		t.Errorf("exam progress changed: %s", w.Body)
+	}
+}
+
+func TestAnswerHistory(t *testing.T) {
+	_, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	postForm(h, "/exam", url.Values{"choice": {"Wales"}}, cookies)
+	postForm(h, "/exam", url.Values{"choice": {"Norway"}}, cookies)
+
+	w := get(h, "/exam/answers.json", cookies)
+	var page models.AnswerPageT
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Answers) != 2 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if a := page.Answers[0]; a.Choice != "Norway" || !a.Correct || a.QuestionID != 1 {
+		t.Errorf("unexpected latest answer: %+v", a)
+	}
+	if a := page.Answers[1]; a.Choice != "Wales" || a.Correct {
+		t.Errorf("unexpected first answer: %+v", a)
+	}
+
+	w = get(h, "/exam/answers", cookies)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Wales - wrong") {
+		t.Errorf("answers are not rendered: status=%d body=%s", w.Code, w.Body)
+	}
+}
+
+func TestExamConcurrentPosts(t *testing.T) {
+	a, h := newTestApp(t)
+	cookies := registerAndLogin(t, h, "alice")
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := postForm(h, "/exam", url.Values{"question_id": {"1"}, "choice": {"Norway"}}, cookies)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	scored := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			scored++
+		case http.StatusFound:
+		default:
+			t.Errorf("unexpected status: %d", code)
+		}
+	}
+	if scored != 1 {
+		t.Errorf("scored not same: expected=%d, result=%d", 1, scored)
+	}
+
+	ranks, err := models.TopRanks(a.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranks) != 1 || ranks[0].Score != 1 {
+		t.Errorf("answer is scored more than once: %+v", ranks)
+	}
+}
+
+func TestAdminQuestions(t *testing.T) {
+	a, h := newTestApp(t)
+	admin := registerAndLogin(t, h, "admin")
+	alice := registerAndLogin(t, h, "alice")
+
+	if w := get(h, "/admin/questions", alice); w.Code != http.StatusForbidden {
+		t.Errorf("non admin is not forbidden: status=%d", w.Code)
+	}
+
+	w := get(h, "/admin/questions?q=island", admin)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "What is the biggest island in the world?") ||
+		strings.Contains(w.Body.String(), "What is not part of United Kingdom?") {
+		t.Errorf("unexpected search: status=%d body=%s", w.Code, w.Body)
+	}
+
+	form := url.Values{"statement": {"What is 1 + 1?"}, "choices": {"1\n2\n3"}, "answer": {"4"}}
+	if w := postForm(h, "/admin/questions", form, admin); !strings.Contains(w.Body.String(), "question is not valid") {
+		t.Errorf("invalid question is accepted: status=%d body=%s", w.Code, w.Body)
+	}
+	form.Set("answer", "2")
+	form.Set("links", "javascript:alert(1)")
+	if w := postForm(h, "/admin/questions", form, admin); !strings.Contains(w.Body.String(), "link is not valid") {
+		t.Errorf("invalid link is accepted: status=%d body=%s", w.Code, w.Body)
+	}
+	form.Set("links", "https://en.wikipedia.org/wiki/Addition")
+	if w := postForm(h, "/admin/questions", form, admin); w.Code != http.StatusFound {
+		t.Errorf("question is not created: status=%d body=%s", w.Code, w.Body)
+	}
+
+	form = url.Values{"statement": {"What is 1 + 1?"}, "choices": {"Norway\nWales"}, "answer": {"Norway"}}
+	if w := postForm(h, "/admin/questions/1", form, admin); !strings.Contains(w.Body.String(), models.ErrQuestionDuplicate.Error()) {
+		t.Errorf("duplicate statement is accepted: status=%d body=%s", w.Code, w.Body)
+	}
+	form.Set("statement", "What is not in United Kingdom?")
+	postForm(h, "/admin/questions/1", form, admin)
+	if w := get(h, "/exam", alice); !strings.Contains(w.Body.String(), "What is not in United Kingdom?") {
+		t.Errorf("edited question is not shown: %s", w.Body)
+	}
+
+	if w := postForm(h, "/admin/questions/1/delete", nil, admin); w.Code != http.StatusFound {
+		t.Errorf("question is not deleted: status=%d", w.Code)
+	}
+	if w := get(h, "/admin/questions/1", admin); w.Code != http.StatusNotFound {
+		t.Errorf("deleted question is found: status=%d", w.Code)
+	}
+	if w := postForm(h, "/exam", url.Values{"question_id": {"1"}, "choice": {"Norway"}}, alice); w.Code != http.StatusFound {
+		t.Errorf("answer to the deleted question is not redirected: status=%d", w.Code)
+	}
+	if w := get(h, "/exam", alice); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "United Kingdom") {
+		t.Errorf("deleted question is not skipped: status=%d body=%s", w.Code, w.Body)
+	}
+
+	ids, err := a.store.ListQuestionIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 {
+		t.Errorf("questions not same: expected=%d, result=%d", 3, len(ids))
+	}
+}
+
+func TestAdminImportExport(t *testing.T) {
+	_, h := newTestApp(t)
+	admin := registerAndLogin(t, h, "admin")
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "questions.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("statement,choices,answer\nWhat is 1 + 1?,1|2,2\nWhat is 2 + 2?,1|2,4\n"))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/admin/questions/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, c := range admin {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "1 imported, 0 already in the bank, 1 skipped") ||
+		!strings.Contains(w.Body.String(), "row 3: question is not valid") {
+		t.Errorf("import is not reported: status=%d body=%s", w.Code, w.Body)
+	}
+
+	w = get(h, "/admin/questions/export.csv", admin)
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" || !strings.Contains(w.Body.String(), "What is 1 + 1?,single,2,1|2") {
+		t.Errorf("unexpected csv export: %s", w.Body)
+	}
+
+	w = get(h, "/admin/questions/export.json", admin)
+	var qf models.QuestionFileT
+	if err := json.NewDecoder(w.Body).Decode(&qf); err != nil {
+		t.Fatal(err)
+	}
+	if len(qf.Questions) != 4 {
+		t.Errorf("questions not same: expected=%d, result=%d", 4, len(qf.Questions))
+	}
+}
+
+func TestLobbyHandlers(t *testing.T) {
+	a, h := newTestApp(t)
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+
+	hostID, err := a.store.GetUserIDByUsername("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := models.GetLobbyByUserID(a.store, hostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := l.GetCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, guest)
+	players, err := l.GetPlayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(players, " ") != "host guest" {
+		t.Errorf("unexpected players: %v", players)
+	}
+
+	w := get(h, "/lobby", guest)
+	if !strings.Contains(w.Body.String(), code) {
+		t.Errorf("lobby code is not rendered: %s", w.Body)
+	}
+
+	postForm(h, "/lobby/leave", nil, host)
+	hostID, err = l.GetHostID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	guestID, err := a.store.GetUserIDByUsername("guest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostID != guestID {
+		t.Errorf("host is not handed over: expected=%d, result=%d", guestID, hostID)
+	}
+}
+
+func TestLobbyRoles(t *testing.T) {
+	a, h := newTestApp(t)
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+	third := registerAndLogin(t, h, "third")
+	outsider := registerAndLogin(t, h, "outsider")
+
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, outsider)
+	hostID, err := a.store.GetUserIDByUsername("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := models.GetLobbyByUserID(a.store, hostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := l.GetCode()
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, guest)
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, third)
+
+	tests := []struct {
+		path   string
+		form   url.Values
+		cookie []*http.Cookie
+		code   int
+	}{
+		// a player cannot kick, nor can the host of another lobby
+		{"/lobby/kick", url.Values{"username": {"third"}}, guest, http.StatusForbidden},
+		{"/lobby/kick", url.Values{"username": {"third"}}, outsider, http.StatusNotFound},
+		{"/lobby/role", url.Values{"username": {"guest"}, "role": {"admin"}}, host, http.StatusBadRequest},
+		{"/lobby/role", url.Values{"username": {"guest"}, "role": {"co-host"}}, host, http.StatusFound},
+		// a co-host cannot kick the host nor hand out roles
+		{"/lobby/kick", url.Values{"username": {"host"}}, guest, http.StatusForbidden},
+		{"/lobby/role", url.Values{"username": {"third"}, "role": {"co-host"}}, guest, http.StatusForbidden},
+		{"/lobby/kick", url.Values{"username": {"third"}, "ban": {"1"}}, guest, http.StatusFound},
+		{"/lobby", url.Values{"choice": {"join"}, "code": {code}}, third, http.StatusForbidden},
+		{"/lobby/unban", url.Values{"username": {"third"}}, guest, http.StatusFound},
+		{"/lobby", url.Values{"choice": {"join"}, "code": {code}}, third, http.StatusFound},
+		{"/lobby/host", url.Values{"username": {"third"}}, guest, http.StatusForbidden},
+		{"/lobby/host", url.Values{"username": {"third"}}, host, http.StatusFound},
+	}
+	for _, tt := range tests {
+		if w := postForm(h, tt.path, tt.form, tt.cookie); w.Code != tt.code {
+			t.Errorf("%s %v: status not same: expected=%d, result=%d, body=%s", tt.path, tt.form, tt.code, w.Code, w.Body)
+		}
+	}
+
+	for un, expected := range map[string]string{"third": models.RoleHost, "host": models.RoleCoHost, "guest": models.RoleCoHost} {
+		id, err := a.store.GetUserIDByUsername(un)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role, err := l.GetRole(id); err != nil || role != expected {
+			t.Errorf("%s: role not same: expected=%s, result=%s, err=%v", un, expected, role, err)
+		}
+	}
+}
+
+func TestLobbySettings(t *testing.T) {
+	a, h := newTestApp(t)
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+	third := registerAndLogin(t, h, "third")
+
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	hostID, err := a.store.GetUserIDByUsername("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := models.GetLobbyByUserID(a.store, hostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := l.GetCode()
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, guest)
+
+	form := url.Values{"max_players": {"2"}, "public": {"on"}, "rounds": {"3"}, "round_time": {"15"}, "category": {""}}
+	tests := []struct {
+		form   url.Values
+		cookie []*http.Cookie
+		code   int
+	}{
+		{form, guest, http.StatusForbidden},
+		{url.Values{"round_time": {"1"}}, host, http.StatusBadRequest},
+		{url.Values{"rounds": {"many"}}, host, http.StatusBadRequest},
+		{form, host, http.StatusFound},
+	}
+	for _, tt := range tests {
+		if w := postForm(h, "/lobby/settings", tt.form, tt.cookie); w.Code != tt.code {
+			t.Errorf("%v: status not same: expected=%d, result=%d, body=%s", tt.form, tt.code, w.Code, w.Body)
+		}
+	}
+
+	expected := models.LobbySettings{MaxPlayers: 2, Public: true, Rounds: 3, RoundTime: 15 * time.Second}
+	if settings, err := l.GetSettings(); err != nil || *settings != expected {
+		t.Errorf("settings not same: expected=%+v, result=%+v, err=%v", expected, settings, err)
+	}
+	if w := get(h, "/lobby", host); !strings.Contains(w.Body.String(), `value="15"`) {
+		t.Errorf("settings are not rendered: %s", w.Body)
+	}
+	if w := postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, third); w.Code != http.StatusConflict {
+		t.Errorf("status not same: expected=%d, result=%d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestLobbyGame(t *testing.T) {
+	a, h := newTestApp(t)
+	a.game = models.GameRulesT{Rounds: 2, RoundTime: time.Minute}
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	hostID, err := a.store.GetUserIDByUsername("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := models.GetLobbyByUserID(a.store, hostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := l.GetCode()
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, guest)
+
+	if w := get(h, "/lobby", host); strings.Contains(w.Body.String(), `hidden><button>Start game`) {
+		t.Errorf("host cannot start the game: %s", w.Body)
+	}
+	if w := postForm(h, "/lobby/start", nil, guest); w.Code != http.StatusForbidden {
+		t.Errorf("status not same: expected=%d, result=%d", http.StatusForbidden, w.Code)
+	}
+	if w := postForm(h, "/lobby/start", nil, host); w.Code != http.StatusFound {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body)
+	}
+	if w := postForm(h, "/lobby/start", nil, host); w.Code != http.StatusConflict {
+		t.Errorf("status not same: expected=%d, result=%d", http.StatusConflict, w.Code)
+	}
+
+	g, err := l.GetGame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(h, "/lobby", guest); !strings.Contains(w.Body.String(), g.Question.Statement) ||
+		!strings.Contains(w.Body.String(), `hidden><button>Start game`) {
+		t.Errorf("round is not rendered: %s", w.Body)
+	}
+
+	w := postForm(h, "/lobby/game/answer", url.Values{"round": {"0"}, "choice": {g.Question.Answer}}, host)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"correct":true}` {
+		t.Errorf("unexpected answer: status=%d body=%s", w.Code, w.Body)
+	}
+	w = postForm(h, "/lobby/game/answer", url.Values{"round": {"0"}, "choice": {g.Question.Answer}}, host)
+	if w.Code != http.StatusConflict {
+		t.Errorf("status not same: expected=%d, result=%d", http.StatusConflict, w.Code)
+	}
+
+	// the runner closes the round as soon as every player has answered
+	postForm(h, "/lobby/game/answer", url.Values{"round": {"0"}, "choice": {"nope"}}, guest)
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		if g, err = l.GetGame(); err != nil {
+			t.Fatal(err)
+		}
+		if g.Round == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("round is not closed: %+v", g)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// wsClient reads the messages of a websocket in the background, a timed out read would break the connection
+type wsClient struct {
+	conn *websocket.Conn
+	msgs chan string
+}
+
+// dialLobby opens the user's lobby websocket on the test server, it gets the lobby's state and its chat history on
+// connect while the others already connected to the lobby get the state with the user online
+func dialLobby(t *testing.T, srv *httptest.Server, cookies []*http.Cookie, others ...*wsClient) (*wsClient,
+	*message.Message, *message.Message) {
+	t.Helper()
+	c := dialWS(t, srv, "/lobbyws", cookies)
+	st := c.next(t, time.Second)
+	if st.Type != message.TypeState {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+	history := c.next(t, time.Second)
+	if history.Type != message.TypeChatHistory {
+		t.Fatalf("unexpected chat history: %+v", history)
+	}
+	for _, o := range others {
+		if m := o.next(t, time.Second); m.Type != message.TypeState {
+			t.Fatalf("unexpected state: %+v", m)
+		}
+	}
+	return c, st, history
+}
+
+// dialWS opens the user's websocket at the path on the test server
+func dialWS(t *testing.T, srv *httptest.Server, path string, cookies []*http.Cookie) *wsClient {
+	t.Helper()
+	header := http.Header{}
+	for _, c := range cookies {
+		header.Add("Cookie", c.String())
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	c := &wsClient{conn: conn, msgs: make(chan string, 16)}
+	go func() {
+		defer close(c.msgs)
+		for {
+			_, b, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.msgs <- string(b)
+		}
+	}()
+	return c
+}
+
+// read gets the next message, empty if none comes within the wait
+func (c *wsClient) read(wait time.Duration) string {
+	select {
+	case msg := <-c.msgs:
+		return msg
+	case <-time.After(wait):
+		return ""
+	}
+}
+
+// next decodes the next message, it must come within the wait
+func (c *wsClient) next(t *testing.T, wait time.Duration) *message.Message {
+	t.Helper()
+	msg := c.read(wait)
+	if msg == "" {
+		t.Fatal("no message came")
+	}
+	m, err := message.Decode([]byte(msg))
+	if err != nil {
+		t.Fatalf("%s: %v", msg, err)
+	}
+	return m
+}
+
+func TestLobbyRooms(t *testing.T) {
+	a, h := newTestApp(t)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	users := map[string][]*http.Cookie{}
+	for _, un := range []string{"ann", "amy", "bob", "ben", "nobody"} {
+		users[un] = registerAndLogin(t, h, un)
+	}
+	lobbyIDs := map[string]int64{}
+	for _, host := range []string{"ann", "bob"} {
+		postForm(h, "/lobby", url.Values{"choice": {"create"}}, users[host])
+		userID, _ := a.store.GetUserIDByUsername(host)
+		l, err := models.GetLobbyByUserID(a.store, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := l.GetCode()
+		lobbyIDs[host], _ = l.GetLobbyID()
+		guest := map[string]string{"ann": "amy", "bob": "ben"}[host]
+		postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, users[guest])
+	}
+
+	if w := get(h, "/lobbyws", users["nobody"]); w.Code != http.StatusConflict {
+		t.Errorf("status not same: expected=%d, result=%d", http.StatusConflict, w.Code)
+	}
+
+	conns := map[string]*wsClient{}
+	for _, un := range []string{"ann", "amy", "bob", "ben"} {
+		var m *message.Message
+		var others []*wsClient
+		if host := map[string]string{"amy": "ann", "ben": "bob"}[un]; host != "" {
+			others = append(others, conns[host])
+		}
+		conns[un], m, _ = dialLobby(t, srv, users[un], others...)
+		// every websocket is told its own lobby's members on connect
+		expected := map[string][]string{"ann": {"ann", "amy"}, "amy": {"ann", "amy"}, "bob": {"bob", "ben"},
+			"ben": {"bob", "ben"}}[un]
+		if !reflect.DeepEqual(m.State.Members, expected) {
+			t.Errorf("%s: members not same: expected=%q, result=%+v", un, expected, m)
+		}
+	}
+
+	// a change of members goes to the same lobby only
+	postForm(h, "/lobby/leave", nil, users["amy"])
+	if m := conns["ann"].next(t, time.Second); m.Type != message.TypeMemberLeft || m.Username != "amy" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if m := conns["ann"].next(t, time.Second); m.Type != message.TypeState || len(m.State.Members) != 1 {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	for _, un := range []string{"bob", "ben"} {
+		if msg := conns[un].read(300 * time.Millisecond); msg != "" {
+			t.Errorf("%s got another lobby's message: %q", un, msg)
+		}
+	}
+
+	// so does what the server pushes to a lobby
+	a.broadcastLobby(lobbyIDs["bob"], message.HostChanged("ben"))
+	for _, un := range []string{"bob", "ben"} {
+		if m := conns[un].next(t, time.Second); m.Type != message.TypeHostChanged {
+			t.Errorf("%s: unexpected message: %+v", un, m)
+		}
+	}
+	for _, un := range []string{"ann"} {
+		if msg := conns[un].read(300 * time.Millisecond); msg != "" {
+			t.Errorf("%s got another lobby's message: %q", un, msg)
+		}
+	}
+}
+
+func TestLobbyEvents(t *testing.T) {
+	_, h := newTestApp(t)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+	third := registerAndLogin(t, h, "third")
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	hc, st, _ := dialLobby(t, srv, host)
+	if st.State.Host != "host" || st.State.Status != models.StatusWaiting {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+	code := st.State.Code
+
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, guest)
+	if m := hc.next(t, time.Second); m.Type != message.TypeMemberJoined || m.Username != "guest" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if m := hc.next(t, time.Second); !reflect.DeepEqual(m.State.Members, []string{"host", "guest"}) {
+		t.Errorf("unexpected state: %+v", m)
+	}
+	gc, _, _ := dialLobby(t, srv, guest, hc)
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {code}}, third)
+	for _, c := range []*wsClient{hc, gc} {
+		c.next(t, time.Second)
+		c.next(t, time.Second)
+	}
+
+	// the kicked member is told and its websocket is closed
+	tc, _, _ := dialLobby(t, srv, third, hc, gc)
+	postForm(h, "/lobby/kick", url.Values{"username": {"third"}}, host)
+	for _, c := range []*wsClient{hc, gc, tc} {
+		if m := c.next(t, time.Second); m.Type != message.TypeKicked || m.Username != "third" {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	}
+	// the state goes to the members left only
+	for _, c := range []*wsClient{hc, gc} {
+		if m := c.next(t, time.Second); !reflect.DeepEqual(m.State.Members, []string{"host", "guest"}) {
+			t.Errorf("unexpected state: %+v", m)
+		}
+	}
+	for msg := range tc.msgs {
+		t.Errorf("kicked websocket got: %s", msg)
+	}
+
+	// the host leaving hands the lobby over
+	postForm(h, "/lobby/leave", nil, host)
+	if m := gc.next(t, time.Second); m.Type != message.TypeMemberLeft || m.Username != "host" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if m := gc.next(t, time.Second); m.Type != message.TypeHostChanged || m.Username != "guest" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if m := gc.next(t, time.Second); m.State.Host != "guest" {
+		t.Errorf("unexpected state: %+v", m)
+	}
+
+	// the messages that are not of the protocol or only the server sends are refused
+	gc.conn.WriteMessage(websocket.TextMessage, []byte("host guest"))
+	if m := gc.next(t, time.Second); m.Type != message.TypeError || m.Error != message.ErrMalformed.Error() {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	gc.send(t, message.HostChanged("guest"))
+	if m := gc.next(t, time.Second); m.Type != message.TypeError || m.Error != message.ErrUnexpected.Error() {
+		t.Errorf("unexpected message: %+v", m)
+	}
+}
+
+// send writes the message to the websocket
+func (c *wsClient) send(t *testing.T, m message.Message) {
+	t.Helper()
+	b, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLobbyChat(t *testing.T) {
+	a, h := newTestApp(t)
+	a.chat = models.ChatRulesT{History: 2, MaxLength: 10, Rate: 4, Per: time.Minute}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	hc, st, _ := dialLobby(t, srv, host)
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {st.State.Code}}, guest)
+	hc.next(t, time.Second)
+	hc.next(t, time.Second)
+	gc, _, _ := dialLobby(t, srv, guest, hc)
+
+	chat := func(text string) message.Message {
+		return message.Message{Version: message.Version, Type: message.TypeChat, Chat: &message.Chat{Text: text}}
+	}
+	refused := func(c *wsClient, err error) {
+		t.Helper()
+		if m := c.next(t, time.Second); m.Type != message.TypeError || m.Error != err.Error() {
+			t.Errorf("expected=%v, result=%+v", err, m)
+		}
+	}
+
+	gc.send(t, chat("  hello "))
+	var id int64
+	for _, c := range []*wsClient{hc, gc} {
+		m := c.next(t, time.Second)
+		if m.Type != message.TypeChat || m.Chat.Username != "guest" || m.Chat.Text != "hello" || m.Chat.ID == 0 {
+			t.Errorf("unexpected message: %+v", m)
+		}
+		if m.Chat != nil {
+			id = m.Chat.ID
+		}
+	}
+	gc.send(t, chat(" "))
+	refused(gc, models.ErrChatEmpty)
+	gc.send(t, chat("hello world"))
+	refused(gc, models.ErrChatTooLong)
+	if msg := hc.read(300 * time.Millisecond); msg != "" {
+		t.Errorf("refused message got out: %s", msg)
+	}
+
+	// the host moderates the chat
+	gc.send(t, message.Message{Version: message.Version, Type: message.TypeDeleteChat, Chat: &message.Chat{ID: id}})
+	refused(gc, models.ErrLobbyPermission)
+	hc.send(t, message.Message{Version: message.Version, Type: message.TypeDeleteChat, Chat: &message.Chat{ID: id}})
+	for _, c := range []*wsClient{hc, gc} {
+		if m := c.next(t, time.Second); m.Type != message.TypeChatDeleted || m.Chat.ID != id {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	}
+	hc.send(t, message.Message{Version: message.Version, Type: message.TypeMute, Username: "guest"})
+	for _, c := range []*wsClient{hc, gc} {
+		if m := c.next(t, time.Second); m.Type != message.TypeState || !reflect.DeepEqual(m.State.Muted, []string{"guest"}) {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	}
+	gc.send(t, chat("hi"))
+	refused(gc, models.ErrMuted)
+
+	// the host's rate is its own
+	for _, text := range []string{"one", "two", "three", "four"} {
+		hc.send(t, chat(text))
+		for _, c := range []*wsClient{hc, gc} {
+			c.next(t, time.Second)
+		}
+	}
+	hc.send(t, chat("five"))
+	refused(hc, models.ErrChatRate)
+
+	// the chat keeps its latest messages
+	_, _, history := dialLobby(t, srv, guest)
+	var texts []string
+	for _, c := range history.Chats {
+		texts = append(texts, c.Text)
+	}
+	if !reflect.DeepEqual(texts, []string{"three", "four"}) {
+		t.Errorf("unexpected history: %q", texts)
+	}
+
+	// the guest's refused messages have not counted towards its rate
+	hc.send(t, message.Message{Version: message.Version, Type: message.TypeUnmute, Username: "guest"})
+	for _, c := range []*wsClient{hc, gc} {
+		c.next(t, time.Second)
+	}
+	for _, text := range []string{"again", "and again", "once more"} {
+		gc.send(t, chat(text))
+		if m := gc.next(t, time.Second); m.Type != message.TypeChat || m.Chat.Text != text {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	}
+}
+
+func TestLobbyChatMaxLength(t *testing.T) {
+	a, h := newTestApp(t)
+	a.chat = models.ChatRulesT{History: 10, MaxLength: 500}
+	a.m.Config.MaxMessageSize = chatFrameSize(a.chat.MaxLength)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	host := registerAndLogin(t, h, "host")
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	hc, _, _ := dialLobby(t, srv, host)
+
+	// escaped and multibyte characters take the most room in the websocket message
+	text := strings.Repeat("<", 250) + strings.Repeat("\U0001F600", 250)
+	hc.send(t, message.Message{Version: message.Version, Type: message.TypeChat, Chat: &message.Chat{Text: text}})
+	if m := hc.next(t, time.Second); m.Type != message.TypeChat || m.Chat.Text != text {
+		t.Errorf("message at the max length is not sent: %+v", m)
+	}
+}
+
+func TestChatLimiter(t *testing.T) {
+	var cl chatLimiter
+	now := time.Unix(1600000000, 0)
+	if !cl.allow(1, 1, time.Second, now) || cl.allow(1, 1, time.Second, now.Add(time.Millisecond)) {
+		t.Error("rate is not limited")
+	}
+	if !cl.allow(2, 1, time.Second, now.Add(time.Millisecond)) {
+		t.Error("rate is limited across users")
+	}
+	if !cl.allow(1, 1, time.Second, now.Add(2*time.Second)) || len(cl.sent[1]) != 1 {
+		t.Errorf("old messages are kept: %v", cl.sent[1])
+	}
+
+	// a refunded message leaves room for another one
+	later := now.Add(3 * time.Second)
+	if !cl.allow(2, 1, time.Second, later) {
+		t.Fatal("rate is not renewed")
+	}
+	cl.refund(2, later)
+	if !cl.allow(2, 1, time.Second, later.Add(time.Millisecond)) {
+		t.Error("refunded message is counted")
+	}
+
+	// the users who have left are forgotten
+	cl.forget(1)
+	cl.forget(2)
+	if len(cl.sent) != 0 {
+		t.Errorf("users who have left are kept: %v", cl.sent)
+	}
+}
+
+func TestLobbyPresence(t *testing.T) {
+	a, h := newTestApp(t)
+	a.presenceRules = PresenceT{Grace: 300 * time.Millisecond}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	hc, st, _ := dialLobby(t, srv, host)
+	if p := st.State.Presence["host"]; p != message.PresenceOnline {
+		t.Errorf("presence not same: expected=%s, result=%s", message.PresenceOnline, p)
+	}
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {st.State.Code}}, guest)
+	hc.next(t, time.Second)
+	if m := hc.next(t, time.Second); m.State.Presence["guest"] != message.PresenceDisconnected {
+		t.Errorf("unexpected state: %+v", m.State)
+	}
+	gc, _, _ := dialLobby(t, srv, guest, hc)
+
+	presence := func(expected string) {
+		t.Helper()
+		m := hc.next(t, time.Second)
+		if m.Type != message.TypeState || m.State.Presence["guest"] != expected {
+			t.Errorf("presence not same: expected=%s, result=%+v", expected, m)
+		}
+	}
+	gc.send(t, message.NewPresence(message.PresenceAway))
+	presence(message.PresenceAway)
+	gc.next(t, time.Second)
+	gc.send(t, message.NewPresence("asleep"))
+	if m := gc.next(t, time.Second); m.Type != message.TypeError || m.Error != message.ErrMalformed.Error() {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	gc.send(t, message.NewPresence(message.PresenceOnline))
+	presence(message.PresenceOnline)
+
+	// the member is still online while one of its websockets is open
+	gc2, _, _ := dialLobby(t, srv, guest)
+	gc2.conn.Close()
+	if msg := hc.read(300 * time.Millisecond); msg != "" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+
+	// a member back within the grace period keeps its seat
+	gc.conn.Close()
+	presence(message.PresenceDisconnected)
+	gc, _, _ = dialLobby(t, srv, guest, hc)
+	time.Sleep(400 * time.Millisecond)
+	if msg := hc.read(100 * time.Millisecond); msg != "" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+
+	// a member who is not back in time is taken out of the lobby
+	gc.conn.Close()
+	presence(message.PresenceDisconnected)
+	if m := hc.next(t, time.Second); m.Type != message.TypeMemberLeft || m.Username != "guest" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if m := hc.next(t, time.Second); !reflect.DeepEqual(m.State.Members, []string{"host"}) {
+		t.Errorf("unexpected state: %+v", m)
+	}
+	userID, _ := a.store.GetUserIDByUsername("guest")
+	if _, err := models.GetLobbyByUserID(a.store, userID); err != models.ErrUserNotInLobby {
+		t.Errorf("expected=%v, result=%v", models.ErrUserNotInLobby, err)
+	}
+}
+
+func TestLobbyReadyCheck(t *testing.T) {
+	a, h := newTestApp(t)
+	a.game = models.GameRulesT{Rounds: 1, RoundTime: time.Minute, Quorum: 100, Countdown: 2 * time.Second}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	hc, st, _ := dialLobby(t, srv, host)
+	postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {st.State.Code}}, guest)
+	hc.next(t, time.Second)
+	hc.next(t, time.Second)
+	gc, _, _ := dialLobby(t, srv, guest, hc)
+
+	// the host cannot start before the guest is ready
+	if w := postForm(h, "/lobby/start", nil, host); w.Code != http.StatusConflict {
+		t.Errorf("status not same: expected=%d, result=%d", http.StatusConflict, w.Code)
+	}
+	gc.send(t, message.Message{Version: message.Version, Type: message.TypeReady})
+	for _, c := range []*wsClient{hc, gc} {
+		m := c.next(t, time.Second)
+		if m.Type != message.TypeState || !reflect.DeepEqual(m.State.Ready, []string{"guest"}) {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	}
+
+	if w := postForm(h, "/lobby/start", nil, host); w.Code != http.StatusFound {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body)
+	}
+	// the lobby counts down while it is starting then opens the game
+	for _, c := range []*wsClient{hc, gc} {
+		if m := c.next(t, time.Second); m.Type != message.TypeState || m.State.Status != models.StatusStarting {
+			t.Errorf("unexpected message: %+v", m)
+		}
+		for _, left := range []int64{2, 1} {
+			if m := c.next(t, 2*time.Second); m.Type != message.TypeCountdown || m.Countdown != left {
+				t.Errorf("unexpected message: %+v", m)
+			}
+		}
+		if m := c.next(t, 2*time.Second); m.Type != message.TypeState || m.State.Status != models.StatusOngoing {
+			t.Errorf("unexpected message: %+v", m)
+		}
+		if m := c.next(t, time.Second); m.Type != message.TypeGame || m.Game.Round != 0 {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	}
+
+	// the ready marks are kept for the waiting lobby only
+	gc.send(t, message.Message{Version: message.Version, Type: message.TypeUnready})
+	if m := gc.next(t, time.Second); m.Type != message.TypeError || m.Error != models.ErrLobbyStatus.Error() {
+		t.Errorf("unexpected message: %+v", m)
+	}
+}
+
+func TestLobbyStartingResumed(t *testing.T) {
+	a, h := newTestApp(t)
+	a.game = models.GameRulesT{Rounds: 1, RoundTime: time.Minute}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	host := registerAndLogin(t, h, "host")
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+
+	// a server that has restarted during the countdown has left the lobby starting with no countdown running
+	l, err := models.GetLobbyByUserID(a.store, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.StartGame(1, a.game); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := l.GetStatus(); status != models.StatusStarting {
+		t.Fatalf("status not same: expected=%d, result=%d", models.StatusStarting, status)
+	}
+
+	// reading the lobby page leaves it as it is
+	get(h, "/lobby", host)
+	if status, _ := l.GetStatus(); status != models.StatusStarting {
+		t.Errorf("status not same: expected=%d, result=%d", models.StatusStarting, status)
+	}
+
+	// a member connecting to the lobby picks the game up
+	hc, _, _ := dialLobby(t, srv, host)
+	for m := hc.next(t, time.Second); m.Type != message.TypeGame; m = hc.next(t, time.Second) {
+		// the lobby's new state comes before its game
+	}
+	if status, _ := l.GetStatus(); status != models.StatusOngoing {
+		t.Errorf("status not same: expected=%d, result=%d", models.StatusOngoing, status)
+	}
+}
+
+func TestLobbyBrowser(t *testing.T) {
+	_, h := newTestApp(t)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	host := registerAndLogin(t, h, "host")
+	guest := registerAndLogin(t, h, "guest")
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, host)
+	postForm(h, "/lobby", url.Values{"choice": {"create"}}, registerAndLogin(t, h, "private"))
+
+	bc := dialWS(t, srv, "/lobbiesws", guest)
+	if m := bc.next(t, time.Second); m.Type != message.TypeLobbies || len(m.Lobbies) != 0 {
+		t.Errorf("unexpected message: %+v", m)
+	}
+
+	settings := url.Values{"max_players": {"4"}, "public": {"on"}, "category": {"Geography"}}
+	postForm(h, "/lobby/settings", settings, host)
+	m := bc.next(t, time.Second)
+	expected := []message.Lobby{{Host: "host", Players: 1, MaxPlayers: 4, Category: "Geography"}}
+	if len(m.Lobbies) == 1 {
+		expected[0].Code = m.Lobbies[0].Code
+	}
+	if !reflect.DeepEqual(m.Lobbies, expected) {
+		t.Errorf("lobbies not same: expected=%+v, result=%+v", expected, m.Lobbies)
+	}
+
+	w := get(h, "/lobbies.json", guest)
+	var ls []message.Lobby
+	if err := json.NewDecoder(w.Body).Decode(&ls); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ls, expected) {
+		t.Errorf("lobbies not same: expected=%+v, result=%+v", expected, ls)
+	}
+	if w := get(h, "/lobbies", guest); !strings.Contains(w.Body.String(), expected[0].Code) {
+		t.Errorf("lobby is not rendered: %s", w.Body)
+	}
+
+	// joining from the browser takes the user to the lobby
+	w = postForm(h, "/lobby", url.Values{"choice": {"join"}, "code": {expected[0].Code}}, guest)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/lobby" {
+		t.Errorf("unexpected join: status=%d location=%s", w.Code, w.Header().Get("Location"))
+	}
+	if m := bc.next(t, time.Second); len(m.Lobbies) != 1 || m.Lobbies[0].Players != 2 {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if w := get(h, "/lobbies", guest); strings.Contains(w.Body.String(), `value="join"`) {
+		t.Errorf("a member can join another lobby: %s", w.Body)
+	}
+
+	// a started lobby is not listed
+	postForm(h, "/lobby/start", nil, host)
+	if m := bc.next(t, time.Second); len(m.Lobbies) != 0 {
+		t.Errorf("unexpected message: %+v", m)
+	}
+}
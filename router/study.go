@@ -0,0 +1,118 @@
+package router
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gocs/davy/models"
+	"github.com/gocs/davy/servererrors"
+	"github.com/gorilla/csrf"
+)
+
+// StudyPayload is the data to pass to the template of the study mode
+type StudyPayload struct {
+	CSRF       template.HTML
+	Title      string
+	User       string
+	Category   string
+	Categories []string
+	Study      *models.StudyT
+	QuestionID int64
+	Question   models.QuestionT
+	// Answered shows whether Correct, the question's explanation and its next review
+	Answered bool
+	Correct  bool
+	Answer   string
+	Card     *models.CardRecord
+}
+
+func (a *App) renderStudy(w http.ResponseWriter, r *http.Request, p StudyPayload) {
+	username, err := a.sessionUsername(r)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	categories, err := models.ListCategories(a.store)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	p.CSRF = csrf.TemplateField(r)
+	p.Title = "Study"
+	p.User = username
+	p.Categories = categories
+	a.tmpl.ExecuteTemplate(w, "study.html", p)
+}
+
+func (a *App) studyGetHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	category := strings.TrimSpace(r.URL.Query().Get("category"))
+	st, err := models.GetStudy(a.store, userID, category)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	p := StudyPayload{Category: category, Study: st}
+	if st.Next != nil {
+		p.QuestionID = st.Next.QuestionID
+		p.Question = st.Next.Question
+	}
+	a.renderStudy(w, r, p)
+}
+
+func (a *App) studyPostHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.sessions.Store.Get(r, "session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		servererrors.InternalServerError(w, "userID is not int64")
+		return
+	}
+
+	r.ParseForm()
+	category := r.PostForm.Get("category")
+	next := "/study?" + url.Values{"category": {category}}.Encode()
+	questionID, err := strconv.ParseInt(r.PostForm.Get("question_id"), 10, 64)
+	if err != nil {
+		http.Redirect(w, r, next, http.StatusFound)
+		return
+	}
+
+	correct, card, err := models.ReviewQuestion(a.store, userID, questionID, r.PostForm["choice"]...)
+	if err != nil {
+		if err == models.ErrStaleAnswer || err == models.ErrQuestionNotFound {
+			// already reviewed by another submission or deleted from the bank, show what is due now
+			http.Redirect(w, r, next, http.StatusFound)
+			return
+		}
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	qt, err := a.store.GetQuestion(questionID)
+	if err != nil {
+		servererrors.InternalServerError(w, err.Error())
+		return
+	}
+
+	a.renderStudy(w, r, StudyPayload{
+		Category:   category,
+		QuestionID: questionID,
+		Question:   *qt,
+		Answered:   true,
+		Correct:    correct,
+		Answer:     qt.CorrectAnswer(),
+		Card:       card,
+	})
+}
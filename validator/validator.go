@@ -3,12 +3,44 @@ package validator
 import (
 	"errors"
 	"github.com/asaskevich/govalidator"
+	"net/url"
 	"strings"
+	"time"
 )
 
 var (
 	// ErrInvalidUsernameFormat gives error message when user attempts to join a lobby when is already in lobby
 	ErrInvalidUsernameFormat = errors.New("username is not valid (example valid: 2 < length < 20 and must be A-z 0-9 - _)")
+
+	// ErrInvalidQuestion gives error message when a question cannot be answered as written
+	ErrInvalidQuestion = errors.New("question is not valid (statement and answer must not be empty, choices must be at least 2 distinct and include the answer)")
+
+	// ErrInvalidLink gives error message when a reference link cannot be opened from the page
+	ErrInvalidLink = errors.New("link is not valid (example valid: https://en.wikipedia.org/wiki/Norway)")
+
+	// ErrInvalidDifficulty gives error message when a question's difficulty is out of the scale
+	ErrInvalidDifficulty = errors.New("difficulty is not valid (from 1 easy to 5 hard, 0 is 1)")
+
+	// ErrInvalidScoring gives error message when a scoring rule would take points away for a right answer
+	ErrInvalidScoring = errors.New("scoring is not valid (penalty, streak, bonus and time must not be negative)")
+
+	// ErrInvalidQuiz gives error message when a quiz cannot be taken as written
+	ErrInvalidQuiz = errors.New("quiz is not valid (title must not be empty, it needs at least 1 question and the pass mark is a percentage from 0 to 100)")
+
+	// ErrInvalidLifelines gives error message when a lifeline would be used a negative number of times or give points
+	ErrInvalidLifelines = errors.New("lifelines are not valid (uses and costs must not be negative)")
+
+	// ErrInvalidGameRules gives error message when a lobby's game could not be played by its rules
+	ErrInvalidGameRules = errors.New("game rules are not valid (rounds must not be negative, round time must be positive, ready quorum a percentage from 0 to 100 and countdown must not be negative)")
+
+	// ErrInvalidChatRules gives error message when a lobby's chat could not be kept by its rules
+	ErrInvalidChatRules = errors.New("chat rules are not valid (history and rate must not be negative, max length and the rate's window must be positive)")
+
+	// ErrInvalidPresence gives error message when the lobby websockets could not be kept alive by the presence rules
+	ErrInvalidPresence = errors.New("presence is not valid (heartbeat and reconnect grace must not be negative)")
+
+	// ErrInvalidJanitor gives error message when the idle lobbies could not be swept as asked
+	ErrInvalidJanitor = errors.New("janitor is not valid (lobby ttl must not be negative, the sweep must be positive)")
 )
 
 // Username must contain alphanumerics, dashes, or unserscores and is from 2 to 20 characters long
@@ -27,3 +59,97 @@ func Username(input string) error {
 	}
 	return nil
 }
+
+// Question must have a statement and at least 2 distinct non-empty choices, one of which is the answer
+func Question(statement, answer string, choices []string) error {
+	if strings.TrimSpace(statement) == "" || strings.TrimSpace(answer) == "" || len(choices) < 2 {
+		return ErrInvalidQuestion
+	}
+
+	seen := map[string]bool{}
+	for _, c := range choices {
+		if strings.TrimSpace(c) == "" || seen[c] {
+			return ErrInvalidQuestion
+		}
+		seen[c] = true
+	}
+	if !seen[answer] {
+		return ErrInvalidQuestion
+	}
+	return nil
+}
+
+// Link must be an absolute http or https url
+func Link(input string) error {
+	u, err := url.Parse(input)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidLink
+	}
+	return nil
+}
+
+// Quiz must have a title, at least 1 question and a pass mark from 0 to 100 percent
+func Quiz(title string, questions int, passMark int64) error {
+	if strings.TrimSpace(title) == "" || questions < 1 || passMark < 0 || passMark > 100 {
+		return ErrInvalidQuiz
+	}
+	return nil
+}
+
+// Difficulty must be from 1 to 5, 0 stands for 1
+func Difficulty(n int64) error {
+	if n < 0 || n > 5 {
+		return ErrInvalidDifficulty
+	}
+	return nil
+}
+
+// Scoring rules must not be negative, the penalty is taken off so it is given as a positive number
+func Scoring(penalty, streakEvery, streakMax, timeBonus int64, bonusWithin time.Duration) error {
+	if penalty < 0 || streakEvery < 0 || streakMax < 0 || timeBonus < 0 || bonusWithin < 0 {
+		return ErrInvalidScoring
+	}
+	return nil
+}
+
+// Lifelines must not be negative, a cost is taken off so it is given as a positive number
+func Lifelines(fiftyFifty, fiftyFiftyCost, hint, hintCost int64) error {
+	if fiftyFifty < 0 || fiftyFiftyCost < 0 || hint < 0 || hintCost < 0 {
+		return ErrInvalidLifelines
+	}
+	return nil
+}
+
+// GameRules must give the players time to answer, 0 rounds asks every question but fewer is not a number of rounds,
+// the quorum is a percentage and a countdown of 0 starts at once
+func GameRules(rounds int64, roundTime time.Duration, quorum int64, countdown time.Duration) error {
+	if rounds < 0 || roundTime <= 0 || quorum < 0 || quorum > 100 || countdown < 0 {
+		return ErrInvalidGameRules
+	}
+	return nil
+}
+
+// ChatRules must not be negative, a message must be capped to fit a websocket message and a rate needs a window to
+// count the messages in
+func ChatRules(history int64, maxLength, rate int, per time.Duration) error {
+	if history < 0 || maxLength <= 0 || rate < 0 || rate > 0 && per <= 0 {
+		return ErrInvalidChatRules
+	}
+	return nil
+}
+
+// Janitor must not have a negative ttl, a ttl of 0 keeps the lobbies forever, otherwise they are swept every so often
+func Janitor(ttl, sweep time.Duration) error {
+	if ttl < 0 || ttl > 0 && sweep <= 0 {
+		return ErrInvalidJanitor
+	}
+	return nil
+}
+
+// Presence must not be negative, a heartbeat of 0 keeps the websocket library's default
+func Presence(heartbeat, grace time.Duration) error {
+	if heartbeat < 0 || grace < 0 {
+		return ErrInvalidPresence
+	}
+	return nil
+}
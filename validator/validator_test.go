@@ -1,6 +1,9 @@
 package validator
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func Test_Username(t *testing.T) {
 	given := map[string]error{
@@ -23,3 +26,216 @@ func Test_Username(t *testing.T) {
 		}
 	}
 }
+
+func Test_Question(t *testing.T) {
+	given := []struct {
+		statement, answer string
+		choices           []string
+		expected          error
+	}{
+		{"What is not part of United Kingdom?", "Norway", []string{"Wales", "Norway"}, nil},
+		{"", "Norway", []string{"Wales", "Norway"}, ErrInvalidQuestion},
+		{"What is not part of United Kingdom?", "", []string{"Wales", "Norway"}, ErrInvalidQuestion},
+		{"What is not part of United Kingdom?", "Norway", []string{"Norway"}, ErrInvalidQuestion},
+		{"What is not part of United Kingdom?", "Norway", []string{"Wales", "Scotland"}, ErrInvalidQuestion},
+		{"What is not part of United Kingdom?", "Norway", []string{"Norway", "Norway"}, ErrInvalidQuestion},
+		{"What is not part of United Kingdom?", "Norway", []string{"Wales", " ", "Norway"}, ErrInvalidQuestion},
+	}
+
+	for _, g := range given {
+		result := Question(g.statement, g.answer, g.choices)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}
+
+func Test_Link(t *testing.T) {
+	given := map[string]error{
+		"https://en.wikipedia.org/wiki/Norway": nil,
+		"http://example.com":                   nil,
+		"javascript:alert(1)":                  ErrInvalidLink,
+		"/wiki/Norway":                         ErrInvalidLink,
+		"https://":                             ErrInvalidLink,
+	}
+
+	for k, v := range given {
+		result := Link(k)
+		if result != v {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", k, v, result)
+		}
+	}
+}
+
+func Test_Quiz(t *testing.T) {
+	given := []struct {
+		title     string
+		questions int
+		passMark  int64
+		expected  error
+	}{
+		{"Europe", 3, 60, nil},
+		{"Europe", 1, 0, nil},
+		{" ", 3, 60, ErrInvalidQuiz},
+		{"Europe", 0, 60, ErrInvalidQuiz},
+		{"Europe", 3, 101, ErrInvalidQuiz},
+		{"Europe", 3, -1, ErrInvalidQuiz},
+	}
+
+	for _, g := range given {
+		result := Quiz(g.title, g.questions, g.passMark)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}
+
+func Test_Difficulty(t *testing.T) {
+	given := map[int64]error{
+		0:  nil,
+		1:  nil,
+		5:  nil,
+		6:  ErrInvalidDifficulty,
+		-1: ErrInvalidDifficulty,
+	}
+
+	for k, v := range given {
+		result := Difficulty(k)
+		if result != v {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", k, v, result)
+		}
+	}
+}
+
+func Test_Scoring(t *testing.T) {
+	given := []struct {
+		penalty, streakEvery, streakMax, timeBonus int64
+		bonusWithin                                time.Duration
+		expected                                   error
+	}{
+		{0, 0, 0, 0, 0, nil},
+		{1, 3, 4, 2, 10 * time.Second, nil},
+		{-1, 0, 0, 0, 0, ErrInvalidScoring},
+		{0, -3, 0, 0, 0, ErrInvalidScoring},
+		{0, 3, -1, 0, 0, ErrInvalidScoring},
+		{0, 0, 0, -2, 0, ErrInvalidScoring},
+		{0, 0, 0, 2, -time.Second, ErrInvalidScoring},
+	}
+
+	for _, g := range given {
+		result := Scoring(g.penalty, g.streakEvery, g.streakMax, g.timeBonus, g.bonusWithin)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}
+
+func Test_Lifelines(t *testing.T) {
+	given := []struct {
+		fiftyFifty, fiftyFiftyCost, hint, hintCost int64
+		expected                                   error
+	}{
+		{1, 1, 1, 1, nil},
+		{0, 0, 0, 0, nil},
+		{-1, 1, 1, 1, ErrInvalidLifelines},
+		{1, -2, 1, 1, ErrInvalidLifelines},
+		{1, 1, -1, 1, ErrInvalidLifelines},
+		{1, 1, 1, -1, ErrInvalidLifelines},
+	}
+
+	for _, g := range given {
+		result := Lifelines(g.fiftyFifty, g.fiftyFiftyCost, g.hint, g.hintCost)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}
+
+func Test_GameRules(t *testing.T) {
+	given := []struct {
+		rounds    int64
+		roundTime time.Duration
+		quorum    int64
+		countdown time.Duration
+		expected  error
+	}{
+		{10, 20 * time.Second, 100, 5 * time.Second, nil},
+		{0, time.Second, 0, 0, nil},
+		{-5, 20 * time.Second, 100, 0, ErrInvalidGameRules},
+		{10, 0, 100, 0, ErrInvalidGameRules},
+		{10, -time.Second, 100, 0, ErrInvalidGameRules},
+		{10, time.Second, -1, 0, ErrInvalidGameRules},
+		{10, time.Second, 101, 0, ErrInvalidGameRules},
+		{10, time.Second, 50, -time.Second, ErrInvalidGameRules},
+	}
+
+	for _, g := range given {
+		result := GameRules(g.rounds, g.roundTime, g.quorum, g.countdown)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}
+
+func Test_ChatRules(t *testing.T) {
+	given := []struct {
+		history   int64
+		maxLength int
+		rate      int
+		per       time.Duration
+		expected  error
+	}{
+		{100, 500, 5, 10 * time.Second, nil},
+		{0, 1, 0, 0, nil},
+		{-1, 500, 5, time.Second, ErrInvalidChatRules},
+		{100, 0, 5, time.Second, ErrInvalidChatRules},
+		{100, -1, 5, time.Second, ErrInvalidChatRules},
+		{100, 500, -1, time.Second, ErrInvalidChatRules},
+		{100, 500, 5, 0, ErrInvalidChatRules},
+	}
+
+	for _, g := range given {
+		result := ChatRules(g.history, g.maxLength, g.rate, g.per)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}
+
+func Test_Janitor(t *testing.T) {
+	given := []struct {
+		ttl, sweep time.Duration
+		expected   error
+	}{
+		{time.Hour, time.Minute, nil},
+		{0, 0, nil},
+		{-time.Hour, time.Minute, ErrInvalidJanitor},
+		{time.Hour, 0, ErrInvalidJanitor},
+	}
+
+	for _, g := range given {
+		result := Janitor(g.ttl, g.sweep)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}
+
+func Test_Presence(t *testing.T) {
+	given := []struct {
+		heartbeat, grace time.Duration
+		expected         error
+	}{
+		{30 * time.Second, time.Minute, nil},
+		{0, 0, nil},
+		{-time.Second, time.Minute, ErrInvalidPresence},
+		{time.Second, -time.Minute, ErrInvalidPresence},
+	}
+
+	for _, g := range given {
+		result := Presence(g.heartbeat, g.grace)
+		if result != g.expected {
+			t.Fatalf("error did not occured: given=%v expected=%v result=%v", g, g.expected, result)
+		}
+	}
+}